@@ -0,0 +1,34 @@
+package main
+
+import "flag"
+
+// ciDefaults are the flags set by -ci, unless they are given explicitly.
+// xc already stops at the first task which fails, so there is no flag for that.
+var ciDefaults = []struct{ name, value string }{
+	{name: "no-tty", value: "true"},
+	{name: "log-file", value: "xc-ci.log"},
+	{name: "task-output-strip-ansi", value: "true"},
+	{name: "task-no-pty", value: "true"},
+	{name: "task-log-timestamps", value: "true"},
+	{name: "task-summary-line", value: ciSummaryLine},
+}
+
+// ciSummaryLine is the -task-summary-line set by -ci.
+const ciSummaryLine = "{{.Task}} {{.Status}} in {{.Duration}}"
+
+// applyCIDefaults sets each flag in ciDefaults which has not been set on fs.
+func applyCIDefaults(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for _, d := range ciDefaults {
+		if set[d.name] {
+			continue
+		}
+		if err := fs.Set(d.name, d.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+)
+
+func TestApplyCIDefaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		expect func(config) bool
+	}{
+		{
+			name: "given -ci, should set the defaults",
+			args: []string{"-ci"},
+			expect: func(cfg config) bool {
+				return cfg.noTTY && cfg.logFile == "xc-ci.log" && cfg.stripANSI && cfg.noPTY &&
+					cfg.logTimestamps && cfg.summaryLine == ciSummaryLine
+			},
+		},
+		{
+			name: "given -ci and an explicit -log-file, should keep the explicit value",
+			args: []string{"-ci", "-log-file", "build.log"},
+			expect: func(cfg config) bool {
+				return cfg.logFile == "build.log" && cfg.noTTY
+			},
+		},
+		{
+			name: "given -ci and explicitly disabled flags, should keep them disabled",
+			args: []string{"-task-log-timestamps=false", "-ci", "-task-summary-line="},
+			expect: func(cfg config) bool {
+				return !cfg.logTimestamps && cfg.summaryLine == "" && cfg.stripANSI
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg config
+			fs := flag.NewFlagSet("xc", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			registerFlags(fs, &cfg)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyCIDefaults(fs); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.expect(cfg) {
+				t.Fatalf("unexpected config for %v: %+v", tt.args, cfg)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configFileName is the file, next to the markdown file, which sets defaults
+// for every run of xc in a repository.
+const configFileName = "xc.toml"
+
+// fileConfig are the settings read from xc.toml.
+// Each is used unless its flag is given explicitly.
+type fileConfig struct {
+	defaultTimeout time.Duration
+}
+
+// applyConfigFile sets the values of cfg from xc.toml in dir, if it exists,
+// for each setting whose flag has not been set on fs.
+func applyConfigFile(cfg *config, fs *flag.FlagSet, dir string) error {
+	f, err := os.Open(filepath.Join(dir, configFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("xc: failed to read %s: %w", configFileName, err)
+	}
+	defer f.Close()
+	fc, keys, err := parseConfigFile(f)
+	if err != nil {
+		return fmt.Errorf("xc: invalid %s: %w", configFileName, err)
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	if keys["default-timeout"] && !set["task-default-timeout"] {
+		cfg.defaultTimeout = fc.defaultTimeout
+	}
+	return nil
+}
+
+// parseConfigFile parses the subset of TOML used by xc.toml: comments, and
+// key = value lines whose value is a string, quoted or not.
+// It also returns which keys were set.
+func parseConfigFile(r io.Reader) (fileConfig, map[string]bool, error) {
+	var fc fileConfig
+	keys := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return fc, nil, fmt.Errorf("line %d: expected key = value", line)
+		}
+		key = strings.TrimSpace(key)
+		value, err := configValue(strings.TrimSpace(value))
+		if err != nil {
+			return fc, nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if keys[key] {
+			return fc, nil, fmt.Errorf("line %d: %s is set more than once", line, key)
+		}
+		switch key {
+		case "default-timeout":
+			if value != "none" {
+				if fc.defaultTimeout, err = time.ParseDuration(value); err != nil {
+					return fc, nil, fmt.Errorf("line %d: invalid default-timeout: %w", line, err)
+				}
+			}
+		default:
+			return fc, nil, fmt.Errorf("line %d: unknown key %q", line, key)
+		}
+		keys[key] = true
+	}
+	return fc, keys, scanner.Err()
+}
+
+// configValue unquotes a TOML string, and strips a trailing comment.
+func configValue(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, `"`):
+		end := strings.LastIndex(v, `"`)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", v)
+		}
+		return strconv.Unquote(v[:end+1])
+	case strings.HasPrefix(v, "'"):
+		end := strings.LastIndex(v, "'")
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", v)
+		}
+		return v[1:end], nil
+	}
+	v, _, _ = strings.Cut(v, "#")
+	return strings.TrimSpace(v), nil
+}
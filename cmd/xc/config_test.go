@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfigFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		expected  time.Duration
+		expectErr bool
+	}{
+		{
+			name:     "given a quoted default-timeout, should parse it",
+			in:       "# defaults\ndefault-timeout = \"30m\"\n",
+			expected: 30 * time.Minute,
+		},
+		{
+			name:     "given a literal string and a comment, should parse it",
+			in:       "default-timeout = '1h' # an hour\n",
+			expected: time.Hour,
+		},
+		{
+			name: "given none, should set no default",
+			in:   "default-timeout = \"none\"\n",
+		},
+		{
+			name:      "given an invalid duration, should error",
+			in:        "default-timeout = \"soon\"\n",
+			expectErr: true,
+		},
+		{
+			name:      "given an unknown key, should error",
+			in:        "timeout = \"1m\"\n",
+			expectErr: true,
+		},
+		{
+			name:      "given a line without =, should error",
+			in:        "[defaults]\n",
+			expectErr: true,
+		},
+		{
+			name:      "given an unterminated string, should error",
+			in:        "default-timeout = \"1m\n",
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			fc, _, err := parseConfigFile(strings.NewReader(tt.in))
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("err=%v, want error=%v", err, tt.expectErr)
+			}
+			if fc.defaultTimeout != tt.expected {
+				t.Fatalf("got %v, want %v", fc.defaultTimeout, tt.expected)
+			}
+		})
+	}
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, configFileName), []byte("default-timeout = \"30m\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		dir      string
+		args     []string
+		expected time.Duration
+	}{
+		{name: "given xc.toml, should use its default-timeout", dir: dir, expected: 30 * time.Minute},
+		{name: "given -task-default-timeout, should take precedence", dir: dir, args: []string{"-task-default-timeout", "1m"}, expected: time.Minute},
+		{name: "given -task-default-timeout 0, should take precedence", dir: dir, args: []string{"-task-default-timeout", "0"}},
+		{name: "given no xc.toml, should use the flag default", dir: t.TempDir()},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg config
+			fs := flag.NewFlagSet("xc", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			registerFlags(fs, &cfg)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyConfigFile(&cfg, fs, tt.dir); err != nil {
+				t.Fatal(err)
+			}
+			if cfg.defaultTimeout != tt.expected {
+				t.Fatalf("got %v, want %v", cfg.defaultTimeout, tt.expected)
+			}
+		})
+	}
+}
@@ -106,10 +106,12 @@ func (m model) View() string {
 	return "\n" + m.list.View()
 }
 
-func interactivePicker(ctx context.Context, tasks []models.Task, dir string) error {
+func interactivePicker(ctx context.Context, tasks []models.Task, dir string, opts []run.RunnerOption) error {
 	var items []list.Item
 	for _, t := range tasks {
-		items = append(items, taskItem{t})
+		if !t.IsHidden() {
+			items = append(items, taskItem{t})
+		}
 	}
 	l := list.New(items, itemDelegate{}, listItemWidth, listItemHeight+len(tasks))
 	l.Title = "xc: Choose a task"
@@ -129,7 +131,7 @@ func interactivePicker(ctx context.Context, tasks []models.Task, dir string) err
 	if task == nil {
 		return nil
 	}
-	runner, err := run.NewRunner(tasks, dir)
+	runner, err := run.NewRunner(tasks, dir, opts...)
 	if err != nil {
 		return fmt.Errorf("xc parse error: %w", err)
 	}
@@ -13,10 +13,15 @@ import (
 	"path/filepath"
 	"runtime/debug"
 	"strings"
+	"syscall"
+	"time"
 
+	completionscript "github.com/joerdav/xc/completion"
+	"github.com/joerdav/xc/format"
 	"github.com/joerdav/xc/models"
 	"github.com/joerdav/xc/parser"
 	"github.com/joerdav/xc/run"
+	"github.com/joerdav/xc/state"
 	"github.com/posener/complete/v2"
 	"github.com/posener/complete/v2/install"
 	"github.com/posener/complete/v2/predict"
@@ -30,14 +35,45 @@ var ErrNoMarkdownFile = errors.New("no xc compatible markdown file found")
 
 type config struct {
 	version, help, short, display, noTTY, complete, uncomplete bool
-	filename, heading                                          string
+	killGroup, colorErrorLines, stripANSI, requireDocker       bool
+	gc, gcOnSuccess, dryRun, jsonLog, test, ci, preserveMtime  bool
+	validate, cleanupEnvFiles                                  bool
+	envLog, noMaskSecrets, dirSnapshot, runInOrder, logDir     bool
+	rewriteEnvRefs, noPTY, showScript, tmpfs, noSyncBack       bool
+	logTimestamps, logRelativeTime, inheritSignals, noNewlines bool
+	interpolateScripts, logScript, allowEmpty, createDir       bool
+	abortOnStderr, force, watch, noDedup                       bool
+	persistEnv, clearEnvOnError, noInheritCwd                  bool
+	filename, heading, logFile, cleanupScript, hostname        string
+	envJSON, scriptDiffRef, retryBackoff, envOverrideFile      string
+	stdinEnv, stdinJSON, timestampFormat, summaryLine          string
+	outputFilter, validateFormat                               string
+	defaultInputs, completionScript, dryRunOutput              string
+	beforeEach, afterEach, dynamicEnv, stdinLog, scriptMode    string
+	errorPatterns, envWhitelist, envBlacklist, inputFiles      stringList
+	outputAssertions, maskPatterns, requiredOutputs            stringList
+	requiredFiles, assertNoOutput, persistOutputs              stringList
+	grepPatterns, highlights, envTypes, envFiles               stringList
+	tagLimits, inputMasks, exitCodes, globInputs               stringList
+	stdoutFiles, stderrFiles, truncatePatterns, computedEnv    stringList
+	outputLimit                                                byteSize
+	maxOpenFiles                                               uint64
+	outputTail, outputHead, maxLineLength, maxRestarts         int
+	stdinEOFTimeout, memProfileInterval, defaultTimeout        time.Duration
+	// signals receives the signals forwarded to tasks by -task-inherit-signals.
+	signals chan os.Signal
 }
 
+// inheritedSignals are forwarded to tasks by -task-inherit-signals.
+var inheritedSignals = []os.Signal{syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP}
+
 var version = ""
 
 func main() {
 	if err := runMain(); err != nil {
-		fmt.Println(err.Error())
+		if !errors.Is(err, errValidationFailed) {
+			fmt.Println(err.Error())
+		}
 		os.Exit(1)
 	}
 }
@@ -50,52 +86,172 @@ func flags() config {
 	flag.Usage = func() {
 		fmt.Print(usage)
 	}
-	flag.BoolVar(&cfg.version, "version", false, "show xc version")
-	flag.BoolVar(&cfg.version, "V", false, "show xc version")
+	registerFlags(flag.CommandLine, &cfg)
+	flag.Parse()
+	if cfg.ci {
+		if err := applyCIDefaults(flag.CommandLine); err != nil {
+			log.Fatalf("xc: failed to apply -ci defaults: %v", err)
+		}
+	}
+	return cfg
+}
 
-	flag.BoolVar(&cfg.help, "help", false, "show xc usage")
-	flag.BoolVar(&cfg.help, "h", false, "show xc usage")
+// registerFlags defines the flags of xc on fs, which are parsed into cfg.
+func registerFlags(fs *flag.FlagSet, cfg *config) {
+	fs.BoolVar(&cfg.version, "version", false, "show xc version")
+	fs.BoolVar(&cfg.version, "V", false, "show xc version")
 
-	flag.StringVar(&cfg.heading, "heading", "Tasks", "specify the heading for xc tasks")
-	flag.StringVar(&cfg.heading, "H", "Tasks", "specify the heading for xc tasks")
+	fs.BoolVar(&cfg.help, "help", false, "show xc usage")
+	fs.BoolVar(&cfg.help, "h", false, "show xc usage")
 
-	flag.StringVar(&cfg.filename, "file", "", "specify a markdown file that contains tasks")
-	flag.StringVar(&cfg.filename, "f", "", "specify a markdown file that contains tasks")
+	fs.StringVar(&cfg.heading, "heading", "Tasks", "specify the heading for xc tasks")
+	fs.StringVar(&cfg.heading, "H", "Tasks", "specify the heading for xc tasks")
 
-	flag.BoolVar(&cfg.short, "short", false, "list task names in a short format")
-	flag.BoolVar(&cfg.short, "s", false, "list task names in a short format")
+	fs.StringVar(&cfg.filename, "file", "", "specify a markdown file that contains tasks")
+	fs.StringVar(&cfg.filename, "f", "", "specify a markdown file that contains tasks")
 
-	flag.BoolVar(&cfg.display, "d", false, "print the markdown code of a task rather than running it")
-	flag.BoolVar(&cfg.display, "display", false, "print the markdown code of a task rather than running it")
+	fs.BoolVar(&cfg.short, "short", false, "list task names in a short format")
+	fs.BoolVar(&cfg.short, "s", false, "list task names in a short format")
 
-	flag.BoolVar(&cfg.complete, "complete", false, "install shell completion for xc")
-	flag.BoolVar(&cfg.uncomplete, "uncomplete", false, "uninstall shell completion for xc")
+	fs.BoolVar(&cfg.display, "d", false, "print the markdown code of a task rather than running it")
+	fs.BoolVar(&cfg.display, "display", false, "print the markdown code of a task rather than running it")
 
-	flag.BoolVar(&cfg.noTTY, "no-tty", false, "disable interactive picker")
+	fs.BoolVar(&cfg.complete, "complete", false, "install shell completion for xc")
+	fs.BoolVar(&cfg.uncomplete, "uncomplete", false, "uninstall shell completion for xc")
+	fs.StringVar(&cfg.completionScript, "completion", "", "print a completion script of the task names for a shell: bash, zsh or fish")
 
-	flag.Parse()
-	return cfg
+	fs.BoolVar(&cfg.test, "test", false, "run test tasks and report which pass or fail")
+	fs.BoolVar(&cfg.validate, "validate", false, "check the tasks for problems without running them")
+	fs.StringVar(&cfg.validateFormat, "validate-format", "text", "output format of -validate: text or json")
+	fs.BoolVar(&cfg.watch, "watch", false, "run a task again whenever files matching its watch attribute change")
+	fs.IntVar(&cfg.maxRestarts, "task-max-restarts", 0, "with -watch, exit with an error once a task without max-restarts has run again <n> times")
+
+	fs.BoolVar(&cfg.gc, "gc", false, "remove state left behind by deleted tasks and crashed runs")
+	fs.BoolVar(&cfg.gcOnSuccess, "gc-on-success", false, "run -gc after a task succeeds")
+	fs.BoolVar(&cfg.force, "force", false, "allow hidden tasks, whose names start with _, to be run directly")
+	fs.BoolVar(&cfg.dryRun, "dry-run", false, "print what -gc would remove, or which tasks would run, without doing it")
+	fs.StringVar(&cfg.dryRunOutput, "task-dry-run-output", "", "with -dry-run, write the tasks which would run to a file as a JSON object")
+
+	fs.BoolVar(&cfg.noTTY, "no-tty", false, "disable interactive picker")
+
+	fs.BoolVar(&cfg.killGroup, "task-kill-group", false, "kill the process group of a task when it fails or is cancelled")
+
+	fs.BoolVar(&cfg.colorErrorLines, "color-error-lines", false, "highlight lines of task output which look like errors")
+	fs.Var(&cfg.errorPatterns, "error-pattern", "regular expression matching error lines, can be repeated")
+
+	fs.StringVar(&cfg.logFile, "log-file", "", "write the full output of every task to a file")
+	fs.BoolVar(&cfg.stripANSI, "task-output-strip-ansi", false, "remove ANSI escape codes from output written to -log-file")
+	fs.BoolVar(&cfg.jsonLog, "task-output-json-log", false, "write each line of task output to stdout as a JSON object")
+	fs.Var(&cfg.requiredOutputs, "task-require-outputs", "fail a task unless it creates a file, as <task>:<file>[,<task>:<file>]")
+	fs.Var(&cfg.requiredFiles, "task-require-files", "fail a task before it runs unless files matching a glob exist, can be repeated")
+	fs.Var(&cfg.persistOutputs, "task-persist-outputs", "save the outputs of a task to .xc/artifacts/<task> when it succeeds, can be repeated")
+	fs.Var(&cfg.highlights, "task-output-highlight", "colour lines of task output matching <regex>=<colour>, can be repeated")
+	fs.Var(&cfg.truncatePatterns, "task-output-truncate-pattern", "hide sections of task output, as <start-regex>,<end-regex>, can be repeated")
+	fs.Var(&cfg.grepPatterns, "task-output-grep", "only show lines of task output matching the regular expression, can be repeated")
+	fs.Var(&cfg.maskPatterns, "task-mask-output", "regular expression redacted from task output, can be repeated")
+	fs.Var(&cfg.inputMasks, "task-input-mask", "input whose value is redacted from task output, can be repeated")
+	fs.Var(&cfg.globInputs, "task-expand-glob-inputs", "input whose value is expanded as glob patterns, can be repeated")
+	fs.Var(&cfg.outputLimit, "task-output-limit", "show only the last <bytes> of output from each task, e.g. 10M")
+	fs.IntVar(&cfg.outputTail, "task-output-tail", -1, "show only the last <n> lines of output from each task")
+	fs.IntVar(&cfg.outputHead, "task-output-head", -1, "show only the first <n> lines of output from each task")
+	fs.StringVar(&cfg.outputFilter, "task-output-filter-command", "", "shell command which the output of each task is piped through")
+	fs.IntVar(&cfg.maxLineLength, "task-output-max-line-length", 0, "truncate lines of output from each task longer than <n> bytes")
+
+	fs.Var(&cfg.envWhitelist, "task-env-whitelist", "glob of environment variables passed to tasks, can be repeated")
+	fs.Var(&cfg.envBlacklist, "task-env-blacklist", "glob of environment variables hidden from tasks, can be repeated")
+
+	fs.Var(&cfg.inputFiles, "task-input-file", "read inputs for a task from a file of KEY=VALUE lines, as <task>:<file>")
+	fs.StringVar(&cfg.defaultInputs, "task-default-inputs", "", "read defaults for the inputs of every task from a file of KEY=VALUE lines")
+
+	fs.StringVar(&cfg.cleanupScript, "task-sigterm-script", "", "script run when a task is cancelled")
+	fs.StringVar(&cfg.dynamicEnv, "task-env-expand-from-script", "", "script run before each task whose KEY=VALUE output is added to its environment")
+	fs.Var(&cfg.computedEnv, "task-env-from-process-substitution", "set a variable to the output of a command before each task, as <VAR>=<cmd>, can be repeated")
+	fs.StringVar(&cfg.beforeEach, "task-before-each", "", "script run before every task")
+	fs.StringVar(&cfg.afterEach, "task-after-each", "", "script run after every task, even if it failed")
+
+	fs.Uint64Var(&cfg.maxOpenFiles, "task-limit-open-files", 0, "limit the number of files each task can open")
+
+	fs.StringVar(&cfg.hostname, "task-hostname", "", "set the hostname seen by tasks, linux only")
+
+	fs.BoolVar(&cfg.preserveMtime, "task-preserve-mtime", false, "restore modification times of files tasks touch without changing")
+
+	fs.BoolVar(&cfg.createDir, "task-dir-create", false, "create the directory of each task if it does not exist")
+
+	fs.BoolVar(&cfg.noNewlines, "task-env-validate-no-newlines", false, "fail tasks if any environment variable contains a newline")
+	fs.Var(&cfg.envTypes, "task-env-require-typed", "require an environment variable of every task to have a type, as NAME=type, can be repeated")
+	fs.BoolVar(&cfg.cleanupEnvFiles, "task-cleanup-env-file", false, "delete the env-files of each task once it has run")
+	fs.Var(&cfg.envFiles, "task-combine-env-files", "comma separated env files loaded into the environment of every task, later files take precedence")
+	fs.BoolVar(&cfg.noInheritCwd, "task-no-inherit-cwd", false, "set PWD to the directory each task runs in, rather than where xc was run")
+	fs.BoolVar(&cfg.persistEnv, "task-persist-env", false, "set the variables exported by each task for the tasks which run after it")
+	fs.BoolVar(&cfg.clearEnvOnError, "task-env-clear-on-error", false, "with -task-persist-env, drop the variables exported by tasks which fail")
+	fs.StringVar(&cfg.envOverrideFile, "task-env-override-file", "", "KEY=VALUE file which overrides the environment of every task")
+	fs.StringVar(&cfg.envJSON, "task-env-json", "", "JSON file of environment variables for each task")
+	fs.StringVar(&cfg.summaryLine, "task-summary-line", "", "Go template of a line printed once each task has finished")
+	fs.StringVar(&cfg.scriptDiffRef, "task-script-diff", "", "show how the script of each task changed since a git ref")
+	fs.StringVar(&cfg.retryBackoff, "task-max-retries-backoff", "constant", "how the wait between retries grows: constant, linear or exponential")
+	fs.StringVar(&cfg.scriptMode, "task-script-mode", "", "how scripts are passed to interpreters other than the built-in shell: file, stdin or heredoc")
+	fs.BoolVar(&cfg.showScript, "task-show-script", false, "print the script of each task before running it")
+	fs.BoolVar(&cfg.tmpfs, "task-working-dir-tmpfs", false, "run tasks in a memory-backed copy of their directory")
+	fs.BoolVar(&cfg.noSyncBack, "no-sync-back", false, "discard the changes tasks make in a tmpfs directory")
+	fs.BoolVar(&cfg.logTimestamps, "task-log-timestamps", false, "prepend a timestamp to every line of task output")
+	fs.BoolVar(&cfg.logRelativeTime, "log-relative-time", false, "use the time since xc started for -task-log-timestamps")
+	fs.StringVar(&cfg.timestampFormat, "task-output-timestamp-format", time.RFC3339, "format of -task-log-timestamps: RFC3339, RFC3339Nano, UnixMs or a go time layout")
+	fs.StringVar(&cfg.timestampFormat, "log-timestamp-format", time.RFC3339, "format of -task-log-timestamps: RFC3339, RFC3339Nano, UnixMs or a go time layout")
+	fs.BoolVar(&cfg.inheritSignals, "task-inherit-signals", false, "forward SIGTERM, SIGINT and SIGHUP to running tasks")
+	fs.BoolVar(&cfg.interpolateScripts, "task-script-interpolate-from-env", false, "expand $VAR in scripts from the task environment before running them")
+	fs.BoolVar(&cfg.allowEmpty, "task-allow-empty", false, "allow tasks with no script and no required tasks")
+	fs.BoolVar(&cfg.noPTY, "task-no-pty", false, "run interactive tasks without giving them the terminal")
+	fs.BoolVar(&cfg.rewriteEnvRefs, "task-rewrite-env-refs", false, "expand variable references in env attributes before running tasks")
+	fs.BoolVar(&cfg.logScript, "task-log-script", false, "write the script of each task to -log-file before its output")
+	fs.BoolVar(&cfg.envLog, "task-env-log", false, "log the environment of each task before it runs")
+	fs.BoolVar(&cfg.logDir, "task-log-working-dir", false, "log the directory each task runs in before it runs")
+	fs.BoolVar(&cfg.noMaskSecrets, "no-mask-secrets", false, "show values of secrets in -task-env-log")
+
+	fs.BoolVar(&cfg.dirSnapshot, "task-dir-snapshot", false, "report files changed by each task")
+
+	fs.BoolVar(&cfg.abortOnStderr, "task-abort-on-stderr", false, "fail tasks as soon as they write to stderr")
+	fs.Var(&cfg.assertNoOutput, "task-assert-no-output", "fail a task if it writes to stdout or stderr, can be repeated")
+	fs.Var(&cfg.exitCodes, "task-exit-code-map", "treat an exit code of every task as a warning or cancelled, as <code>=<meaning>, can be repeated")
+	fs.Var(&cfg.tagLimits, "task-parallel-limit-by-tag", "allow at most <n> tasks with a tag to run at once, as <tag>=<n>, can be repeated")
+	fs.BoolVar(&cfg.runInOrder, "task-run-in-order", false, "run dependencies one at a time, ignoring runDeps: async")
+	fs.BoolVar(&cfg.noDedup, "no-dedup", false, "run a task every time it is required, rather than once")
+
+	fs.Var(&cfg.outputAssertions, "task-assert-output", "fail a task unless a line of its output matches, as <task>=<regex>")
+	fs.Var(&cfg.stdoutFiles, "task-stdout-file", "write the stdout of a task to a file, as <task>=<path>, can be repeated")
+	fs.Var(&cfg.stderrFiles, "task-stderr-file", "write the stderr of a task to a file, as <task>=<path>, can be repeated")
+
+	fs.BoolVar(&cfg.requireDocker, "require-docker", false, "fail early if the Docker daemon is not accessible")
+
+	fs.StringVar(&cfg.stdinEnv, "task-stdin-from-env", "", "environment variable whose value is the stdin of each task")
+	fs.StringVar(&cfg.stdinJSON, "task-stdin-json", "", "JSON passed verbatim as the stdin of each task")
+	fs.DurationVar(&cfg.defaultTimeout, "task-default-timeout", 0, "stop tasks without a timeout attribute after a duration")
+	fs.StringVar(&cfg.stdinLog, "task-stdin-tee", "", "file which the stdin of each task is copied to")
+	fs.DurationVar(&cfg.stdinEOFTimeout, "task-stdin-eof-timeout", 0, "close the stdin of a task after it is idle for a duration")
+
+	fs.DurationVar(&cfg.memProfileInterval, "task-profile-mem-interval", 0, "sample the memory used by each task every duration")
+
+	fs.BoolVar(&cfg.ci, "ci", false, "use defaults suited to running in CI")
 }
 
-func parse(filename, heading string) (models.Tasks, string, error) {
+func parse(filename, heading string, allowEmpty bool) (models.Tasks, string, error) {
 	if filename != "" {
-		return tryParse(filename, heading)
+		return tryParse(filename, heading, allowEmpty)
 	}
 	curr, err := filepath.Abs(filepath.Dir("."))
 	if err != nil {
 		return nil, "", fmt.Errorf("error getting current directory: %w", err)
 	}
-	return searchUpForFile(curr, heading)
+	return searchUpForFile(curr, heading, allowEmpty)
 }
 
-func searchUpForFile(curr, heading string) (models.Tasks, string, error) {
+func searchUpForFile(curr, heading string, allowEmpty bool) (models.Tasks, string, error) {
 	rm := filepath.Join(curr, "README.md")
-	tasks, directory, err := tryParse(rm, heading)
+	tasks, directory, err := tryParse(rm, heading, allowEmpty)
 	if err == nil {
 		return tasks, directory, nil
 	}
 	if err != nil && !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, parser.ErrNoTasksHeading) {
-		return nil, "", err
+		return tasks, directory, err
 	}
 	git := filepath.Join(curr, ".git")
 	_, err = os.Stat(git)
@@ -106,83 +262,100 @@ func searchUpForFile(curr, heading string) (models.Tasks, string, error) {
 	if strings.HasSuffix(next, string([]rune{filepath.Separator})) {
 		return nil, "", ErrNoMarkdownFile
 	}
-	return searchUpForFile(next, heading)
+	return searchUpForFile(next, heading, allowEmpty)
 }
 
-func tryParse(path, heading string) (models.Tasks, string, error) {
+func tryParse(path, heading string, allowEmpty bool) (models.Tasks, string, error) {
 	directory := filepath.Dir(path)
-	b, err := os.Open(path)
-	if err != nil {
+	if _, err := os.Stat(path); err != nil {
 		return nil, "", fmt.Errorf("xc error opening file: %w", err)
 	}
-	p, err := parser.NewParser(b, heading)
-	if err != nil {
-		return nil, "", fmt.Errorf("xc parse error: %w", err)
+	tasks, err := parser.ParseWithIncludes(path, heading,
+		parser.WithAllowEmpty(allowEmpty),
+		parser.WithWarnings(func(w string) {
+			fmt.Fprintln(os.Stderr, "xc: warning:", w)
+		}),
+	)
+	if errors.Is(err, parser.ErrCircularDependency) {
+		// the tasks are complete, so can still be validated
+		return tasks, directory, fmt.Errorf("xc parse error: %w", err)
 	}
-	tasks, err := p.Parse()
 	if err != nil {
 		return nil, "", fmt.Errorf("xc parse error: %w", err)
 	}
 	return tasks, directory, nil
 }
 
-func printTasks(tasks models.Tasks, short bool) {
-	print := printTask
-	if short {
-		print = func(t models.Task, maxLen int) { fmt.Println(t.Name) }
+func printTasks(tasks models.Tasks, short bool) error {
+	if !short {
+		return format.Format(tasks, os.Stdout, "table")
 	}
-	maxLen := 0
-	for _, n := range tasks {
-		if len(n.Name) > maxLen {
-			maxLen = len(n.Name)
+	for _, t := range tasks {
+		if !t.IsHidden() {
+			fmt.Println(t.Name)
 		}
 	}
-	for _, n := range tasks {
-		print(n, maxLen)
-	}
+	return nil
 }
 
 func displayAndRunTasks(ctx context.Context, tasks models.Tasks, dir string, cfg config) error {
 	if cfg.noTTY || cfg.short {
-		printTasks(tasks, cfg.short)
-		return nil
+		return printTasks(tasks, cfg.short)
 	}
-	return interactivePicker(ctx, tasks, dir)
+	opts, closeOpts, err := runnerOptions(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeOpts()
+	return interactivePicker(ctx, tasks, dir, opts)
 }
 
-func printTask(task models.Task, maxLen int) {
-	padLen := maxLen - len(task.Name)
-	pad := strings.Repeat(" ", padLen)
-	desc := task.Description
-	if len(task.DependsOn) > 0 {
-		desc = append(desc, fmt.Sprintf("Requires:  %s", strings.Join(task.DependsOn, ", ")))
-	}
-	if len(desc) == 0 {
-		desc = strings.Split(task.Script, "\n")
-	}
-	fmt.Printf("    %s%s  %s\n", task.Name, pad, desc[0])
-	for _, d := range desc[1:] {
-		fmt.Printf("    %s  %s\n", strings.Repeat(" ", maxLen), d)
+// relaySignals forwards each signal received on in to out, for
+// -task-inherit-signals. A second SIGINT also calls cancel, so that control+c
+// can still stop xc if a task ignores the first.
+func relaySignals(in <-chan os.Signal, out chan<- os.Signal, cancel func()) {
+	interrupted := false
+	for sig := range in {
+		if sig == os.Interrupt {
+			if interrupted {
+				cancel()
+			}
+			interrupted = true
+		}
+		select {
+		case out <- sig:
+		default:
+			// tasks have not taken the last signal yet
+		}
 	}
 }
 
 func runMain() error {
 	ctx, cancel := context.WithCancel(context.Background())
-	// handle SIGINT (control+c)
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt)
-		<-c
-		cancel()
-	}()
+	defer cancel()
 	cfg := flags()
+	if cfg.inheritSignals {
+		// forward signals to tasks, which decide how to stop themselves
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, inheritedSignals...)
+		cfg.signals = make(chan os.Signal, len(inheritedSignals))
+		go relaySignals(c, cfg.signals, cancel)
+	} else {
+		// handle SIGINT (control+c)
+		go func() {
+			c := make(chan os.Signal, 1)
+			signal.Notify(c, os.Interrupt)
+			<-c
+			cancel()
+		}()
+	}
 	if cfg.uncomplete {
 		return install.Uninstall("xc")
 	}
 	if cfg.complete {
 		return install.Install("xc")
 	}
-	tasks, dir, err := parse(cfg.filename, cfg.heading)
+	tasks, dir, err := parse(cfg.filename, cfg.heading, cfg.allowEmpty)
 	completion(tasks).Complete("xc")
 	// xc -version
 	if cfg.version {
@@ -194,9 +367,44 @@ func runMain() error {
 		flag.Usage()
 		return nil
 	}
+	// xc -completion bash
+	if cfg.completionScript != "" {
+		if err != nil {
+			return err
+		}
+		return completionscript.Generate(cfg.completionScript, tasks, os.Stdout)
+	}
+	// xc -validate
+	if cfg.validate {
+		return validate(os.Stdout, tasks, dir, err, cfg.validateFormat)
+	}
 	if err != nil {
 		return err
 	}
+	if err := applyConfigFile(&cfg, flag.CommandLine, dir); err != nil {
+		return err
+	}
+	// xc -test
+	if cfg.test {
+		opts, closeOpts, err := runnerOptions(cfg)
+		if err != nil {
+			return err
+		}
+		defer closeOpts()
+		return run.Test(ctx, tasks, dir, os.Stdout, opts...)
+	}
+	// xc -task-script-diff ref
+	if cfg.scriptDiffRef != "" {
+		path := cfg.filename
+		if path == "" {
+			path = filepath.Join(dir, "README.md")
+		}
+		return scriptDiff(ctx, os.Stdout, path, cfg.heading, cfg.scriptDiffRef, tasks)
+	}
+	// xc -gc
+	if cfg.gc {
+		return state.GC(dir, tasks, cfg.dryRun, os.Stdout)
+	}
 	tav := flag.Args()
 	// xc
 	if len(tav) == 0 {
@@ -212,14 +420,29 @@ func runMain() error {
 		return nil
 	}
 	// xc task1
-	runner, err := run.NewRunner(tasks, dir)
+	opts, closeOpts, err := runnerOptions(cfg)
+	if err != nil {
+		return err
+	}
+	defer closeOpts()
+	runner, err := run.NewRunner(tasks, dir, opts...)
 	if err != nil {
 		return fmt.Errorf("xc parse error: %w", err)
 	}
+	// xc -watch task1
+	if cfg.watch {
+		if err := runner.Watch(ctx, tav[0], tav[1:]); err != nil {
+			return fmt.Errorf("xc: %w", err)
+		}
+		return nil
+	}
 	err = runner.Run(ctx, tav[0], tav[1:])
 	if err != nil {
 		return fmt.Errorf("xc: %w", err)
 	}
+	if cfg.gcOnSuccess {
+		return state.GC(dir, tasks, cfg.dryRun, os.Stdout)
+	}
 	return nil
 }
 
@@ -244,18 +467,112 @@ func getVersion() string {
 func completion(tasks models.Tasks) *complete.Command {
 	return &complete.Command{
 		Flags: map[string]complete.Predictor{
-			"version": predict.Nothing,
-			"V":       predict.Nothing,
-			"h":       predict.Nothing,
-			"help":    predict.Nothing,
-			"f":       predict.Files("*.md"),
-			"file":    predict.Files("*.md"),
-			"s":       predict.Nothing,
-			"short":   predict.Nothing,
-			"d":       predict.Nothing,
-			"display": predict.Nothing,
-			"H":       predict.Nothing,
-			"heading": predict.Nothing,
+			"version":                            predict.Nothing,
+			"V":                                  predict.Nothing,
+			"h":                                  predict.Nothing,
+			"help":                               predict.Nothing,
+			"f":                                  predict.Files("*.md"),
+			"file":                               predict.Files("*.md"),
+			"s":                                  predict.Nothing,
+			"short":                              predict.Nothing,
+			"d":                                  predict.Nothing,
+			"display":                            predict.Nothing,
+			"H":                                  predict.Something,
+			"heading":                            predict.Something,
+			"task-kill-group":                    predict.Nothing,
+			"color-error-lines":                  predict.Nothing,
+			"error-pattern":                      predict.Something,
+			"test":                               predict.Nothing,
+			"validate":                           predict.Nothing,
+			"completion":                         predict.Set{"bash", "zsh", "fish"},
+			"validate-format":                    predict.Set{"text", "json"},
+			"task-limit-open-files":              predict.Something,
+			"task-hostname":                      predict.Something,
+			"ci":                                 predict.Nothing,
+			"task-preserve-mtime":                predict.Nothing,
+			"task-dir-create":                    predict.Nothing,
+			"task-summary-line":                  predict.Something,
+			"task-output-grep":                   predict.Something,
+			"task-output-truncate-pattern":       predict.Something,
+			"task-output-highlight":              predict.Something,
+			"task-env-require-typed":             predict.Something,
+			"task-env-validate-no-newlines":      predict.Nothing,
+			"task-combine-env-files":             predict.Files("*"),
+			"task-cleanup-env-file":              predict.Nothing,
+			"task-stdin-json":                    predict.Something,
+			"task-parallel-limit-by-tag":         predict.Something,
+			"task-abort-on-stderr":               predict.Nothing,
+			"task-assert-no-output":              predict.Something,
+			"task-env-expand-from-script":        predict.Something,
+			"task-env-from-process-substitution": predict.Something,
+			"task-input-mask":                    predict.Something,
+			"task-exit-code-map":                 predict.Something,
+			"force":                              predict.Nothing,
+			"watch":                              predict.Nothing,
+			"task-stdin-tee":                     predict.Files("*"),
+			"task-output-tail":                   predict.Something,
+			"task-output-head":                   predict.Something,
+			"task-output-max-line-length":        predict.Something,
+			"task-output-filter-command":         predict.Something,
+			"task-log-working-dir":               predict.Nothing,
+			"task-env-log":                       predict.Nothing,
+			"no-mask-secrets":                    predict.Nothing,
+			"task-dir-snapshot":                  predict.Nothing,
+			"task-run-in-order":                  predict.Nothing,
+			"no-dedup":                           predict.Nothing,
+			"task-assert-output":                 predict.Something,
+			"task-stdout-file":                   predict.Something,
+			"task-stderr-file":                   predict.Something,
+			"task-mask-output":                   predict.Something,
+			"task-before-each":                   predict.Something,
+			"task-after-each":                    predict.Something,
+			"task-rewrite-env-refs":              predict.Nothing,
+			"task-env-json":                      predict.Files("*.json"),
+			"task-no-pty":                        predict.Nothing,
+			"task-show-script":                   predict.Nothing,
+			"task-script-diff":                   predict.Something,
+			"task-max-retries-backoff":           predict.Set{"constant", "linear", "exponential"},
+			"task-script-mode":                   predict.Set{"file", "stdin", "heredoc"},
+			"task-env-override-file":             predict.Files("*"),
+			"task-stdin-from-env":                predict.Something,
+			"task-working-dir-tmpfs":             predict.Nothing,
+			"no-sync-back":                       predict.Nothing,
+			"task-default-timeout":               predict.Something,
+			"task-log-timestamps":                predict.Nothing,
+			"log-relative-time":                  predict.Nothing,
+			"log-timestamp-format":               predict.Set{"RFC3339", "RFC3339Nano", "UnixMs"},
+			"task-output-timestamp-format":       predict.Set{"RFC3339", "RFC3339Nano", "UnixMs"},
+			"task-require-outputs":               predict.Something,
+			"task-require-files":                 predict.Files("*"),
+			"task-inherit-signals":               predict.Nothing,
+			"task-script-interpolate-from-env":   predict.Nothing,
+			"task-log-script":                    predict.Nothing,
+			"task-allow-empty":                   predict.Nothing,
+			"gc":                                 predict.Nothing,
+			"gc-on-success":                      predict.Nothing,
+			"task-persist-outputs":               predict.Something,
+			"task-persist-env":                   predict.Nothing,
+			"task-no-inherit-cwd":                predict.Nothing,
+			"task-max-restarts":                  predict.Something,
+			"task-env-clear-on-error":            predict.Nothing,
+			"task-expand-glob-inputs":            predict.Something,
+			"dry-run":                            predict.Nothing,
+			"task-dry-run-output":                predict.Files("*"),
+			"task-sigterm-script":                predict.Something,
+			"task-input-file":                    predict.Something,
+			"task-default-inputs":                predict.Files("*"),
+			"task-output-json-log":               predict.Nothing,
+			"task-profile-mem-interval":          predict.Something,
+			"complete":                           predict.Nothing,
+			"uncomplete":                         predict.Nothing,
+			"no-tty":                             predict.Nothing,
+			"log-file":                           predict.Files("*"),
+			"task-output-strip-ansi":             predict.Nothing,
+			"task-output-limit":                  predict.Something,
+			"task-env-whitelist":                 predict.Something,
+			"task-env-blacklist":                 predict.Something,
+			"require-docker":                     predict.Nothing,
+			"task-stdin-eof-timeout":             predict.Something,
 		},
 		Sub: completeTasks(tasks),
 	}
@@ -264,6 +581,9 @@ func completion(tasks models.Tasks) *complete.Command {
 func completeTasks(tasks models.Tasks) map[string]*complete.Command {
 	result := map[string]*complete.Command{}
 	for _, t := range tasks {
+		if t.IsHidden() {
+			continue
+		}
 		result[t.Name] = &complete.Command{
 			Args: predict.Something,
 		}
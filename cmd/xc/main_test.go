@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/posener/complete/v2/predict"
+)
+
+func TestRelaySignals(t *testing.T) {
+	in := make(chan os.Signal)
+	out := make(chan os.Signal, len(inheritedSignals))
+	cancelled := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		relaySignals(in, out, func() { close(cancelled) })
+		close(done)
+	}()
+	expectNotCancelled := func() {
+		t.Helper()
+		select {
+		case <-cancelled:
+			t.Fatal("expected not to be cancelled")
+		default:
+		}
+	}
+	in <- syscall.SIGTERM
+	if sig := <-out; sig != syscall.SIGTERM {
+		t.Fatalf("expected SIGTERM to be forwarded, got %v", sig)
+	}
+	in <- os.Interrupt
+	if sig := <-out; sig != os.Interrupt {
+		t.Fatalf("expected SIGINT to be forwarded, got %v", sig)
+	}
+	expectNotCancelled()
+	in <- syscall.SIGHUP
+	<-out
+	expectNotCancelled()
+	in <- os.Interrupt
+	close(in)
+	<-done
+	select {
+	case <-cancelled:
+	default:
+		t.Fatal("expected a second SIGINT to cancel")
+	}
+	if sig := <-out; sig != os.Interrupt {
+		t.Fatalf("expected the second SIGINT to be forwarded, got %v", sig)
+	}
+}
+
+func TestTimestampFormatAliases(t *testing.T) {
+	for _, name := range []string{"log-timestamp-format", "task-output-timestamp-format"} {
+		var cfg config
+		fs := flag.NewFlagSet("xc", flag.ContinueOnError)
+		registerFlags(fs, &cfg)
+		if err := fs.Parse([]string{"-" + name, "UnixMs"}); err != nil {
+			t.Fatal(err)
+		}
+		if cfg.timestampFormat != "UnixMs" {
+			t.Errorf("-%s: got %q, want UnixMs", name, cfg.timestampFormat)
+		}
+	}
+	fs := flag.NewFlagSet("xc", flag.ContinueOnError)
+	registerFlags(fs, &config{})
+	if a, b := fs.Lookup("log-timestamp-format").Usage, fs.Lookup("task-output-timestamp-format").Usage; a != b {
+		t.Errorf("expected the aliases to have the same usage, got %q and %q", a, b)
+	}
+}
+
+func TestCompletionFlags(t *testing.T) {
+	fs := flag.NewFlagSet("xc", flag.ContinueOnError)
+	registerFlags(fs, &config{})
+	predictors := completion(nil).Flags
+	fs.VisitAll(func(f *flag.Flag) {
+		p, ok := predictors[f.Name]
+		if !ok {
+			t.Errorf("-%s has no completion", f.Name)
+			return
+		}
+		set, isSet := p.(predict.Set)
+		nothing := isSet && len(set) == 0
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			if !nothing {
+				t.Errorf("-%s takes no value, so should complete nothing", f.Name)
+			}
+			return
+		}
+		if nothing {
+			t.Errorf("-%s takes a value, so should not complete nothing", f.Name)
+		}
+	})
+	for name := range predictors {
+		if fs.Lookup(name) == nil {
+			t.Errorf("completion of -%s, which is not a flag", name)
+		}
+	}
+}
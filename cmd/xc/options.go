@@ -0,0 +1,438 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/joerdav/xc/models"
+	"github.com/joerdav/xc/run"
+)
+
+// stringList is a flag.Value which can be set multiple times.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// byteSize is a flag.Value for a number of bytes with an optional K, M or G suffix.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(v string) error {
+	units := map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30}
+	v = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(v)), "B")
+	multiplier := int64(1)
+	if len(v) > 0 {
+		if m, ok := units[v[len(v)-1:]]; ok {
+			multiplier = m
+			v = v[:len(v)-1]
+		}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/multiplier {
+		return fmt.Errorf("invalid size %q", v)
+	}
+	*b = byteSize(n * multiplier)
+	return nil
+}
+
+// runnerOptions converts cfg into options for a run.Runner.
+// The returned function closes any files opened for the Runner.
+func runnerOptions(cfg config) (opts []run.RunnerOption, closer func(), err error) {
+	var closers []func()
+	closer = func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+	defer func() {
+		// closer is nil once an error has been returned
+		if err != nil {
+			for _, c := range closers {
+				c()
+			}
+		}
+	}()
+	opts = []run.RunnerOption{
+		run.WithKillGroup(cfg.killGroup),
+		run.WithOutputLimit(int64(cfg.outputLimit)),
+		run.WithStdinEOFTimeout(cfg.stdinEOFTimeout),
+		run.WithRequireDocker(cfg.requireDocker),
+		run.WithCleanupScript(cfg.cleanupScript),
+		run.WithDynamicEnv(cfg.dynamicEnv),
+		run.WithTaskHooks(cfg.beforeEach, cfg.afterEach),
+		run.WithExpandEnvRefs(cfg.rewriteEnvRefs),
+		run.WithNoPTY(cfg.noPTY),
+		run.WithAbortOnStderr(cfg.abortOnStderr),
+		run.WithAssertNoOutput(cfg.assertNoOutput),
+		run.WithRunHidden(cfg.force),
+		run.WithScriptLog(cfg.logScript),
+		run.WithScriptInterpolation(cfg.interpolateScripts),
+		run.WithDefaultTimeout(cfg.defaultTimeout),
+		run.WithTmpfs(cfg.tmpfs, cfg.noSyncBack),
+		run.WithStdinEnv(cfg.stdinEnv),
+		run.WithStdinLog(cfg.stdinLog),
+		run.WithShowScript(cfg.showScript),
+		run.WithDryRun(cfg.dryRun),
+		run.WithJSONLog(cfg.jsonLog),
+		run.WithMaxOpenFiles(cfg.maxOpenFiles),
+		run.WithHostname(cfg.hostname),
+		run.WithPreserveMtime(cfg.preserveMtime),
+		run.WithCreateDir(cfg.createDir),
+		run.WithEnvLog(cfg.envLog, !cfg.noMaskSecrets),
+		run.WithWorkDirLog(cfg.logDir),
+		run.WithPersistOutputs(cfg.persistOutputs),
+		run.WithPersistEnv(cfg.persistEnv),
+		run.WithNoInheritCwd(cfg.noInheritCwd),
+		run.WithClearEnvOnError(cfg.clearEnvOnError),
+		run.WithOutputFilter(cfg.outputFilter),
+		run.WithDirSnapshot(cfg.dirSnapshot),
+		run.WithRunInOrder(cfg.runInOrder),
+		run.WithNoDedup(cfg.noDedup),
+		run.WithEnvNoNewlines(cfg.noNewlines),
+	}
+	if cfg.colorErrorLines {
+		patterns, err := compilePatterns(cfg.errorPatterns, run.DefaultErrorPatterns)
+		if err != nil {
+			return nil, nil, fmt.Errorf("xc: invalid -error-pattern: %w", err)
+		}
+		opts = append(opts, run.WithErrorHighlighting(patterns))
+	}
+	if len(cfg.highlights) > 0 {
+		highlights := make([]run.Highlight, 0, len(cfg.highlights))
+		for _, v := range cfg.highlights {
+			i := strings.LastIndex(v, "=")
+			if i < 1 {
+				return nil, nil, fmt.Errorf("xc: invalid -task-output-highlight %q, expected <regex>=<colour>", v)
+			}
+			h, err := run.NewHighlight(v[:i], v[i+1:])
+			if err != nil {
+				return nil, nil, fmt.Errorf("xc: invalid -task-output-highlight: %w", err)
+			}
+			highlights = append(highlights, h)
+		}
+		opts = append(opts, run.WithOutputHighlights(highlights))
+	}
+	if len(cfg.maskPatterns) > 0 {
+		patterns, err := compilePatterns(cfg.maskPatterns, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("xc: invalid -task-mask-output: %w", err)
+		}
+		opts = append(opts, run.WithOutputMasking(patterns))
+	}
+	if len(cfg.inputMasks) > 0 {
+		opts = append(opts, run.WithInputMasks(cfg.inputMasks))
+	}
+	if len(cfg.globInputs) > 0 {
+		opts = append(opts, run.WithGlobInputs(cfg.globInputs))
+	}
+	switch {
+	case cfg.outputTail >= 0 && cfg.outputHead >= 0:
+		return nil, nil, fmt.Errorf("xc: -task-output-tail and -task-output-head cannot be used together")
+	case cfg.outputTail >= 0:
+		opts = append(opts, run.WithOutputLines(models.OutputLines{N: cfg.outputTail}))
+	case cfg.outputHead >= 0:
+		opts = append(opts, run.WithOutputLines(models.OutputLines{Head: true, N: cfg.outputHead}))
+	}
+	if cfg.maxLineLength < 0 {
+		return nil, nil, fmt.Errorf("xc: -task-output-max-line-length cannot be negative")
+	}
+	if cfg.maxLineLength > 0 {
+		opts = append(opts, run.WithMaxLineLength(cfg.maxLineLength))
+	}
+	if cfg.maxRestarts < 0 {
+		return nil, nil, fmt.Errorf("xc: -task-max-restarts cannot be negative")
+	}
+	if cfg.maxRestarts > 0 {
+		opts = append(opts, run.WithMaxRestarts(cfg.maxRestarts))
+	}
+	if len(cfg.grepPatterns) > 0 {
+		patterns, err := compilePatterns(cfg.grepPatterns, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("xc: invalid -task-output-grep: %w", err)
+		}
+		opts = append(opts, run.WithOutputGrep(patterns))
+	}
+	if len(cfg.truncatePatterns) > 0 {
+		sections := make([]run.Section, len(cfg.truncatePatterns))
+		for i, v := range cfg.truncatePatterns {
+			start, end, ok := strings.Cut(v, ",")
+			if !ok {
+				return nil, nil, fmt.Errorf("xc: invalid -task-output-truncate-pattern %q, expected <start-regex>,<end-regex>", v)
+			}
+			patterns, err := compilePatterns([]string{start, end}, nil)
+			if err != nil {
+				return nil, nil, fmt.Errorf("xc: invalid -task-output-truncate-pattern: %w", err)
+			}
+			sections[i] = run.Section{Start: patterns[0], End: patterns[1]}
+		}
+		opts = append(opts, run.WithOutputTruncation(sections))
+	}
+	if len(cfg.envWhitelist) > 0 {
+		if err := validateGlobs(cfg.envWhitelist); err != nil {
+			return nil, nil, fmt.Errorf("xc: invalid -task-env-whitelist: %w", err)
+		}
+		opts = append(opts, run.WithEnvWhitelist(cfg.envWhitelist))
+	}
+	if len(cfg.envBlacklist) > 0 {
+		if err := validateGlobs(cfg.envBlacklist); err != nil {
+			return nil, nil, fmt.Errorf("xc: invalid -task-env-blacklist: %w", err)
+		}
+		opts = append(opts, run.WithEnvBlacklist(cfg.envBlacklist))
+	}
+	for _, v := range cfg.inputFiles {
+		task, file, ok := strings.Cut(v, ":")
+		if !ok || task == "" || file == "" {
+			return nil, nil, fmt.Errorf("xc: invalid -task-input-file %q, expected <task>:<file>", v)
+		}
+		values, err := run.ReadEnvFile(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("xc: failed to read -task-input-file: %w", err)
+		}
+		opts = append(opts, run.WithTaskInputs(task, values))
+	}
+	if cfg.defaultInputs != "" {
+		values, err := run.ReadEnvFile(cfg.defaultInputs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("xc: failed to read -task-default-inputs: %w", err)
+		}
+		opts = append(opts, run.WithDefaultInputs(values))
+	}
+	if cfg.stdinJSON != "" {
+		if cfg.stdinEnv != "" {
+			return nil, nil, fmt.Errorf("xc: -task-stdin-json and -task-stdin-from-env cannot be used together")
+		}
+		if !json.Valid([]byte(cfg.stdinJSON)) {
+			return nil, nil, fmt.Errorf("xc: invalid -task-stdin-json, expected valid JSON")
+		}
+		opts = append(opts, run.WithStdinJSON(cfg.stdinJSON))
+	}
+	if cfg.summaryLine != "" {
+		tmpl, err := template.New("summary").Parse(cfg.summaryLine)
+		if err != nil {
+			return nil, nil, fmt.Errorf("xc: invalid -task-summary-line: %w", err)
+		}
+		opts = append(opts, run.WithSummaryLine(tmpl))
+	}
+	if cfg.signals != nil {
+		opts = append(opts, run.WithInheritSignals(cfg.signals))
+	}
+	if cfg.logTimestamps {
+		layout := cfg.timestampFormat
+		if cfg.logRelativeTime {
+			layout = ""
+		}
+		opts = append(opts, run.WithTimestamps(layout))
+	}
+	backoff, ok := models.ParseRetryBackoff(cfg.retryBackoff)
+	if !ok {
+		return nil, nil, fmt.Errorf("xc: invalid -task-max-retries-backoff %q, should be (constant, linear, exponential)", cfg.retryBackoff)
+	}
+	opts = append(opts, run.WithRetryBackoff(backoff))
+	if cfg.cleanupEnvFiles {
+		opts = append(opts, run.WithCleanupEnvFiles(models.EnvFileCleanupAlways))
+	}
+	if cfg.scriptMode != "" {
+		mode, ok := models.ParseScriptMode(cfg.scriptMode)
+		if !ok {
+			return nil, nil, fmt.Errorf("xc: invalid -task-script-mode %q, should be (file, stdin, heredoc)", cfg.scriptMode)
+		}
+		opts = append(opts, run.WithScriptMode(mode))
+	}
+	if len(cfg.envTypes) > 0 {
+		types := make(map[string]models.EnvType, len(cfg.envTypes))
+		for _, v := range cfg.envTypes {
+			name, s, _ := strings.Cut(v, "=")
+			ty, ok := models.ParseEnvType(s)
+			if name == "" || !ok {
+				return nil, nil, fmt.Errorf("xc: invalid -task-env-require-typed %q, expected NAME=(int, bool, float, url, semver)", v)
+			}
+			types[name] = ty
+		}
+		opts = append(opts, run.WithEnvTypes(types))
+	}
+	if len(cfg.computedEnv) > 0 {
+		vars := make([]models.ComputedVar, len(cfg.computedEnv))
+		for i, v := range cfg.computedEnv {
+			cv, err := models.ParseComputedVar(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("xc: invalid -task-env-from-process-substitution: %w", err)
+			}
+			vars[i] = cv
+		}
+		opts = append(opts, run.WithComputedEnv(vars))
+	}
+	if len(cfg.exitCodes) > 0 {
+		codes := map[int]models.ExitCodeMeaning{}
+		for _, v := range cfg.exitCodes {
+			c, err := models.ParseExitCodes(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("xc: invalid -task-exit-code-map: %w", err)
+			}
+			for code, m := range c {
+				codes[code] = m
+			}
+		}
+		opts = append(opts, run.WithExitCodes(codes))
+	}
+	for _, list := range cfg.envFiles {
+		for _, file := range strings.Split(list, ",") {
+			vars, err := run.ReadEnvFile(strings.TrimSpace(file))
+			if err != nil {
+				return nil, nil, fmt.Errorf("xc: failed to read -task-combine-env-files: %w", err)
+			}
+			opts = append(opts, run.WithEnvFiles(vars))
+		}
+	}
+	if cfg.envOverrideFile != "" {
+		vars, err := run.ReadEnvFile(cfg.envOverrideFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("xc: failed to read -task-env-override-file: %w", err)
+		}
+		opts = append(opts, run.WithEnvOverrides(vars))
+	}
+	if cfg.envJSON != "" {
+		env, err := run.ReadEnvJSON(cfg.envJSON)
+		if err != nil {
+			return nil, nil, fmt.Errorf("xc: failed to read -task-env-json: %w", err)
+		}
+		for task, vars := range env {
+			opts = append(opts, run.WithTaskEnv(task, vars))
+		}
+	}
+	for _, list := range cfg.requiredOutputs {
+		for _, v := range strings.Split(list, ",") {
+			task, file, ok := strings.Cut(strings.TrimSpace(v), ":")
+			if !ok || task == "" || file == "" {
+				return nil, nil, fmt.Errorf("xc: invalid -task-require-outputs %q, expected <task>:<file>", v)
+			}
+			opts = append(opts, run.WithRequiredOutputs(task, []string{file}))
+		}
+	}
+	for _, list := range cfg.requiredFiles {
+		var files []string
+		for _, v := range strings.Split(list, ",") {
+			files = append(files, strings.TrimSpace(v))
+		}
+		if err := validateGlobs(files); err != nil {
+			return nil, nil, fmt.Errorf("xc: invalid -task-require-files: %w", err)
+		}
+		opts = append(opts, run.WithRequiredFiles(files))
+	}
+	for _, v := range cfg.tagLimits {
+		tag, s, ok := strings.Cut(v, "=")
+		n, err := strconv.Atoi(s)
+		if !ok || tag == "" || err != nil || n < 1 {
+			return nil, nil, fmt.Errorf("xc: invalid -task-parallel-limit-by-tag %q, expected <tag>=<n> where n is at least 1", v)
+		}
+		opts = append(opts, run.WithTagLimit(tag, n))
+	}
+	for _, v := range cfg.outputAssertions {
+		task, expr, ok := strings.Cut(v, "=")
+		if !ok || task == "" {
+			return nil, nil, fmt.Errorf("xc: invalid -task-assert-output %q, expected <task>=<regex>", v)
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("xc: invalid -task-assert-output: %w", err)
+		}
+		opts = append(opts, run.WithOutputAssertion(task, re))
+	}
+	if cfg.memProfileInterval > 0 {
+		if runtime.GOOS != "linux" {
+			return nil, nil, fmt.Errorf("xc: -task-profile-mem-interval is only supported on linux")
+		}
+		opts = append(opts, run.WithMemProfile(cfg.memProfileInterval))
+	}
+	files := map[string]*os.File{}
+	for _, redirect := range []struct {
+		flag   string
+		values stringList
+		opt    func(string, io.Writer) run.RunnerOption
+	}{
+		{"-task-stdout-file", cfg.stdoutFiles, run.WithStdoutFile},
+		{"-task-stderr-file", cfg.stderrFiles, run.WithStderrFile},
+	} {
+		for _, v := range redirect.values {
+			task, path, ok := strings.Cut(v, "=")
+			if !ok || task == "" || path == "" {
+				return nil, nil, fmt.Errorf("xc: invalid %s %q, expected <task>=<path>", redirect.flag, v)
+			}
+			// tasks redirected to the same path share the file
+			f, ok := files[path]
+			if !ok {
+				var err error
+				if f, err = os.Create(path); err != nil {
+					return nil, nil, fmt.Errorf("xc: failed to create %s: %w", redirect.flag, err)
+				}
+				files[path] = f
+				closers = append(closers, func() { f.Close() })
+			}
+			opts = append(opts, redirect.opt(task, f))
+		}
+	}
+	if cfg.dryRunOutput != "" {
+		if !cfg.dryRun {
+			return nil, nil, fmt.Errorf("xc: -task-dry-run-output can only be used with -dry-run")
+		}
+		f, err := os.Create(cfg.dryRunOutput)
+		if err != nil {
+			return nil, nil, fmt.Errorf("xc: failed to create dry run output: %w", err)
+		}
+		closers = append(closers, func() { f.Close() })
+		opts = append(opts, run.WithDryRunOutput(f))
+	}
+	if cfg.logFile != "" {
+		f, err := os.Create(cfg.logFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("xc: failed to create log file: %w", err)
+		}
+		closers = append(closers, func() { f.Close() })
+		opts = append(opts, run.WithLogFile(f), run.WithStripANSI(cfg.stripANSI))
+	}
+	return opts, closer, nil
+}
+
+// compilePatterns compiles each of exprs, returning defaults if there are none.
+func compilePatterns(exprs []string, defaults []*regexp.Regexp) ([]*regexp.Regexp, error) {
+	if len(exprs) == 0 {
+		return defaults, nil
+	}
+	patterns := make([]*regexp.Regexp, 0, len(exprs))
+	for _, e := range exprs {
+		re, err := regexp.Compile(e)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// validateGlobs returns an error if any of patterns is malformed.
+func validateGlobs(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("%q: %w", p, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestByteSizeSet(t *testing.T) {
+	tests := []struct {
+		in        string
+		expected  byteSize
+		expectErr bool
+	}{
+		{in: "512", expected: 512},
+		{in: "10K", expected: 10 << 10},
+		{in: "10kb", expected: 10 << 10},
+		{in: "3M", expected: 3 << 20},
+		{in: " 2G ", expected: 2 << 30},
+		{in: "0", expected: 0},
+		{in: "", expectErr: true},
+		{in: "G", expectErr: true},
+		{in: "ten", expectErr: true},
+		{in: "1T", expectErr: true},
+		{in: "-1K", expectErr: true},
+		{in: "1.5M", expectErr: true},
+		{in: "9223372036854775807K", expectErr: true},
+		{in: "99999999999999999999", expectErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.in, func(t *testing.T) {
+			var b byteSize
+			err := b.Set(tt.in)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("err=%v, want error=%v", err, tt.expectErr)
+			}
+			if err == nil && b != tt.expected {
+				t.Fatalf("got %d, want %d", b, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunnerOptionsErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.env")
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "invalid -error-pattern", args: []string{"-color-error-lines", "-error-pattern", "("}},
+		{name: "-task-output-highlight without a colour", args: []string{"-task-output-highlight", "error"}},
+		{name: "-task-output-highlight with an unknown colour", args: []string{"-task-output-highlight", "error=mauve"}},
+		{name: "invalid -task-mask-output", args: []string{"-task-mask-output", "["}},
+		{name: "-task-output-tail and -task-output-head", args: []string{"-task-output-tail", "1", "-task-output-head", "1"}},
+		{name: "negative -task-output-max-line-length", args: []string{"-task-output-max-line-length", "-1"}},
+		{name: "negative -task-max-restarts", args: []string{"-task-max-restarts", "-1"}},
+		{name: "invalid -task-output-grep", args: []string{"-task-output-grep", "("}},
+		{name: "-task-output-truncate-pattern without an end", args: []string{"-task-output-truncate-pattern", "start"}},
+		{name: "invalid -task-env-whitelist", args: []string{"-task-env-whitelist", "["}},
+		{name: "invalid -task-env-blacklist", args: []string{"-task-env-blacklist", "["}},
+		{name: "-task-input-file without a task", args: []string{"-task-input-file", "inputs.env"}},
+		{name: "missing -task-input-file", args: []string{"-task-input-file", "build:" + missing}},
+		{name: "missing -task-env-override-file", args: []string{"-task-env-override-file", missing}},
+		{name: "-task-require-outputs without a file", args: []string{"-task-require-outputs", "build"}},
+		{name: "invalid -task-require-files", args: []string{"-task-require-files", "["}},
+		{name: "-task-parallel-limit-by-tag of zero", args: []string{"-task-parallel-limit-by-tag", "db=0"}},
+		{name: "-task-assert-output without a task", args: []string{"-task-assert-output", "ok"}},
+		{name: "invalid -task-assert-output", args: []string{"-task-assert-output", "build=("}},
+		{name: "-task-stdout-file without a path", args: []string{"-task-stdout-file", "build"}},
+		{name: "-task-dry-run-output without -dry-run", args: []string{"-task-dry-run-output", filepath.Join(t.TempDir(), "plan.json")}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var cfg config
+			fs := flag.NewFlagSet("xc", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			registerFlags(fs, &cfg)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := runnerOptions(cfg); err == nil {
+				t.Fatalf("expected an error for %v, got nil", tt.args)
+			}
+		})
+	}
+	t.Run("given no flags, should not error", func(t *testing.T) {
+		var cfg config
+		fs := flag.NewFlagSet("xc", flag.ContinueOnError)
+		registerFlags(fs, &cfg)
+		if err := fs.Parse(nil); err != nil {
+			t.Fatal(err)
+		}
+		_, closer, err := runnerOptions(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		closer()
+	})
+}
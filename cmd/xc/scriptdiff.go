@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/joerdav/xc/diff"
+	"github.com/joerdav/xc/models"
+	"github.com/joerdav/xc/parser"
+	"golang.org/x/term"
+)
+
+// diffContext is the number of unchanged lines shown around each change in a script.
+const diffContext = 3
+
+var diffColors = map[byte]string{
+	'-': "\033[31m",
+	'+': "\033[32m",
+	'@': "\033[36m",
+}
+
+// scriptDiff writes the differences between the scripts of tasks, parsed from
+// the markdown file at path, and those in the same file at the git ref.
+func scriptDiff(ctx context.Context, w io.Writer, path, heading, ref string, tasks models.Tasks) error {
+	old, err := tasksAtRef(ctx, path, heading, ref)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, t := range tasks {
+		before, ok := old.Get(t.Name)
+		switch {
+		case !ok:
+			fmt.Fprintf(&buf, "task %q is new\n", t.Name)
+		case before.ScriptText() == t.ScriptText():
+			fmt.Fprintf(&buf, "task %q is unchanged\n", t.Name)
+		default:
+			fmt.Fprintf(&buf, "task %q changed\n--- %s:%s\n+++ %s\n", t.Name, ref, t.Name, t.Name)
+			if err := diff.Unified(&buf, scriptLines(before.ScriptText()), scriptLines(t.ScriptText()), diffContext); err != nil {
+				return err
+			}
+		}
+	}
+	for _, t := range old {
+		if _, ok := tasks.Get(t.Name); !ok {
+			fmt.Fprintf(&buf, "task %q was deleted\n", t.Name)
+		}
+	}
+	if !useColor(w) {
+		_, err = buf.WriteTo(w)
+		return err
+	}
+	s := bufio.NewScanner(&buf)
+	for s.Scan() {
+		line := s.Text()
+		if color, ok := diffColors[firstByte(line)]; ok && !strings.HasPrefix(line, "task ") {
+			line = color + line + "\033[0m"
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// tasksAtRef parses the tasks in the markdown file at path, as it was at the git ref.
+func tasksAtRef(ctx context.Context, path, heading, ref string) (models.Tasks, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", "show", ref+":./"+filepath.Base(path))
+	cmd.Dir = filepath.Dir(path)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to read %s at %s: %w: %s", path, ref, err, strings.TrimSpace(stderr.String()))
+	}
+	p, err := parser.NewParser(&stdout, heading)
+	if err != nil {
+		return nil, fmt.Errorf("xc parse error at %s: %w", ref, err)
+	}
+	// the old scripts only need to be compared, not run
+	p.AllowEmpty(true)
+	tasks, err := p.Parse()
+	if err != nil {
+		return nil, fmt.Errorf("xc parse error at %s: %w", ref, err)
+	}
+	return tasks, nil
+}
+
+func scriptLines(script string) []string {
+	script = strings.TrimSuffix(script, "\n")
+	if script == "" {
+		return nil
+	}
+	return strings.Split(script, "\n")
+}
+
+func firstByte(s string) byte {
+	if s == "" {
+		return 0
+	}
+	return s[0]
+}
+
+// useColor reports whether w is a terminal which should be written in colour.
+func useColor(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	// Ignore G115: Fd() ultimately returns a SysFd value, which is an int.
+	//nolint:gosec
+	return ok && os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(f.Fd()))
+}
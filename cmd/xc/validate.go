@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/joerdav/xc/models"
+	"github.com/joerdav/xc/parser"
+)
+
+// errValidationFailed is returned by -validate once it has reported the problems it found.
+var errValidationFailed = errors.New("validation failed")
+
+// validate reports the problems with tasks, or parseErr if they could not be
+// parsed, to w in format, which is text or json.
+func validate(w io.Writer, tasks models.Tasks, dir string, parseErr error, format string) error {
+	errs := []error{parseErr}
+	// circular dependencies are found again, along with every other problem
+	if parseErr == nil || errors.Is(parseErr, parser.ErrCircularDependency) {
+		errs = parser.Validate(tasks, dir)
+	}
+	switch format {
+	case "json":
+		problems := make([]string, len(errs))
+		for i, err := range errs {
+			problems[i] = err.Error()
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			Valid    bool     `json:"valid"`
+			Problems []string `json:"problems"`
+		}{len(errs) == 0, problems}); err != nil {
+			return err
+		}
+	case "text":
+		for _, err := range errs {
+			fmt.Fprintln(w, err)
+		}
+		if len(errs) == 0 {
+			fmt.Fprintf(w, "%d tasks are valid\n", len(tasks))
+		} else {
+			fmt.Fprintf(w, "%d problems found\n", len(errs))
+		}
+	default:
+		return fmt.Errorf("xc: invalid -validate-format %q, should be (text, json)", format)
+	}
+	if len(errs) > 0 {
+		return errValidationFailed
+	}
+	return nil
+}
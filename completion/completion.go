@@ -0,0 +1,115 @@
+// Package completion writes shell completion scripts which complete the
+// names of tasks.
+package completion
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/joerdav/xc/models"
+)
+
+// Generate writes a completion script for shell, one of bash, zsh or fish,
+// to w. The script completes the names of tasks which are not hidden, with
+// the first line of the description of each where the shell shows one.
+// The names are written into the script, so it should be generated again
+// when tasks are added or removed.
+func Generate(shell string, tasks models.Tasks, w io.Writer) error {
+	var visible models.Tasks
+	for _, t := range tasks {
+		if !t.IsHidden() {
+			visible = append(visible, t)
+		}
+	}
+	switch shell {
+	case "bash":
+		return bash(visible, w)
+	case "zsh":
+		return zsh(visible, w)
+	case "fish":
+		return fish(visible, w)
+	}
+	return fmt.Errorf("unknown shell %q, expected bash, zsh or fish", shell)
+}
+
+func bash(tasks models.Tasks, w io.Writer) error {
+	names := make([]string, len(tasks))
+	for i, t := range tasks {
+		names[i] = quote(t.Name)
+	}
+	_, err := fmt.Fprintf(w, `# bash completion for xc
+_xc() {
+	local cur="${COMP_WORDS[COMP_CWORD]}"
+	case "$cur" in
+	-*) return ;;
+	esac
+	local tasks=(%s)
+	local t
+	COMPREPLY=()
+	for t in "${tasks[@]}"; do
+		if [[ "$t" == "$cur"* ]]; then
+			COMPREPLY+=("$(printf '%%q' "$t")")
+		fi
+	done
+}
+complete -o default -F _xc xc
+`, strings.Join(names, " "))
+	return err
+}
+
+func zsh(tasks models.Tasks, w io.Writer) error {
+	var sb strings.Builder
+	for _, t := range tasks {
+		entry := strings.ReplaceAll(t.Name, ":", `\:`)
+		if d := summary(t); d != "" {
+			entry += ":" + d
+		}
+		fmt.Fprintf(&sb, "\t\t%s\n", quote(entry))
+	}
+	_, err := fmt.Fprintf(w, `#compdef xc
+# zsh completion for xc
+_xc() {
+	local -a tasks
+	tasks=(
+%s	)
+	_describe -t tasks 'task' tasks
+}
+if [ "$funcstack[1]" = "_xc" ]; then
+	_xc "$@"
+else
+	compdef _xc xc
+fi
+`, sb.String())
+	return err
+}
+
+func fish(tasks models.Tasks, w io.Writer) error {
+	fmt.Fprintln(w, "# fish completion for xc")
+	for _, t := range tasks {
+		line := "complete -c xc -f -n __fish_use_subcommand -a " + fishQuote(t.Name)
+		if d := summary(t); d != "" {
+			line += " -d " + fishQuote(d)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// summary returns the first line of the description of t.
+func summary(t models.Task) string {
+	d, _, _ := strings.Cut(t.DescriptionText(), "\n")
+	return d
+}
+
+// quote quotes s for bash or zsh, in single quotes.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// fishQuote quotes s for fish, in which \ and ' are escaped inside single quotes.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
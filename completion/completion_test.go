@@ -0,0 +1,75 @@
+package completion
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+var tasks = models.Tasks{
+	{Name: "build", Description: []string{"Build the app's binary.", "Then test it."}},
+	{Name: "deploy:prod"},
+	{Name: "_hidden"},
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		shell    string
+		contains []string
+		parse    []string
+	}{
+		{
+			shell:    "bash",
+			contains: []string{"'build'", "'deploy:prod'", "complete -o default -F _xc xc"},
+			parse:    []string{"bash", "-n"},
+		},
+		{
+			shell:    "zsh",
+			contains: []string{`'build:Build the app'\''s binary.'`, `'deploy\:prod'`, "compdef _xc xc"},
+			parse:    []string{"zsh", "-n"},
+		},
+		{
+			shell:    "fish",
+			contains: []string{`-a 'build' -d 'Build the app\'s binary.'`, "-a 'deploy:prod'"},
+			parse:    []string{"fish", "--no-execute"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.shell, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Generate(tt.shell, tasks, &buf); err != nil {
+				t.Fatal(err)
+			}
+			out := buf.String()
+			for _, c := range tt.contains {
+				if !strings.Contains(out, c) {
+					t.Errorf("expected %q in:\n%s", c, out)
+				}
+			}
+			if strings.Contains(out, "_hidden") || strings.Contains(out, "Then test it") {
+				t.Errorf("expected hidden tasks and later lines of descriptions to be left out:\n%s", out)
+			}
+			if _, err := exec.LookPath(tt.parse[0]); err != nil {
+				t.Skipf("%s is not installed, not checking the syntax", tt.parse[0])
+			}
+			path := filepath.Join(t.TempDir(), "xc")
+			if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if out, err := exec.Command(tt.parse[0], append(tt.parse[1:], path)...).CombinedOutput(); err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+		})
+	}
+	t.Run("given an unknown shell, should error", func(t *testing.T) {
+		if err := Generate("powershell", tasks, &bytes.Buffer{}); err == nil {
+			t.Fatal("expected an error got nil")
+		}
+	})
+}
@@ -0,0 +1,163 @@
+// Package diff compares sequences of lines.
+package diff
+
+import (
+	"fmt"
+	"io"
+)
+
+// Op is the kind of an Edit.
+type Op byte
+
+const (
+	// Equal lines are in both sequences.
+	Equal Op = ' '
+	// Delete lines are only in the first sequence.
+	Delete Op = '-'
+	// Insert lines are only in the second sequence.
+	Insert Op = '+'
+)
+
+// Edit is a line of a diff.
+type Edit struct {
+	Op   Op
+	Text string
+}
+
+// Lines returns the edits which turn a into b, using the longest common subsequence.
+func Lines(a, b []string) []Edit {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var edits []Edit
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, Edit{Equal, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, Edit{Delete, a[i]})
+			i++
+		default:
+			edits = append(edits, Edit{Insert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, Edit{Delete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, Edit{Insert, b[j]})
+	}
+	return edits
+}
+
+// Unified writes the edits which turn a into b to w in unified diff format,
+// with context unchanged lines around each change.
+// It writes nothing if a and b are equal.
+func Unified(w io.Writer, a, b []string, context int) error {
+	edits := Lines(a, b)
+	for start := 0; start < len(edits); {
+		first := nextChange(edits, start)
+		if first == len(edits) {
+			break
+		}
+		// extend the hunk while the gap to the next change is small enough to share context
+		end := first
+		for end < len(edits) {
+			next := nextEqual(edits, end)
+			following := nextChange(edits, next)
+			if following == len(edits) || following-next > 2*context {
+				end = next
+				break
+			}
+			end = following
+		}
+		from := first - context
+		if from < start {
+			from = start
+		}
+		to := end + context
+		if to > len(edits) {
+			to = len(edits)
+		}
+		if err := writeHunk(w, edits, from, to); err != nil {
+			return err
+		}
+		start = to
+	}
+	return nil
+}
+
+func nextChange(edits []Edit, i int) int {
+	for i < len(edits) && edits[i].Op == Equal {
+		i++
+	}
+	return i
+}
+
+func nextEqual(edits []Edit, i int) int {
+	for i < len(edits) && edits[i].Op != Equal {
+		i++
+	}
+	return i
+}
+
+// writeHunk writes edits[from:to] with a header giving their line numbers.
+func writeHunk(w io.Writer, edits []Edit, from, to int) error {
+	aLine, bLine := 1, 1
+	for _, e := range edits[:from] {
+		if e.Op != Insert {
+			aLine++
+		}
+		if e.Op != Delete {
+			bLine++
+		}
+	}
+	aCount, bCount := 0, 0
+	for _, e := range edits[from:to] {
+		if e.Op != Insert {
+			aCount++
+		}
+		if e.Op != Delete {
+			bCount++
+		}
+	}
+	if _, err := fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(aLine, aCount), hunkRange(bLine, bCount)); err != nil {
+		return err
+	}
+	for _, e := range edits[from:to] {
+		if _, err := fmt.Fprintf(w, "%c%s\n", e.Op, e.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hunkRange formats the start and length of a hunk, where an empty hunk starts
+// at the line before it.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
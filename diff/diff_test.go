@@ -0,0 +1,73 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	a := []string{"a", "b", "c"}
+	b := []string{"a", "c", "d"}
+	var got []string
+	for _, e := range Lines(a, b) {
+		got = append(got, string(e.Op)+e.Text)
+	}
+	if expect := " a,-b, c,+d"; strings.Join(got, ",") != expect {
+		t.Fatalf("got %q, want %q", strings.Join(got, ","), expect)
+	}
+}
+
+func TestUnified(t *testing.T) {
+	lines := func(s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Split(s, "\n")
+	}
+	tests := []struct {
+		name     string
+		a, b     string
+		expected string
+	}{
+		{
+			name: "given equal input, should write nothing",
+			a:    "a\nb",
+			b:    "a\nb",
+		},
+		{
+			name:     "given a changed line, should write it with context",
+			a:        "1\n2\n3\n4\n5\n6\n7",
+			b:        "1\n2\n3\nfour\n5\n6\n7",
+			expected: "@@ -2,5 +2,5 @@\n 2\n 3\n-4\n+four\n 5\n 6\n",
+		},
+		{
+			name:     "given changes far apart, should write separate hunks",
+			a:        "1\n2\n3\n4\n5\n6\n7\n8",
+			b:        "one\n2\n3\n4\n5\n6\n7\neight",
+			expected: "@@ -1,3 +1,3 @@\n-1\n+one\n 2\n 3\n@@ -6,3 +6,3 @@\n 6\n 7\n-8\n+eight\n",
+		},
+		{
+			name:     "given changes close together, should write one hunk",
+			a:        "1\n2\n3\n4\n5",
+			b:        "one\n2\n3\n4\nfive",
+			expected: "@@ -1,5 +1,5 @@\n-1\n+one\n 2\n 3\n 4\n-5\n+five\n",
+		},
+		{
+			name:     "given an empty input, should insert everything",
+			b:        "a\nb",
+			expected: "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var w strings.Builder
+			if err := Unified(&w, lines(tt.a), lines(tt.b), 2); err != nil {
+				t.Fatal(err)
+			}
+			if w.String() != tt.expected {
+				t.Fatalf("got:\n%s\nwant:\n%s", w.String(), tt.expected)
+			}
+		})
+	}
+}
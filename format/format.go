@@ -0,0 +1,126 @@
+// Package format writes lists of tasks for people and other tools.
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/joerdav/xc/models"
+)
+
+// task is the JSON representation of a models.Task.
+type task struct {
+	Name        string   `json:"name"`
+	Description []string `json:"description"`
+	DependsOn   []string `json:"depends_on"`
+	Dir         string   `json:"dir"`
+	Env         []string `json:"env"`
+	Inputs      []string `json:"inputs"`
+	Script      string   `json:"script"`
+}
+
+// Format writes tasks to w in format, which is one of:
+//
+//   - table: the list shown by xc, with the description of each task which
+//     is not hidden.
+//   - json: an array of objects with the name, description, depends_on, dir,
+//     env, inputs and script of each task.
+func Format(tasks models.Tasks, w io.Writer, format string) error {
+	switch format {
+	case "table":
+		return table(tasks, w)
+	case "json":
+		return writeJSON(tasks, w)
+	}
+	return fmt.Errorf("unknown format %q, expected table or json", format)
+}
+
+func table(tasks models.Tasks, w io.Writer) error {
+	tasks = visible(tasks)
+	maxLen := 0
+	for _, t := range tasks {
+		if len(t.Name) > maxLen {
+			maxLen = len(t.Name)
+		}
+	}
+	for _, t := range tasks {
+		var desc []string
+		if len(t.Description) > 0 {
+			desc = strings.Split(t.DescriptionText(), "\n")
+		}
+		if len(t.DependsOn) > 0 {
+			desc = append(desc[:len(desc):len(desc)], fmt.Sprintf("Requires:  %s", t.RequiresText()))
+		}
+		if len(desc) == 0 {
+			desc = strings.Split(t.ScriptText(), "\n")
+		}
+		pad := strings.Repeat(" ", maxLen-len(t.Name))
+		if _, err := fmt.Fprintf(w, "    %s%s  %s\n", t.Name, pad, desc[0]); err != nil {
+			return err
+		}
+		for _, d := range desc[1:] {
+			if _, err := fmt.Fprintf(w, "    %s  %s\n", strings.Repeat(" ", maxLen), d); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeJSON(tasks models.Tasks, w io.Writer) error {
+	out := make([]task, len(tasks))
+	for i, t := range tasks {
+		out[i] = task{
+			Name:        t.Name,
+			Description: orEmpty(t.Description),
+			DependsOn:   requires(t.DependsOn),
+			Dir:         t.Dir,
+			Env:         orEmpty(t.Env),
+			Inputs:      inputs(t.Inputs),
+			Script:      t.ScriptText(),
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// visible returns the tasks which are not hidden.
+func visible(tasks models.Tasks) models.Tasks {
+	var result models.Tasks
+	for _, t := range tasks {
+		if !t.IsHidden() {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// orEmpty returns s, or an empty slice if it is nil, so that it is written
+// to JSON as [] rather than null.
+// inputs returns the inputs of a task as they are written, NAME or NAME=default.
+func inputs(in []models.Input) []string {
+	s := make([]string, len(in))
+	for i, v := range in {
+		s[i] = v.String()
+	}
+	return s
+}
+
+func orEmpty(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// requires returns the tasks in refs as they are written in the requires attribute.
+func requires(refs []models.TaskRef) []string {
+	deps := make([]string, len(refs))
+	for i, ref := range refs {
+		deps[i] = ref.String()
+	}
+	return deps
+}
@@ -0,0 +1,108 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/parser"
+)
+
+const readme = "# Tasks\n" +
+	"## build\n" +
+	"_Builds the binary._\n" +
+	"Dir: cmd\n" +
+	"Env: CGO_ENABLED=0\n" +
+	"Inputs: VERSION\n" +
+	"```\n" +
+	"go build\n" +
+	"```\n" +
+	"## release\n" +
+	"Requires: build\n" +
+	"## _stamp\n" +
+	"```\n" +
+	"date > stamp\n" +
+	"```\n"
+
+func TestFormatJSON(t *testing.T) {
+	p, err := parser.NewParser(strings.NewReader(readme), "tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Format(tasks, &buf, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	expected := []map[string]any{
+		{
+			"name":        "build",
+			"description": []any{"_Builds the binary._"},
+			"depends_on":  []any{},
+			"dir":         "cmd",
+			"env":         []any{"CGO_ENABLED=0"},
+			"inputs":      []any{"VERSION"},
+			"script":      "go build\n",
+		},
+		{
+			"name":        "release",
+			"description": []any{},
+			"depends_on":  []any{"build"},
+			"dir":         "",
+			"env":         []any{},
+			"inputs":      []any{},
+			"script":      "",
+		},
+		{
+			"name":        "_stamp",
+			"description": []any{},
+			"depends_on":  []any{},
+			"dir":         "",
+			"env":         []any{},
+			"inputs":      []any{},
+			"script":      "date > stamp\n",
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %v, want %v", got, expected)
+	}
+}
+
+func TestFormatTable(t *testing.T) {
+	p, err := parser.NewParser(strings.NewReader(readme), "tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Format(tasks, &buf, "table"); err != nil {
+		t.Fatal(err)
+	}
+	expected := "    build    Builds the binary.\n" +
+		"    release  Requires:  build\n"
+	if buf.String() != expected {
+		t.Fatalf("got %q, want %q", buf.String(), expected)
+	}
+}
+
+func TestFormatUnknown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Format(nil, &buf, "yaml"); err == nil {
+		t.Fatal("expected an error got nil")
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing to be written, got %q", buf.String())
+	}
+}
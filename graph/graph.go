@@ -0,0 +1,105 @@
+// Package graph draws the dependencies between tasks.
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/joerdav/xc/models"
+)
+
+// edge is a task requiring another.
+type edge struct {
+	from, to string
+}
+
+// build returns the sorted names of every task and of every task they
+// require, and the sorted edges from each task to the tasks it requires.
+func build(tasks models.Tasks) ([]string, []edge) {
+	seen := map[string]bool{}
+	var nodes []string
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			nodes = append(nodes, name)
+		}
+	}
+	seenEdges := map[edge]bool{}
+	var edges []edge
+	for _, t := range tasks {
+		add(t.Name)
+		for _, dep := range t.DependsOn {
+			name := dep.Name
+			if d, ok := tasks.Get(name); ok {
+				name = d.Name
+			}
+			add(name)
+			e := edge{t.Name, name}
+			if !seenEdges[e] {
+				seenEdges[e] = true
+				edges = append(edges, e)
+			}
+		}
+	}
+	sort.Strings(nodes)
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].from != edges[j].from {
+			return edges[i].from < edges[j].from
+		}
+		return edges[i].to < edges[j].to
+	})
+	return nodes, edges
+}
+
+func isHidden(name string) bool {
+	return models.Task{Name: name}.IsHidden()
+}
+
+// ToDOT returns a Graphviz digraph of tasks, with an arrow from each task to
+// each task it requires. Hidden tasks have a dashed border.
+func ToDOT(tasks models.Tasks) string {
+	nodes, edges := build(tasks)
+	var b strings.Builder
+	b.WriteString("digraph tasks {\n")
+	for _, n := range nodes {
+		if isHidden(n) {
+			fmt.Fprintf(&b, "\t%s [style=dashed];\n", dotID(n))
+			continue
+		}
+		fmt.Fprintf(&b, "\t%s;\n", dotID(n))
+	}
+	for _, e := range edges {
+		fmt.Fprintf(&b, "\t%s -> %s;\n", dotID(e.from), dotID(e.to))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotID quotes name as a DOT identifier.
+func dotID(name string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+}
+
+// ToMermaid returns a Mermaid flowchart of tasks, which GitHub renders in
+// markdown, with an arrow from each task to each task it requires.
+// Hidden tasks have a dashed border.
+func ToMermaid(tasks models.Tasks) string {
+	nodes, edges := build(tasks)
+	ids := make(map[string]string, len(nodes))
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+	for i, n := range nodes {
+		ids[n] = fmt.Sprintf("n%d", i)
+		fmt.Fprintf(&b, "\t%s[\"%s\"]\n", ids[n], strings.ReplaceAll(n, `"`, "#quot;"))
+	}
+	for _, e := range edges {
+		fmt.Fprintf(&b, "\t%s --> %s\n", ids[e.from], ids[e.to])
+	}
+	for _, n := range nodes {
+		if isHidden(n) {
+			fmt.Fprintf(&b, "\tstyle %s stroke-dasharray: 5 5\n", ids[n])
+		}
+	}
+	return b.String()
+}
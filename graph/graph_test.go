@@ -0,0 +1,83 @@
+package graph
+
+import (
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestGraph(t *testing.T) {
+	tests := []struct {
+		name          string
+		tasks         models.Tasks
+		expectDOT     string
+		expectMermaid string
+	}{
+		{
+			name:          "given no tasks, should draw an empty graph",
+			expectDOT:     "digraph tasks {\n}\n",
+			expectMermaid: "flowchart TD\n",
+		},
+		{
+			name: "given a chain, should draw each requirement once",
+			tasks: models.Tasks{
+				{Name: "deploy", DependsOn: []models.TaskRef{{Name: "build"}}},
+				{Name: "build", DependsOn: []models.TaskRef{{Name: "_generate"}, {Name: "_generate"}}},
+				{Name: "_generate"},
+			},
+			expectDOT: "digraph tasks {\n" +
+				"\t\"_generate\" [style=dashed];\n" +
+				"\t\"build\";\n" +
+				"\t\"deploy\";\n" +
+				"\t\"build\" -> \"_generate\";\n" +
+				"\t\"deploy\" -> \"build\";\n" +
+				"}\n",
+			expectMermaid: "flowchart TD\n" +
+				"\tn0[\"_generate\"]\n" +
+				"\tn1[\"build\"]\n" +
+				"\tn2[\"deploy\"]\n" +
+				"\tn1 --> n0\n" +
+				"\tn2 --> n1\n" +
+				"\tstyle n0 stroke-dasharray: 5 5\n",
+		},
+		{
+			name: "given a diamond, should draw the shared requirement once",
+			tasks: models.Tasks{
+				{Name: "release", DependsOn: []models.TaskRef{{Name: "test"}, {Name: "lint"}}},
+				{Name: "test", DependsOn: []models.TaskRef{{Name: "Build", Args: []string{"debug"}}}},
+				{Name: "lint", DependsOn: []models.TaskRef{{Name: "build", Args: []string{"--strict"}}}},
+				{Name: "build"},
+			},
+			expectDOT: "digraph tasks {\n" +
+				"\t\"build\";\n" +
+				"\t\"lint\";\n" +
+				"\t\"release\";\n" +
+				"\t\"test\";\n" +
+				"\t\"lint\" -> \"build\";\n" +
+				"\t\"release\" -> \"lint\";\n" +
+				"\t\"release\" -> \"test\";\n" +
+				"\t\"test\" -> \"build\";\n" +
+				"}\n",
+			expectMermaid: "flowchart TD\n" +
+				"\tn0[\"build\"]\n" +
+				"\tn1[\"lint\"]\n" +
+				"\tn2[\"release\"]\n" +
+				"\tn3[\"test\"]\n" +
+				"\tn1 --> n0\n" +
+				"\tn2 --> n1\n" +
+				"\tn2 --> n3\n" +
+				"\tn3 --> n0\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToDOT(tt.tasks); got != tt.expectDOT {
+				t.Errorf("ToDOT got:\n%s\nwant:\n%s", got, tt.expectDOT)
+			}
+			if got := ToMermaid(tt.tasks); got != tt.expectMermaid {
+				t.Errorf("ToMermaid got:\n%s\nwant:\n%s", got, tt.expectMermaid)
+			}
+		})
+	}
+}
@@ -3,22 +3,204 @@ package models
 import (
 	"fmt"
 	"io"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/google/shlex"
 )
 
 // Task represents a parsed Task.
 type Task struct {
-	Name              string
-	Description       []string
-	Script            string
-	Dir               string
-	Env               []string
-	DependsOn         []string
-	Inputs            []string
+	Name        string
+	Description []string
+	// Script holds the code blocks of the task, which are run in order.
+	Script []ScriptBlock
+	Dir    string
+	// Shell is the interpreter, with any arguments, which runs the script from
+	// a temporary file, instead of the shell built into xc.
+	Shell string
+	Env   []string
+	// DependsOn are the tasks required by the task, with any arguments
+	// passed to them.
+	DependsOn []TaskRef
+	Inputs    []Input
+	// Outputs are files, relative to the directory of the task, which must
+	// exist once the task has succeeded.
+	Outputs           []string
 	ParsingError      string
 	RequiredBehaviour RequiredBehaviour
 	DepsBehaviour     DepsBehaviour
 	Interactive       bool
+	// FailOnStderr fails the task as soon as it writes to stderr.
+	FailOnStderr bool
+	// ExpectSilent fails the task if it writes to stdout or stderr.
+	ExpectSilent bool
+	// ContinueOnError logs a failure of the task instead of returning it, so
+	// the tasks which require it still run.
+	ContinueOnError bool
+	// Tags group tasks, e.g. to limit how many with a tag run at once.
+	Tags []string
+	// Platforms are the operating systems, as named by GOOS, which the task
+	// runs on. The task is skipped on any other, unless it is empty.
+	Platforms []string
+	// Watch are glob patterns, relative to the directory of the task, of
+	// files which cause the task to run again when they change with xc -watch.
+	Watch []string
+	// MaxRestarts limits how many times xc -watch runs the task again, if set.
+	MaxRestarts int
+	// ScriptMode is how the script is passed to the interpreter set by
+	// the shell attribute or a shebang.
+	ScriptMode ScriptMode
+	// Parallel runs the dependencies of the task concurrently, cancelling the
+	// rest as soon as one fails.
+	Parallel bool
+	// NoKillGroup opts a task out of process group killing, for tasks
+	// which intentionally leave processes running in the background.
+	NoKillGroup bool
+	// StdinEOFTimeout closes the stdin of the task after it has been idle this long.
+	StdinEOFTimeout time.Duration
+	// StdinEnv is the name of an environment variable whose value is the stdin of the task.
+	StdinEnv string
+	// StdinLog is a file, relative to the directory of the task, which the
+	// stdin of the task is copied to as it is read.
+	StdinLog string
+	// RequiresDocker checks that the Docker daemon is accessible before running.
+	RequiresDocker bool
+	// Inherit is the name of a task whose environment and directory this task uses.
+	Inherit string
+	// Cleanup is a script run when the task is cancelled, while the task is
+	// being interrupted.
+	Cleanup string
+	// DynamicEnv is a script run before the task, whose stdout of KEY=VALUE
+	// lines is added to the environment of the task.
+	DynamicEnv string
+	// ComputedEnv are variables set to the output of a command before the task runs.
+	ComputedEnv []ComputedVar
+	// Vars are KEY=VALUE variables of the task alone, which are not inherited.
+	// Values are expanded by the shell of the task before it runs.
+	Vars []string
+	// ValidateInputs is a script which checks the inputs of the task before it runs.
+	ValidateInputs string
+	// ExpandGlobInputs are the names of inputs whose values are expanded as
+	// glob patterns, relative to the directory of the task, before it runs.
+	ExpandGlobInputs []string
+	// DefaultsFile is a file of KEY=VALUE lines, relative to the directory of
+	// the task, giving values to inputs which are not set any other way.
+	DefaultsFile string
+	// RequireFiles are files, or glob patterns, relative to the directory of
+	// the task, which must exist before its script runs.
+	RequireFiles []string
+	// Test marks the task as a test, run by `xc -test` with its output shown
+	// only if it fails.
+	Test bool
+	// MaxOpenFiles limits the number of files the commands of the task can open.
+	MaxOpenFiles uint64
+	// Hostname is the hostname seen by the commands of the task.
+	Hostname string
+	// PreserveMtime restores the modification time of files in the directory
+	// of the task which it touched without changing.
+	PreserveMtime bool
+	// Tmpfs runs the task in a memory-backed copy of its directory, whose
+	// changes are copied back once it has finished.
+	Tmpfs bool
+	// Timeout stops the task once it has run this long. NoTimeout disables
+	// the default timeout of the runner.
+	Timeout time.Duration
+	// NoInterpolate runs the script verbatim, even if the runner expands
+	// variables in scripts.
+	NoInterpolate bool
+	// AllowEmpty permits the task to have no script and no required tasks,
+	// as a placeholder.
+	AllowEmpty bool
+	// EnvFiles are files of KEY=VALUE lines, relative to the directory of the
+	// task, loaded into its environment in order before the env attribute.
+	EnvFiles []string
+	// CleanupEnvFiles deletes the env files of the task once it has run.
+	CleanupEnvFiles EnvFileCleanup
+	// EnvTypes are the types which variables in the environment of the task
+	// must have before it runs, by name.
+	EnvTypes map[string]EnvType
+	// ExitCodes change the meaning of exit codes of the script, by code.
+	ExitCodes map[int]ExitCodeMeaning
+	// OutputLines limits the lines of output from the task shown in the
+	// terminal, if set.
+	OutputLines *OutputLines
+	// OutputFilter is a command which the stdout and stderr of the task are
+	// piped through before they are shown.
+	OutputFilter string
+	// CreateDir creates the directory of the task before it runs, if it does not exist.
+	CreateDir bool
+	// RetryCount is the number of times the task is run again if it fails.
+	RetryCount int
+	// RetryDelay is the wait before the first retry, which RetryBackoff grows.
+	RetryDelay time.Duration
+	// RetryBackoff is how the wait between retries grows.
+	RetryBackoff RetryBackoff
+	// RetryMaxDelay caps the wait between retries, if set.
+	RetryMaxDelay time.Duration
+	// RequiredBehaviourSet is true if the task has the run attribute.
+	// A task without it runs once for each set of inputs it is required
+	// with, unless deduplication is turned off.
+	RequiredBehaviourSet bool
+}
+
+// NoTimeout is the Timeout of a task with `timeout: none`, which runs
+// without a time limit even if the runner has a default timeout.
+const NoTimeout time.Duration = -1
+
+// IsTest reports whether the task is run by `xc -test`, either because it
+// has the test attribute or because its name starts with test_ or ends with _test.
+func (t Task) IsTest() bool {
+	return t.Test || strings.HasPrefix(t.Name, "test_") || strings.HasSuffix(t.Name, "_test")
+}
+
+// ScriptText returns the bodies of the script blocks of t, one after another.
+func (t Task) ScriptText() string {
+	var sb strings.Builder
+	for _, b := range t.Script {
+		sb.WriteString(b.Body)
+	}
+	return sb.String()
+}
+
+// DescriptionText returns the description of t as plain text, one line per
+// line of markdown, without surrounding whitespace or emphasis, such as
+// *text* or `text`, which wraps a whole line.
+func (t Task) DescriptionText() string {
+	lines := make([]string, len(t.Description))
+	for i, d := range t.Description {
+		d = strings.TrimSpace(d)
+		for len(d) > 1 && strings.IndexByte("_*`", d[0]) >= 0 && d[len(d)-1] == d[0] {
+			d = strings.TrimSpace(d[1 : len(d)-1])
+		}
+		lines[i] = d
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DescriptionMarkdown returns the description of t as it was written.
+func (t Task) DescriptionMarkdown() string {
+	return strings.Join(t.Description, "\n")
+}
+
+// RequiresText returns the tasks which t requires, as they are written in
+// the requires attribute.
+func (t Task) RequiresText() string {
+	deps := make([]string, len(t.DependsOn))
+	for i, dep := range t.DependsOn {
+		deps[i] = dep.String()
+	}
+	return strings.Join(deps, ", ")
+}
+
+// IsHidden reports whether the task is only meant to be required by other
+// tasks, because its name starts with an underscore, e.g. _build-intermediate.
+// Hidden tasks are not listed, and cannot be run directly without -force.
+func (t Task) IsHidden() bool {
+	return strings.HasPrefix(t.Name, "_")
 }
 
 // Display writes a Task as Markdown.
@@ -29,30 +211,194 @@ func (t Task) Display(w io.Writer) {
 		fmt.Fprintln(w)
 	}
 	if len(t.DependsOn) > 0 {
-		fmt.Fprintln(w, "Requires:", strings.Join(t.DependsOn, ", "))
+		fmt.Fprintln(w, "Requires:", t.RequiresText())
 		fmt.Fprintln(w, "RunDeps:", t.DepsBehaviour)
+		if t.Parallel {
+			fmt.Fprintln(w, "Parallel: true")
+		}
+		fmt.Fprintln(w)
+	}
+	if t.Inherit != "" {
+		fmt.Fprintln(w, "Inherit:", t.Inherit)
 		fmt.Fprintln(w)
 	}
 	if t.Dir != "" {
 		fmt.Fprintln(w, "Directory:", t.Dir)
 		fmt.Fprintln(w)
 	}
+	if t.Shell != "" {
+		fmt.Fprintln(w, "Shell:", t.Shell)
+		fmt.Fprintln(w)
+	}
+	if t.ScriptMode != "" {
+		fmt.Fprintln(w, "Script-Mode:", t.ScriptMode)
+		fmt.Fprintln(w)
+	}
 	if len(t.Env) > 0 {
 		fmt.Fprintln(w, "Env:", strings.Join(t.Env, ", "))
 		fmt.Fprintln(w)
 	}
 	if len(t.Inputs) > 0 {
-		fmt.Fprintln(w, "Inputs:", strings.Join(t.Inputs, ", "))
+		inputs := make([]string, len(t.Inputs))
+		for i, in := range t.Inputs {
+			inputs[i] = in.String()
+		}
+		fmt.Fprintln(w, "Inputs:", strings.Join(inputs, ", "))
+		fmt.Fprintln(w)
+	}
+	if len(t.Outputs) > 0 {
+		fmt.Fprintln(w, "Outputs:", strings.Join(t.Outputs, ", "))
+		fmt.Fprintln(w)
+	}
+	if len(t.RequireFiles) > 0 {
+		fmt.Fprintln(w, "Require-Files:", strings.Join(t.RequireFiles, ", "))
+		fmt.Fprintln(w)
+	}
+	if t.ValidateInputs != "" {
+		fmt.Fprintln(w, "Validate-Inputs:", t.ValidateInputs)
+		fmt.Fprintln(w)
+	}
+	if len(t.ExpandGlobInputs) > 0 {
+		fmt.Fprintln(w, "Expand-Glob-Inputs:", strings.Join(t.ExpandGlobInputs, ", "))
+		fmt.Fprintln(w)
+	}
+	if t.DefaultsFile != "" {
+		fmt.Fprintln(w, "Defaults-File:", t.DefaultsFile)
 		fmt.Fprintln(w)
 	}
 	fmt.Fprintln(w, "Run:", t.RequiredBehaviour)
 	if t.Interactive {
 		fmt.Fprintln(w, "Interactive: true")
 	}
+	if t.NoKillGroup {
+		fmt.Fprintln(w, "KillGroup: false")
+	}
+	if t.StdinEOFTimeout > 0 {
+		fmt.Fprintln(w, "Stdin-EOF-Timeout:", t.StdinEOFTimeout)
+	}
+	if t.StdinEnv != "" {
+		fmt.Fprintln(w, "Stdin-Env:", t.StdinEnv)
+	}
+	if t.StdinLog != "" {
+		fmt.Fprintln(w, "Stdin-Log:", t.StdinLog)
+	}
+	if t.RequiresDocker {
+		fmt.Fprintln(w, "Requires-Docker: true")
+	}
+	if t.Test {
+		fmt.Fprintln(w, "Test: true")
+	}
+	if t.MaxOpenFiles > 0 {
+		fmt.Fprintln(w, "Max-Open-Files:", t.MaxOpenFiles)
+	}
+	if t.Hostname != "" {
+		fmt.Fprintln(w, "Hostname:", t.Hostname)
+	}
+	if t.PreserveMtime {
+		fmt.Fprintln(w, "Preserve-Mtime: true")
+	}
+	if t.Tmpfs {
+		fmt.Fprintln(w, "Tmpfs: true")
+	}
+	if t.AllowEmpty {
+		fmt.Fprintln(w, "Allow-Empty: true")
+	}
+	if t.CreateDir {
+		fmt.Fprintln(w, "Create-Dir: true")
+	}
+	if t.OutputLines != nil {
+		fmt.Fprintln(w, t.OutputLines)
+	}
+	if t.OutputFilter != "" {
+		fmt.Fprintln(w, "Output-Filter:", t.OutputFilter)
+	}
+	if t.FailOnStderr {
+		fmt.Fprintln(w, "Fail-On-Stderr: true")
+	}
+	if t.ExpectSilent {
+		fmt.Fprintln(w, "Expect-Silent: true")
+	}
+	if t.ContinueOnError {
+		fmt.Fprintln(w, "Continue-On-Error: true")
+	}
+	if len(t.Tags) > 0 {
+		fmt.Fprintln(w, "Tags:", strings.Join(t.Tags, ", "))
+	}
+	if len(t.Platforms) > 0 {
+		fmt.Fprintln(w, "Platform:", strings.Join(t.Platforms, ", "))
+	}
+	if len(t.Watch) > 0 {
+		fmt.Fprintln(w, "Watch:", strings.Join(t.Watch, ", "))
+	}
+	if t.MaxRestarts > 0 {
+		fmt.Fprintln(w, "Max-Restarts:", t.MaxRestarts)
+	}
+	if len(t.EnvFiles) > 0 {
+		fmt.Fprintln(w, "Env-Files:", strings.Join(t.EnvFiles, ", "))
+	}
+	if t.CleanupEnvFiles != EnvFileCleanupNever {
+		fmt.Fprintln(w, "Cleanup-Env-File:", t.CleanupEnvFiles)
+	}
+	if len(t.EnvTypes) > 0 {
+		types := make([]string, 0, len(t.EnvTypes))
+		for name, ty := range t.EnvTypes {
+			types = append(types, name+"="+string(ty))
+		}
+		sort.Strings(types)
+		fmt.Fprintln(w, "Env-Types:", strings.Join(types, ", "))
+	}
+	if len(t.ExitCodes) > 0 {
+		codes := make([]int, 0, len(t.ExitCodes))
+		for code := range t.ExitCodes {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		meanings := make([]string, len(codes))
+		for i, code := range codes {
+			meanings[i] = fmt.Sprintf("%d=%s", code, t.ExitCodes[code])
+		}
+		fmt.Fprintln(w, "Exit-Codes:", strings.Join(meanings, ", "))
+	}
+	if t.NoInterpolate {
+		fmt.Fprintln(w, "No-Interpolate: true")
+	}
+	if t.Timeout == NoTimeout {
+		fmt.Fprintln(w, "Timeout: none")
+	} else if t.Timeout > 0 {
+		fmt.Fprintln(w, "Timeout:", t.Timeout)
+	}
+	if t.RetryCount > 0 {
+		fmt.Fprintln(w, "Retry:", t.RetryCount)
+	}
+	if t.RetryDelay > 0 {
+		fmt.Fprintln(w, "Retry-Delay:", t.RetryDelay)
+	}
+	if t.RetryBackoff != RetryBackoffDefault {
+		fmt.Fprintln(w, "Retry-Backoff:", t.RetryBackoff)
+	}
+	if t.RetryMaxDelay > 0 {
+		fmt.Fprintln(w, "Retry-Max-Delay:", t.RetryMaxDelay)
+	}
+	if t.Cleanup != "" {
+		fmt.Fprintln(w, "Cleanup:", t.Cleanup)
+	}
+	if t.DynamicEnv != "" {
+		fmt.Fprintln(w, "Dynamic-Env:", t.DynamicEnv)
+	}
+	if len(t.ComputedEnv) > 0 {
+		vars := make([]string, len(t.ComputedEnv))
+		for i, v := range t.ComputedEnv {
+			vars[i] = v.String()
+		}
+		fmt.Fprintln(w, "Computed-Env:", strings.Join(vars, ", "))
+	}
+	if len(t.Vars) > 0 {
+		fmt.Fprintln(w, "Vars:", strings.Join(t.Vars, ", "))
+	}
 	fmt.Fprintln(w)
-	if len(t.Script) > 0 {
-		fmt.Fprintln(w, "```")
-		fmt.Fprintln(w, t.Script)
+	for _, b := range t.Script {
+		fmt.Fprintln(w, "```"+b.Lang)
+		fmt.Fprint(w, b.Body)
 		fmt.Fprintln(w, "```")
 	}
 }
@@ -130,3 +476,376 @@ func ParseDepsBehaviour(s string) (DepsBehaviour, bool) {
 		return 0, false
 	}
 }
+
+// EnvFileCleanup is when the env files of a task are deleted once it has run.
+// The default is EnvFileCleanupNever.
+type EnvFileCleanup int
+
+const (
+	// EnvFileCleanupNever keeps the env files of the task.
+	EnvFileCleanupNever EnvFileCleanup = iota
+	// EnvFileCleanupAlways deletes the env files whether or not the task succeeds.
+	EnvFileCleanupAlways
+	// EnvFileCleanupOnSuccess deletes the env files only if the task succeeds.
+	EnvFileCleanupOnSuccess
+)
+
+func (c EnvFileCleanup) String() string {
+	switch c {
+	case EnvFileCleanupAlways:
+		return "true"
+	case EnvFileCleanupOnSuccess:
+		return "on-success"
+	default:
+		return "false"
+	}
+}
+
+// ParseEnvFileCleanup returns the EnvFileCleanup named s, which is true,
+// false or on-success, and false if there is none.
+func ParseEnvFileCleanup(s string) (EnvFileCleanup, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true":
+		return EnvFileCleanupAlways, true
+	case "false":
+		return EnvFileCleanupNever, true
+	case "on-success":
+		return EnvFileCleanupOnSuccess, true
+	default:
+		return 0, false
+	}
+}
+
+// ScriptMode is how a script is passed to an interpreter other than the
+// built-in shell. The default is ScriptModeFile.
+type ScriptMode string
+
+// The ScriptModes which scripts can be passed with.
+const (
+	// ScriptModeFile writes the script to a temporary file whose path is
+	// passed to the interpreter.
+	ScriptModeFile ScriptMode = "file"
+	// ScriptModeStdin writes the script to the stdin of the interpreter.
+	ScriptModeStdin ScriptMode = "stdin"
+	// ScriptModeHeredoc passes the script to the interpreter with -c.
+	ScriptModeHeredoc ScriptMode = "heredoc"
+)
+
+// ParseScriptMode returns the ScriptMode named s, and false if there is none.
+func ParseScriptMode(s string) (ScriptMode, bool) {
+	switch m := ScriptMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case ScriptModeFile, ScriptModeStdin, ScriptModeHeredoc:
+		return m, true
+	default:
+		return "", false
+	}
+}
+
+// EnvType is a type which the value of an environment variable must have.
+type EnvType string
+
+// The EnvTypes which can be required of environment variables.
+const (
+	EnvTypeInt    EnvType = "int"
+	EnvTypeBool   EnvType = "bool"
+	EnvTypeFloat  EnvType = "float"
+	EnvTypeURL    EnvType = "url"
+	EnvTypeSemver EnvType = "semver"
+)
+
+// ParseEnvType returns the EnvType named s, and false if there is none.
+func ParseEnvType(s string) (EnvType, bool) {
+	switch t := EnvType(strings.ToLower(s)); t {
+	case EnvTypeInt, EnvTypeBool, EnvTypeFloat, EnvTypeURL, EnvTypeSemver:
+		return t, true
+	default:
+		return "", false
+	}
+}
+
+// ExitCodeMeaning is how an exit code of a task is treated, instead of as a failure.
+type ExitCodeMeaning string
+
+// The ExitCodeMeanings which exit codes can be given.
+const (
+	// ExitCodeWarning is logged, but the task succeeds.
+	ExitCodeWarning ExitCodeMeaning = "warning"
+	// ExitCodeCancelled is treated as if xc was interrupted.
+	ExitCodeCancelled ExitCodeMeaning = "cancelled"
+)
+
+// ParseExitCodeMeaning returns the ExitCodeMeaning named s, and false if there is none.
+func ParseExitCodeMeaning(s string) (ExitCodeMeaning, bool) {
+	switch m := ExitCodeMeaning(strings.ToLower(s)); m {
+	case ExitCodeWarning, ExitCodeCancelled:
+		return m, true
+	default:
+		return "", false
+	}
+}
+
+// ParseExitCodes parses exit code meanings of the form 2=warning, 130=cancelled.
+func ParseExitCodes(s string) (map[int]ExitCodeMeaning, error) {
+	codes := map[int]ExitCodeMeaning{}
+	for _, v := range strings.Split(s, ",") {
+		code, name, _ := strings.Cut(strings.TrimSpace(v), "=")
+		n, err := strconv.Atoi(strings.TrimSpace(code))
+		m, ok := ParseExitCodeMeaning(strings.TrimSpace(name))
+		if err != nil || n < 0 || n > 255 || !ok {
+			return nil, fmt.Errorf("invalid exit code meaning %q, should be CODE=(warning, cancelled)", strings.TrimSpace(v))
+		}
+		codes[n] = m
+	}
+	return codes, nil
+}
+
+// Input is a named input of a task.
+type Input struct {
+	Name string
+	// Default is the value of the input when it is not given as an argument
+	// or in the environment. An input without a default is required.
+	Default string
+	// HasDefault is true if the input has a default, even if it is empty,
+	// such as NAME=.
+	HasDefault bool
+}
+
+// ParseInput parses an input of the form NAME or NAME=default.
+// NAME= has the empty default, where NAME has none and is required.
+func ParseInput(s string) Input {
+	name, def, ok := strings.Cut(s, "=")
+	return Input{Name: strings.TrimSpace(name), Default: strings.TrimSpace(def), HasDefault: ok}
+}
+
+// Required reports whether the input has no default, so must be given.
+func (i Input) Required() bool {
+	return !i.HasDefault && i.Default == ""
+}
+
+func (i Input) String() string {
+	if i.Required() {
+		return i.Name
+	}
+	return i.Name + "=" + i.Default
+}
+
+// knownPlatforms are the operating systems Go can build for.
+var knownPlatforms = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true,
+	"illumos": true, "ios": true, "js": true, "linux": true, "netbsd": true,
+	"openbsd": true, "plan9": true, "solaris": true, "wasip1": true, "windows": true,
+}
+
+// ParsePlatform returns the lowercase operating system named s, and false if
+// it is not one which Go builds for, such as linux, darwin or windows.
+func ParsePlatform(s string) (string, bool) {
+	p := strings.ToLower(strings.TrimSpace(s))
+	return p, knownPlatforms[p]
+}
+
+// ComputedVar is an environment variable whose value is the trimmed stdout
+// of a shell command.
+type ComputedVar struct {
+	Name    string
+	Command string
+}
+
+func (v ComputedVar) String() string {
+	return fmt.Sprintf("%s=$(%s)", v.Name, v.Command)
+}
+
+// ParseComputedVar parses a variable of the form NAME=$(command), or NAME=command.
+func ParseComputedVar(s string) (ComputedVar, error) {
+	name, cmd, ok := strings.Cut(s, "=")
+	name, cmd = strings.TrimSpace(name), strings.TrimSpace(cmd)
+	if strings.HasPrefix(cmd, "$(") && strings.HasSuffix(cmd, ")") {
+		cmd = strings.TrimSpace(cmd[2 : len(cmd)-1])
+	}
+	if !ok || name == "" || strings.ContainsAny(name, " \t$") || cmd == "" {
+		return ComputedVar{}, fmt.Errorf("invalid computed variable %q, should be NAME=$(command)", strings.TrimSpace(s))
+	}
+	return ComputedVar{Name: name, Command: cmd}, nil
+}
+
+// ParseComputedEnv parses a list of variables of the form
+// NAME=$(command), NAME=$(command). Commas inside $(...) do not separate variables.
+func ParseComputedEnv(s string) ([]ComputedVar, error) {
+	var vars []ComputedVar
+	for _, part := range SplitOutsideParens(s) {
+		v, err := ParseComputedVar(part)
+		if err != nil {
+			return nil, err
+		}
+		vars = append(vars, v)
+	}
+	return vars, nil
+}
+
+// ParseVars parses a list of variables of the form NAME=value, NAME=value,
+// splitting each on its first = and keeping the value as it is written.
+// Commas inside $(...) do not separate variables.
+func ParseVars(s string) ([]string, error) {
+	var vars []string
+	for _, part := range SplitOutsideParens(s) {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || name == "" || strings.ContainsAny(name, " \t$") {
+			return nil, fmt.Errorf("invalid variable %q, should be NAME=value", strings.TrimSpace(part))
+		}
+		vars = append(vars, name+"="+strings.TrimSpace(value))
+	}
+	return vars, nil
+}
+
+// TaskRef is a task required by another, with the arguments it is run with.
+type TaskRef struct {
+	Name string
+	// Args are the inputs of the task, in order, or as NAME=value to set an
+	// input by name.
+	Args []string
+}
+
+func (r TaskRef) String() string {
+	if len(r.Args) == 0 {
+		return r.Name
+	}
+	return r.Name + "(" + strings.Join(r.Args, ", ") + ")"
+}
+
+// ParseTaskRef parses a required task of the form name(arg, NAME=value), or
+// name arg NAME=value, where the arguments are split like a shell would.
+// If the arguments cannot be split the returned TaskRef still has the name.
+func ParseTaskRef(s string) (TaskRef, error) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '('); i > 0 && strings.HasSuffix(s, ")") && !strings.ContainsAny(s[:i], " \t") {
+		ref := TaskRef{Name: s[:i]}
+		args := strings.TrimSpace(s[i+1 : len(s)-1])
+		if args == "" {
+			return ref, nil
+		}
+		for _, a := range SplitOutsideParens(args) {
+			a = strings.TrimSpace(a)
+			if a == "" {
+				return ref, fmt.Errorf("invalid task %q, has an empty argument", s)
+			}
+			ref.Args = append(ref.Args, a)
+		}
+		return ref, nil
+	}
+	name, _, _ := strings.Cut(s, " ")
+	parts, err := shlex.Split(s)
+	if err != nil {
+		return TaskRef{Name: name}, fmt.Errorf("invalid task %q: %w", s, err)
+	}
+	if len(parts) == 0 {
+		return TaskRef{}, fmt.Errorf("invalid task %q, has no name", s)
+	}
+	ref := TaskRef{Name: parts[0]}
+	if len(parts) > 1 {
+		ref.Args = parts[1:]
+	}
+	return ref, nil
+}
+
+// SplitOutsideParens splits s on the commas which are not inside parentheses.
+func SplitOutsideParens(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// ScriptBlock is a code block in the body of a task.
+type ScriptBlock struct {
+	// Body is the script, with a new line after each line.
+	Body string
+	// Lang is the language hint after the opening fence, e.g. sh, if any.
+	Lang string
+}
+
+// OutputLines limits the output of a task shown in the terminal to its first
+// or last N lines. If N is 0 no output is shown.
+type OutputLines struct {
+	// Head shows the first N lines, rather than the last.
+	Head bool
+	N    int
+}
+
+// String returns the attribute which sets o, e.g. Output-Tail: 20.
+func (o OutputLines) String() string {
+	if o.Head {
+		return fmt.Sprintf("Output-Head: %d", o.N)
+	}
+	return fmt.Sprintf("Output-Tail: %d", o.N)
+}
+
+// RetryBackoff represents how the wait between retries of a task grows.
+// The default is RetryBackoffDefault, which uses the backoff of the runner.
+type RetryBackoff int
+
+const (
+	// RetryBackoffDefault should be used if the task does not set a backoff.
+	RetryBackoffDefault RetryBackoff = iota
+	// RetryBackoffConstant waits the retry delay before every retry.
+	RetryBackoffConstant
+	// RetryBackoffLinear waits N times the retry delay before retry N.
+	RetryBackoffLinear
+	// RetryBackoffExponential doubles the wait before each retry.
+	RetryBackoffExponential
+)
+
+func (b RetryBackoff) String() string {
+	switch b {
+	case RetryBackoffConstant:
+		return "constant"
+	case RetryBackoffLinear:
+		return "linear"
+	case RetryBackoffExponential:
+		return "exponential"
+	default:
+		return "default"
+	}
+}
+
+// Delay returns the wait before retry n, counting from 1, given the delay before
+// the first retry. The wait is capped at maxDelay if it is greater than 0.
+// RetryBackoffDefault waits a constant delay.
+func (b RetryBackoff) Delay(n int, delay, maxDelay time.Duration) time.Duration {
+	d := delay
+	switch b {
+	case RetryBackoffLinear:
+		d = delay * time.Duration(n)
+	case RetryBackoffExponential:
+		for i := 1; i < n && (maxDelay <= 0 || d < maxDelay) && d < math.MaxInt64/2; i++ {
+			d *= 2
+		}
+	}
+	if maxDelay > 0 && d > maxDelay {
+		d = maxDelay
+	}
+	return d
+}
+
+func ParseRetryBackoff(s string) (RetryBackoff, bool) {
+	switch strings.ToLower(s) {
+	case "constant":
+		return RetryBackoffConstant, true
+	case "linear":
+		return RetryBackoffLinear, true
+	case "exponential":
+		return RetryBackoffExponential, true
+	default:
+		return 0, false
+	}
+}
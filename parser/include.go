@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joerdav/xc/models"
+)
+
+// parseInclude records the file named by the current line if it is an
+// include line, such as `include: backend/README.md`.
+func (p *parser) parseInclude() {
+	a, rest, found := strings.Cut(p.currentLine, ":")
+	if !found || !strings.EqualFold(strings.Trim(a, trimValues), "include") {
+		return
+	}
+	if path := strings.Trim(rest, trimValues); path != "" {
+		p.includes = append(p.includes, path)
+	}
+}
+
+// Includes returns the files named by include lines between the heading of
+// the block of tasks and its first task, as they were written.
+func (p *parser) Includes() []string {
+	return p.includes
+}
+
+// ParseWithIncludes parses the block of tasks under heading in the markdown
+// file at rootPath, and the same block in every file it includes, resolved
+// relative to the directory of the file which includes it.
+// The directory of each included task is made relative to the directory of
+// rootPath, so it runs where it would if its own file was parsed.
+// A file included more than once is parsed once. Including a file which
+// includes it, or a task with the same name as another, is an error.
+func ParseWithIncludes(rootPath, heading string, opts ...ParserOption) (models.Tasks, error) {
+	root, err := filepath.Abs(rootPath)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		tasks  models.Tasks
+		source = map[string]string{}
+		parsed = map[string]bool{}
+	)
+	var include func(path string, stack []string) error
+	include = func(path string, stack []string) error {
+		for i, s := range stack {
+			if s == path {
+				return parseErrorf(0, "", "circular include: %s", strings.Join(append(relPaths(root, stack[i:]), relPath(root, path)), " → "))
+			}
+		}
+		if parsed[path] {
+			return nil
+		}
+		parsed[path] = true
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		p, err := NewParserWithOptions(f, heading, opts...)
+		if err != nil {
+			return err
+		}
+		fileTasks, err := p.Parse()
+		if err != nil && !errors.Is(err, ErrCircularDependency) && !errors.Is(err, ErrCircularInherit) {
+			return err
+		}
+		if p.warn != nil {
+			for _, w := range p.Warnings() {
+				p.warn(w)
+			}
+		}
+		dir, err := filepath.Rel(filepath.Dir(root), filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		for _, t := range fileTasks {
+			if existing, ok := tasks.Get(t.Name); ok {
+				return parseErrorf(0, t.Name, "task %s in %s is already defined in %s", t.Name, relPath(root, path), source[strings.ToLower(existing.Name)])
+			}
+			if dir != "." && !filepath.IsAbs(t.Dir) {
+				t.Dir = filepath.Join(dir, t.Dir)
+			}
+			source[strings.ToLower(t.Name)] = relPath(root, path)
+			tasks = append(tasks, t)
+		}
+		for _, inc := range p.Includes() {
+			next := inc
+			if !filepath.IsAbs(next) {
+				next = filepath.Join(filepath.Dir(path), next)
+			}
+			if err := include(filepath.Clean(next), append(stack, path)); err != nil {
+				var parseErr *ParseError
+				if errors.As(err, &parseErr) {
+					return fmt.Errorf("include %s: %w", inc, err)
+				}
+				// not wrapped, so a missing file or heading is not mistaken for one in rootPath
+				return parseErrorf(0, "", "include %s: %v", inc, err)
+			}
+		}
+		return nil
+	}
+	if err := include(root, nil); err != nil {
+		return nil, err
+	}
+	return tasks, ValidateDependencies(tasks)
+}
+
+func relPath(root, path string) string {
+	if rel, err := filepath.Rel(filepath.Dir(root), path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+func relPaths(root string, paths []string) []string {
+	rel := make([]string, len(paths))
+	for i, p := range paths {
+		rel[i] = relPath(root, p)
+	}
+	return rel
+}
@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeMarkdown(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseWithIncludes(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       map[string]string
+		expectTasks string
+		expectDirs  string
+		expectErr   string
+	}{
+		{
+			name: "given includes, should merge the tasks of every file",
+			files: map[string]string{
+				"README.md":          "## Tasks\ninclude: backend/README.md\ninclude: `frontend/README.md`\n### build\nrequires: api, web\n```\nmake\n```\n",
+				"backend/README.md":  "# Backend\n## Tasks\ninclude: ../shared/README.md\n### api\ndir: cmd\n```\ngo build\n```\n",
+				"frontend/README.md": "## Tasks\ninclude: ../shared/README.md\n### web\n```\nnpm run build\n```\n",
+				"shared/README.md":   "## Tasks\n### lint\n```\nlint\n```\n",
+			},
+			expectTasks: "build,api,lint,web",
+			expectDirs:  ",backend/cmd,shared,frontend",
+		},
+		{
+			name: "given a circular include, should error",
+			files: map[string]string{
+				"README.md": "## Tasks\ninclude: a.md\n### build\n```\nmake\n```\n",
+				"a.md":      "## Tasks\ninclude: README.md\n### a\n```\na\n```\n",
+			},
+			expectErr: "circular include: README.md → a.md → README.md",
+		},
+		{
+			name: "given a task defined in two files, should error",
+			files: map[string]string{
+				"README.md": "## Tasks\ninclude: a.md\n### Build\n```\nmake\n```\n",
+				"a.md":      "## Tasks\n### build\n```\nmake\n```\n",
+			},
+			expectErr: "task build in a.md is already defined in README.md",
+		},
+		{
+			name: "given an included file without a tasks heading, should error",
+			files: map[string]string{
+				"README.md": "## Tasks\ninclude: a.md\n### build\n```\nmake\n```\n",
+				"a.md":      "# Notes\n",
+			},
+			expectErr: "include a.md: no xc block found",
+		},
+		{
+			name: "given a missing included file, should error",
+			files: map[string]string{
+				"README.md": "## Tasks\ninclude: missing.md\n### build\n```\nmake\n```\n",
+			},
+			expectErr: "include missing.md:",
+		},
+		{
+			name: "given requirements which form a cycle across files, should error",
+			files: map[string]string{
+				"README.md": "## Tasks\ninclude: a.md\n### build\nrequires: a\n```\nmake\n```\n",
+				"a.md":      "## Tasks\n### a\nrequires: build\n```\na\n```\n",
+			},
+			expectErr: "circular dependency detected: build → a → build",
+		},
+		{
+			name: "given an invalid attribute in an included file, should give its line",
+			files: map[string]string{
+				"README.md": "## Tasks\ninclude: a.md\n### build\n```\nmake\n```\n",
+				"a.md":      "## Tasks\n### a\nrun: never\n```\na\n```\n",
+			},
+			expectErr: "include a.md: line 3: run contains invalid behaviour",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				writeMarkdown(t, filepath.Join(dir, name), content)
+			}
+			tasks, err := ParseWithIncludes(filepath.Join(dir, "README.md"), "Tasks")
+			if tt.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+					t.Fatalf("expected error %q, got %v", tt.expectErr, err)
+				}
+				if errors.Is(err, ErrNoTasksHeading) || errors.Is(err, os.ErrNotExist) {
+					t.Fatalf("expected an error in an included file not to match the errors of the root file, got %v", err)
+				}
+				var parseErr *ParseError
+				if !errors.As(err, &parseErr) {
+					t.Fatalf("expected a ParseError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names, dirs []string
+			for _, task := range tasks {
+				names = append(names, task.Name)
+				dirs = append(dirs, filepath.ToSlash(task.Dir))
+			}
+			if got := strings.Join(names, ","); got != tt.expectTasks {
+				t.Errorf("tasks=%s, want %s", got, tt.expectTasks)
+			}
+			if got := strings.Join(dirs, ","); got != tt.expectDirs {
+				t.Errorf("dirs=%s, want %s", got, tt.expectDirs)
+			}
+		})
+	}
+}
@@ -2,10 +2,16 @@ package parser
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joerdav/xc/models"
 )
@@ -13,6 +19,53 @@ import (
 // ErrNoTasksHeading is returned if the markdown contains no xc block
 var ErrNoTasksHeading = errors.New("no xc block found")
 
+// ErrCircularDependency is returned if the required tasks of a task form a cycle.
+var ErrCircularDependency = errors.New("circular dependency detected")
+
+// ErrCircularInherit is returned if the inherited tasks of a task form a cycle.
+var ErrCircularInherit = errors.New("circular inherit detected")
+
+// ParseError is an error in the markdown of a task, with the line of the file
+// it was found on, such as an attribute with an invalid value.
+type ParseError struct {
+	// Line is the line of the file, starting at 1, or 0 if the error is not
+	// on one line, such as required tasks which form a cycle.
+	Line int
+	// TaskName is the name of the task being parsed, if any.
+	TaskName string
+	Message  string
+	// err is the error which caused it, if any.
+	err error
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.err
+}
+
+// parseErrorf returns a ParseError in task at line, formatting its message as
+// fmt.Errorf does, so it unwraps to any error given with %w.
+func parseErrorf(line int, task, format string, a ...any) *ParseError {
+	err := fmt.Errorf(format, a...)
+	return &ParseError{Line: line, TaskName: task, Message: err.Error(), err: errors.Unwrap(err)}
+}
+
+// errorAt returns a ParseError in the current task at line.
+func (p *parser) errorAt(line int, format string, a ...any) *ParseError {
+	return parseErrorf(line, p.currTask.Name, format, a...)
+}
+
+// errorf returns a ParseError at the current line.
+func (p *parser) errorf(format string, a ...any) *ParseError {
+	return p.errorAt(p.line, format, a...)
+}
+
 const (
 	trimValues       = "_*` "
 	codeBlockStarter = "```"
@@ -25,6 +78,64 @@ type parser struct {
 	rootHeadingLevel      int
 	nextLine, currentLine string
 	reachedEnd            bool
+	allowEmpty            bool
+	warnings              []string
+	maxLineSize           int
+	// line is the line of the file, starting at 1, of currentLine, and
+	// scanned is the number of lines read so far.
+	line, scanned int
+	// taskLine is the line of the heading of currTask.
+	taskLine int
+	// taskLines are the lines of the headings of tasks, by lowercase name.
+	taskLines map[string]int
+	// includes are the files named by include lines before the first task.
+	includes []string
+	// warn is called with each warning once a file is parsed by ParseWithIncludes.
+	warn func(string)
+	// scanErr is the error which stopped the scanner, if any.
+	scanErr error
+}
+
+// DefaultMaxLineSize is the longest line, in bytes, which a parser reads
+// unless WithMaxLineSize is given.
+const DefaultMaxLineSize = 1024 * 1024
+
+// ParserOption configures a parser created by NewParserWithOptions.
+type ParserOption func(*parser)
+
+// WithMaxLineSize sets the longest line, in bytes, which the parser reads,
+// such as a line of minified JSON in a script. Longer lines are an error.
+func WithMaxLineSize(n int) ParserOption {
+	return func(p *parser) {
+		p.maxLineSize = n
+	}
+}
+
+// WithAllowEmpty permits tasks with no script and no required tasks, as if
+// they all had the allow-empty attribute, like AllowEmpty.
+func WithAllowEmpty(allow bool) ParserOption {
+	return func(p *parser) {
+		p.allowEmpty = allow
+	}
+}
+
+// WithWarnings calls warn with each problem found by ParseWithIncludes
+// which did not stop it, as returned by Warnings.
+func WithWarnings(warn func(string)) ParserOption {
+	return func(p *parser) {
+		p.warn = warn
+	}
+}
+
+// AllowEmpty permits tasks with no script and no required tasks, as if they
+// all had the allow-empty attribute.
+func (p *parser) AllowEmpty(allow bool) {
+	p.allowEmpty = allow
+}
+
+// Warnings returns problems found while parsing which did not stop it.
+func (p *parser) Warnings() []string {
+	return p.warnings
 }
 
 func (p *parser) Parse() (tasks models.Tasks, err error) {
@@ -35,24 +146,52 @@ func (p *parser) Parse() (tasks models.Tasks, err error) {
 			break
 		}
 	}
+	if p.scanErr != nil {
+		// any other error is likely caused by the rest of the file being missing
+		err = p.errorAt(p.scanned+1, "failed to read file: %w", p.scanErr)
+	}
+	if err == nil {
+		err = ValidateDependencies(p.tasks)
+		var parseErr *ParseError
+		if errors.As(err, &parseErr) {
+			parseErr.Line = p.taskLines[strings.ToLower(parseErr.TaskName)]
+		}
+	}
 	tasks = p.tasks
 	return
 }
 
 func (p *parser) scan() bool {
-	p.currentLine = p.nextLine
+	p.currentLine, p.line = p.nextLine, p.scanned
 	if p.reachedEnd {
 		return false
 	}
 	if !p.scanner.Scan() {
 		p.reachedEnd = true
 		p.nextLine = ""
+		if err := p.scanner.Err(); errors.Is(err, bufio.ErrTooLong) {
+			p.scanErr = fmt.Errorf("a line is longer than the maximum of %d bytes: %w", p.maxLineSize, err)
+		} else if err != nil {
+			p.scanErr = err
+		}
 		return true
 	}
 	p.nextLine = p.scanner.Text()
+	p.scanned++
 	return true
 }
 
+// trimName returns the name of a task without markdown formatting.
+// A leading underscore is kept unless it is closed by a trailing one, as
+// emphasis, because it marks a hidden task.
+func trimName(s string) string {
+	name := strings.Trim(s, trimValues)
+	if t := strings.Trim(s, "*` "); strings.HasPrefix(t, "_") && !strings.HasSuffix(t, "_") {
+		return "_" + name
+	}
+	return name
+}
+
 func stringOnlyContains(input string, matcher rune) bool {
 	if len(input) == 0 {
 		return false
@@ -139,20 +278,182 @@ const (
 	// if it is, then logs are not prefixed and the stdout/stderr are passed directly
 	// from the OS
 	AttributeTypeInteractive
+	// AttributeTypeKillGroup can be set to false to stop xc from killing the
+	// process group of a task when it fails or is cancelled.
+	AttributeTypeKillGroup
+	// AttributeTypeStdinEOFTimeout closes the stdin of a task once no input has
+	// been received for the given duration, e.g. `5s`.
+	AttributeTypeStdinEOFTimeout
+	// AttributeTypeRequiresDocker indicates that a task needs the Docker daemon,
+	// xc checks that it is accessible before running anything.
+	AttributeTypeRequiresDocker
+	// AttributeTypeInherit sets a task whose environment variables and directory
+	// are applied to this task, without running its script.
+	AttributeTypeInherit
+	// AttributeTypeCleanup sets a script which is run when the task is cancelled.
+	AttributeTypeCleanup
+	// AttributeTypeValidateInputs sets a script which checks the inputs of a task
+	// before it runs.
+	AttributeTypeValidateInputs
+	// AttributeTypeTest marks a task as a test, run by `xc -test`.
+	AttributeTypeTest
+	// AttributeTypeMaxOpenFiles limits the number of files a task can open.
+	AttributeTypeMaxOpenFiles
+	// AttributeTypeHostname sets the hostname seen by the commands of a task.
+	AttributeTypeHostname
+	// AttributeTypePreserveMtime restores the modification times of files which
+	// a task touches without changing.
+	AttributeTypePreserveMtime
+	// AttributeTypeRetry sets the number of times a failed task is run again.
+	AttributeTypeRetry
+	// AttributeTypeRetryDelay sets the wait before the first retry of a task, e.g. `1s`.
+	AttributeTypeRetryDelay
+	// AttributeTypeRetryBackoff sets how the wait between retries grows,
+	// one of constant, linear or exponential.
+	AttributeTypeRetryBackoff
+	// AttributeTypeRetryMaxDelay caps the wait between retries, e.g. `60s`.
+	AttributeTypeRetryMaxDelay
+	// AttributeTypeStdinEnv sets an environment variable whose value is the stdin of a task.
+	AttributeTypeStdinEnv
+	// AttributeTypeTmpfs runs a task in a memory-backed copy of its directory.
+	AttributeTypeTmpfs
+	// AttributeTypeTimeout stops a task once it has run for the given duration,
+	// e.g. `5m`, or runs it without the default timeout if `none`.
+	AttributeTypeTimeout
+	// AttributeTypeOutputs sets files which must exist once a task has succeeded.
+	AttributeTypeOutputs
+	// AttributeTypeNoInterpolate runs the script of a task verbatim, even
+	// with `xc -task-script-interpolate-from-env`.
+	AttributeTypeNoInterpolate
+	// AttributeTypeAllowEmpty permits a task with no script and no required tasks.
+	AttributeTypeAllowEmpty
+	// AttributeTypeCreateDir creates the directory of a task if it does not exist.
+	AttributeTypeCreateDir
+	// AttributeTypeOutputTail shows only the last N lines of the output of a task.
+	AttributeTypeOutputTail
+	// AttributeTypeOutputHead shows only the first N lines of the output of a task.
+	AttributeTypeOutputHead
+	// AttributeTypeEnvTypes sets the types which environment variables of a
+	// task must have, e.g. `PORT=int, ENABLED=bool`.
+	AttributeTypeEnvTypes
+	// AttributeTypeEnvFiles sets files of KEY=VALUE lines loaded into the environment of a task.
+	// It can be represented by an attribute with name `env-files` or `envfile`.
+	AttributeTypeEnvFiles
+	// AttributeTypeParallel runs the dependencies of a task concurrently,
+	// cancelling the rest on the first failure.
+	AttributeTypeParallel
+	// AttributeTypeTags sets the tags of a task.
+	AttributeTypeTags
+	// AttributeTypeFailOnStderr fails a task as soon as it writes to stderr.
+	AttributeTypeFailOnStderr
+	// AttributeTypeShell sets the interpreter which runs the script of a task.
+	AttributeTypeShell
+	// AttributeTypeExpectSilent fails a task if it writes any output.
+	AttributeTypeExpectSilent
+	// AttributeTypeDynamicEnv sets a script whose output of KEY=VALUE lines is
+	// added to the environment of a task.
+	AttributeTypeDynamicEnv
+	// AttributeTypeExitCodes changes the meaning of exit codes of a task,
+	// e.g. `2=warning, 130=cancelled`.
+	AttributeTypeExitCodes
+	// AttributeTypeStdinLog sets a file which the stdin of a task is copied to.
+	AttributeTypeStdinLog
+	// AttributeTypePlatform sets the operating systems a task runs on, e.g. `linux, darwin`.
+	AttributeTypePlatform
+	// AttributeTypeWatch sets glob patterns of files which cause a task to run
+	// again with xc -watch, e.g. `**/*.go, go.mod`.
+	AttributeTypeWatch
+	// AttributeTypeMaxRestarts limits how many times xc -watch runs a task again.
+	AttributeTypeMaxRestarts
+	// AttributeTypeComputedEnv sets variables to the output of commands, e.g.
+	// `PORT=$(find-free-port)`.
+	AttributeTypeComputedEnv
+	// AttributeTypeScriptMode sets how the script is passed to an interpreter,
+	// one of file, stdin or heredoc.
+	AttributeTypeScriptMode
+	// AttributeTypeVars sets variables of the task alone, e.g.
+	// `VERSION=1.2.3, YEAR=$(date +%Y)`.
+	AttributeTypeVars
+	// AttributeTypeOutputFilter pipes the output of a task through a command,
+	// e.g. `grep -v DEBUG`.
+	AttributeTypeOutputFilter
+	// AttributeTypeCleanupEnvFile deletes the env files of a task once it has
+	// run, one of true, false or on-success.
+	AttributeTypeCleanupEnvFile
+	// AttributeTypeContinueOnError logs a failure of a task instead of
+	// failing the tasks which require it.
+	AttributeTypeContinueOnError
+	// AttributeTypeExpandGlobInputs expands glob patterns in the values of
+	// inputs of a task, e.g. `FILES`.
+	AttributeTypeExpandGlobInputs
+	// AttributeTypeDefaultsFile sets a file of defaults for the inputs of a
+	// task, e.g. `.xc-defaults.env`.
+	AttributeTypeDefaultsFile
+	// AttributeTypeRequireFiles sets files which must exist before a task
+	// runs, e.g. `go.mod, go.sum`.
+	AttributeTypeRequireFiles
 )
 
 var attMap = map[string]AttributeType{
-	"req":             AttributeTypeReq,
-	"requires":        AttributeTypeReq,
-	"env":             AttributeTypeEnv,
-	"environment":     AttributeTypeEnv,
-	"dir":             AttributeTypeDir,
-	"directory":       AttributeTypeDir,
-	"inputs":          AttributeTypeInp,
-	"run":             AttributeTypeRun,
-	"rundeps":         AttributeTypeRunDeps,
-	"rundependencies": AttributeTypeRunDeps,
-	"interactive":     AttributeTypeInteractive,
+	"req":                AttributeTypeReq,
+	"requires":           AttributeTypeReq,
+	"env":                AttributeTypeEnv,
+	"environment":        AttributeTypeEnv,
+	"dir":                AttributeTypeDir,
+	"directory":          AttributeTypeDir,
+	"inputs":             AttributeTypeInp,
+	"run":                AttributeTypeRun,
+	"rundeps":            AttributeTypeRunDeps,
+	"rundependencies":    AttributeTypeRunDeps,
+	"interactive":        AttributeTypeInteractive,
+	"kill-group":         AttributeTypeKillGroup,
+	"killgroup":          AttributeTypeKillGroup,
+	"stdin-eof-timeout":  AttributeTypeStdinEOFTimeout,
+	"requires-docker":    AttributeTypeRequiresDocker,
+	"inherit":            AttributeTypeInherit,
+	"cleanup":            AttributeTypeCleanup,
+	"validate-inputs":    AttributeTypeValidateInputs,
+	"test":               AttributeTypeTest,
+	"max-open-files":     AttributeTypeMaxOpenFiles,
+	"hostname":           AttributeTypeHostname,
+	"preserve-mtime":     AttributeTypePreserveMtime,
+	"retry":              AttributeTypeRetry,
+	"retry-delay":        AttributeTypeRetryDelay,
+	"retry-backoff":      AttributeTypeRetryBackoff,
+	"retry-max-delay":    AttributeTypeRetryMaxDelay,
+	"stdin-env":          AttributeTypeStdinEnv,
+	"tmpfs":              AttributeTypeTmpfs,
+	"timeout":            AttributeTypeTimeout,
+	"outputs":            AttributeTypeOutputs,
+	"no-interpolate":     AttributeTypeNoInterpolate,
+	"allow-empty":        AttributeTypeAllowEmpty,
+	"create-dir":         AttributeTypeCreateDir,
+	"output-tail":        AttributeTypeOutputTail,
+	"output-head":        AttributeTypeOutputHead,
+	"env-types":          AttributeTypeEnvTypes,
+	"env-files":          AttributeTypeEnvFiles,
+	"envfile":            AttributeTypeEnvFiles,
+	"env-file":           AttributeTypeEnvFiles,
+	"parallel":           AttributeTypeParallel,
+	"tags":               AttributeTypeTags,
+	"fail-on-stderr":     AttributeTypeFailOnStderr,
+	"shell":              AttributeTypeShell,
+	"expect-silent":      AttributeTypeExpectSilent,
+	"dynamic-env":        AttributeTypeDynamicEnv,
+	"exit-codes":         AttributeTypeExitCodes,
+	"stdin-log":          AttributeTypeStdinLog,
+	"platform":           AttributeTypePlatform,
+	"watch":              AttributeTypeWatch,
+	"max-restarts":       AttributeTypeMaxRestarts,
+	"computed-env":       AttributeTypeComputedEnv,
+	"script-mode":        AttributeTypeScriptMode,
+	"vars":               AttributeTypeVars,
+	"output-filter":      AttributeTypeOutputFilter,
+	"cleanup-env-file":   AttributeTypeCleanupEnvFile,
+	"continue-on-error":  AttributeTypeContinueOnError,
+	"expand-glob-inputs": AttributeTypeExpandGlobInputs,
+	"defaults-file":      AttributeTypeDefaultsFile,
+	"require-files":      AttributeTypeRequireFiles,
 }
 
 func (p *parser) parseAttribute() (bool, error) {
@@ -168,12 +469,119 @@ func (p *parser) parseAttribute() (bool, error) {
 	case AttributeTypeInp:
 		vs := strings.Split(rest, ",")
 		for _, v := range vs {
-			p.currTask.Inputs = append(p.currTask.Inputs, strings.Trim(v, trimValues))
+			p.currTask.Inputs = append(p.currTask.Inputs, models.ParseInput(strings.Trim(v, trimValues)))
 		}
-	case AttributeTypeReq:
+	case AttributeTypeOutputs:
 		vs := strings.Split(rest, ",")
 		for _, v := range vs {
-			p.currTask.DependsOn = append(p.currTask.DependsOn, strings.Trim(v, trimValues))
+			p.currTask.Outputs = append(p.currTask.Outputs, strings.Trim(v, trimValues))
+		}
+	case AttributeTypeEnvTypes:
+		if p.currTask.EnvTypes == nil {
+			p.currTask.EnvTypes = map[string]models.EnvType{}
+		}
+		for _, v := range strings.Split(rest, ",") {
+			name, s, _ := strings.Cut(strings.Trim(v, trimValues), "=")
+			ty, ok := models.ParseEnvType(strings.TrimSpace(s))
+			if name = strings.TrimSpace(name); name == "" || !ok {
+				return false, p.errorf("env-types contains invalid type %q, should be NAME=(int, bool, float, url, semver): %s", strings.Trim(v, trimValues), p.currTask.Name)
+			}
+			p.currTask.EnvTypes[name] = ty
+		}
+	case AttributeTypeExitCodes:
+		codes, err := models.ParseExitCodes(strings.Trim(rest, trimValues))
+		if err != nil {
+			return false, p.errorf("invalid exit-codes of task %s: %w", p.currTask.Name, err)
+		}
+		if p.currTask.ExitCodes == nil {
+			p.currTask.ExitCodes = map[int]models.ExitCodeMeaning{}
+		}
+		for code, m := range codes {
+			p.currTask.ExitCodes[code] = m
+		}
+	case AttributeTypeTags:
+		for _, v := range strings.Split(rest, ",") {
+			p.currTask.Tags = append(p.currTask.Tags, strings.Trim(v, trimValues))
+		}
+	case AttributeTypePlatform:
+		for _, v := range strings.Split(rest, ",") {
+			platform, ok := models.ParsePlatform(strings.Trim(v, trimValues))
+			if !ok {
+				return false, p.errorf("platform contains an unknown operating system %q, should be one of linux, darwin, windows or another GOOS: %s", strings.TrimSpace(v), p.currTask.Name)
+			}
+			p.currTask.Platforms = append(p.currTask.Platforms, platform)
+		}
+	case AttributeTypeWatch:
+		for _, v := range strings.Split(rest, ",") {
+			// * is part of the pattern, so is not trimmed as emphasis
+			pattern := strings.Trim(v, "` ")
+			if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+				return false, p.errorf("watch contains an invalid pattern %q: %s", pattern, p.currTask.Name)
+			}
+			p.currTask.Watch = append(p.currTask.Watch, pattern)
+		}
+	case AttributeTypeComputedEnv:
+		vars, err := models.ParseComputedEnv(strings.Trim(strings.TrimSpace(rest), "`"))
+		if err != nil {
+			return false, p.errorf("invalid computed-env of task %s: %w", p.currTask.Name, err)
+		}
+		p.currTask.ComputedEnv = append(p.currTask.ComputedEnv, vars...)
+	case AttributeTypeRequireFiles:
+		for _, v := range strings.Split(rest, ",") {
+			pattern := strings.Trim(v, trimValues)
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return false, p.errorf("require-files contains an invalid pattern %q: %s", pattern, p.currTask.Name)
+			}
+			p.currTask.RequireFiles = append(p.currTask.RequireFiles, pattern)
+		}
+	case AttributeTypeDefaultsFile:
+		if p.currTask.DefaultsFile != "" {
+			return false, p.errorf("defaults-file appears more than once for %s", p.currTask.Name)
+		}
+		p.currTask.DefaultsFile = strings.Trim(rest, trimValues)
+	case AttributeTypeExpandGlobInputs:
+		for _, v := range strings.Split(rest, ",") {
+			p.currTask.ExpandGlobInputs = append(p.currTask.ExpandGlobInputs, strings.Trim(v, trimValues))
+		}
+	case AttributeTypeContinueOnError:
+		s := strings.Trim(rest, trimValues)
+		p.currTask.ContinueOnError = s == "true"
+	case AttributeTypeCleanupEnvFile:
+		s := strings.Trim(rest, trimValues)
+		c, ok := models.ParseEnvFileCleanup(s)
+		if !ok {
+			return false, p.errorf("cleanup-env-file contains invalid value %q should be (true, false, on-success): %s", s, p.currTask.Name)
+		}
+		p.currTask.CleanupEnvFiles = c
+	case AttributeTypeOutputFilter:
+		if p.currTask.OutputFilter != "" {
+			return false, p.errorf("output-filter appears more than once for %s", p.currTask.Name)
+		}
+		p.currTask.OutputFilter = strings.Trim(strings.TrimSpace(rest), "`")
+	case AttributeTypeVars:
+		vars, err := models.ParseVars(strings.Trim(strings.TrimSpace(rest), "`"))
+		if err != nil {
+			return false, p.errorf("invalid vars of task %s: %w", p.currTask.Name, err)
+		}
+		p.currTask.Vars = append(p.currTask.Vars, vars...)
+	case AttributeTypeScriptMode:
+		s := strings.Trim(rest, trimValues)
+		m, ok := models.ParseScriptMode(s)
+		if !ok {
+			return false, p.errorf("script-mode contains invalid mode %q should be (file, stdin, heredoc): %s", s, p.currTask.Name)
+		}
+		p.currTask.ScriptMode = m
+	case AttributeTypeEnvFiles:
+		for _, v := range strings.Split(rest, ",") {
+			p.currTask.EnvFiles = append(p.currTask.EnvFiles, strings.Trim(v, trimValues))
+		}
+	case AttributeTypeReq:
+		for _, v := range models.SplitOutsideParens(rest) {
+			dep, err := models.ParseTaskRef(trimName(v))
+			if err != nil {
+				return false, p.errorf("invalid requires of task %s: %w", p.currTask.Name, err)
+			}
+			p.currTask.DependsOn = append(p.currTask.DependsOn, dep)
 		}
 	case AttributeTypeEnv:
 		vs := strings.Split(rest, ",")
@@ -182,40 +590,185 @@ func (p *parser) parseAttribute() (bool, error) {
 		}
 	case AttributeTypeDir:
 		if p.currTask.Dir != "" {
-			return false, fmt.Errorf("directory appears more than once for %s", p.currTask.Name)
+			return false, p.errorf("directory appears more than once for %s", p.currTask.Name)
+		}
+		p.currTask.Dir = p.expandPath(strings.Trim(rest, trimValues))
+	case AttributeTypeShell:
+		if p.currTask.Shell != "" {
+			return false, p.errorf("shell appears more than once for %s", p.currTask.Name)
 		}
 		s := strings.Trim(rest, trimValues)
-		p.currTask.Dir = s
+		p.currTask.Shell = s
 	case AttributeTypeRun:
 		s := strings.Trim(rest, trimValues)
 		r, ok := models.ParseRequiredBehaviour(s)
 		if !ok {
-			return false, fmt.Errorf("run contains invalid behaviour %q should be (always, once): %s", s, p.currTask.Name)
+			return false, p.errorf("run contains invalid behaviour %q should be (always, once): %s", s, p.currTask.Name)
 		}
 		p.currTask.RequiredBehaviour = r
+		p.currTask.RequiredBehaviourSet = true
 	case AttributeTypeRunDeps:
 		s := strings.Trim(rest, trimValues)
 		r, ok := models.ParseDepsBehaviour(s)
 		if !ok {
-			return false, fmt.Errorf("runDeps contains invalid behaviour %q should be (sync, async): %s", s, p.currTask.Name)
+			return false, p.errorf("runDeps contains invalid behaviour %q should be (sync, async): %s", s, p.currTask.Name)
 		}
 		p.currTask.DepsBehaviour = r
 	case AttributeTypeInteractive:
 		s := strings.Trim(rest, trimValues)
 		p.currTask.Interactive = s == "true"
+	case AttributeTypeKillGroup:
+		s := strings.Trim(rest, trimValues)
+		p.currTask.NoKillGroup = s == "false"
+	case AttributeTypeStdinEOFTimeout:
+		s := strings.Trim(rest, trimValues)
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return false, p.errorf("stdin-eof-timeout contains invalid duration %q: %s", s, p.currTask.Name)
+		}
+		p.currTask.StdinEOFTimeout = d
+	case AttributeTypeStdinLog:
+		if p.currTask.StdinLog != "" {
+			return false, p.errorf("stdin-log appears more than once for %s", p.currTask.Name)
+		}
+		p.currTask.StdinLog = strings.Trim(rest, trimValues)
+	case AttributeTypeStdinEnv:
+		if p.currTask.StdinEnv != "" {
+			return false, p.errorf("stdin-env appears more than once for %s", p.currTask.Name)
+		}
+		p.currTask.StdinEnv = strings.Trim(rest, trimValues)
+	case AttributeTypeRequiresDocker:
+		s := strings.Trim(rest, trimValues)
+		p.currTask.RequiresDocker = s == "true"
+	case AttributeTypeInherit:
+		if p.currTask.Inherit != "" {
+			return false, p.errorf("inherit appears more than once for %s", p.currTask.Name)
+		}
+		p.currTask.Inherit = trimName(rest)
+	case AttributeTypeCleanup:
+		if p.currTask.Cleanup != "" {
+			return false, p.errorf("cleanup appears more than once for %s", p.currTask.Name)
+		}
+		// only trim backticks, as other characters are meaningful in a script
+		p.currTask.Cleanup = strings.Trim(strings.TrimSpace(rest), "`")
+	case AttributeTypeDynamicEnv:
+		if p.currTask.DynamicEnv != "" {
+			return false, p.errorf("dynamic-env appears more than once for %s", p.currTask.Name)
+		}
+		// only trim backticks, as other characters are meaningful in a script
+		p.currTask.DynamicEnv = strings.Trim(strings.TrimSpace(rest), "`")
+	case AttributeTypeTest:
+		s := strings.Trim(rest, trimValues)
+		p.currTask.Test = s == "true"
+	case AttributeTypeMaxOpenFiles:
+		s := strings.Trim(rest, trimValues)
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || n == 0 {
+			return false, p.errorf("max-open-files contains invalid number %q: %s", s, p.currTask.Name)
+		}
+		p.currTask.MaxOpenFiles = n
+	case AttributeTypeOutputTail, AttributeTypeOutputHead:
+		if p.currTask.OutputLines != nil {
+			return false, p.errorf("output-head or output-tail appears more than once for %s", p.currTask.Name)
+		}
+		s := strings.Trim(rest, trimValues)
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return false, p.errorf("%s contains invalid number of lines %q: %s", strings.ToLower(strings.Trim(a, trimValues)), s, p.currTask.Name)
+		}
+		p.currTask.OutputLines = &models.OutputLines{Head: ty == AttributeTypeOutputHead, N: n}
+	case AttributeTypeHostname:
+		if p.currTask.Hostname != "" {
+			return false, p.errorf("hostname appears more than once for %s", p.currTask.Name)
+		}
+		p.currTask.Hostname = strings.Trim(rest, trimValues)
+	case AttributeTypePreserveMtime:
+		s := strings.Trim(rest, trimValues)
+		p.currTask.PreserveMtime = s == "true"
+	case AttributeTypeAllowEmpty:
+		s := strings.Trim(rest, trimValues)
+		p.currTask.AllowEmpty = s == "true"
+	case AttributeTypeFailOnStderr:
+		s := strings.Trim(rest, trimValues)
+		p.currTask.FailOnStderr = s == "true"
+	case AttributeTypeExpectSilent:
+		s := strings.Trim(rest, trimValues)
+		p.currTask.ExpectSilent = s == "true"
+	case AttributeTypeParallel:
+		s := strings.Trim(rest, trimValues)
+		p.currTask.Parallel = s == "true"
+	case AttributeTypeCreateDir:
+		s := strings.Trim(rest, trimValues)
+		p.currTask.CreateDir = s == "true"
+	case AttributeTypeNoInterpolate:
+		s := strings.Trim(rest, trimValues)
+		p.currTask.NoInterpolate = s == "true"
+	case AttributeTypeTmpfs:
+		s := strings.Trim(rest, trimValues)
+		p.currTask.Tmpfs = s == "true"
+	case AttributeTypeTimeout:
+		s := strings.Trim(rest, trimValues)
+		if strings.EqualFold(s, "none") {
+			p.currTask.Timeout = models.NoTimeout
+			break
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return false, p.errorf("timeout contains invalid duration %q should be a positive duration or none: %s", s, p.currTask.Name)
+		}
+		p.currTask.Timeout = d
+	case AttributeTypeRetry:
+		s := strings.Trim(rest, trimValues)
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return false, p.errorf("retry contains invalid number %q: %s", s, p.currTask.Name)
+		}
+		p.currTask.RetryCount = n
+	case AttributeTypeMaxRestarts:
+		s := strings.Trim(rest, trimValues)
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return false, p.errorf("max-restarts contains invalid number %q: %s", s, p.currTask.Name)
+		}
+		p.currTask.MaxRestarts = n
+	case AttributeTypeRetryDelay:
+		s := strings.Trim(rest, trimValues)
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return false, p.errorf("retry-delay contains invalid duration %q: %s", s, p.currTask.Name)
+		}
+		p.currTask.RetryDelay = d
+	case AttributeTypeRetryBackoff:
+		s := strings.Trim(rest, trimValues)
+		b, ok := models.ParseRetryBackoff(s)
+		if !ok {
+			return false, p.errorf("retry-backoff contains invalid backoff %q should be (constant, linear, exponential): %s", s, p.currTask.Name)
+		}
+		p.currTask.RetryBackoff = b
+	case AttributeTypeRetryMaxDelay:
+		s := strings.Trim(rest, trimValues)
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 {
+			return false, p.errorf("retry-max-delay contains invalid duration %q: %s", s, p.currTask.Name)
+		}
+		p.currTask.RetryMaxDelay = d
+	case AttributeTypeValidateInputs:
+		if p.currTask.ValidateInputs != "" {
+			return false, p.errorf("validate-inputs appears more than once for %s", p.currTask.Name)
+		}
+		p.currTask.ValidateInputs = strings.Trim(strings.TrimSpace(rest), "`")
 	}
 	p.scan()
 	return true, nil
 }
 
-func (p *parser) parseCodeBlock() error {
+func (p *parser) parseCodeBlock() (bool, error) {
 	t := p.currentLine
 	if len(t) < 3 || t[:3] != codeBlockStarter {
-		return nil
-	}
-	if len(p.currTask.Script) > 0 {
-		return fmt.Errorf("command block already exists for task %s", p.currTask.Name)
+		return false, nil
 	}
+	start := p.line
+	block := models.ScriptBlock{Lang: strings.TrimSpace(t[3:])}
 	var ended bool
 	for p.scan() {
 		if len(p.currentLine) >= 3 && p.currentLine[:3] == codeBlockStarter {
@@ -223,29 +776,38 @@ func (p *parser) parseCodeBlock() error {
 			break
 		}
 		if strings.TrimSpace(p.currentLine) != "" {
-			p.currTask.Script += p.currentLine + "\n"
+			block.Body += p.currentLine + "\n"
 		}
 	}
 	if !ended {
-		return fmt.Errorf("command block in task %s was not ended", p.currTask.Name)
+		return false, p.errorAt(start, "command block in task %s was not ended", p.currTask.Name)
+	}
+	// blocks without any commands are left out, so that the task is empty
+	if block.Body != "" {
+		p.currTask.Script = append(p.currTask.Script, block)
 	}
 	p.scan()
-	return nil
+	return true, nil
 }
 
 func (p *parser) findTaskHeading() (heading string, done bool, err error) {
 	for {
+		line := p.line
 		tok, level, text := p.parseHeading(true)
 		if !tok || level > p.rootHeadingLevel+1 {
+			if !tok {
+				p.parseInclude()
+			}
 			if !p.scan() {
-				return "", false, fmt.Errorf("failed to read file: %w", p.scanner.Err())
+				return "", false, p.errorAt(p.scanned+1, "failed to read file: %w", p.scanErr)
 			}
 			continue
 		}
 		if level <= p.rootHeadingLevel {
 			return "", true, nil
 		}
-		return strings.Trim(text, trimValues), false, nil
+		p.taskLine = line
+		return trimName(text), false, nil
 	}
 }
 
@@ -258,15 +820,21 @@ func (p *parser) parseTaskBody() (bool, error) {
 		if p.reachedEnd {
 			// parse attribute again in case it is on the last line
 			_, err = p.parseAttribute()
-			return false, err
+			// or the last line is the heading of another task
+			tok, level, _ := p.parseHeading(false)
+			return err == nil && tok && level == p.rootHeadingLevel+1, err
 		}
 		if ok {
 			continue
 		}
-		err = p.parseCodeBlock()
+		ok, err = p.parseCodeBlock()
 		if err != nil {
 			return false, err
 		}
+		if ok {
+			// the next line may start another code block
+			continue
+		}
 		tok, level, _ := p.parseHeading(false)
 		if tok && level <= p.rootHeadingLevel {
 			return false, nil
@@ -275,7 +843,8 @@ func (p *parser) parseTaskBody() (bool, error) {
 			return true, nil
 		}
 		if strings.TrimSpace(p.currentLine) != "" {
-			p.currTask.Description = append(p.currTask.Description, strings.Trim(p.currentLine, trimValues))
+			// kept as written, so markdown such as links and lists is not lost
+			p.currTask.Description = append(p.currTask.Description, strings.TrimRight(p.currentLine, "\r"))
 		}
 		if !p.scan() {
 			return false, nil
@@ -294,26 +863,200 @@ func (p *parser) parseTask() (ok bool, err error) {
 	if err != nil {
 		return
 	}
-	if len(p.currTask.Script) < 1 && len(p.currTask.DependsOn) < 1 {
-		err = fmt.Errorf("task %s has no commands or required tasks", p.currTask.Name)
+	if len(p.currTask.Script) < 1 && len(p.currTask.DependsOn) < 1 && !p.allowEmpty && !p.currTask.AllowEmpty {
+		err = p.errorAt(p.taskLine, "task %s has no commands or required tasks", p.currTask.Name)
 		return
 	}
+	if p.taskLines == nil {
+		p.taskLines = map[string]int{}
+	}
+	p.taskLines[strings.ToLower(p.currTask.Name)] = p.taskLine
 	p.tasks = append(p.tasks, p.currTask)
 	return
 }
 
+// expandPath replaces a leading ~ in path with the home directory, and
+// expands $VAR, ${VAR} and ${VAR:-default} from the environment of xc.
+// Variables which are not set are expanded to nothing, with a warning.
+func (p *parser) expandPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			p.warnings = append(p.warnings, fmt.Sprintf("could not expand ~ in directory of %s: %s", p.currTask.Name, err))
+		} else {
+			path = home + path[1:]
+		}
+	}
+	return os.Expand(path, func(name string) string {
+		name, def, hasDefault := strings.Cut(name, ":-")
+		value, ok := os.LookupEnv(name)
+		switch {
+		case value != "":
+			return value
+		case hasDefault:
+			return def
+		case !ok:
+			p.warnings = append(p.warnings, fmt.Sprintf("directory of %s refers to $%s, which is not set", p.currTask.Name, name))
+		}
+		return ""
+	})
+}
+
 // NewParser will read from r until it finds a valid xc heading block.
 // If no block is found an error is returned.
+// Lines may be up to DefaultMaxLineSize bytes long.
 func NewParser(r io.Reader, heading string) (p parser, err error) {
-	p.scanner = bufio.NewScanner(r)
+	return NewParserWithOptions(r, heading)
+}
+
+// NewParserWithOptions is NewParser, configured by opts.
+func NewParserWithOptions(r io.Reader, heading string, opts ...ParserOption) (p parser, err error) {
+	p = newParser(r, opts)
 	for p.scan() {
-		ok, level, text := p.parseHeading(true)
+		// only advance past the heading if it matches, as the next line may be a heading
+		ok, level, text := p.parseHeading(false)
 		if !ok || !strings.EqualFold(strings.TrimSpace(text), strings.TrimSpace(heading)) {
 			continue
 		}
+		p.parseHeading(true)
 		p.rootHeadingLevel = level
 		return
 	}
+	if p.scanErr != nil {
+		err = p.errorAt(p.scanned+1, "failed to read file: %w", p.scanErr)
+		return
+	}
 	err = ErrNoTasksHeading
 	return
 }
+
+func newParser(r io.Reader, opts []ParserOption) parser {
+	p := parser{maxLineSize: DefaultMaxLineSize}
+	for _, opt := range opts {
+		opt(&p)
+	}
+	p.scanner = bufio.NewScanner(r)
+	p.scanner.Buffer(nil, p.maxLineSize)
+	return p
+}
+
+// ParseAll reads the whole of r and parses the block of tasks under each of
+// headings, keyed by the heading as given. Headings are matched as by
+// NewParser, so a heading which is not given is never parsed as tasks.
+// If any of headings is not found an error wrapping ErrNoTasksHeading is
+// returned. opts configure the parser of each block, as with
+// NewParserWithOptions.
+func ParseAll(r io.Reader, headings []string, opts ...ParserOption) (map[string]models.Tasks, error) {
+	if len(headings) == 0 {
+		return nil, ErrNoTasksHeading
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, parseErrorf(0, "", "failed to read file: %w", err)
+	}
+	blocks := make(map[string]models.Tasks, len(headings))
+	for _, heading := range headings {
+		if _, ok := blocks[heading]; ok {
+			continue
+		}
+		p, err := NewParserWithOptions(bytes.NewReader(b), heading, opts...)
+		if err != nil {
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, parseErrorf(0, "", "%s: %w", heading, err)
+			}
+			return nil, fmt.Errorf("%s: %w", heading, err)
+		}
+		tasks, err := p.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", heading, err)
+		}
+		blocks[heading] = tasks
+	}
+	return blocks, nil
+}
+
+// ValidateDependencies returns a ParseError if the required tasks of any of
+// tasks form a cycle, such as a task which requires a task which requires it,
+// or their inherited tasks do. The error gives the path of the cycle, starting
+// and ending at the same task. Tasks which do not exist are ignored.
+func ValidateDependencies(tasks models.Tasks) error {
+	if errs := circularDependencies(tasks); len(errs) > 0 {
+		return errs[0]
+	}
+	if errs := circularInherits(tasks); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// circularInherits returns an ErrCircularInherit for each cycle of inherited
+// tasks in tasks.
+func circularInherits(tasks models.Tasks) []error {
+	var errs []error
+	checked := map[string]bool{}
+	for _, t := range tasks {
+		index := map[string]int{}
+		var path []string
+		for !checked[t.Name] {
+			if i, ok := index[t.Name]; ok {
+				cycle := append(path[i:len(path):len(path)], t.Name)
+				errs = append(errs, parseErrorf(0, t.Name, "%w: %s", ErrCircularInherit, strings.Join(cycle, " → ")))
+				break
+			}
+			index[t.Name] = len(path)
+			path = append(path, t.Name)
+			base, ok := tasks.Get(t.Inherit)
+			if t.Inherit == "" || !ok {
+				break
+			}
+			t = base
+		}
+		for _, name := range path {
+			checked[name] = true
+		}
+	}
+	return errs
+}
+
+// circularDependencies returns an ErrCircularDependency for each cycle of
+// required tasks in tasks.
+func circularDependencies(tasks models.Tasks) []error {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	var errs []error
+	state := map[string]int{}
+	var path []string
+	var visit func(name string)
+	visit = func(name string) {
+		t, ok := tasks.Get(name)
+		if !ok {
+			return
+		}
+		switch state[t.Name] {
+		case visiting:
+			for i := range path {
+				if path[i] == t.Name {
+					cycle := append(path[i:len(path):len(path)], t.Name)
+					errs = append(errs, parseErrorf(0, t.Name, "%w: %s", ErrCircularDependency, strings.Join(cycle, " → ")))
+				}
+			}
+			return
+		case visited:
+			return
+		}
+		state[t.Name] = visiting
+		path = append(path, t.Name)
+		for _, dep := range t.DependsOn {
+			visit(dep.Name)
+		}
+		path = path[:len(path)-1]
+		state[t.Name] = visited
+	}
+	for _, t := range tasks {
+		visit(t.Name)
+	}
+	return errs
+}
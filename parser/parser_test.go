@@ -6,8 +6,12 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/joerdav/xc/models"
 )
@@ -29,7 +33,7 @@ func assertTask(t *testing.T, expected, actual models.Task) {
 	if strings.Join(expected.Description, ",") != strings.Join(actual.Description, ",") {
 		t.Fatalf("description want=%v got=%v", expected.Description, actual.Description)
 	}
-	if expected.Script != actual.Script {
+	if !reflect.DeepEqual(expected.Script, actual.Script) {
 		t.Fatalf("script want=%q got=%q", expected.Script, actual.Script)
 	}
 	if expected.Dir != actual.Dir {
@@ -41,10 +45,10 @@ func assertTask(t *testing.T, expected, actual models.Task) {
 	if expected.DepsBehaviour != actual.DepsBehaviour {
 		t.Fatalf("Run want=%q got=%q", expected.DepsBehaviour, actual.DepsBehaviour)
 	}
-	if strings.Join(expected.DependsOn, ",") != strings.Join(actual.DependsOn, ",") {
+	if !reflect.DeepEqual(expected.DependsOn, actual.DependsOn) {
 		t.Fatalf("requires want=%v got=%v", expected.DependsOn, actual.DependsOn)
 	}
-	if strings.Join(expected.Inputs, ",") != strings.Join(actual.Inputs, ",") {
+	if !reflect.DeepEqual(expected.Inputs, actual.Inputs) {
 		t.Fatalf("inputs want=%v got=%v", expected.Inputs, actual.Inputs)
 	}
 }
@@ -59,27 +63,27 @@ func TestParseFile(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	expected := models.Tasks{
-		{Name: "list", Description: []string{"Lists files"}, Script: "ls\n"},
+		{Name: "list", Description: []string{"Lists files"}, Script: []models.ScriptBlock{{Body: "ls\n"}}},
 		{
 			Name:        "list2",
 			Description: []string{"Lists files"},
-			Script:      "ls\n",
+			Script:      []models.ScriptBlock{{Body: "ls\n"}},
 			Dir:         "./somefolder",
 		},
 		{
 			Name:        "hello",
 			Description: []string{"Print a message"},
-			Script: `echo "Hello, world!"
+			Script: []models.ScriptBlock{{Body: `echo "Hello, world!"
 echo "Hello, world2!"
-`,
+`}},
 			Env:       []string{"somevar=val"},
-			DependsOn: []string{"list", "list2"},
-			Inputs:    []string{"FOO", "BAR"},
+			DependsOn: []models.TaskRef{{Name: "list"}, {Name: "list2"}},
+			Inputs:    []models.Input{{Name: "FOO"}, {Name: "BAR"}},
 		},
 		{
 			Name:        "all-lists",
 			Description: []string{"An example of a commandless task."},
-			DependsOn:   []string{"list", "list2"},
+			DependsOn:   []models.TaskRef{{Name: "list"}, {Name: "list2"}},
 		},
 	}
 	if len(result) != len(expected) {
@@ -90,6 +94,32 @@ echo "Hello, world2!"
 	}
 }
 
+func TestParseDescription(t *testing.T) {
+	in := "## Tasks\n### deploy\n" +
+		"Deploys the **api**, see [the runbook](docs/runbook.md).\n" +
+		"- `staging` first\n" +
+		"  - then *production*\n" +
+		"**Needs VPN access**\n" +
+		"```\n./deploy.sh\n```\n"
+	p, err := NewParser(strings.NewReader(in), "Tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := result[0]
+	expectMarkdown := "Deploys the **api**, see [the runbook](docs/runbook.md).\n- `staging` first\n  - then *production*\n**Needs VPN access**"
+	if got := task.DescriptionMarkdown(); got != expectMarkdown {
+		t.Errorf("DescriptionMarkdown()=%q, want=%q", got, expectMarkdown)
+	}
+	expectText := "Deploys the **api**, see [the runbook](docs/runbook.md).\n- `staging` first\n- then *production*\nNeeds VPN access"
+	if got := task.DescriptionText(); got != expectText {
+		t.Errorf("DescriptionText()=%q, want=%q", got, expectText)
+	}
+}
+
 func TestParseFileToEOF(t *testing.T) {
 	p, err := NewParser(strings.NewReader(tillEOF), "Tasks")
 	if err != nil {
@@ -102,17 +132,17 @@ func TestParseFileToEOF(t *testing.T) {
 	expected := models.Tasks{
 		{
 			Name:   "generate-templ",
-			Script: "go run -mod=mod github.com/a-h/templ/cmd/templ generate\ngo mod tidy\n",
+			Script: []models.ScriptBlock{{Body: "go run -mod=mod github.com/a-h/templ/cmd/templ generate\ngo mod tidy\n", Lang: "bash"}},
 		},
 		{
 			Name:   "generate-translations",
-			Script: "go run ./i18n/generate\n",
+			Script: []models.ScriptBlock{{Body: "go run ./i18n/generate\n", Lang: "bash"}},
 		},
 		{
 			Name: "generate-all",
-			DependsOn: []string{
-				"generate-templ",
-				"generate-translations",
+			DependsOn: []models.TaskRef{
+				{Name: "generate-templ"},
+				{Name: "generate-translations"},
 			},
 			DepsBehaviour: models.DependencyBehaviourAsync,
 		},
@@ -144,6 +174,30 @@ func TestMultipleDirs(t *testing.T) {
 	}
 }
 
+func TestMultipleInherits(t *testing.T) {
+	var p parser
+	p.scanner = bufio.NewScanner(strings.NewReader("inherit: base"))
+	p.scan()
+	p.scan()
+	p.currTask.Inherit = "setup"
+	_, err := p.parseAttribute()
+	if err == nil {
+		t.Fatal("expected error got nil")
+	}
+}
+
+func TestMultipleShells(t *testing.T) {
+	var p parser
+	p.scanner = bufio.NewScanner(strings.NewReader("shell: bash -eu"))
+	p.scan()
+	p.scan()
+	p.currTask.Shell = "python3"
+	_, err := p.parseAttribute()
+	if err == nil {
+		t.Fatal("expected error got nil")
+	}
+}
+
 func TestInvalidRun(t *testing.T) {
 	var p parser
 	p.scanner = bufio.NewScanner(strings.NewReader("run: never"))
@@ -167,6 +221,39 @@ func TestCommandlessTask(t *testing.T) {
 	}
 }
 
+func TestAllowEmptyTask(t *testing.T) {
+	t.Run("given the allow-empty attribute, should parse", func(t *testing.T) {
+		p, _ := NewParser(strings.NewReader(`
+# Tasks
+## a task
+allow-empty: true
+## another task
+`), "tasks")
+		_, err := p.parseTask()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.tasks) != 1 || !p.tasks[0].AllowEmpty {
+			t.Fatalf("expected an empty task, got %v", p.tasks)
+		}
+	})
+	t.Run("given AllowEmpty, should parse", func(t *testing.T) {
+		p, _ := NewParser(strings.NewReader(`
+# Tasks
+## a task
+## another task
+`), "tasks")
+		p.AllowEmpty(true)
+		tasks, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tasks) != 2 {
+			t.Fatalf("expected 2 tasks, got %v", tasks)
+		}
+	})
+}
+
 func TestRequiresOnlyTask(t *testing.T) {
 	p, _ := NewParser(strings.NewReader(`
 # Tasks
@@ -179,6 +266,85 @@ requires: some-task
 	}
 }
 
+func TestValidateDependencies(t *testing.T) {
+	tests := []struct {
+		name      string
+		tasks     models.Tasks
+		expectErr string
+	}{
+		{
+			name: "given no cycle, should pass",
+			tasks: models.Tasks{
+				{Name: "a", DependsOn: []models.TaskRef{{Name: "b"}, {Name: "c"}}},
+				{Name: "b", DependsOn: []models.TaskRef{{Name: "c"}}},
+				{Name: "c", Script: []models.ScriptBlock{{Body: "c"}}},
+			},
+		},
+		{
+			name: "given two tasks which require each other, should error",
+			tasks: models.Tasks{
+				{Name: "A", DependsOn: []models.TaskRef{{Name: "B"}}},
+				{Name: "B", DependsOn: []models.TaskRef{{Name: "A"}}},
+			},
+			expectErr: "circular dependency detected: A → B → A",
+		},
+		{
+			name: "given a transitive cycle, should give its path",
+			tasks: models.Tasks{
+				{Name: "build", DependsOn: []models.TaskRef{{Name: "lint"}}},
+				{Name: "lint", DependsOn: []models.TaskRef{{Name: "generate", Args: []string{"arg=1"}}}},
+				{Name: "generate", DependsOn: []models.TaskRef{{Name: "setup"}}},
+				{Name: "setup", DependsOn: []models.TaskRef{{Name: "Lint"}}},
+			},
+			expectErr: "circular dependency detected: lint → generate → setup → lint",
+		},
+		{
+			name:      "given a task which requires itself, should error",
+			tasks:     models.Tasks{{Name: "a", DependsOn: []models.TaskRef{{Name: "a"}}}},
+			expectErr: "circular dependency detected: a → a",
+		},
+		{
+			name:  "given a missing required task, should pass",
+			tasks: models.Tasks{{Name: "a", DependsOn: []models.TaskRef{{Name: "missing"}}}},
+		},
+		{
+			name: "given two tasks which inherit each other, should error",
+			tasks: models.Tasks{
+				{Name: "a", Inherit: "b"},
+				{Name: "b", Inherit: "a"},
+			},
+			expectErr: "circular inherit detected: a → b → a",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDependencies(tt.tasks)
+			if tt.expectErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.expectErr {
+				t.Fatalf("expected error %q, got %v", tt.expectErr, err)
+			}
+		})
+	}
+	t.Run("given a cycle, Parse should error", func(t *testing.T) {
+		p, _ := NewParser(strings.NewReader(`
+# Tasks
+## a
+requires: b
+## b
+requires: a
+`), "tasks")
+		if _, err := p.Parse(); err == nil {
+			t.Fatal("expected an error got nil")
+		}
+	})
+}
+
 func TestHeadingCaseInsensitive(t *testing.T) {
 	tests := []struct {
 		mdHeading, parserHeading string
@@ -210,7 +376,7 @@ some code
 		}
 		assertTask(t, models.Task{
 			Name:   "a task",
-			Script: "some code\n",
+			Script: []models.ScriptBlock{{Body: "some code\n"}},
 		}, p.currTask)
 	}
 }
@@ -228,29 +394,207 @@ some code
 	}
 }
 
-func TestMultipleCodeBlocks(t *testing.T) {
-	var p parser
-	p.scanner = bufio.NewScanner(strings.NewReader("```\ncode\n```"))
-	p.scan()
-	p.scan()
-	p.currTask.Script = "an existing script"
-	err := p.parseCodeBlock()
-	if err == nil {
-		t.Fatal("expected error got nil")
+func TestParseErrorLine(t *testing.T) {
+	tests := []struct {
+		name       string
+		in         string
+		expectLine int
+		expectTask string
+	}{
+		{
+			name:       "given a duplicate attribute, should give its line",
+			in:         "# Readme\n## Tasks\n### build\ndir: a\ndir: b\n```\nmake\n```\n",
+			expectLine: 5,
+			expectTask: "build",
+		},
+		{
+			name:       "given a code block which is not ended, should give the line it starts on",
+			in:         "## Tasks\n### build\n```\nmake\n```\n### test\n\n```\ngo test\n",
+			expectLine: 8,
+			expectTask: "test",
+		},
+		{
+			name:       "given a task without commands, should give the line of its heading",
+			in:         "## Tasks\n### build\n```\nmake\n```\n\n### test\nsome description\n### lint\n```\nlint\n```\n",
+			expectLine: 7,
+			expectTask: "test",
+		},
+		{
+			name:       "given an invalid attribute on the last line, should give its line",
+			in:         "## Tasks\n### build\n```\nmake\n```\nrun: never",
+			expectLine: 6,
+			expectTask: "build",
+		},
+		{
+			name:       "given required tasks which form a cycle, should give the line of the first task in it",
+			in:         "## Tasks\n### lint\n```\nlint\n```\n### build\nrequires: test\n### test\nrequires: build\n",
+			expectLine: 6,
+			expectTask: "build",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewParser(strings.NewReader(tt.in), "tasks")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = p.Parse()
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("expected a ParseError, got %v", err)
+			}
+			if parseErr.Line != tt.expectLine || parseErr.TaskName != tt.expectTask {
+				t.Fatalf("got line %d of %q, want line %d of %q: %v", parseErr.Line, parseErr.TaskName, tt.expectLine, tt.expectTask, err)
+			}
+			if !strings.HasPrefix(err.Error(), fmt.Sprintf("line %d: ", tt.expectLine)) {
+				t.Fatalf("expected the error to start with the line, got %q", err.Error())
+			}
+		})
+	}
+}
+
+func TestCodeBlocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		expected []models.ScriptBlock
+	}{
+		{
+			name: "given no code blocks, should have no script",
+			in:   "Requires: b\n",
+		},
+		{
+			name:     "given one code block, should parse",
+			in:       "```\nls\n```\n",
+			expected: []models.ScriptBlock{{Body: "ls\n"}},
+		},
+		{
+			name: "given several code blocks, should keep them in order with their language",
+			in:   "```sh\ncc -c main.c\n```\n\nthen\n\n``` python\nprint(1)\n\nprint(2)\n```\n",
+			expected: []models.ScriptBlock{
+				{Body: "cc -c main.c\n", Lang: "sh"},
+				{Body: "print(1)\nprint(2)\n", Lang: "python"},
+			},
+		},
+		{
+			name:     "given an empty code block, should leave it out",
+			in:       "```\n\n```\n```\nls\n```\n",
+			expected: []models.ScriptBlock{{Body: "ls\n"}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewParser(strings.NewReader("# Tasks\n## a\n"+tt.in+"## b\n```\nls\n```\n"), "tasks")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tasks, err := p.Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tasks[0].Script, tt.expected) {
+				t.Fatalf("Script=%q, want=%q", tasks[0].Script, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExpandDir(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory:", err)
+	}
+	t.Setenv("XC_TEST_ROOT", "/src")
+	t.Setenv("XC_TEST_EMPTY", "")
+	tests := []struct {
+		name          string
+		in            string
+		expectDir     string
+		expectWarning bool
+	}{
+		{name: "given ~, should expand it to the home directory", in: "dir: ~/projects/foo", expectDir: filepath.Join(home, "projects", "foo")},
+		{name: "given $VAR, should expand it", in: "dir: $XC_TEST_ROOT/repo", expectDir: "/src/repo"},
+		{name: "given ${VAR:-default} which is set, should use the value", in: "dir: ${XC_TEST_ROOT:-/tmp}/repo", expectDir: "/src/repo"},
+		{name: "given ${VAR:-default} which is empty, should use the default", in: "dir: ${XC_TEST_EMPTY:-/tmp}/repo", expectDir: "/tmp/repo"},
+		{name: "given an unset variable, should warn", in: "dir: ${XC_TEST_UNSET}/repo", expectDir: "/repo", expectWarning: true},
+		{name: "given a bare path, should not change it", in: "dir: ./src/~user", expectDir: "./src/~user"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var p parser
+			p.scanner = bufio.NewScanner(strings.NewReader(tt.in))
+			p.scan()
+			p.scan()
+			if _, err := p.parseAttribute(); err != nil {
+				t.Fatal(err)
+			}
+			if p.currTask.Dir != tt.expectDir {
+				t.Fatalf("Dir=%q, want=%q", p.currTask.Dir, tt.expectDir)
+			}
+			if (len(p.Warnings()) > 0) != tt.expectWarning {
+				t.Fatalf("warnings=%q, want warning=%v", p.Warnings(), tt.expectWarning)
+			}
+		})
 	}
 }
 
 func TestParseAttribute(t *testing.T) {
 	tests := []struct {
-		name                string
-		in                  string
-		expectNotOk         bool
-		expectEnv           string
-		expectDir           string
-		expectDependsOn     string
-		expectInputs        string
-		expectBehaviour     models.RequiredBehaviour
-		expectDepsBehaviour models.DepsBehaviour
+		name                 string
+		in                   string
+		expectNotOk          bool
+		expectEnv            string
+		expectDir            string
+		expectDependsOn      models.TaskRef
+		expectInputs         models.Input
+		expectBehaviour      models.RequiredBehaviour
+		expectDepsBehaviour  models.DepsBehaviour
+		expectNoKillGroup    bool
+		expectStdinTimeout   time.Duration
+		expectRequiresDocker bool
+		expectCleanup        string
+		expectValidateInputs string
+		expectTest           bool
+		expectMaxOpenFiles   uint64
+		expectHostname       string
+		expectPreserveMtime  bool
+		expectRetry          int
+		expectStdinEnv       string
+		expectStdinLog       string
+		expectTmpfs          bool
+		expectTimeout        time.Duration
+		expectOutputs        string
+		expectNoInterpolate  bool
+		expectCreateDir      bool
+		expectParallel       bool
+		expectTags           string
+		expectPlatforms      string
+		expectWatch          string
+		expectMaxRestarts    int
+		expectComputedEnv    []models.ComputedVar
+		expectScriptMode     models.ScriptMode
+		expectVars           string
+		expectOutputFilter   string
+		expectCleanupEnvFile models.EnvFileCleanup
+		expectGlobInputs     string
+		expectDefaultsFile   string
+		expectRequireFiles   string
+		expectFailOnStderr   bool
+		expectContinue       bool
+		expectShell          string
+		expectExpectSilent   bool
+		expectDynamicEnv     string
+		expectExitCodes      map[int]models.ExitCodeMeaning
+		expectOutputLines    string
+		expectEnvTypes       map[string]models.EnvType
+		expectEnvFiles       string
+		expectRetryDelay     time.Duration
+		expectRetryBackoff   models.RetryBackoff
+		expectRetryMaxDelay  time.Duration
+		expectErr            bool
 	}{
 		{
 			name:      "given a basic Env, should parse",
@@ -275,42 +619,72 @@ func TestParseAttribute(t *testing.T) {
 		{
 			name:            "given a basic req, should parse",
 			in:              "req: my attribute",
-			expectDependsOn: "my attribute",
+			expectDependsOn: models.TaskRef{Name: "my", Args: []string{"attribute"}},
 		},
 		{
 			name:            "given requires attribute with mixed casing, should parse",
 			in:              "ReqUiRES: my attribute",
-			expectDependsOn: "my attribute",
+			expectDependsOn: models.TaskRef{Name: "my", Args: []string{"attribute"}},
 		},
 		{
 			name:            "given req with colons, should parse",
 			in:              "req: my:attribute",
-			expectDependsOn: "my:attribute",
+			expectDependsOn: models.TaskRef{Name: "my:attribute"},
 		},
 		{
 			name:            "given req with formatting, should parse",
 			in:              "req: _*`my:attribute_*`",
-			expectDependsOn: "my:attribute",
+			expectDependsOn: models.TaskRef{Name: "my:attribute"},
+		},
+		{
+			name:            "given req with arguments in parentheses, should not split them",
+			in:              "req: deploy(ENV=prod, REGION=eu), lint",
+			expectDependsOn: models.TaskRef{Name: "deploy", Args: []string{"ENV=prod", "REGION=eu"}},
+		},
+		{
+			name:      "given req with an unclosed quote, should error",
+			in:        "req: deploy 'prod",
+			expectErr: true,
+		},
+		{
+			name:      "given req with an empty argument, should error",
+			in:        "req: deploy(prod, )",
+			expectErr: true,
 		},
 		{
 			name:         "given a basic Inputs, should parse",
 			in:           "Inputs: my attribute",
-			expectInputs: "my attribute",
+			expectInputs: models.Input{Name: "my attribute"},
 		},
 		{
 			name:         "given inputs attribute with mixed casing, should parse",
 			in:           "InpUts: my attribute",
-			expectInputs: "my attribute",
+			expectInputs: models.Input{Name: "my attribute"},
 		},
 		{
 			name:         "given Inputs with colons, should parse",
 			in:           "Inputs: my:attribute",
-			expectInputs: "my:attribute",
+			expectInputs: models.Input{Name: "my:attribute"},
 		},
 		{
 			name:         "given Inputs with formatting, should parse",
 			in:           "Inputs: _*`my:attribute_*`",
-			expectInputs: "my:attribute",
+			expectInputs: models.Input{Name: "my:attribute"},
+		},
+		{
+			name:         "given Inputs with a default, should parse",
+			in:           "Inputs: `NAME = hello world`, COUNT=3",
+			expectInputs: models.Input{Name: "NAME", Default: "hello world", HasDefault: true},
+		},
+		{
+			name:         "given Inputs with an empty default, should parse",
+			in:           "Inputs: NAME=",
+			expectInputs: models.Input{Name: "NAME", HasDefault: true},
+		},
+		{
+			name:         "given Inputs without a default, should parse as required",
+			in:           "Inputs: NAME",
+			expectInputs: models.Input{Name: "NAME"},
 		},
 		{
 			name:      "given a basic dir, should parse",
@@ -362,6 +736,338 @@ func TestParseAttribute(t *testing.T) {
 			in:                  "runDeps: _*`sync`*_",
 			expectDepsBehaviour: models.DependencyBehaviourSync,
 		},
+		{
+			name:              "given kill-group false, should parse",
+			in:                "kill-group: false",
+			expectNoKillGroup: true,
+		},
+		{
+			name: "given kill-group true, should parse",
+			in:   "KillGroup: true",
+		},
+		{
+			name:               "given stdin-eof-timeout, should parse",
+			in:                 "stdin-eof-timeout: 5s",
+			expectStdinTimeout: 5 * time.Second,
+		},
+		{
+			name:           "given stdin-env, should parse",
+			in:             "Stdin-Env: INPUT_DATA",
+			expectStdinEnv: "INPUT_DATA",
+		},
+		{
+			name:           "given stdin-log, should parse",
+			in:             "stdin-log: `input.log`",
+			expectStdinLog: "input.log",
+		},
+		{
+			name:      "given invalid stdin-eof-timeout, should error",
+			in:        "stdin-eof-timeout: soon",
+			expectErr: true,
+		},
+		{
+			name:                 "given requires-docker, should parse",
+			in:                   "Requires-Docker: true",
+			expectRequiresDocker: true,
+		},
+		{
+			name:          "given cleanup, should keep the script intact",
+			in:            "Cleanup: `rm -rf /tmp/build-*`",
+			expectCleanup: "rm -rf /tmp/build-*",
+		},
+		{
+			name:                "given preserve-mtime, should parse",
+			in:                  "Preserve-Mtime: true",
+			expectPreserveMtime: true,
+		},
+		{
+			name:                "given no-interpolate, should parse",
+			in:                  "No-Interpolate: true",
+			expectNoInterpolate: true,
+		},
+		{
+			name:               "given fail-on-stderr, should parse",
+			in:                 "Fail-On-Stderr: true",
+			expectFailOnStderr: true,
+		},
+		{
+			name:           "given continue-on-error, should parse",
+			in:             "Continue-On-Error: true",
+			expectContinue: true,
+		},
+		{
+			name:            "given exit-codes, should parse",
+			in:              "Exit-Codes: `2=warning, 130=Cancelled`",
+			expectExitCodes: map[int]models.ExitCodeMeaning{2: models.ExitCodeWarning, 130: models.ExitCodeCancelled},
+		},
+		{
+			name:      "given an unknown exit code meaning, should error",
+			in:        "exit-codes: 2=ignore",
+			expectErr: true,
+		},
+		{
+			name:      "given an invalid exit code, should error",
+			in:        "exit-codes: 256=warning",
+			expectErr: true,
+		},
+		{
+			name:             "given dynamic-env, should parse",
+			in:               "Dynamic-Env: `vault read -field=token secret/ci | sed 's/^/TOKEN=/'`",
+			expectDynamicEnv: "vault read -field=token secret/ci | sed 's/^/TOKEN=/'",
+		},
+		{
+			name:               "given expect-silent, should parse",
+			in:                 "Expect-Silent: true",
+			expectExpectSilent: true,
+		},
+		{
+			name:        "given shell, should parse",
+			in:          "Shell: `python3 -u`",
+			expectShell: "python3 -u",
+		},
+		{
+			name:       "given tags, should parse",
+			in:         "Tags: deploy, `build`",
+			expectTags: "deploy,build",
+		},
+		{
+			name:            "given platform, should parse lowercase",
+			in:              "platform: Darwin, `windows`",
+			expectPlatforms: "darwin,windows",
+		},
+		{
+			name:        "given watch, should keep the * of each pattern",
+			in:          "watch: **/*.go, `go.mod`",
+			expectWatch: "**/*.go,go.mod",
+		},
+		{
+			name:              "given max-restarts, should parse",
+			in:                "max-restarts: `10`",
+			expectMaxRestarts: 10,
+		},
+		{
+			name:      "given a negative max-restarts, should error",
+			in:        "max-restarts: -1",
+			expectErr: true,
+		},
+		{
+			name: "given computed-env, should split on commas outside commands",
+			in:   "computed-env: PORT=$(find-free-port), NAME=$(printf '%s,%s' a b)",
+			expectComputedEnv: []models.ComputedVar{
+				{Name: "PORT", Command: "find-free-port"},
+				{Name: "NAME", Command: "printf '%s,%s' a b"},
+			},
+		},
+		{
+			name:                 "given cleanup-env-file on-success, should parse",
+			in:                   "cleanup-env-file: On-Success",
+			expectCleanupEnvFile: models.EnvFileCleanupOnSuccess,
+		},
+		{
+			name:                 "given cleanup-env-file true, should parse",
+			in:                   "cleanup-env-file: true",
+			expectCleanupEnvFile: models.EnvFileCleanupAlways,
+		},
+		{
+			name:      "given an invalid cleanup-env-file, should error",
+			in:        "cleanup-env-file: sometimes",
+			expectErr: true,
+		},
+		{
+			name:               "given require-files, should parse",
+			in:                 "require-files: go.sum, `gen/*.go`",
+			expectRequireFiles: "go.sum|gen/*.go",
+		},
+		{
+			name:      "given require-files with an invalid pattern, should error",
+			in:        "require-files: gen/[",
+			expectErr: true,
+		},
+		{
+			name:               "given defaults-file, should parse",
+			in:                 "defaults-file: `.xc-defaults.env`",
+			expectDefaultsFile: ".xc-defaults.env",
+		},
+		{
+			name:             "given expand-glob-inputs, should parse",
+			in:               "expand-glob-inputs: `FILES`, DOCS",
+			expectGlobInputs: "FILES|DOCS",
+		},
+		{
+			name:               "given output-filter, should keep * in the command",
+			in:                 "output-filter: `sed 's/TOKEN=[^ ]*/TOKEN=***/g'`",
+			expectOutputFilter: "sed 's/TOKEN=[^ ]*/TOKEN=***/g'",
+		},
+		{
+			name:       "given vars, should keep the raw values",
+			in:         "vars: VERSION=1.2.3, YEAR=$(date +%Y), PAIR=$(printf '%s,%s' a b), URL=a=b",
+			expectVars: "VERSION=1.2.3|YEAR=$(date +%Y)|PAIR=$(printf '%s,%s' a b)|URL=a=b",
+		},
+		{
+			name:      "given vars without =, should error",
+			in:        "vars: VERSION",
+			expectErr: true,
+		},
+		{
+			name:             "given script-mode, should parse",
+			in:               "script-mode: Stdin",
+			expectScriptMode: models.ScriptModeStdin,
+		},
+		{
+			name:      "given an unknown script-mode, should error",
+			in:        "script-mode: pipe",
+			expectErr: true,
+		},
+		{
+			name:      "given computed-env without a command, should error",
+			in:        "computed-env: PORT=",
+			expectErr: true,
+		},
+		{
+			name:      "given an invalid watch pattern, should error",
+			in:        "watch: src/[a",
+			expectErr: true,
+		},
+		{
+			name:      "given an unknown platform, should error",
+			in:        "platform: macos",
+			expectErr: true,
+		},
+		{
+			name:           "given parallel, should parse",
+			in:             "Parallel: true",
+			expectParallel: true,
+		},
+		{
+			name:            "given create-dir, should parse",
+			in:              "Create-Dir: true",
+			expectCreateDir: true,
+		},
+		{
+			name:          "given outputs, should parse",
+			in:            "Outputs: bin/app, `dist/app.tar.gz`",
+			expectOutputs: "bin/app,dist/app.tar.gz",
+		},
+		{
+			name:          "given timeout, should parse",
+			in:            "Timeout: 5m",
+			expectTimeout: 5 * time.Minute,
+		},
+		{
+			name:          "given timeout none, should parse",
+			in:            "timeout: None",
+			expectTimeout: models.NoTimeout,
+		},
+		{
+			name:          "given timeout in seconds, should parse",
+			in:            "timeout: `30s`",
+			expectTimeout: 30 * time.Second,
+		},
+		{
+			name:      "given a zero timeout, should error",
+			in:        "timeout: 0s",
+			expectErr: true,
+		},
+		{
+			name:      "given an invalid timeout, should error",
+			in:        "timeout: soon",
+			expectErr: true,
+		},
+		{
+			name:        "given tmpfs, should parse",
+			in:          "Tmpfs: true",
+			expectTmpfs: true,
+		},
+		{
+			name:        "given retry, should parse",
+			in:          "Retry: 3",
+			expectRetry: 3,
+		},
+		{
+			name:      "given invalid retry, should error",
+			in:        "retry: -1",
+			expectErr: true,
+		},
+		{
+			name:             "given retry-delay, should parse",
+			in:               "Retry-Delay: 500ms",
+			expectRetryDelay: 500 * time.Millisecond,
+		},
+		{
+			name:               "given retry-backoff, should parse",
+			in:                 "Retry-Backoff: Exponential",
+			expectRetryBackoff: models.RetryBackoffExponential,
+		},
+		{
+			name:      "given invalid retry-backoff, should error",
+			in:        "retry-backoff: random",
+			expectErr: true,
+		},
+		{
+			name:                "given retry-max-delay, should parse",
+			in:                  "Retry-Max-Delay: 1m",
+			expectRetryMaxDelay: time.Minute,
+		},
+		{
+			name:           "given hostname, should parse",
+			in:             "Hostname: build-node",
+			expectHostname: "build-node",
+		},
+		{
+			name:               "given max-open-files, should parse",
+			in:                 "Max-Open-Files: 100",
+			expectMaxOpenFiles: 100,
+		},
+		{
+			name:      "given invalid max-open-files, should error",
+			in:        "max-open-files: lots",
+			expectErr: true,
+		},
+		{
+			name:              "given output-tail, should parse",
+			in:                "Output-Tail: 20",
+			expectOutputLines: "Output-Tail: 20",
+		},
+		{
+			name:              "given output-head of 0, should parse",
+			in:                "output-head: 0",
+			expectOutputLines: "Output-Head: 0",
+		},
+		{
+			name:      "given invalid output-tail, should error",
+			in:        "output-tail: -1",
+			expectErr: true,
+		},
+		{
+			name:           "given env-types, should parse",
+			in:             "Env-Types: PORT=int, `ENABLED=Bool`",
+			expectEnvTypes: map[string]models.EnvType{"PORT": models.EnvTypeInt, "ENABLED": models.EnvTypeBool},
+		},
+		{
+			name:           "given env-files, should parse",
+			in:             "Env-Files: .env, `.env.local`",
+			expectEnvFiles: ".env,.env.local",
+		},
+		{
+			name:           "given envfile, should parse",
+			in:             "envfile: .env",
+			expectEnvFiles: ".env",
+		},
+		{
+			name:      "given an unknown env type, should error",
+			in:        "env-types: PORT=number",
+			expectErr: true,
+		},
+		{
+			name:       "given test, should parse",
+			in:         "Test: true",
+			expectTest: true,
+		},
+		{
+			name:                 "given validate-inputs, should keep the script intact",
+			in:                   `Validate-Inputs: [[ "$V" =~ ^v[0-9]+$ ]] || echo "V must be v*"`,
+			expectValidateInputs: `[[ "$V" =~ ^v[0-9]+$ ]] || echo "V must be v*"`,
+		},
 		{
 			name:        "given env with no colon, should not parse",
 			in:          "env _*`my:attribute_*`",
@@ -386,8 +1092,11 @@ func TestParseAttribute(t *testing.T) {
 			p.scan()
 			p.scan()
 			ok, err := p.parseAttribute()
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("err=%v, want error=%v", err, tt.expectErr)
+			}
 			if err != nil {
-				t.Fatal(err)
+				return
 			}
 			if ok == tt.expectNotOk {
 				t.Fatalf("ok=%v want=%v", ok, !tt.expectNotOk)
@@ -395,11 +1104,11 @@ func TestParseAttribute(t *testing.T) {
 			if tt.expectEnv != "" && p.currTask.Env[0] != tt.expectEnv {
 				t.Fatalf("Env[0]=%s, want=%s", p.currTask.Env[0], tt.expectEnv)
 			}
-			if tt.expectDependsOn != "" && p.currTask.DependsOn[0] != tt.expectDependsOn {
-				t.Fatalf("DependsOn[0]=%s, want=%s", p.currTask.DependsOn[0], tt.expectDependsOn)
+			if tt.expectDependsOn.Name != "" && !reflect.DeepEqual(p.currTask.DependsOn[0], tt.expectDependsOn) {
+				t.Fatalf("DependsOn[0]=%v, want=%v", p.currTask.DependsOn[0], tt.expectDependsOn)
 			}
-			if tt.expectInputs != "" && p.currTask.Inputs[0] != tt.expectInputs {
-				t.Fatalf("Inputs[0]=%s, want=%s", p.currTask.Inputs[0], tt.expectInputs)
+			if tt.expectInputs.Name != "" && p.currTask.Inputs[0] != tt.expectInputs {
+				t.Fatalf("Inputs[0]=%+v, want=%+v", p.currTask.Inputs[0], tt.expectInputs)
 			}
 			if tt.expectDir != "" && p.currTask.Dir != tt.expectDir {
 				t.Fatalf("Dir=%s, want=%s", p.currTask.Dir, tt.expectDir)
@@ -410,6 +1119,136 @@ func TestParseAttribute(t *testing.T) {
 			if p.currTask.DepsBehaviour != tt.expectDepsBehaviour {
 				t.Fatalf("got=%q, want=%q", p.currTask.DepsBehaviour, tt.expectDepsBehaviour)
 			}
+			if p.currTask.NoKillGroup != tt.expectNoKillGroup {
+				t.Fatalf("NoKillGroup=%v, want=%v", p.currTask.NoKillGroup, tt.expectNoKillGroup)
+			}
+			if p.currTask.RequiresDocker != tt.expectRequiresDocker {
+				t.Fatalf("RequiresDocker=%v, want=%v", p.currTask.RequiresDocker, tt.expectRequiresDocker)
+			}
+			if p.currTask.Cleanup != tt.expectCleanup {
+				t.Fatalf("Cleanup=%q, want=%q", p.currTask.Cleanup, tt.expectCleanup)
+			}
+			if p.currTask.PreserveMtime != tt.expectPreserveMtime {
+				t.Fatalf("PreserveMtime=%v, want=%v", p.currTask.PreserveMtime, tt.expectPreserveMtime)
+			}
+			if p.currTask.NoInterpolate != tt.expectNoInterpolate {
+				t.Fatalf("NoInterpolate=%v, want=%v", p.currTask.NoInterpolate, tt.expectNoInterpolate)
+			}
+			if strings.Join(p.currTask.EnvFiles, ",") != tt.expectEnvFiles {
+				t.Fatalf("EnvFiles=%q, want=%q", p.currTask.EnvFiles, tt.expectEnvFiles)
+			}
+			if fmt.Sprint(p.currTask.EnvTypes) != fmt.Sprint(tt.expectEnvTypes) {
+				t.Fatalf("EnvTypes=%v, want=%v", p.currTask.EnvTypes, tt.expectEnvTypes)
+			}
+			var outputLines string
+			if p.currTask.OutputLines != nil {
+				outputLines = p.currTask.OutputLines.String()
+			}
+			if outputLines != tt.expectOutputLines {
+				t.Fatalf("OutputLines=%q, want=%q", outputLines, tt.expectOutputLines)
+			}
+			if p.currTask.ContinueOnError != tt.expectContinue {
+				t.Fatalf("ContinueOnError=%v, want=%v", p.currTask.ContinueOnError, tt.expectContinue)
+			}
+			if p.currTask.FailOnStderr != tt.expectFailOnStderr {
+				t.Fatalf("FailOnStderr=%v, want=%v", p.currTask.FailOnStderr, tt.expectFailOnStderr)
+			}
+			if !reflect.DeepEqual(p.currTask.ExitCodes, tt.expectExitCodes) {
+				t.Fatalf("ExitCodes=%v, want=%v", p.currTask.ExitCodes, tt.expectExitCodes)
+			}
+			if p.currTask.DynamicEnv != tt.expectDynamicEnv {
+				t.Fatalf("DynamicEnv=%q, want=%q", p.currTask.DynamicEnv, tt.expectDynamicEnv)
+			}
+			if p.currTask.ExpectSilent != tt.expectExpectSilent {
+				t.Fatalf("ExpectSilent=%v, want=%v", p.currTask.ExpectSilent, tt.expectExpectSilent)
+			}
+			if p.currTask.Shell != tt.expectShell {
+				t.Fatalf("Shell=%q, want=%q", p.currTask.Shell, tt.expectShell)
+			}
+			if p.currTask.CleanupEnvFiles != tt.expectCleanupEnvFile {
+				t.Fatalf("CleanupEnvFiles=%v, want=%v", p.currTask.CleanupEnvFiles, tt.expectCleanupEnvFile)
+			}
+			if strings.Join(p.currTask.RequireFiles, "|") != tt.expectRequireFiles {
+				t.Fatalf("RequireFiles=%q, want=%q", p.currTask.RequireFiles, tt.expectRequireFiles)
+			}
+			if p.currTask.DefaultsFile != tt.expectDefaultsFile {
+				t.Fatalf("DefaultsFile=%q, want=%q", p.currTask.DefaultsFile, tt.expectDefaultsFile)
+			}
+			if strings.Join(p.currTask.ExpandGlobInputs, "|") != tt.expectGlobInputs {
+				t.Fatalf("ExpandGlobInputs=%q, want=%q", p.currTask.ExpandGlobInputs, tt.expectGlobInputs)
+			}
+			if p.currTask.OutputFilter != tt.expectOutputFilter {
+				t.Fatalf("OutputFilter=%q, want=%q", p.currTask.OutputFilter, tt.expectOutputFilter)
+			}
+			if strings.Join(p.currTask.Vars, "|") != tt.expectVars {
+				t.Fatalf("Vars=%q, want=%q", p.currTask.Vars, tt.expectVars)
+			}
+			if p.currTask.ScriptMode != tt.expectScriptMode {
+				t.Fatalf("ScriptMode=%q, want=%q", p.currTask.ScriptMode, tt.expectScriptMode)
+			}
+			if !reflect.DeepEqual(p.currTask.ComputedEnv, tt.expectComputedEnv) {
+				t.Fatalf("ComputedEnv=%q, want=%q", p.currTask.ComputedEnv, tt.expectComputedEnv)
+			}
+			if strings.Join(p.currTask.Watch, ",") != tt.expectWatch {
+				t.Fatalf("Watch=%q, want=%q", p.currTask.Watch, tt.expectWatch)
+			}
+			if p.currTask.MaxRestarts != tt.expectMaxRestarts {
+				t.Fatalf("MaxRestarts=%d, want=%d", p.currTask.MaxRestarts, tt.expectMaxRestarts)
+			}
+			if strings.Join(p.currTask.Platforms, ",") != tt.expectPlatforms {
+				t.Fatalf("Platforms=%q, want=%q", p.currTask.Platforms, tt.expectPlatforms)
+			}
+			if strings.Join(p.currTask.Tags, ",") != tt.expectTags {
+				t.Fatalf("Tags=%q, want=%q", p.currTask.Tags, tt.expectTags)
+			}
+			if p.currTask.Parallel != tt.expectParallel {
+				t.Fatalf("Parallel=%v, want=%v", p.currTask.Parallel, tt.expectParallel)
+			}
+			if p.currTask.CreateDir != tt.expectCreateDir {
+				t.Fatalf("CreateDir=%v, want=%v", p.currTask.CreateDir, tt.expectCreateDir)
+			}
+			if strings.Join(p.currTask.Outputs, ",") != tt.expectOutputs {
+				t.Fatalf("Outputs=%q, want=%q", p.currTask.Outputs, tt.expectOutputs)
+			}
+			if p.currTask.Timeout != tt.expectTimeout {
+				t.Fatalf("Timeout=%v, want=%v", p.currTask.Timeout, tt.expectTimeout)
+			}
+			if p.currTask.Tmpfs != tt.expectTmpfs {
+				t.Fatalf("Tmpfs=%v, want=%v", p.currTask.Tmpfs, tt.expectTmpfs)
+			}
+			if p.currTask.StdinEnv != tt.expectStdinEnv {
+				t.Fatalf("StdinEnv=%q, want=%q", p.currTask.StdinEnv, tt.expectStdinEnv)
+			}
+			if p.currTask.StdinLog != tt.expectStdinLog {
+				t.Fatalf("StdinLog=%q, want=%q", p.currTask.StdinLog, tt.expectStdinLog)
+			}
+			if p.currTask.RetryCount != tt.expectRetry {
+				t.Fatalf("RetryCount=%d, want=%d", p.currTask.RetryCount, tt.expectRetry)
+			}
+			if p.currTask.RetryDelay != tt.expectRetryDelay {
+				t.Fatalf("RetryDelay=%v, want=%v", p.currTask.RetryDelay, tt.expectRetryDelay)
+			}
+			if p.currTask.RetryBackoff != tt.expectRetryBackoff {
+				t.Fatalf("RetryBackoff=%v, want=%v", p.currTask.RetryBackoff, tt.expectRetryBackoff)
+			}
+			if p.currTask.RetryMaxDelay != tt.expectRetryMaxDelay {
+				t.Fatalf("RetryMaxDelay=%v, want=%v", p.currTask.RetryMaxDelay, tt.expectRetryMaxDelay)
+			}
+			if p.currTask.Hostname != tt.expectHostname {
+				t.Fatalf("Hostname=%q, want=%q", p.currTask.Hostname, tt.expectHostname)
+			}
+			if p.currTask.MaxOpenFiles != tt.expectMaxOpenFiles {
+				t.Fatalf("MaxOpenFiles=%d, want=%d", p.currTask.MaxOpenFiles, tt.expectMaxOpenFiles)
+			}
+			if p.currTask.Test != tt.expectTest {
+				t.Fatalf("Test=%v, want=%v", p.currTask.Test, tt.expectTest)
+			}
+			if p.currTask.ValidateInputs != tt.expectValidateInputs {
+				t.Fatalf("ValidateInputs=%q, want=%q", p.currTask.ValidateInputs, tt.expectValidateInputs)
+			}
+			if p.currTask.StdinEOFTimeout != tt.expectStdinTimeout {
+				t.Fatalf("StdinEOFTimeout=%v, want=%v", p.currTask.StdinEOFTimeout, tt.expectStdinTimeout)
+			}
 		})
 	}
 }
@@ -447,3 +1286,153 @@ echo "Hello, world2!"
 		}
 	}
 }
+
+func TestRequiredBehaviourSet(t *testing.T) {
+	p, err := NewParser(strings.NewReader("# Tasks\n## migrate\n```\nmigrate\n```\n## banner\nrun: always\n```\ndate\n```\n"), "tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tasks[0].RequiredBehaviourSet {
+		t.Errorf("expected %s without the run attribute to have it unset", tasks[0].Name)
+	}
+	if !tasks[1].RequiredBehaviourSet || tasks[1].RequiredBehaviour != models.RequiredBehaviourAlways {
+		t.Errorf("expected %s to run always, got %v", tasks[1].Name, tasks[1].RequiredBehaviour)
+	}
+}
+
+func TestParseAll(t *testing.T) {
+	in := `# Project
+## Tasks
+### build
+` + "```\ngo build\n```" + `
+Tasks for CI
+------------
+### lint
+` + "```\ngo vet\n```" + `
+### test
+` + "```\ngo test\n```" + `
+## Release tasks
+### tag
+Requires: build
+## Housekeeping tasks
+### weekly
+Tidy the issue tracker.
+## Other
+`
+	blocks, err := ParseAll(strings.NewReader(in), []string{"Tasks", "tasks for ci", "Release tasks"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]string{}
+	for heading, tasks := range blocks {
+		var n []string
+		for _, task := range tasks {
+			n = append(n, task.Name)
+		}
+		names[heading] = strings.Join(n, ",")
+	}
+	expected := map[string]string{"Tasks": "build", "tasks for ci": "lint,test", "Release tasks": "tag"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("got %v, want %v", names, expected)
+	}
+	t.Run("given the default heading, NewParser should only parse that block", func(t *testing.T) {
+		p, err := NewParser(strings.NewReader(in), "tasks")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tasks, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tasks) != 1 || tasks[0].Name != "build" {
+			t.Fatalf("expected only build, got %v", tasks)
+		}
+	})
+	t.Run("given a heading ending in tasks which is not given, should not parse it", func(t *testing.T) {
+		blocks, err := ParseAll(strings.NewReader(in), []string{"Tasks"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := blocks["Housekeeping tasks"]; ok || len(blocks) != 1 {
+			t.Fatalf("expected only Tasks, got %v", blocks)
+		}
+	})
+	t.Run("given a heading which is not found, should error", func(t *testing.T) {
+		_, err := ParseAll(strings.NewReader(in), []string{"Tasks", "Deploy tasks"})
+		if !errors.Is(err, ErrNoTasksHeading) {
+			t.Fatalf("expected %v, got %v", ErrNoTasksHeading, err)
+		}
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("expected a ParseError, got %v", err)
+		}
+	})
+	t.Run("given an invalid attribute in a block, should give its line", func(t *testing.T) {
+		_, err := ParseAll(strings.NewReader(in+"## Broken tasks\n### a\nrun: never\n"), []string{"Tasks", "Broken tasks"})
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || parseErr.Line != 26 {
+			t.Fatalf("expected a ParseError on line 26, got %v", err)
+		}
+	})
+	t.Run("given no headings, should error", func(t *testing.T) {
+		_, err := ParseAll(strings.NewReader(in), nil)
+		if !errors.Is(err, ErrNoTasksHeading) {
+			t.Fatalf("expected %v, got %v", ErrNoTasksHeading, err)
+		}
+	})
+}
+
+func TestHiddenTaskNames(t *testing.T) {
+	p, err := NewParser(strings.NewReader("# Tasks\n## _compile\n```\ncc\n```\n## _emphasised_\n```\necho\n```\n## build\nRequires: `_compile`\nInherit: _compile\n"), "tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 3 || tasks[0].Name != "_compile" || tasks[1].Name != "emphasised" {
+		t.Fatalf("got %v", tasks)
+	}
+	if tasks[2].RequiresText() != "_compile" || tasks[2].Inherit != "_compile" {
+		t.Fatalf("got Requires=%v Inherit=%q, want _compile", tasks[2].DependsOn, tasks[2].Inherit)
+	}
+	if !tasks[0].IsHidden() || tasks[1].IsHidden() {
+		t.Fatal("expected only _compile to be hidden")
+	}
+}
+
+func TestParseLongLines(t *testing.T) {
+	line := strings.Repeat("x", 100*1024)
+	in := "## Tasks\n### migrate\n```\necho '" + line + "'\n```\n"
+	p, err := NewParser(strings.NewReader(in), "tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || !strings.Contains(tasks[0].ScriptText(), line) {
+		t.Fatalf("expected the long line to be parsed, got %d tasks", len(tasks))
+	}
+	t.Run("given a line longer than the maximum, should error", func(t *testing.T) {
+		p, err := NewParserWithOptions(strings.NewReader(in), "tasks", WithMaxLineSize(64*1024))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.Parse(); !errors.Is(err, bufio.ErrTooLong) {
+			t.Fatalf("expected bufio.ErrTooLong, got %v", err)
+		}
+	})
+	t.Run("given a long line before the heading, should error", func(t *testing.T) {
+		_, err := NewParserWithOptions(strings.NewReader(line+"\n"+in), "tasks", WithMaxLineSize(64*1024))
+		if !errors.Is(err, bufio.ErrTooLong) {
+			t.Fatalf("expected bufio.ErrTooLong, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/joerdav/xc/models"
+)
+
+// Validate checks tasks for errors which would stop them running, without
+// running anything, and returns all of them rather than only the first.
+// Every task required or inherited by another must exist, dependencies and
+// inherits must not be circular, and the env-files of each task must exist,
+// relative to its directory within baseDir.
+func Validate(tasks models.Tasks, baseDir string) []error {
+	var errs []error
+	for _, t := range tasks {
+		if t.ParsingError != "" {
+			errs = append(errs, fmt.Errorf("task %s has a parsing error: %s", t.Name, t.ParsingError))
+		}
+		for _, dep := range t.DependsOn {
+			if _, ok := tasks.Get(dep.Name); !ok {
+				errs = append(errs, fmt.Errorf("task %s requires %s which does not exist", t.Name, dep.Name))
+			}
+		}
+		if t.Inherit != "" {
+			if _, ok := tasks.Get(t.Inherit); !ok {
+				errs = append(errs, fmt.Errorf("task %s inherits from %s which does not exist", t.Name, t.Inherit))
+			}
+		}
+		dir := t.Dir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(baseDir, dir)
+		}
+		for _, path := range t.EnvFiles {
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			if _, err := os.Stat(path); err != nil {
+				errs = append(errs, fmt.Errorf("task %s has an env file which cannot be read: %w", t.Name, err))
+			}
+		}
+	}
+	errs = append(errs, circularDependencies(tasks)...)
+	return append(errs, circularInherits(tasks)...)
+}
@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "app"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app", ".env"), []byte("A=1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		tasks        models.Tasks
+		expectErrors []string
+	}{
+		{
+			name: "given valid tasks, should return no errors",
+			tasks: models.Tasks{
+				{Name: "build", Dir: "app", EnvFiles: []string{".env"}},
+				{Name: "test", DependsOn: []models.TaskRef{{Name: "build"}, {Name: "build", Args: []string{"arg"}}}},
+				{Name: "ci", DependsOn: []models.TaskRef{{Name: "build"}, {Name: "test"}}, Inherit: "build"},
+			},
+		},
+		{
+			name: "given several problems, should return all of them",
+			tasks: models.Tasks{
+				{Name: "build", EnvFiles: []string{".env"}},
+				{Name: "test", DependsOn: []models.TaskRef{{Name: "lint"}, {Name: "build"}}, Inherit: "base"},
+				{Name: "broken", ParsingError: "no script"},
+			},
+			expectErrors: []string{
+				"task build has an env file which cannot be read",
+				"task test requires lint which does not exist",
+				"task test inherits from base which does not exist",
+				"task broken has a parsing error: no script",
+			},
+		},
+		{
+			name: "given circular dependencies, should name the tasks in the cycle",
+			tasks: models.Tasks{
+				{Name: "a", DependsOn: []models.TaskRef{{Name: "b"}}},
+				{Name: "b", DependsOn: []models.TaskRef{{Name: "c"}}},
+				{Name: "c", DependsOn: []models.TaskRef{{Name: "a"}}},
+				{Name: "d", DependsOn: []models.TaskRef{{Name: "d"}}},
+			},
+			expectErrors: []string{
+				"circular dependency detected: a → b → c → a",
+				"circular dependency detected: d → d",
+			},
+		},
+		{
+			name: "given circular inherits, should name the tasks in the cycle",
+			tasks: models.Tasks{
+				{Name: "a", Inherit: "b"},
+				{Name: "b", Inherit: "a"},
+			},
+			expectErrors: []string{"circular inherit detected: a → b → a"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			errs := Validate(tt.tasks, dir)
+			if len(errs) != len(tt.expectErrors) {
+				t.Fatalf("expected %d errors, got %q", len(tt.expectErrors), errs)
+			}
+			for i, expect := range tt.expectErrors {
+				if !strings.HasPrefix(errs[i].Error(), expect) {
+					t.Errorf("error %d=%q, want prefix %q", i, errs[i], expect)
+				}
+			}
+		})
+	}
+}
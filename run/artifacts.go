@@ -0,0 +1,67 @@
+package run
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/joerdav/xc/models"
+	"github.com/joerdav/xc/state"
+)
+
+// artifactsDir returns the directory the artifacts of the named task are saved in.
+func (r *Runner) artifactsDir(name string) string {
+	return filepath.Join(state.Dir(r.dir, "artifacts"), state.FileName(name))
+}
+
+// saveArtifacts copies the outputs of task, if the Runner persists its
+// outputs, from dir to .xc/artifacts/<task>, replacing those saved by an
+// earlier run.
+func (r *Runner) saveArtifacts(task models.Task, dir string) error {
+	if !r.persistsOutputs(task.Name) || len(task.Outputs) == 0 {
+		return nil
+	}
+	store := r.artifactsDir(task.Name)
+	if err := os.RemoveAll(store); err != nil {
+		return fmt.Errorf("task %s: failed to remove saved outputs: %w", task.Name, err)
+	}
+	for _, output := range task.Outputs {
+		if !filepath.IsLocal(output) {
+			return fmt.Errorf("task %s: output %s is not within the directory of the task", task.Name, output)
+		}
+		if err := copyTree(filepath.Join(dir, output), filepath.Join(store, output)); err != nil {
+			return fmt.Errorf("task %s: failed to save output %s: %w", task.Name, output, err)
+		}
+	}
+	return nil
+}
+
+// persistsOutputs reports whether the Runner persists the outputs of the named task.
+func (r *Runner) persistsOutputs(name string) bool {
+	for _, n := range r.persistOutputs {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// copyTree copies the regular file, or the regular files in the directory,
+// src to dst, creating any missing directories.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info fs.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		return copyFile(path, target, info.Mode().Perm())
+	})
+}
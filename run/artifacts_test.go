@@ -0,0 +1,67 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestRunPersistOutputs(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app", "bin", "app"), "v1")
+	writeFile(t, filepath.Join(dir, "app", "report.txt"), "ok")
+	tasks := models.Tasks{
+		{Name: "build", Script: []models.ScriptBlock{{Body: "somecmd"}}, Dir: "app", Outputs: []string{"bin", "report.txt"}},
+		{Name: "lint", Script: []models.ScriptBlock{{Body: "somecmd"}}, Dir: "app", Outputs: []string{"report.txt"}},
+	}
+	newRunner := func(t *testing.T, opts ...RunnerOption) *Runner {
+		runner, err := NewRunner(tasks, dir, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runner.scriptRunner = &mockScriptRunner{}
+		return &runner
+	}
+	stored := filepath.Join(dir, ".xc", "artifacts", "build")
+
+	if err := newRunner(t).Run(context.Background(), "build", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stored); err == nil {
+		t.Fatal("expected outputs not to be saved without WithPersistOutputs")
+	}
+
+	if err := newRunner(t, WithPersistOutputs([]string{"build"})).Run(context.Background(), "build", nil); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(stored, "bin", "app")); err != nil || string(b) != "v1" {
+		t.Fatalf("expected bin/app to be saved, got %q, %v", b, err)
+	}
+	if _, err := os.Stat(filepath.Join(stored, "report.txt")); err != nil {
+		t.Fatalf("expected report.txt to be saved: %v", err)
+	}
+
+	t.Run("given a failing task, should keep the saved outputs", func(t *testing.T) {
+		writeFile(t, filepath.Join(dir, "app", "bin", "app"), "broken")
+		runner := newRunner(t, WithPersistOutputs([]string{"build"}))
+		runner.scriptRunner = &mockScriptRunner{returns: errors.New("failed")}
+		if err := runner.Run(context.Background(), "build", nil); err == nil {
+			t.Fatal("expected an error got nil")
+		}
+		if b, _ := os.ReadFile(filepath.Join(stored, "bin", "app")); string(b) != "v1" {
+			t.Fatalf("expected the saved output to be kept, got %q", b)
+		}
+	})
+	t.Run("given another task, should not save its outputs", func(t *testing.T) {
+		if err := newRunner(t, WithPersistOutputs([]string{"build"})).Run(context.Background(), "lint", nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".xc", "artifacts", "lint")); err == nil {
+			t.Fatal("expected the outputs of lint not to be saved")
+		}
+	})
+}
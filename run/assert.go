@@ -0,0 +1,72 @@
+package run
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/joerdav/xc/models"
+)
+
+// outputAssertion checks that the output of a task contains a line matching
+// each of its patterns.
+type outputAssertion struct {
+	mu       sync.Mutex
+	patterns []*regexp.Regexp
+	matched  []bool
+}
+
+// observe records which patterns match line, for use with lineWriter.
+// Lines traced by the shell are ignored, as they contain the commands of the
+// script rather than their output.
+func (a *outputAssertion) observe(line []byte) []byte {
+	text := bytes.TrimSuffix(line, []byte{newLine})
+	if bytes.HasPrefix(text, []byte("+ ")) {
+		return line
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, re := range a.patterns {
+		if re.Match(text) {
+			a.matched[i] = true
+		}
+	}
+	return line
+}
+
+func (a *outputAssertion) err(task string) error {
+	var missing []string
+	for i, re := range a.patterns {
+		if !a.matched[i] {
+			missing = append(missing, fmt.Sprintf("%q", re))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("task %s succeeded, but no line of its output matched %s", task, strings.Join(missing, ", "))
+}
+
+// assertOutput wraps the output of task to check it against the patterns given
+// by WithOutputAssertion. The returned function must be called once the task
+// has exited, it returns an error if any pattern was not matched.
+func (r *Runner) assertOutput(task models.Task, stdout, stderr io.Writer) (io.Writer, io.Writer, func() error) {
+	patterns := r.outputAssertions[task.Name]
+	if len(patterns) == 0 {
+		return stdout, stderr, func() error { return nil }
+	}
+	a := &outputAssertion{patterns: patterns, matched: make([]bool, len(patterns))}
+	// the underlying writers are closed with the rest of the task output
+	out := newLineWriter(struct{ io.Writer }{stdout}, a.observe)
+	errOut := newLineWriter(struct{ io.Writer }{stderr}, a.observe)
+	return out, errOut, func() error {
+		if err := errors.Join(out.Close(), errOut.Close()); err != nil {
+			return err
+		}
+		return a.err(task.Name)
+	}
+}
@@ -0,0 +1,87 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+// outputScriptRunner writes its script to stdout.
+type outputScriptRunner struct{}
+
+func (outputScriptRunner) Execute(ctx context.Context, e Execution) error {
+	_, err := io.WriteString(e.Stdout, e.Script)
+	return err
+}
+
+func TestAssertOutput(t *testing.T) {
+	tests := []struct {
+		name      string
+		script    string
+		patterns  []string
+		expectErr bool
+	}{
+		{
+			name:     "given output matching the pattern, should succeed",
+			script:   "building\nSuccessfully compiled\n",
+			patterns: []string{"^Successfully compiled$"},
+		},
+		{
+			name:     "given a final line without a newline, should match it",
+			script:   "building\ndone",
+			patterns: []string{"^done$"},
+		},
+		{
+			name:      "given output without a match, should fail",
+			script:    "building\nFAILED\n",
+			patterns:  []string{"Successfully compiled"},
+			expectErr: true,
+		},
+		{
+			name:      "given a match only in a traced command, should fail",
+			script:    "+ echo 'Successfully compiled'\n",
+			patterns:  []string{"Successfully compiled"},
+			expectErr: true,
+		},
+		{
+			name:      "given several patterns, all must match",
+			script:    "one\n",
+			patterns:  []string{"one", "two"},
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []RunnerOption
+			for _, p := range tt.patterns {
+				opts = append(opts, WithOutputAssertion("build", regexp.MustCompile(p)))
+			}
+			var stdout bytes.Buffer
+			opts = append(opts, WithOutput(&stdout, &stdout))
+			runner, err := NewRunner(models.Tasks{{Name: "build", Script: []models.ScriptBlock{{Body: tt.script}}}}, "", opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			runner.scriptRunner = outputScriptRunner{}
+			err = runner.Run(context.Background(), "build", nil)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("err=%v, want error=%v", err, tt.expectErr)
+			}
+			if !strings.Contains(stdout.String(), strings.Split(tt.script, "\n")[0]) {
+				t.Fatalf("expected output to be passed through, got %q", stdout.String())
+			}
+		})
+	}
+	t.Run("given an assertion for an unknown task, should error", func(t *testing.T) {
+		_, err := NewRunner(models.Tasks{{Name: "build"}}, "", WithOutputAssertion("missing", regexp.MustCompile("x")))
+		if err == nil {
+			t.Fatal("expected an error got nil")
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joerdav/xc/models"
+)
+
+// cleanupTimeout is how long a cleanup script has to run before it is killed.
+const cleanupTimeout = 5 * time.Second
+
+// cleanupOnCancel runs the cleanup script of a task once ctx is cancelled.
+// The commands of the task are sent SIGTERM, then the cleanup script runs
+// before they are killed.
+// The returned function must be called once the task has exited, it runs the
+// cleanup script if it has not already run, and ctx is cancelled.
+func (r *Runner) cleanupOnCancel(ctx context.Context, task models.Task, e *Execution) (wait func() error) {
+	script := task.Cleanup
+	if script == "" {
+		script = r.cleanupScript
+	}
+	if script == "" {
+		return func() error { return nil }
+	}
+	cleanupExec := *e
+	var once sync.Once
+	var err error
+	cleanup := func() {
+		once.Do(func() {
+			if ctx.Err() != nil {
+				err = r.runCleanup(ctx, task, cleanupExec, script)
+			}
+		})
+	}
+	e.interrupted = cleanup
+	return func() error {
+		cleanup()
+		return err
+	}
+}
+
+func (r *Runner) runCleanup(ctx context.Context, task models.Task, e Execution, script string) error {
+	cleanupCtx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	var prefix string
+	if !task.Interactive {
+		prefix = strings.TrimSpace(task.Name) + " cleanup"
+	}
+	stdout, stderr, closeOutput := r.taskOutput(prefix, nil)
+	e.Script = script
+	e.Env = append(e.Env[:len(e.Env):len(e.Env)],
+		"XC_TASK_NAME="+task.Name,
+		"XC_KILL_REASON="+killReason(ctx.Err()),
+	)
+	e.Stdin = nil
+	e.Stdout, e.Stderr = stdout, stderr
+	err := r.scriptRunner.Execute(cleanupCtx, e)
+	if errors.Is(cleanupCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("cleanup of %s did not finish within %s", task.Name, cleanupTimeout)
+	} else if err != nil {
+		err = fmt.Errorf("cleanup of %s failed: %w", task.Name, err)
+	}
+	return errors.Join(err, closeOutput())
+}
+
+// killReason describes why a task was stopped, given the error of its context.
+func killReason(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	return "cancelled"
+}
@@ -0,0 +1,125 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+// blockingScriptRunner blocks running script until it is cancelled, then
+// interrupts it, and records the executions of any other script.
+type blockingScriptRunner struct {
+	script  string
+	started chan struct{}
+	mu      sync.Mutex
+	others  []Execution
+	// interrupted is the number of other scripts run by the time script was interrupted
+	interrupted int
+}
+
+func (r *blockingScriptRunner) Execute(ctx context.Context, e Execution) error {
+	if e.Script == r.script {
+		close(r.started)
+		<-ctx.Done()
+		e.interrupt()
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.interrupted = len(r.others)
+		return ctx.Err()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.others = append(r.others, e)
+	return nil
+}
+
+func TestCleanupOnCancel(t *testing.T) {
+	tests := []struct {
+		name          string
+		cleanup       string
+		cleanupScript string
+		expected      string
+	}{
+		{
+			name:     "given a task with cleanup, should run it when cancelled",
+			cleanup:  "task-cleanup",
+			expected: "task-cleanup",
+		},
+		{
+			name:          "given a default cleanup script, should run it when cancelled",
+			cleanupScript: "default-cleanup",
+			expected:      "default-cleanup",
+		},
+		{
+			name:          "given both, the task cleanup takes precedence",
+			cleanup:       "task-cleanup",
+			cleanupScript: "default-cleanup",
+			expected:      "task-cleanup",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{Name: "task", Script: []models.ScriptBlock{{Body: "main"}}, Cleanup: tt.cleanup, Interactive: true},
+			}, "", WithCleanupScript(tt.cleanupScript))
+			if err != nil {
+				t.Fatal(err)
+			}
+			scriptRunner := &blockingScriptRunner{script: "main", started: make(chan struct{})}
+			runner.scriptRunner = scriptRunner
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				<-scriptRunner.started
+				cancel()
+			}()
+			err = runner.Run(ctx, "task", nil)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected context.Canceled, got %v", err)
+			}
+			if len(scriptRunner.others) != 1 {
+				t.Fatalf("expected cleanup to run once, ran %d times", len(scriptRunner.others))
+			}
+			if scriptRunner.interrupted != 1 {
+				t.Fatal("expected cleanup to run before the task exited")
+			}
+			e := scriptRunner.others[0]
+			if e.Script != tt.expected {
+				t.Fatalf("script=%q, want %q", e.Script, tt.expected)
+			}
+			env := strings.Join(e.Env, ",")
+			if !strings.HasSuffix(env, "XC_TASK_NAME=task,XC_KILL_REASON=cancelled") {
+				t.Fatalf("env=%s, want XC_TASK_NAME and XC_KILL_REASON", env)
+			}
+		})
+	}
+	t.Run("given a task which is not cancelled, should not run cleanup", func(t *testing.T) {
+		runner, err := NewRunner(models.Tasks{
+			{Name: "task", Script: []models.ScriptBlock{{Body: "main"}}, Cleanup: "cleanup"},
+		}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptRunner := &mockScriptRunner{}
+		runner.scriptRunner = scriptRunner
+		if err := runner.Run(context.Background(), "task", nil); err != nil {
+			t.Fatal(err)
+		}
+		if scriptRunner.calls != 1 {
+			t.Fatalf("expected only the task to run, got %d runs", scriptRunner.calls)
+		}
+	})
+}
+
+func TestKillReason(t *testing.T) {
+	if r := killReason(context.DeadlineExceeded); r != "timeout" {
+		t.Fatalf("got %q, want timeout", r)
+	}
+	if r := killReason(context.Canceled); r != "cancelled" {
+		t.Fatalf("got %q, want cancelled", r)
+	}
+}
@@ -0,0 +1,54 @@
+package run
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// dedupState records the tasks which have run, or are running, during one
+// call to Run, so that a task required more than once only runs once.
+type dedupState struct {
+	mu   sync.Mutex
+	runs map[string]*dedupRun
+}
+
+type dedupRun struct {
+	done chan struct{}
+	err  error
+}
+
+func newDedupState() *dedupState {
+	return &dedupState{runs: map[string]*dedupRun{}}
+}
+
+// dedupKey identifies a task required with inputs, so that a task required
+// with different inputs still runs for each of them.
+func dedupKey(name string, inputs []string) string {
+	return strings.Join(append([]string{name}, inputs...), "\x00")
+}
+
+// claim returns true and a function to record the result of running key, if
+// key has not been claimed already. Otherwise it waits for the claimed run to
+// finish and returns false and its error.
+func (d *dedupState) claim(ctx context.Context, key string) (bool, func(error), error) {
+	d.mu.Lock()
+	run, ok := d.runs[key]
+	if !ok {
+		run = &dedupRun{done: make(chan struct{})}
+		d.runs[key] = run
+	}
+	d.mu.Unlock()
+	if !ok {
+		return true, func(err error) {
+			run.err = err
+			close(run.done)
+		}, nil
+	}
+	select {
+	case <-run.done:
+		return false, nil, run.err
+	case <-ctx.Done():
+		return false, nil, ctx.Err()
+	}
+}
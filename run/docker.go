@@ -0,0 +1,76 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDockerHost = "unix:///var/run/docker.sock"
+	dockerPingTimeout = 5 * time.Second
+)
+
+// ErrDockerUnavailable is returned when a task requires Docker but the daemon cannot be reached.
+var ErrDockerUnavailable = errors.New("docker is required but the daemon is not accessible")
+
+// pingDocker checks that the Docker daemon configured by DOCKER_HOST is responding.
+func pingDocker(ctx context.Context) error {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = defaultDockerHost
+	}
+	client, url, err := dockerClient(host)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDockerUnavailable, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, dockerPingTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/v1.24/_ping", http.NoBody)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDockerUnavailable, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w at %s, is it running? %v", ErrDockerUnavailable, host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w at %s: ping returned %s", ErrDockerUnavailable, host, resp.Status)
+	}
+	return nil
+}
+
+// dockerClient returns a client and base URL for a DOCKER_HOST value.
+func dockerClient(host string) (*http.Client, string, error) {
+	scheme, addr, ok := strings.Cut(host, "://")
+	if !ok {
+		return nil, "", fmt.Errorf("invalid DOCKER_HOST %q", host)
+	}
+	switch scheme {
+	case "unix":
+		if runtime.GOOS == "windows" {
+			return nil, "", fmt.Errorf("unsupported DOCKER_HOST %q", host)
+		}
+		var d net.Dialer
+		return &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return d.DialContext(ctx, "unix", addr)
+				},
+			},
+		}, "http://docker", nil
+	case "tcp", "http":
+		return http.DefaultClient, "http://" + addr, nil
+	case "https":
+		return http.DefaultClient, "https://" + addr, nil
+	default:
+		return nil, "", fmt.Errorf("unsupported DOCKER_HOST %q", host)
+	}
+}
@@ -0,0 +1,87 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestPingDocker(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not supported for DOCKER_HOST on windows")
+	}
+	sock := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1.24/_ping" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("OK")) //nolint:errcheck
+	})}
+	go srv.Serve(l) //nolint:errcheck
+	defer srv.Close()
+
+	t.Setenv("DOCKER_HOST", "unix://"+sock)
+	if err := pingDocker(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Setenv("DOCKER_HOST", "unix://"+filepath.Join(t.TempDir(), "missing.sock"))
+	if err := pingDocker(context.Background()); !errors.Is(err, ErrDockerUnavailable) {
+		t.Fatalf("expected %v, got %v", ErrDockerUnavailable, err)
+	}
+}
+
+func TestRunRequiresDocker(t *testing.T) {
+	tasks := models.Tasks{
+		{Name: "build", Script: []models.ScriptBlock{{Body: "docker build ."}}, RequiresDocker: true},
+		{Name: "deploy", Script: []models.ScriptBlock{{Body: "somecmd"}}, DependsOn: []models.TaskRef{{Name: "build"}}},
+		{Name: "lint", Script: []models.ScriptBlock{{Body: "somecmd"}}},
+	}
+	tests := []struct {
+		name          string
+		taskName      string
+		requireDocker bool
+		expectPing    bool
+	}{
+		{name: "given a task requiring docker, should ping", taskName: "build", expectPing: true},
+		{name: "given a dependency requiring docker, should ping", taskName: "deploy", expectPing: true},
+		{name: "given no task requiring docker, should not ping", taskName: "lint"},
+		{name: "given docker is required globally, should ping", taskName: "lint", requireDocker: true, expectPing: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(tasks, "", WithRequireDocker(tt.requireDocker))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var pinged bool
+			runner.dockerPing = func(context.Context) error {
+				pinged = true
+				return ErrDockerUnavailable
+			}
+			scriptRunner := &mockScriptRunner{}
+			runner.scriptRunner = scriptRunner
+			err = runner.Run(context.Background(), tt.taskName, nil)
+			if pinged != tt.expectPing {
+				t.Fatalf("pinged=%v, want=%v", pinged, tt.expectPing)
+			}
+			if (err != nil) != tt.expectPing {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.expectPing && scriptRunner.calls != 0 {
+				t.Fatal("expected no tasks to run")
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/joerdav/xc/models"
+)
+
+// dynamicEnv runs the dynamic env script of the Runner, then the dynamic-env
+// script of task, with env set, and returns the KEY=VALUE lines they write to
+// stdout. Each script sees the variables written by the one before it.
+func (r *Runner) dynamicEnv(ctx context.Context, task models.Task, env []string) ([]string, error) {
+	var vars []string
+	for _, script := range []string{r.dynamicEnvScript, task.DynamicEnv} {
+		if script == "" {
+			continue
+		}
+		var stdout, stderr bytes.Buffer
+		err := r.scriptRunner.Execute(ctx, Execution{
+			Script: script,
+			Env:    append(env[:len(env):len(env)], vars...),
+			Dir:    r.getExecutionPath(task),
+			Stdin:  strings.NewReader(""),
+			Stdout: &stdout,
+			Stderr: &stderr,
+		})
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("dynamic env of %s failed: %w: %s", task.Name, err, msg)
+			}
+			return nil, fmt.Errorf("dynamic env of %s failed: %w", task.Name, err)
+		}
+		v, err := parseEnvFile(&stdout)
+		if err != nil {
+			return nil, fmt.Errorf("dynamic env of %s: %w", task.Name, err)
+		}
+		vars = append(vars, v...)
+	}
+	return vars, nil
+}
+
+// computedEnv runs the command of each computed variable of the Runner, then
+// of task, with env set, and returns the variables set to their trimmed
+// stdout. Each command sees the variables computed before it.
+func (r *Runner) computedEnv(ctx context.Context, task models.Task, env []string) ([]string, error) {
+	var vars []string
+	for _, v := range append(r.computedVars[:len(r.computedVars):len(r.computedVars)], task.ComputedEnv...) {
+		var stdout, stderr bytes.Buffer
+		err := r.scriptRunner.Execute(ctx, Execution{
+			Script: v.Command,
+			Env:    append(env[:len(env):len(env)], vars...),
+			Dir:    r.getExecutionPath(task),
+			Stdin:  strings.NewReader(""),
+			Stdout: &stdout,
+			Stderr: &stderr,
+		})
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("computed env %s of %s failed: %w: %s", v.Name, task.Name, err, msg)
+			}
+			return nil, fmt.Errorf("computed env %s of %s failed: %w", v.Name, task.Name, err)
+		}
+		vars = append(vars, v.Name+"="+strings.TrimSpace(stdout.String()))
+	}
+	return vars, nil
+}
+
+// varsHeredoc ends the heredoc which vars are expanded in.
+const varsHeredoc = "XC_VARS_EOF"
+
+// taskVars returns the vars of task, with values containing $ or ` expanded
+// by the shell of the task, with env set. Each value sees the vars before it.
+func (r *Runner) taskVars(ctx context.Context, task models.Task, env []string) ([]string, error) {
+	var vars []string
+	for _, v := range task.Vars {
+		name, value, _ := strings.Cut(v, "=")
+		if !strings.ContainsAny(value, "$`") {
+			vars = append(vars, v)
+			continue
+		}
+		var stdout, stderr bytes.Buffer
+		err := r.scriptRunner.Execute(ctx, Execution{
+			// an unquoted heredoc expands the value as a double quoted string would,
+			// without needing to escape quotes in it
+			Script: "cat <<" + varsHeredoc + "\n" + value + "\n" + varsHeredoc + "\n",
+			Env:    append(env[:len(env):len(env)], vars...),
+			Dir:    r.getExecutionPath(task),
+			Shell:  task.Shell,
+			Stdin:  strings.NewReader(""),
+			Stdout: &stdout,
+			Stderr: &stderr,
+		})
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return nil, fmt.Errorf("var %s of %s failed: %w: %s", name, task.Name, err, msg)
+			}
+			return nil, fmt.Errorf("var %s of %s failed: %w", name, task.Name, err)
+		}
+		vars = append(vars, name+"="+strings.TrimSuffix(stdout.String(), "\n"))
+	}
+	return vars, nil
+}
@@ -0,0 +1,284 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+// envScriptRunner writes scripts starting with "vars:" to stdout, without
+// the prefix, fails scripts starting with "fail", and records the
+// environment of the rest.
+type envScriptRunner struct {
+	mu  sync.Mutex
+	env []string
+}
+
+func (r *envScriptRunner) Execute(ctx context.Context, e Execution) error {
+	switch {
+	case strings.HasPrefix(e.Script, "vars:"):
+		_, err := io.WriteString(e.Stdout, strings.TrimPrefix(e.Script, "vars:"))
+		return err
+	case strings.HasPrefix(e.Script, "fail"):
+		_, _ = io.WriteString(e.Stderr, "permission denied\n")
+		return errors.New("exit status 1")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.env = e.Env
+	return nil
+}
+
+func TestRunWithDynamicEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		global    string
+		task      string
+		expectEnv map[string]string
+		expectErr string
+	}{
+		{
+			name:      "given dynamic-env, should add its output to the environment",
+			task:      "vars:TOKEN=abc\nexport REGION='eu'\n",
+			expectEnv: map[string]string{"TOKEN": "abc", "REGION": "eu"},
+		},
+		{
+			name:      "given -task-env-expand-from-script, should run it before dynamic-env",
+			global:    "vars:TOKEN=global\nA=1\n",
+			task:      "vars:TOKEN=task\n",
+			expectEnv: map[string]string{"A": "1", "TOKEN": "task"},
+		},
+		{
+			name:      "given a failing script, should not run the task",
+			task:      "fail",
+			expectErr: "dynamic env of task failed: exit status 1: permission denied",
+		},
+		{
+			name:      "given output which is not KEY=VALUE, should not run the task",
+			task:      "vars:token\n",
+			expectErr: "dynamic env of task: line 1: expected KEY=VALUE",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, DynamicEnv: tt.task},
+			}, "", WithDynamicEnv(tt.global))
+			if err != nil {
+				t.Fatal(err)
+			}
+			scriptRunner := &envScriptRunner{}
+			runner.scriptRunner = scriptRunner
+			err = runner.Run(context.Background(), "task", nil)
+			if tt.expectErr != "" {
+				if err == nil || err.Error() != tt.expectErr {
+					t.Fatalf("expected error %q, got %v", tt.expectErr, err)
+				}
+				if scriptRunner.env != nil {
+					t.Fatal("expected the task not to run")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, expect := range tt.expectEnv {
+				if v, _ := lookupEnv(scriptRunner.env, name); v != expect {
+					t.Errorf("%s=%q, want %q", name, v, expect)
+				}
+			}
+		})
+	}
+}
+
+func TestRunWithComputedEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		global    []models.ComputedVar
+		task      []models.ComputedVar
+		expectEnv map[string]string
+		expectErr string
+	}{
+		{
+			name:      "given computed-env, should set the trimmed output",
+			task:      []models.ComputedVar{{Name: "PORT", Command: "vars:8080\n"}},
+			expectEnv: map[string]string{"PORT": "8080"},
+		},
+		{
+			name:      "given -task-env-from-process-substitution, should compute it before computed-env",
+			global:    []models.ComputedVar{{Name: "PORT", Command: "vars:1"}, {Name: "HOST", Command: "vars:localhost"}},
+			task:      []models.ComputedVar{{Name: "PORT", Command: "vars:2"}},
+			expectEnv: map[string]string{"PORT": "2", "HOST": "localhost"},
+		},
+		{
+			name:      "given a failing command, should not run the task",
+			task:      []models.ComputedVar{{Name: "TOKEN", Command: "fail"}},
+			expectErr: "computed env TOKEN of task failed: exit status 1: permission denied",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, ComputedEnv: tt.task},
+			}, "", WithComputedEnv(tt.global))
+			if err != nil {
+				t.Fatal(err)
+			}
+			scriptRunner := &envScriptRunner{}
+			runner.scriptRunner = scriptRunner
+			err = runner.Run(context.Background(), "task", nil)
+			if tt.expectErr != "" {
+				if err == nil || err.Error() != tt.expectErr {
+					t.Fatalf("expected error %q, got %v", tt.expectErr, err)
+				}
+				if scriptRunner.env != nil {
+					t.Fatal("expected the task not to run")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, expect := range tt.expectEnv {
+				if v, _ := lookupEnv(scriptRunner.env, name); v != expect {
+					t.Errorf("%s=%q, want %q", name, v, expect)
+				}
+			}
+		})
+	}
+}
+
+// varsScriptRunner expands vars with the built-in shell, and records the env
+// of every other script by its body.
+type varsScriptRunner struct {
+	mu   sync.Mutex
+	envs map[string][]string
+}
+
+func (r *varsScriptRunner) Execute(ctx context.Context, e Execution) error {
+	if strings.HasPrefix(e.Script, "cat <<"+varsHeredoc) {
+		return newInterpreter().Execute(ctx, e)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.envs[e.Script] = e.Env
+	return nil
+}
+
+func TestRunWithVars(t *testing.T) {
+	runner, err := NewRunner(models.Tasks{
+		{Name: "lint", Script: []models.ScriptBlock{{Body: "lint"}}},
+		{Name: "test", Script: []models.ScriptBlock{{Body: "test"}}},
+		{
+			Name:      "build",
+			Script:    []models.ScriptBlock{{Body: "build"}},
+			DependsOn: []models.TaskRef{{Name: "lint"}, {Name: "test"}},
+			Env:       []string{"NAME=app"},
+			Vars:      []string{"VERSION=1.2.3", `TAG=$NAME:v$VERSION-$(echo "a b")`, "PLAIN=it's"},
+		},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptRunner := &varsScriptRunner{envs: map[string][]string{}}
+	runner.scriptRunner = scriptRunner
+	if err := runner.Run(context.Background(), "build", nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, expect := range map[string]string{"VERSION": "1.2.3", "TAG": "app:v1.2.3-a b", "PLAIN": "it's"} {
+		if v, _ := lookupEnv(scriptRunner.envs["build"], name); v != expect {
+			t.Errorf("%s=%q, want %q", name, v, expect)
+		}
+	}
+	for _, dep := range []string{"lint", "test"} {
+		if _, ok := lookupEnv(scriptRunner.envs[dep], "VERSION"); ok {
+			t.Errorf("expected VERSION not to be set for %s", dep)
+		}
+	}
+	t.Run("given an invalid expression, should not run the task", func(t *testing.T) {
+		runner, err := NewRunner(models.Tasks{
+			{Name: "build", Script: []models.ScriptBlock{{Body: "build"}}, Vars: []string{"TOKEN=$(echo"}},
+		}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptRunner := &varsScriptRunner{envs: map[string][]string{}}
+		runner.scriptRunner = scriptRunner
+		err = runner.Run(context.Background(), "build", nil)
+		if err == nil || !strings.HasPrefix(err.Error(), "var TOKEN of build failed") {
+			t.Fatalf("expected the var to fail, got %v", err)
+		}
+		if len(scriptRunner.envs) != 0 {
+			t.Fatal("expected the task not to run")
+		}
+	})
+}
+
+func TestRunEnvAfterDependencies(t *testing.T) {
+	dir := t.TempDir()
+	var out strings.Builder
+	runner, err := NewRunner(models.Tasks{
+		{Name: "gen", Script: []models.ScriptBlock{{Body: "echo 'echo REGION=eu' > region.sh\nexport LOGIN=yes\n"}}},
+		{
+			Name:       "task",
+			Script:     []models.ScriptBlock{{Body: `test "$REGION" = eu && test "$LOGIN" = yes` + "\n"}},
+			DependsOn:  []models.TaskRef{{Name: "gen"}},
+			DynamicEnv: "sh region.sh",
+		},
+	}, dir, WithPersistEnv(true), WithOutput(&out, &out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Run(context.Background(), "task", nil); err != nil {
+		t.Fatalf("expected the env of task to come from gen: %v\n%s", err, out.String())
+	}
+	t.Run("given a failing dynamic-env, should run the dependencies first", func(t *testing.T) {
+		runner, err := NewRunner(models.Tasks{
+			{Name: "dep", Script: []models.ScriptBlock{{Body: "dep"}}},
+			{Name: "task", Script: []models.ScriptBlock{{Body: "task"}}, DependsOn: []models.TaskRef{{Name: "dep"}}, DynamicEnv: "fail"},
+		}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptRunner := &envScriptRunner{}
+		runner.scriptRunner = scriptRunner
+		if err := runner.Run(context.Background(), "task", nil); err == nil {
+			t.Fatal("expected an error got nil")
+		}
+		if scriptRunner.env == nil {
+			t.Fatal("expected the dependency to run")
+		}
+	})
+	t.Run("given invalid inputs, should not run the dependencies", func(t *testing.T) {
+		tests := map[string]models.Task{
+			"missing":  {Name: "task", Script: []models.ScriptBlock{{Body: "task"}}, DependsOn: []models.TaskRef{{Name: "dep"}}, Inputs: []models.Input{{Name: "XC_TEST_MISSING_INPUT"}}},
+			"validate": {Name: "task", Script: []models.ScriptBlock{{Body: "task"}}, DependsOn: []models.TaskRef{{Name: "dep"}}, ValidateInputs: "fail"},
+		}
+		for name, task := range tests {
+			t.Run(name, func(t *testing.T) {
+				runner, err := NewRunner(models.Tasks{
+					{Name: "dep", Script: []models.ScriptBlock{{Body: "dep"}}},
+					task,
+				}, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				scriptRunner := &envScriptRunner{}
+				runner.scriptRunner = scriptRunner
+				if err := runner.Run(context.Background(), "task", nil); err == nil {
+					t.Fatal("expected an error got nil")
+				}
+				if scriptRunner.env != nil {
+					t.Fatal("expected the dependency not to run")
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,209 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/joerdav/xc/models"
+)
+
+// inheritedEnv returns the environment of the xc process which is passed to task.
+// If an allowlist is configured, only matching variables are inherited, and
+// variables matching the blocklist are never inherited.
+// The inputs of the task are inherited even if they do not match the allowlist.
+func (r *Runner) inheritedEnv(task models.Task) []string {
+	env := os.Environ()
+	if len(r.envWhitelist) == 0 && len(r.envBlacklist) == 0 {
+		return env
+	}
+	result := make([]string, 0, len(env))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if matchesAny(r.envBlacklist, name) {
+			continue
+		}
+		if len(r.envWhitelist) > 0 && !matchesAny(r.envWhitelist, name) && !isInput(task, name) {
+			continue
+		}
+		result = append(result, kv)
+	}
+	return result
+}
+
+// workDirEnv returns PWD set to the absolute path of the directory task runs
+// in, if the Runner does not let tasks inherit the working directory of xc.
+func (r *Runner) workDirEnv(task models.Task) ([]string, error) {
+	if !r.noInheritCwd {
+		return nil, nil
+	}
+	abs, err := filepath.Abs(r.getExecutionPath(task))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve the directory of task %s: %w", task.Name, err)
+	}
+	return []string{"PWD=" + abs}, nil
+}
+
+// matchesAny reports whether name matches any of the glob patterns.
+func matchesAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isInput(task models.Task, name string) bool {
+	for _, in := range task.Inputs {
+		if in.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// expandEnvRefs expands $VAR and ${VAR} references in the values of vars,
+// using base and the preceding entries of vars. Unset variables expand to "".
+func expandEnvRefs(base, vars []string) []string {
+	values := map[string]string{}
+	for _, kv := range base {
+		name, value, _ := strings.Cut(kv, "=")
+		values[name] = value
+	}
+	result := make([]string, len(vars))
+	for i, kv := range vars {
+		name, value, _ := strings.Cut(kv, "=")
+		value = os.Expand(value, func(ref string) string { return values[ref] })
+		values[name] = value
+		result[i] = name + "=" + value
+	}
+	return result
+}
+
+// interpolate returns script, from task, with $VAR and ${VAR} references to
+// variables in env expanded, if the Runner is configured to and the task
+// has not opted out. References to other variables are left to the shell.
+func (r *Runner) interpolate(task models.Task, script string, env []string) string {
+	if !r.interpolateScripts || task.NoInterpolate {
+		return script
+	}
+	return os.Expand(script, func(name string) string {
+		if value, ok := lookupEnv(env, name); ok {
+			return value
+		}
+		return "${" + name + "}"
+	})
+}
+
+// inputValues returns the variables supplied for the inputs of task by WithTaskInputs.
+func (r *Runner) inputValues(task models.Task) []string {
+	var result []string
+	for _, kv := range r.taskInputs[task.Name] {
+		name, _, _ := strings.Cut(kv, "=")
+		if isInput(task, name) {
+			result = append(result, kv)
+		}
+	}
+	return result
+}
+
+// inputDefaults returns the defaults for the inputs of task, from the
+// Runner and then its defaults-file, so the defaults-file takes precedence.
+func (r *Runner) inputDefaults(task models.Task) ([]string, error) {
+	if task.DefaultsFile == "" {
+		return r.defaultInputs, nil
+	}
+	path := task.DefaultsFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(r.getExecutionPath(task), path)
+	}
+	values, err := ReadEnvFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read defaults-file of task %s: %w", task.Name, err)
+	}
+	return append(r.defaultInputs[:len(r.defaultInputs):len(r.defaultInputs)], values...), nil
+}
+
+// secretRegexp matches the names of environment variables which are likely to hold secrets.
+var secretRegexp = regexp.MustCompile(`(?i)secret|token|passw(or)?d|credential|api_?key|private_?key|auth`)
+
+// maskedValue replaces the values of secrets in logged environments.
+const maskedValue = "****"
+
+// logEnv writes the resolved environment of a task, one KEY=VALUE per line, to w.
+// The values of likely secrets are masked unless the Runner is configured not to.
+func (r *Runner) logEnv(env []string, w io.WriteCloser) error {
+	for _, kv := range resolveEnv(env) {
+		name, value, _ := strings.Cut(kv, "=")
+		if r.maskSecrets && secretRegexp.MatchString(name) {
+			value = maskedValue
+		}
+		if len(r.inputMasks) > 0 {
+			value = string(r.maskedInputs.line([]byte(value)))
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", name, value); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// logWorkDir writes the absolute path of dir, the directory a task runs in, to w.
+func logWorkDir(dir string, w io.WriteCloser) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "working directory: %s\n", abs); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// writeScriptLog writes script to w, with the values of likely secrets in env
+// and text matching the output mask patterns of the Runner redacted.
+func (r *Runner) writeScriptLog(script string, env []string, w io.WriteCloser) error {
+	if r.maskSecrets {
+		for _, kv := range resolveEnv(env) {
+			name, value, _ := strings.Cut(kv, "=")
+			if value != "" && secretRegexp.MatchString(name) {
+				script = strings.ReplaceAll(script, value, maskedValue)
+			}
+		}
+	}
+	for _, re := range r.maskPatterns {
+		script = re.ReplaceAllLiteralString(script, string(redacted))
+	}
+	if len(r.inputMasks) > 0 {
+		script = string(r.maskedInputs.line([]byte(script)))
+	}
+	if _, err := fmt.Fprintf(w, "script:\n%s\n", indent(script)); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// resolveEnv returns env with only the last value of each variable, sorted by name.
+func resolveEnv(env []string) []string {
+	values := map[string]string{}
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		values[name] = kv
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := make([]string, len(names))
+	for i, name := range names {
+		result[i] = values[name]
+	}
+	return result
+}
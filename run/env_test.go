@@ -0,0 +1,273 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestInheritedEnv(t *testing.T) {
+	t.Setenv("XC_TEST_ALLOWED", "1")
+	t.Setenv("XC_TEST_DENIED", "1")
+	t.Setenv("XC_TEST_INPUT", "1")
+	tests := []struct {
+		name      string
+		whitelist []string
+		blacklist []string
+		expect    map[string]bool
+	}{
+		{
+			name: "given no whitelist, should inherit everything",
+			expect: map[string]bool{
+				"XC_TEST_ALLOWED": true,
+				"XC_TEST_DENIED":  true,
+				"XC_TEST_INPUT":   true,
+			},
+		},
+		{
+			name:      "given a whitelist, should inherit matches and inputs",
+			whitelist: []string{"*_ALLOWED"},
+			expect: map[string]bool{
+				"XC_TEST_ALLOWED": true,
+				"XC_TEST_DENIED":  false,
+				"XC_TEST_INPUT":   true,
+			},
+		},
+		{
+			name:      "given a blacklist, should inherit everything else",
+			blacklist: []string{"*_DENIED"},
+			expect: map[string]bool{
+				"XC_TEST_ALLOWED": true,
+				"XC_TEST_DENIED":  false,
+				"XC_TEST_INPUT":   true,
+			},
+		},
+		{
+			name:      "given a blacklisted input, should not inherit it",
+			whitelist: []string{"XC_TEST_*"},
+			blacklist: []string{"XC_TEST_INPUT"},
+			expect: map[string]bool{
+				"XC_TEST_ALLOWED": true,
+				"XC_TEST_DENIED":  true,
+				"XC_TEST_INPUT":   false,
+			},
+		},
+		{
+			name:      "given a whitelist and blacklist, should apply both",
+			whitelist: []string{"XC_TEST_*"},
+			blacklist: []string{"*_DENIED"},
+			expect: map[string]bool{
+				"XC_TEST_ALLOWED": true,
+				"XC_TEST_DENIED":  false,
+				"XC_TEST_INPUT":   true,
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := Runner{envWhitelist: tt.whitelist, envBlacklist: tt.blacklist}
+			env := r.inheritedEnv(models.Task{Inputs: []models.Input{{Name: "XC_TEST_INPUT"}}})
+			for name, want := range tt.expect {
+				if got := environmentContainsInput(env, name); got != want {
+					t.Errorf("%s inherited=%v, want=%v", name, got, want)
+				}
+			}
+			if len(tt.whitelist) > 0 && environmentContainsInput(env, "PATH") {
+				t.Errorf("unexpected PATH in %s", strings.Join(env, ","))
+			}
+		})
+	}
+}
+
+func TestLogEnv(t *testing.T) {
+	env := []string{"B=2", "GITHUB_TOKEN=abc", "A=1", "B=3", "DB_PASSWORD=hunter2"}
+	tests := []struct {
+		name        string
+		maskSecrets bool
+		logFile     bool
+		expected    string
+	}{
+		{
+			name:        "given mask secrets, should mask them",
+			maskSecrets: true,
+			expected:    "A=1\nB=3\nDB_PASSWORD=****\nGITHUB_TOKEN=****\n",
+		},
+		{
+			name:     "given no mask secrets, should show them",
+			expected: "A=1\nB=3\nDB_PASSWORD=hunter2\nGITHUB_TOKEN=abc\n",
+		},
+		{
+			name:        "given a log file, should write to it with a prefix",
+			maskSecrets: true,
+			logFile:     true,
+			expected:    "\x1b[0mtask｜ A=1\n\x1b[0mtask｜ B=3\n\x1b[0mtask｜ DB_PASSWORD=****\n\x1b[0mtask｜ GITHUB_TOKEN=****\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, logFile bytes.Buffer
+			r := Runner{maskSecrets: tt.maskSecrets}
+			if tt.logFile {
+				r.logFile = &logFile
+			}
+			if err := r.logEnv(env, r.infoWriter("task", &stdout)); err != nil {
+				t.Fatal(err)
+			}
+			got := stdout.String()
+			if tt.logFile {
+				if stdout.Len() > 0 {
+					t.Fatalf("expected nothing on stdout, got %q", stdout.String())
+				}
+				got = logFile.String()
+			}
+			if got != tt.expected {
+				t.Fatalf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunWorkDirLog(t *testing.T) {
+	dir := t.TempDir()
+	var out bytes.Buffer
+	runner, err := NewRunner(models.Tasks{
+		{Name: "build", Script: []models.ScriptBlock{{Body: "somecmd"}}, Dir: "app", CreateDir: true},
+	}, dir, WithWorkDirLog(true), WithOutput(&out, &out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.scriptRunner = &mockScriptRunner{}
+	if err := runner.Run(context.Background(), "build", nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := "working directory: " + filepath.Join(dir, "app") + "\n"
+	if !strings.Contains(out.String(), expected) {
+		t.Fatalf("expected %q in output, got %q", expected, out.String())
+	}
+}
+
+func TestRunNoInheritCwd(t *testing.T) {
+	t.Setenv("PWD", "/caller")
+	dir := t.TempDir()
+	tests := []struct {
+		name      string
+		noInherit bool
+		taskDir   string
+		expected  string
+	}{
+		{name: "given no flag, should inherit PWD from xc", expected: "/caller"},
+		{name: "given no-inherit-cwd, should set PWD to the directory of the markdown file", noInherit: true, expected: dir},
+		{name: "given no-inherit-cwd and a relative dir, should resolve it from the markdown file", noInherit: true, taskDir: "web", expected: filepath.Join(dir, "web")},
+		{name: "given no-inherit-cwd and an absolute dir, should use it", noInherit: true, taskDir: "/srv/app", expected: "/srv/app"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{Name: "build", Script: []models.ScriptBlock{{Body: "somecmd"}}, Dir: tt.taskDir},
+			}, dir, WithNoInheritCwd(tt.noInherit))
+			if err != nil {
+				t.Fatal(err)
+			}
+			scriptRunner := &mockScriptRunner{}
+			runner.scriptRunner = scriptRunner
+			if err := runner.Run(context.Background(), "build", nil); err != nil {
+				t.Fatal(err)
+			}
+			if pwd, _ := lookupEnv(scriptRunner.executions[0].Env, "PWD"); pwd != tt.expected {
+				t.Fatalf("PWD=%q, want %q", pwd, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExpandEnvRefs(t *testing.T) {
+	base := []string{"HOST=localhost", "PORT=1"}
+	vars := []string{"PORT=8080", "BASE_URL=http://$HOST:${PORT}", "MISSING=$NOPE", "LITERAL=a=b"}
+	got := expandEnvRefs(base, vars)
+	expected := []string{"PORT=8080", "BASE_URL=http://localhost:8080", "MISSING=", "LITERAL=a=b"}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("got %v, want %v", got, expected)
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	env := []string{"HOST=old", "HOST=example.com", "PORT=8080"}
+	script := `curl "$HOST:${PORT}/${PATH_SUFFIX:-x}" $1 $? $(date) ${UNSET}`
+	tests := []struct {
+		name          string
+		interpolate   bool
+		noInterpolate bool
+		expected      string
+	}{
+		{
+			name:     "given interpolation is off, should leave the script verbatim",
+			expected: script,
+		},
+		{
+			name:        "given interpolation, should expand set variables only",
+			interpolate: true,
+			expected:    `curl "example.com:8080/${PATH_SUFFIX:-x}" ${1} ${?} $(date) ${UNSET}`,
+		},
+		{
+			name:          "given no-interpolate, should leave the script verbatim",
+			interpolate:   true,
+			noInterpolate: true,
+			expected:      script,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := Runner{interpolateScripts: tt.interpolate}
+			got := r.interpolate(models.Task{NoInterpolate: tt.noInterpolate}, script, env)
+			if got != tt.expected {
+				t.Fatalf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWriteScriptLog(t *testing.T) {
+	env := []string{"DEPLOY_TOKEN=abc123", "REGION=eu-west-2"}
+	script := "deploy --token abc123 --region eu-west-2 --account 123456789012"
+	tests := []struct {
+		name        string
+		maskSecrets bool
+		expected    string
+	}{
+		{
+			name:        "given mask secrets, should redact secret values and patterns",
+			maskSecrets: true,
+			expected:    "\x1b[0mtask｜ script:\n\x1b[0mtask｜     deploy --token **** --region eu-west-2 --account ***REDACTED***\n",
+		},
+		{
+			name:     "given no mask secrets, should still redact patterns",
+			expected: "\x1b[0mtask｜ script:\n\x1b[0mtask｜     deploy --token abc123 --region eu-west-2 --account ***REDACTED***\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var logFile bytes.Buffer
+			r := Runner{
+				maskSecrets:  tt.maskSecrets,
+				maskPatterns: []*regexp.Regexp{regexp.MustCompile(`\b[0-9]{12}\b`)},
+				logFile:      &logFile,
+			}
+			if err := r.writeScriptLog(script, env, r.infoWriter("task", nil)); err != nil {
+				t.Fatal(err)
+			}
+			if logFile.String() != tt.expected {
+				t.Fatalf("got %q, want %q", logFile.String(), tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package run
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/joerdav/xc/models"
+)
+
+// ReadEnvFile reads KEY=VALUE lines from the file at path.
+// Blank lines and lines starting with # are ignored, an `export` prefix is
+// allowed, and values may be wrapped in single or double quotes.
+func ReadEnvFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	vars, err := parseEnvFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return vars, nil
+}
+
+// taskEnvFiles reads the env-files of task, relative to its directory, in order.
+func (r *Runner) taskEnvFiles(task models.Task) ([]string, error) {
+	var vars []string
+	for _, path := range task.EnvFiles {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(r.getExecutionPath(task), path)
+		}
+		v, err := ReadEnvFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read env-files of task %s: %w", task.Name, err)
+		}
+		vars = append(vars, v...)
+	}
+	return vars, nil
+}
+
+// removeEnvFiles deletes the env files of task once it has run, if its
+// cleanup-env-file attribute, or the Runner, asks for it. With on-success they
+// are only deleted if err is nil.
+func (r *Runner) removeEnvFiles(task models.Task, err error) error {
+	cleanup := task.CleanupEnvFiles
+	if cleanup == models.EnvFileCleanupNever {
+		cleanup = r.cleanupEnvFiles
+	}
+	if cleanup == models.EnvFileCleanupNever || (cleanup == models.EnvFileCleanupOnSuccess && err != nil) {
+		return nil
+	}
+	var errs []error
+	for _, path := range task.EnvFiles {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(r.getExecutionPath(task), path)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("failed to remove env file of task %s: %w", task.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func parseEnvFile(r io.Reader) ([]string, error) {
+	var vars []string
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars = append(vars, key+"="+value)
+	}
+	return vars, s.Err()
+}
+
+// ReadEnvJSON reads the environment of each task from the JSON file at path,
+// which must hold an object of the form {"task": {"KEY": "VALUE"}}.
+// The variables of each task are returned as KEY=VALUE, sorted by name.
+func ReadEnvJSON(path string) (map[string][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	env, err := parseEnvJSON(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return env, nil
+}
+
+func parseEnvJSON(r io.Reader) (map[string][]string, error) {
+	var tasks map[string]map[string]string
+	d := json.NewDecoder(r)
+	if err := d.Decode(&tasks); err != nil {
+		return nil, fmt.Errorf(`expected an object of the form {"task": {"KEY": "VALUE"}}: %w`, err)
+	}
+	if d.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON object")
+	}
+	env := make(map[string][]string, len(tasks))
+	for task, vars := range tasks {
+		keys := make([]string, 0, len(vars))
+		for key := range vars {
+			if key == "" || strings.ContainsAny(key, "= \t") {
+				return nil, fmt.Errorf("task %s: invalid variable name %q", task, key)
+			}
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			env[task] = append(env[task], key+"="+vars[key])
+		}
+	}
+	return env, nil
+}
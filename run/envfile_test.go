@@ -0,0 +1,217 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		expected  []string
+		expectErr bool
+	}{
+		{
+			name:     "given KEY=VALUE lines, should parse",
+			in:       "FOO=bar\nBAZ=qux=quux\n",
+			expected: []string{"FOO=bar", "BAZ=qux=quux"},
+		},
+		{
+			name:     "given comments and blank lines, should ignore them",
+			in:       "# secrets\n\nFOO=bar\n  # indented\n",
+			expected: []string{"FOO=bar"},
+		},
+		{
+			name:     "given export and quotes, should strip them",
+			in:       "export FOO=\"bar baz\"\nBAR='a # b'\nEMPTY=",
+			expected: []string{"FOO=bar baz", "BAR=a # b", "EMPTY="},
+		},
+		{
+			name:      "given a line without =, should error",
+			in:        "FOO=bar\nBAR\n",
+			expectErr: true,
+		},
+		{
+			name:      "given a key with spaces, should error",
+			in:        "MY KEY=bar\n",
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEnvFile(strings.NewReader(tt.in))
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("err=%v, want error=%v", err, tt.expectErr)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Fatalf("got %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inputs.env")
+	if err := os.WriteFile(path, []byte("FOO=bar\nBAR\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ReadEnvFile(path)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected an error for line 2, got %v", err)
+	}
+}
+
+func TestParseEnvJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		expected  map[string]string
+		expectErr bool
+	}{
+		{
+			name:     "given env for tasks, should sort the variables of each",
+			in:       `{"deploy": {"REGION": "eu-west-2", "ACCOUNT": "123"}, "test": {}}`,
+			expected: map[string]string{"deploy": "ACCOUNT=123,REGION=eu-west-2", "test": ""},
+		},
+		{
+			name:      "given a non-string value, should error",
+			in:        `{"deploy": {"PORT": 8080}}`,
+			expectErr: true,
+		},
+		{
+			name:      "given an array, should error",
+			in:        `["deploy"]`,
+			expectErr: true,
+		},
+		{
+			name:      "given an invalid variable name, should error",
+			in:        `{"deploy": {"A=B": "c"}}`,
+			expectErr: true,
+		},
+		{
+			name:      "given trailing data, should error",
+			in:        `{} {}`,
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEnvJSON(strings.NewReader(tt.in))
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("err=%v, want error=%v", err, tt.expectErr)
+			}
+			for task, expected := range tt.expected {
+				if strings.Join(got[task], ",") != expected {
+					t.Errorf("%s: got %q, want %q", task, got[task], expected)
+				}
+			}
+		})
+	}
+}
+
+func TestRunWithEnvFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app", ".env"), "A=base\nB=base\nC=base\n")
+	writeFile(t, filepath.Join(dir, "app", ".env.local"), "B=local\nC=local\n")
+	runner, err := NewRunner(models.Tasks{
+		{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, Dir: "app", EnvFiles: []string{".env", ".env.local"}, Env: []string{"C=attribute"}},
+	}, dir, WithEnvFiles([]string{"A=global", "D=global"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptRunner := &mockScriptRunner{}
+	runner.scriptRunner = scriptRunner
+	if err := runner.Run(context.Background(), "task", nil); err != nil {
+		t.Fatal(err)
+	}
+	env := scriptRunner.executions[0].Env
+	for name, expect := range map[string]string{"A": "base", "B": "local", "C": "attribute", "D": "global"} {
+		if v, _ := lookupEnv(env, name); v != expect {
+			t.Errorf("%s=%q, want %q", name, v, expect)
+		}
+	}
+	t.Run("given a missing env file, should fail", func(t *testing.T) {
+		runner, err := NewRunner(models.Tasks{
+			{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, EnvFiles: []string{"missing.env"}},
+		}, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runner.scriptRunner = &mockScriptRunner{}
+		if err := runner.Run(context.Background(), "task", nil); err == nil {
+			t.Fatal("expected an error got nil")
+		}
+	})
+}
+
+func TestRunCleanupEnvFiles(t *testing.T) {
+	tests := []struct {
+		name         string
+		cleanup      models.EnvFileCleanup
+		global       models.EnvFileCleanup
+		fail         bool
+		expectExists bool
+	}{
+		{
+			name:         "given no cleanup, should keep the file",
+			expectExists: true,
+		},
+		{
+			name:    "given cleanup-env-file true, should delete the file even if the task fails",
+			cleanup: models.EnvFileCleanupAlways,
+			fail:    true,
+		},
+		{
+			name:    "given cleanup-env-file on-success, should delete the file if the task succeeds",
+			cleanup: models.EnvFileCleanupOnSuccess,
+		},
+		{
+			name:         "given cleanup-env-file on-success, should keep the file if the task fails",
+			cleanup:      models.EnvFileCleanupOnSuccess,
+			fail:         true,
+			expectExists: true,
+		},
+		{
+			name:   "given -task-cleanup-env-file, should delete the file",
+			global: models.EnvFileCleanupAlways,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "creds.env")
+			writeFile(t, path, "TOKEN=secret\n")
+			runner, err := NewRunner(models.Tasks{
+				{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, EnvFiles: []string{"creds.env"}, CleanupEnvFiles: tt.cleanup},
+			}, dir, WithCleanupEnvFiles(tt.global))
+			if err != nil {
+				t.Fatal(err)
+			}
+			scriptRunner := &mockScriptRunner{}
+			if tt.fail {
+				scriptRunner.returns = errors.New("failed")
+			}
+			runner.scriptRunner = scriptRunner
+			err = runner.Run(context.Background(), "task", nil)
+			if (err != nil) != tt.fail {
+				t.Fatalf("expected error %v, got %v", tt.fail, err)
+			}
+			if v, _ := lookupEnv(scriptRunner.executions[0].Env, "TOKEN"); v != "secret" {
+				t.Fatalf("expected the env file to be loaded, got TOKEN=%q", v)
+			}
+			if _, err := os.Stat(path); (err == nil) != tt.expectExists {
+				t.Fatalf("expected the file to exist %v, got %v", tt.expectExists, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package run
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/joerdav/xc/models"
+)
+
+// semverRegexp matches a semantic version, as given by https://semver.org,
+// optionally prefixed with v.
+var semverRegexp = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+// validEnvValue reports whether value is of type ty.
+func validEnvValue(ty models.EnvType, value string) bool {
+	var err error
+	switch ty {
+	case models.EnvTypeInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case models.EnvTypeBool:
+		_, err = strconv.ParseBool(value)
+	case models.EnvTypeFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case models.EnvTypeURL:
+		var u *url.URL
+		u, err = url.Parse(value)
+		if err == nil && (u.Scheme == "" || u.Host == "") {
+			return false
+		}
+	case models.EnvTypeSemver:
+		return semverRegexp.MatchString(value)
+	}
+	return err == nil
+}
+
+// checkEnvTypes returns an error for each variable required by task, or given
+// by WithEnvTypes, which is not set in env or whose value is not of its type.
+func (r *Runner) checkEnvTypes(task models.Task, env []string) error {
+	types := make(map[string]models.EnvType, len(r.envTypes)+len(task.EnvTypes))
+	for name, ty := range r.envTypes {
+		types[name] = ty
+	}
+	for name, ty := range task.EnvTypes {
+		types[name] = ty
+	}
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		value, ok := lookupEnv(env, name)
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("task %s: env var %s is not set, expected a valid %s", task.Name, name, types[name]))
+		case !validEnvValue(types[name], value):
+			errs = append(errs, fmt.Errorf("task %s: env var %s='%s' is not a valid %s", task.Name, name, value, types[name]))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkEnvNewlines returns an error for each variable in env whose value
+// contains \n or \r, with a hex dump of the bytes around the first of them.
+func checkEnvNewlines(task models.Task, env []string) error {
+	var names []string
+	seen := map[string]bool{}
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		value, _ := lookupEnv(env, name)
+		i := strings.IndexAny(value, "\r\n")
+		if i < 0 {
+			continue
+		}
+		start, end := i-8, i+8
+		if start < 0 {
+			start = 0
+		}
+		if end > len(value) {
+			end = len(value)
+		}
+		errs = append(errs, fmt.Errorf("task %s: env var %s contains a newline at byte %d:\n%s",
+			task.Name, name, i, strings.TrimRight(hex.Dump([]byte(value[start:end])), "\n")))
+	}
+	return errors.Join(errs...)
+}
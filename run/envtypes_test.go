@@ -0,0 +1,127 @@
+package run
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestValidEnvValue(t *testing.T) {
+	tests := []struct {
+		ty    models.EnvType
+		value string
+		valid bool
+	}{
+		{models.EnvTypeInt, "8080", true},
+		{models.EnvTypeInt, "abc", false},
+		{models.EnvTypeInt, "1.5", false},
+		{models.EnvTypeBool, "true", true},
+		{models.EnvTypeBool, "yes", false},
+		{models.EnvTypeFloat, "1.5", true},
+		{models.EnvTypeFloat, "one", false},
+		{models.EnvTypeURL, "https://example.com/path", true},
+		{models.EnvTypeURL, "example.com", false},
+		{models.EnvTypeSemver, "1.2.3", true},
+		{models.EnvTypeSemver, "v1.2.3-rc.1+build.5", true},
+		{models.EnvTypeSemver, "1.2", false},
+	}
+	for _, tt := range tests {
+		if got := validEnvValue(tt.ty, tt.value); got != tt.valid {
+			t.Errorf("%s %q: got valid=%v, want %v", tt.ty, tt.value, got, tt.valid)
+		}
+	}
+}
+
+func TestCheckEnvTypes(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       []string
+		types     map[string]models.EnvType
+		expectErr string
+	}{
+		{
+			name:  "given valid values, should run",
+			env:   []string{"PORT=8080", "ENABLED=true"},
+			types: map[string]models.EnvType{"ENABLED": models.EnvTypeBool},
+		},
+		{
+			name:      "given an invalid value, should fail",
+			env:       []string{"PORT=abc"},
+			expectErr: "task build: env var PORT='abc' is not a valid int",
+		},
+		{
+			name:      "given a missing value, should fail",
+			expectErr: "task build: env var PORT is not set, expected a valid int",
+		},
+		{
+			name:  "given the task sets the type, should override the runner",
+			env:   []string{"PORT=8080.5"},
+			types: map[string]models.EnvType{"PORT": models.EnvTypeFloat},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{Name: "build", Script: []models.ScriptBlock{{Body: "somecmd"}}, Env: tt.env, EnvTypes: tt.types},
+			}, "", WithEnvTypes(map[string]models.EnvType{"PORT": models.EnvTypeInt}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			scriptRunner := &mockScriptRunner{}
+			runner.scriptRunner = scriptRunner
+			err = runner.Run(context.Background(), "build", nil)
+			if tt.expectErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.expectErr {
+				t.Fatalf("expected error %q, got %v", tt.expectErr, err)
+			}
+			if scriptRunner.calls != 0 {
+				t.Fatal("expected the task not to run")
+			}
+		})
+	}
+}
+
+func TestCheckEnvNewlines(t *testing.T) {
+	env := []string{"A=one\ntwo", "B=fine", "C=x\r", "C=replaced", "D=abcdefghijklmnop\nq"}
+	err := checkEnvNewlines(models.Task{Name: "build"}, env)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	got := err.Error()
+	for _, expect := range []string{
+		"task build: env var A contains a newline at byte 3:\n00000000  6f 6e 65 0a 74 77 6f",
+		"task build: env var D contains a newline at byte 16:\n00000000  69 6a 6b 6c 6d 6e 6f 70  0a 71",
+	} {
+		if !strings.Contains(got, expect) {
+			t.Errorf("expected %q in error, got:\n%s", expect, got)
+		}
+	}
+	if strings.Contains(got, "env var B") || strings.Contains(got, "env var C") {
+		t.Errorf("expected only A and D to fail, got:\n%s", got)
+	}
+	t.Run("given the runner checks newlines, should not run the task", func(t *testing.T) {
+		runner, err := NewRunner(models.Tasks{
+			{Name: "build", Script: []models.ScriptBlock{{Body: "somecmd"}}, Env: []string{"TOKEN=abc\n"}},
+		}, "", WithEnvNoNewlines(true))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptRunner := &mockScriptRunner{}
+		runner.scriptRunner = scriptRunner
+		err = runner.Run(context.Background(), "build", nil)
+		if err == nil || !strings.Contains(err.Error(), "env var TOKEN contains a newline") {
+			t.Fatalf("expected a newline error, got %v", err)
+		}
+		if scriptRunner.calls != 0 {
+			t.Fatal("expected the task not to run")
+		}
+	})
+}
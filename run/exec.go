@@ -0,0 +1,219 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// killTimeout is how long a command has to exit after being interrupted
+// before it is killed.
+const killTimeout = 2 * time.Second
+
+// execHandler returns the handler used to run commands from the shell script of e.
+// It behaves like interp.DefaultExecHandler, except that commands are run with
+// the options of e by runCommand.
+func execHandler(e Execution) interp.ExecHandlerFunc {
+	return func(ctx context.Context, args []string) error {
+		hc := interp.HandlerCtx(ctx)
+		path, err := interp.LookPathDir(hc.Dir, hc.Env, args[0])
+		if err != nil {
+			fmt.Fprintln(hc.Stderr, err)
+			return interp.NewExitStatus(127)
+		}
+		cmd := &exec.Cmd{
+			Path:   path,
+			Args:   args,
+			Env:    execEnv(hc.Env),
+			Dir:    hc.Dir,
+			Stdin:  hc.Stdin,
+			Stdout: hc.Stdout,
+			Stderr: hc.Stderr,
+		}
+		err = runCommand(ctx, cmd, e)
+		switch x := err.(type) {
+		case *exec.ExitError:
+			if status, ok := x.Sys().(syscall.WaitStatus); ok {
+				if status.Signaled() {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					return interp.NewExitStatus(uint8(128 + status.Signal()))
+				}
+				return interp.NewExitStatus(uint8(status.ExitStatus()))
+			}
+			return interp.NewExitStatus(1)
+		case *exec.Error:
+			fmt.Fprintf(hc.Stderr, "%v\n", err)
+			return interp.NewExitStatus(127)
+		default:
+			return err
+		}
+	}
+}
+
+// runCommand starts cmd and waits for it to exit.
+// If ctx is cancelled the command is interrupted, then killed after killTimeout
+// once e.interrupted returns.
+// If e.KillGroup is set the command is started in its own process group, and
+// that group is killed if the command fails. If the context is cancelled the
+// group is sent SIGTERM, then killed.
+func runCommand(ctx context.Context, cmd *exec.Cmd, e Execution) error {
+	killGroup := e.KillGroup
+	var out outputPipes
+	if killGroup {
+		setProcessGroup(cmd)
+		// Children left running by the command hold on to its output.
+		// Copy output through pipes owned by xc, so that the command can be
+		// waited on, and its process group killed, without waiting for them.
+		var err error
+		if cmd.Stdout, err = out.pipe(cmd.Stdout); err != nil {
+			out.close()
+			return err
+		}
+		if cmd.Stderr, err = out.pipe(cmd.Stderr); err != nil {
+			out.close()
+			return err
+		}
+	}
+	if err := beforeStart(cmd, e); err != nil {
+		out.close()
+		out.wait()
+		return err
+	}
+	err := cmd.Start()
+	out.close()
+	if err != nil {
+		out.wait()
+		return err
+	}
+	defer e.processes.track(cmd.Process)()
+	defer e.running.track(cmd.Process)()
+	exited := make(chan struct{})
+	defer close(exited)
+	go func() {
+		select {
+		case <-exited:
+			return
+		case <-ctx.Done():
+		}
+		kill := cmd.Process.Kill
+		switch {
+		case killGroup:
+			_ = terminateProcessGroup(cmd.Process)
+			kill = func() error { return killProcessGroup(cmd.Process) }
+		case runtime.GOOS == "windows":
+			_ = cmd.Process.Kill()
+		default:
+			_ = cmd.Process.Signal(os.Interrupt)
+		}
+		e.interrupt()
+		select {
+		case <-exited:
+		case <-time.After(killTimeout):
+			_ = kill()
+		}
+	}()
+	err = cmd.Wait()
+	if err != nil && killGroup {
+		_ = killProcessGroup(cmd.Process)
+	}
+	out.wait()
+	return err
+}
+
+// beforeStart applies the options of e which must be set before cmd starts.
+func beforeStart(cmd *exec.Cmd, e Execution) error {
+	if cmd.Err != nil {
+		// the command was not found, leave it to fail when started
+		return nil
+	}
+	if e.MaxOpenFiles > 0 {
+		setOpenFilesLimit(cmd, e.MaxOpenFiles)
+	}
+	if e.Hostname != "" {
+		return setHostname(cmd, e.Hostname)
+	}
+	return nil
+}
+
+// wrapShell makes cmd run through a shell script, which is given arg as $0
+// and the original command as its arguments.
+func wrapShell(cmd *exec.Cmd, script, arg string) {
+	cmd.Args = append([]string{"/bin/sh", "-c", script, arg, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+}
+
+// outputPipes copies command output through pipes created by xc.
+type outputPipes struct {
+	writers []*os.File
+	copiers sync.WaitGroup
+}
+
+// pipe returns the write end of a pipe which is copied to w until every
+// process holding it has closed it.
+func (o *outputPipes) pipe(w io.Writer) (io.Writer, error) {
+	if w == nil {
+		return nil, nil
+	}
+	if _, ok := w.(*os.File); ok {
+		return w, nil
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output pipe: %w", err)
+	}
+	o.writers = append(o.writers, pw)
+	o.copiers.Add(1)
+	go func() {
+		defer o.copiers.Done()
+		defer pr.Close()
+		_, _ = io.Copy(w, pr)
+	}()
+	return pw, nil
+}
+
+// close closes xc's copy of the write ends, once the command has its own.
+func (o *outputPipes) close() {
+	for _, w := range o.writers {
+		w.Close()
+	}
+	o.writers = nil
+}
+
+// wait blocks until all output has been copied.
+func (o *outputPipes) wait() {
+	o.copiers.Wait()
+}
+
+// execEnv returns the exported variables of env in KEY=VALUE form.
+// It is a copy of the unexported function used by interp.DefaultExecHandler.
+func execEnv(env expand.Environ) []string {
+	list := make([]string, 0, 64)
+	env.Each(func(name string, vr expand.Variable) bool {
+		if !vr.IsSet() {
+			// a variable unset in the runner may still be in the list
+			// from the parent environment, so it needs removing
+			for i, kv := range list {
+				if strings.HasPrefix(kv, name+"=") {
+					list[i] = ""
+				}
+			}
+		}
+		if vr.Exported && vr.Kind == expand.String {
+			list = append(list, name+"="+vr.String())
+		}
+		return true
+	})
+	return list
+}
@@ -0,0 +1,92 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// processAlive reports if pid is running, treating zombies as dead.
+func processAlive(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	_, state, _ := strings.Cut(string(stat), ") ")
+	return !strings.HasPrefix(state, "Z")
+}
+
+func TestRunCommandKillGroup(t *testing.T) {
+	tests := []struct {
+		name        string
+		killGroup   bool
+		expectAlive bool
+	}{
+		{name: "given kill group, should kill background children", killGroup: true},
+		{name: "given no kill group, should leave background children", expectAlive: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := os.Create(filepath.Join(t.TempDir(), "out"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer out.Close()
+			cmd := exec.Command("sh", "-c", "sleep 30 & echo $!; exit 1")
+			cmd.Stdout = out
+			if err := runCommand(context.Background(), cmd, Execution{KillGroup: tt.killGroup}); err == nil {
+				t.Fatal("expected an error")
+			}
+			b, err := os.ReadFile(out.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer syscall.Kill(pid, syscall.SIGKILL) //nolint:errcheck
+			// give the kill signal time to be delivered
+			time.Sleep(100 * time.Millisecond)
+			if alive := processAlive(pid); alive != tt.expectAlive {
+				t.Fatalf("alive=%v, want=%v", alive, tt.expectAlive)
+			}
+		})
+	}
+}
+
+func TestRunCommandTerminateGroup(t *testing.T) {
+	var out strings.Builder
+	cmd := exec.Command("sh", "-c", `trap "echo term" TERM; while :; do sleep 0.05; done`)
+	cmd.Stdout = &out
+	interrupted := make(chan bool, 1)
+	e := Execution{KillGroup: true, interrupted: func() { interrupted <- processAlive(cmd.Process.Pid) }}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	start := time.Now()
+	if err := runCommand(ctx, cmd, e); err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed < killTimeout {
+		t.Errorf("expected the group to be killed after %s, took %s", killTimeout, elapsed)
+	}
+	select {
+	case alive := <-interrupted:
+		if !alive {
+			t.Error("expected the command to be running when interrupted is called")
+		}
+	default:
+		t.Fatal("expected interrupted to be called")
+	}
+	if !strings.Contains(out.String(), "term") {
+		t.Errorf("expected the command to be sent SIGTERM, got %q", out.String())
+	}
+}
@@ -0,0 +1,32 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/joerdav/xc/models"
+)
+
+// mapExitCode applies the meaning given to the exit code of err by task, or
+// by the Runner, once the script of task has exited.
+// A warning is reported to w and the task succeeds, and cancelled is returned
+// as context.Canceled, as if xc had been interrupted.
+func (r *Runner) mapExitCode(task models.Task, err error, w io.Writer) error {
+	code, ok := exitStatus(err)
+	if !ok {
+		return err
+	}
+	meaning, ok := task.ExitCodes[code]
+	if !ok {
+		meaning = r.exitCodes[code]
+	}
+	switch meaning {
+	case models.ExitCodeWarning:
+		fmt.Fprintf(w, "warning: exit status %d\n", code)
+		return nil
+	case models.ExitCodeCancelled:
+		return fmt.Errorf("%w: exit status %d", context.Canceled, code)
+	}
+	return err
+}
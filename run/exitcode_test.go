@@ -0,0 +1,77 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+	"mvdan.cc/sh/v3/interp"
+)
+
+func TestRunWithExitCodes(t *testing.T) {
+	tests := []struct {
+		name          string
+		exitCodes     map[int]models.ExitCodeMeaning
+		taskExitCodes map[int]models.ExitCodeMeaning
+		status        uint8
+		expectErr     error
+		expectWarning bool
+	}{
+		{
+			name:          "given a warning, should succeed",
+			exitCodes:     map[int]models.ExitCodeMeaning{2: models.ExitCodeWarning},
+			status:        2,
+			expectWarning: true,
+		},
+		{
+			name:          "given cancelled, should be cancelled",
+			taskExitCodes: map[int]models.ExitCodeMeaning{130: models.ExitCodeCancelled},
+			status:        130,
+			expectErr:     context.Canceled,
+		},
+		{
+			name:          "given the task sets the code, should take precedence",
+			exitCodes:     map[int]models.ExitCodeMeaning{2: models.ExitCodeWarning},
+			taskExitCodes: map[int]models.ExitCodeMeaning{2: models.ExitCodeCancelled},
+			status:        2,
+			expectErr:     context.Canceled,
+		},
+		{
+			name:      "given another code, should fail",
+			exitCodes: map[int]models.ExitCodeMeaning{2: models.ExitCodeWarning},
+			status:    1,
+			expectErr: interp.NewExitStatus(1),
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, ExitCodes: tt.taskExitCodes, RetryCount: 2},
+			}, "", WithExitCodes(tt.exitCodes))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var stdout bytes.Buffer
+			runner.stdout = &stdout
+			scriptRunner := &mockScriptRunner{returns: interp.NewExitStatus(tt.status)}
+			runner.scriptRunner = scriptRunner
+			err = runner.Run(context.Background(), "task", nil)
+			if tt.expectErr == nil && err != nil || !errors.Is(err, tt.expectErr) {
+				t.Fatalf("got error %v, want %v", err, tt.expectErr)
+			}
+			if warned := strings.Contains(stdout.String(), "warning: exit status"); warned != tt.expectWarning {
+				t.Fatalf("got warning=%v, want %v: %q", warned, tt.expectWarning, stdout.String())
+			}
+			if tt.expectErr != context.Canceled && tt.expectErr != nil {
+				return
+			}
+			if scriptRunner.calls != 1 {
+				t.Fatalf("expected no retries, got %d calls", scriptRunner.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package run
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/joerdav/xc/models"
+)
+
+// filterOutput pipes what the task writes to stdout and stderr through the
+// output-filter command of task, or the filter given by WithOutputFilter,
+// which writes to stdout and stderr. The returned function closes the input
+// of the filter and waits for it to exit before calling closeOutput.
+// A failing filter is reported, but does not fail the task.
+func (r *Runner) filterOutput(
+	ctx context.Context,
+	task models.Task,
+	env []string,
+	stdout, stderr io.Writer,
+	closeOutput func() error,
+) (io.Writer, io.Writer, func() error) {
+	filter := task.OutputFilter
+	if filter == "" {
+		filter = r.outputFilter
+	}
+	if filter == "" || task.Interactive {
+		return stdout, stderr, closeOutput
+	}
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := r.scriptRunner.Execute(ctx, Execution{
+			Script: filter,
+			Env:    env,
+			Dir:    r.getExecutionPath(task),
+			Stdin:  pr,
+			Stdout: stdout,
+			Stderr: stderr,
+		})
+		// keep accepting output once the filter exits, so the task is unaffected
+		_, _ = io.Copy(io.Discard, pr)
+		done <- err
+	}()
+	return pw, pw, func() error {
+		pw.Close()
+		if err := <-done; err != nil {
+			fmt.Fprintf(r.stderr, "task %q: output filter failed: %v\n", task.Name, err)
+		}
+		return closeOutput()
+	}
+}
@@ -0,0 +1,85 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+// filterScriptRunner writes lines to stdout and stderr for the script "task",
+// and runs every other script, such as output filters, with the built-in shell.
+type filterScriptRunner struct{}
+
+func (filterScriptRunner) Execute(ctx context.Context, e Execution) error {
+	if e.Script != "task" {
+		return newInterpreter().Execute(ctx, e)
+	}
+	_, stdout, stderr := e.stdio()
+	if _, err := io.WriteString(stdout, "DEBUG starting\ninfo ready\n"); err != nil {
+		return err
+	}
+	_, err := io.WriteString(stderr, "DEBUG retrying\nwarn slow\n")
+	return err
+}
+
+func TestRunOutputFilter(t *testing.T) {
+	tests := []struct {
+		name         string
+		filter       string
+		global       string
+		expectOutput []string
+		expectHidden []string
+		expectStderr string
+	}{
+		{
+			name:         "given output-filter, should filter stdout and stderr",
+			filter:       "grep -v DEBUG",
+			expectOutput: []string{"info ready", "warn slow"},
+			expectHidden: []string{"DEBUG"},
+		},
+		{
+			name:         "given -task-output-filter-command, should filter tasks without output-filter",
+			global:       "sed 's/ready/READY/'",
+			expectOutput: []string{"info READY", "DEBUG retrying"},
+		},
+		{
+			name:         "given a failing filter, should report it without failing the task",
+			filter:       "exit 3",
+			expectHidden: []string{"info ready"},
+			expectStderr: `task "task": output filter failed: exit status 3`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			runner, err := NewRunner(models.Tasks{
+				{Name: "task", Script: []models.ScriptBlock{{Body: "task"}}, OutputFilter: tt.filter},
+			}, t.TempDir(), WithOutputFilter(tt.global), WithOutput(&out, &errOut))
+			if err != nil {
+				t.Fatal(err)
+			}
+			runner.scriptRunner = filterScriptRunner{}
+			if err := runner.Run(context.Background(), "task", nil); err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.expectOutput {
+				if !strings.Contains(out.String(), s) {
+					t.Errorf("expected %q in output, got %q", s, out.String())
+				}
+			}
+			for _, s := range tt.expectHidden {
+				if strings.Contains(out.String(), s) {
+					t.Errorf("expected %q to be filtered, got %q", s, out.String())
+				}
+			}
+			if !strings.Contains(errOut.String(), tt.expectStderr) {
+				t.Errorf("expected %q on stderr, got %q", tt.expectStderr, errOut.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package run
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/joerdav/xc/models"
+)
+
+// expandGlobInputs expands the glob patterns in the values of the inputs of
+// task named by its expand-glob-inputs attribute, or WithGlobInputs, relative
+// to dir. The expanded values are appended to env, and replace the arguments
+// given for those inputs.
+func (r *Runner) expandGlobInputs(task models.Task, dir string, env, args []string) ([]string, []string, error) {
+	names := append(task.ExpandGlobInputs[:len(task.ExpandGlobInputs):len(task.ExpandGlobInputs)], r.globInputs...)
+	if len(names) == 0 {
+		return env, args, nil
+	}
+	args = append([]string(nil), args...)
+	for _, name := range names {
+		value, ok := lookupEnv(env, name)
+		if !ok {
+			continue
+		}
+		expanded, err := expandGlobs(dir, value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("task %s: input %s: %w", task.Name, name, err)
+		}
+		env = append(env, name+"="+expanded)
+		for i, in := range task.Inputs {
+			if in.Name == name && i < len(args) {
+				args[i] = expanded
+			}
+		}
+	}
+	return env, args, nil
+}
+
+// expandGlobs replaces each space separated glob pattern in value with the
+// paths which match it, relative to dir unless the pattern is absolute.
+// A pattern which matches nothing is an error.
+func expandGlobs(dir, value string) (string, error) {
+	var paths []string
+	for _, field := range strings.Fields(value) {
+		if !strings.ContainsAny(field, "*?[") {
+			paths = append(paths, field)
+			continue
+		}
+		pattern := field
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return "", fmt.Errorf("invalid pattern %q: %w", field, err)
+		}
+		if len(matches) == 0 {
+			return "", fmt.Errorf("pattern %q matches no files", field)
+		}
+		for _, m := range matches {
+			if !filepath.IsAbs(field) {
+				if rel, err := filepath.Rel(dir, m); err == nil {
+					m = rel
+				}
+			}
+			paths = append(paths, m)
+		}
+	}
+	return strings.Join(paths, " "), nil
+}
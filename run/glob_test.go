@@ -0,0 +1,85 @@
+package run
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestRunExpandGlobInputs(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "a.go"), "")
+	writeFile(t, filepath.Join(dir, "src", "b.go"), "")
+	writeFile(t, filepath.Join(dir, "src", "README.md"), "")
+	tests := []struct {
+		name       string
+		attribute  []string
+		global     []string
+		args       []string
+		expected   string
+		expectArgs string
+		expectErr  bool
+	}{
+		{
+			name:       "given no expand-glob-inputs, should pass the pattern as it is",
+			args:       []string{"src/*.go"},
+			expected:   "src/*.go",
+			expectArgs: "src/*.go",
+		},
+		{
+			name:       "given expand-glob-inputs, should expand the pattern",
+			attribute:  []string{"FILES"},
+			args:       []string{"src/*.go main.go"},
+			expected:   "src/a.go src/b.go main.go",
+			expectArgs: "src/a.go src/b.go main.go",
+		},
+		{
+			name:       "given -task-expand-glob-inputs, should expand the pattern",
+			global:     []string{"FILES"},
+			args:       []string{"src/*.md"},
+			expected:   "src/README.md",
+			expectArgs: "src/README.md",
+		},
+		{
+			name:      "given a pattern which matches nothing, should error",
+			attribute: []string{"FILES"},
+			args:      []string{"src/*.py"},
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{
+					Name:             "lint",
+					Script:           []models.ScriptBlock{{Body: "somecmd"}},
+					Inputs:           []models.Input{{Name: "FILES"}},
+					ExpandGlobInputs: tt.attribute,
+				},
+			}, dir, WithGlobInputs(tt.global))
+			if err != nil {
+				t.Fatal(err)
+			}
+			scriptRunner := &mockScriptRunner{}
+			runner.scriptRunner = scriptRunner
+			err = runner.Run(context.Background(), "lint", tt.args)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("err=%v, want error=%v", err, tt.expectErr)
+			}
+			if err != nil {
+				return
+			}
+			e := scriptRunner.executions[0]
+			if v, _ := lookupEnv(e.Env, "FILES"); v != tt.expected {
+				t.Errorf("FILES=%q, want %q", v, tt.expected)
+			}
+			if got := strings.Join(e.Args, " "); got != tt.expectArgs {
+				t.Errorf("args=%q, want %q", got, tt.expectArgs)
+			}
+		})
+	}
+}
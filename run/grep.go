@@ -0,0 +1,75 @@
+package run
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// grepFilter drops lines of the output of a task which match none of its patterns.
+type grepFilter struct {
+	mu       sync.Mutex
+	patterns []*regexp.Regexp
+	matched  bool
+}
+
+// line drops line unless it matches one of the patterns, for use with lineWriter.
+func (g *grepFilter) line(line []byte) []byte {
+	text := bytes.TrimSuffix(line, []byte{newLine})
+	for _, re := range g.patterns {
+		if re.Match(text) {
+			g.mu.Lock()
+			g.matched = true
+			g.mu.Unlock()
+			return line
+		}
+	}
+	return nil
+}
+
+func (g *grepFilter) hasMatched() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.matched
+}
+
+func (g *grepFilter) notice() string {
+	exprs := make([]string, len(g.patterns))
+	for i, re := range g.patterns {
+		exprs[i] = re.String()
+	}
+	return fmt.Sprintf("(no output matching '%s')\n", strings.Join(exprs, "|"))
+}
+
+// newGrepFilter returns writers which pass on only the lines written to stdout
+// and stderr that match any of patterns. If none have matched by the time
+// stdout is closed, a notice is written to it instead.
+func newGrepFilter(stdout, stderr io.WriteCloser, patterns []*regexp.Regexp) (io.WriteCloser, io.WriteCloser) {
+	g := &grepFilter{patterns: patterns}
+	return grepWriter{g, newLineWriter(struct{ io.Writer }{stdout}, g.line), stdout, true},
+		grepWriter{g, newLineWriter(struct{ io.Writer }{stderr}, g.line), stderr, false}
+}
+
+type grepWriter struct {
+	g *grepFilter
+	// lines filters what is written to w, without closing it.
+	lines  *lineWriter
+	w      io.WriteCloser
+	notify bool
+}
+
+func (g grepWriter) Write(p []byte) (int, error) {
+	return g.lines.Write(p)
+}
+
+func (g grepWriter) Close() error {
+	err := g.lines.Close()
+	if err == nil && g.notify && !g.g.hasMatched() {
+		_, err = io.WriteString(g.w, g.g.notice())
+	}
+	return errors.Join(err, g.w.Close())
+}
@@ -0,0 +1,39 @@
+//nolint:errcheck
+package run
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGrepFilter(t *testing.T) {
+	patterns := []*regexp.Regexp{regexp.MustCompile(`warning`), regexp.MustCompile(`^error:`)}
+	t.Run("given matching lines, should only write those", func(t *testing.T) {
+		var out, errOut closeRecorder
+		stdout, stderr := newGrepFilter(&out, &errOut, patterns)
+		stdout.Write([]byte("compiling\nmain.go: warning: unused\n"))
+		stderr.Write([]byte("error: failed\nnote: see above\n"))
+		stdout.Close()
+		stderr.Close()
+		if out.String() != "main.go: warning: unused\n" || errOut.String() != "error: failed\n" {
+			t.Fatalf("got stdout=%q stderr=%q", out.String(), errOut.String())
+		}
+		if !out.closed || !errOut.closed {
+			t.Fatal("expected writers to be closed")
+		}
+	})
+	t.Run("given no matching lines, should write a notice", func(t *testing.T) {
+		var out, errOut closeRecorder
+		stdout, stderr := newGrepFilter(&out, &errOut, patterns)
+		stdout.Write([]byte("compiling\n"))
+		stderr.Write([]byte("done"))
+		stdout.Close()
+		stderr.Close()
+		if expect := "(no output matching 'warning|^error:')\n"; out.String() != expect {
+			t.Fatalf("got %q, want %q", out.String(), expect)
+		}
+		if errOut.String() != "" {
+			t.Fatalf("got %q, want stderr to be empty", errOut.String())
+		}
+	})
+}
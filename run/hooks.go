@@ -0,0 +1,78 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/joerdav/xc/models"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// runBeforeEach runs the before-each hook of the Runner for task, if there is one.
+func (r *Runner) runBeforeEach(ctx context.Context, task models.Task, e Execution) error {
+	if r.beforeEach == "" {
+		return nil
+	}
+	return r.runHook(ctx, task, e, "before", r.beforeEach)
+}
+
+// runAfterEach runs the after-each hook of the Runner for task, if there is one,
+// passing it the exit code resulting from taskErr.
+// It runs even if the task was cancelled.
+func (r *Runner) runAfterEach(task models.Task, e Execution, taskErr error) error {
+	if r.afterEach == "" {
+		return nil
+	}
+	e.Env = append(e.Env[:len(e.Env):len(e.Env)], "XC_EXIT_CODE="+strconv.Itoa(exitCode(taskErr)))
+	return r.runHook(context.Background(), task, e, "after", r.afterEach)
+}
+
+func (r *Runner) runHook(ctx context.Context, task models.Task, e Execution, stage, script string) error {
+	var prefix string
+	if !task.Interactive {
+		prefix = strings.TrimSpace(task.Name) + " " + stage
+	}
+	stdout, stderr, closeOutput := r.taskOutput(prefix, nil)
+	e.Script = script
+	e.Args = nil
+	e.Env = append(e.Env[:len(e.Env):len(e.Env)],
+		"XC_TASK_NAME="+task.Name,
+		"XC_TASK_DIR="+e.Dir,
+	)
+	e.Stdin = nil
+	e.Stdout, e.Stderr = stdout, stderr
+	e.processes = nil
+	err := r.scriptRunner.Execute(ctx, e)
+	if err != nil {
+		err = fmt.Errorf("%s hook of %s failed: %w", stage, task.Name, err)
+	}
+	return errors.Join(err, closeOutput())
+}
+
+// exitCode returns the exit code of a script which returned err.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if code, ok := exitStatus(err); ok {
+		return code
+	}
+	return 1
+}
+
+// exitStatus returns the exit status of the script which returned err, and
+// false if err is not an exit status, such as a timeout.
+func exitStatus(err error) (int, bool) {
+	if status, ok := interp.IsExitStatus(err); ok {
+		return int(status), true
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,86 @@
+package run
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// scriptResults returns the error in results for each script, recording every execution.
+type scriptResults struct {
+	results    map[string]error
+	executions []Execution
+}
+
+func (r *scriptResults) Execute(ctx context.Context, e Execution) error {
+	r.executions = append(r.executions, e)
+	return r.results[e.Script]
+}
+
+func TestTaskHooks(t *testing.T) {
+	tests := []struct {
+		name        string
+		results     map[string]error
+		expectRun   []string
+		expectExit  string
+		expectError bool
+	}{
+		{
+			name:       "given a successful task, should run both hooks around it",
+			expectRun:  []string{"before", "main", "after"},
+			expectExit: "XC_EXIT_CODE=0",
+		},
+		{
+			name:        "given a failing task, should run the after hook with its exit code",
+			results:     map[string]error{"main": interp.NewExitStatus(3)},
+			expectRun:   []string{"before", "main", "after"},
+			expectExit:  "XC_EXIT_CODE=3",
+			expectError: true,
+		},
+		{
+			name:        "given a failing before hook, should not run the task",
+			results:     map[string]error{"before": interp.NewExitStatus(1)},
+			expectRun:   []string{"before"},
+			expectError: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{Name: "task", Script: []models.ScriptBlock{{Body: "main"}}, Dir: "sub", Interactive: true},
+			}, "/root", WithTaskHooks("before", "after"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			scriptRunner := &scriptResults{results: tt.results}
+			runner.scriptRunner = scriptRunner
+			err = runner.Run(context.Background(), "task", nil)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("expected error %v, got %v", tt.expectError, err)
+			}
+			var ran []string
+			for _, e := range scriptRunner.executions {
+				ran = append(ran, e.Script)
+			}
+			if strings.Join(ran, ",") != strings.Join(tt.expectRun, ",") {
+				t.Fatalf("expected %v to run, got %v", tt.expectRun, ran)
+			}
+			for _, e := range scriptRunner.executions {
+				if e.Script == "main" {
+					continue
+				}
+				env := strings.Join(e.Env, "\n")
+				if !strings.Contains(env, "XC_TASK_NAME=task") || !strings.Contains(env, "XC_TASK_DIR=/root/sub") {
+					t.Errorf("expected %s hook to receive the task name and dir, got %v", e.Script, e.Env)
+				}
+				if e.Script == "after" && !strings.Contains(env, tt.expectExit) {
+					t.Errorf("expected after hook to receive %s, got %v", tt.expectExit, e.Env)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// capSysAdmin is the bit of CAP_SYS_ADMIN in a capability set.
+const capSysAdmin = 21
+
+// hostnameScript sets the hostname of the UTS namespace it runs in,
+// given as $0, then runs the command given as its arguments.
+const hostnameScript = `printf %s "$0" > /proc/sys/kernel/hostname && exec "$@"`
+
+// setHostname wraps cmd so that it runs in a new UTS namespace with hostname.
+// Without CAP_SYS_ADMIN a user namespace is created too, in which the user is root.
+func setHostname(cmd *exec.Cmd, hostname string) error {
+	unshare, err := exec.LookPath("unshare")
+	if err != nil {
+		return fmt.Errorf("hostname requires unshare: %w", err)
+	}
+	args := []string{unshare, "--uts"}
+	if !hasCapSysAdmin() {
+		args = append(args, "--user", "--map-root-user")
+	}
+	wrapShell(cmd, hostnameScript, hostname)
+	cmd.Path, cmd.Args = unshare, append(append(args, "--"), cmd.Args...)
+	return nil
+}
+
+// checkHostnameSupport returns an error if setHostname cannot work.
+func checkHostnameSupport() error {
+	if _, err := exec.LookPath("unshare"); err != nil {
+		return fmt.Errorf("hostname requires unshare: %w", err)
+	}
+	if !hasCapSysAdmin() && !userNamespacesEnabled() {
+		return errors.New("hostname requires CAP_SYS_ADMIN or unprivileged user namespaces")
+	}
+	return nil
+}
+
+func hasCapSysAdmin() bool {
+	b, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		caps, ok := strings.CutPrefix(line, "CapEff:")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(caps), 16, 64)
+		return err == nil && n&(1<<capSysAdmin) != 0
+	}
+	return false
+}
+
+func userNamespacesEnabled() bool {
+	// only present on some distributions, such as Debian
+	if b, err := os.ReadFile("/proc/sys/kernel/unprivileged_userns_clone"); err == nil &&
+		strings.TrimSpace(string(b)) == "0" {
+		return false
+	}
+	b, err := os.ReadFile("/proc/sys/user/max_user_namespaces")
+	if err != nil {
+		return false
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	return err == nil && n > 0
+}
@@ -0,0 +1,24 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestRunCommandHostname(t *testing.T) {
+	if err := checkHostnameSupport(); err != nil {
+		t.Skip(err)
+	}
+	var out bytes.Buffer
+	cmd := exec.Command("cat", "/proc/sys/kernel/hostname")
+	cmd.Stdout = &out
+	if err := runCommand(context.Background(), cmd, Execution{Hostname: "xc-test"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "xc-test" {
+		t.Fatalf("got hostname %q, want xc-test", got)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package run
+
+import (
+	"errors"
+	"os/exec"
+)
+
+var errHostnameUnsupported = errors.New("hostname is only supported on linux")
+
+// setHostname is only supported on linux.
+func setHostname(*exec.Cmd, string) error {
+	return errHostnameUnsupported
+}
+
+// checkHostnameSupport is only supported on linux.
+func checkHostnameSupport() error {
+	return errHostnameUnsupported
+}
@@ -0,0 +1,51 @@
+package run
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// maskedValues are the values of inputs redacted from all task output.
+// Values are added as the inputs of each task are resolved, and stay masked
+// for every task which runs after.
+type maskedValues struct {
+	mu sync.RWMutex
+	// values are kept longest first, so a value containing another is
+	// redacted whole.
+	values [][]byte
+}
+
+func (m *maskedValues) add(value string) {
+	if value == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, v := range m.values {
+		if string(v) == value {
+			return
+		}
+	}
+	m.values = append(m.values, []byte(value))
+	sort.SliceStable(m.values, func(i, j int) bool { return len(m.values[i]) > len(m.values[j]) })
+}
+
+// line replaces every masked value in line, for use with lineWriter.
+func (m *maskedValues) line(line []byte) []byte {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, v := range m.values {
+		line = bytes.ReplaceAll(line, v, redacted)
+	}
+	return line
+}
+
+// maskInputs adds the values in env of the inputs which the Runner masks.
+func (r *Runner) maskInputs(env []string) {
+	for _, name := range r.inputMasks {
+		if value, ok := lookupEnv(env, name); ok {
+			r.maskedInputs.add(value)
+		}
+	}
+}
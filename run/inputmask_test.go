@@ -0,0 +1,48 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestRunWithInputMasks(t *testing.T) {
+	var stdout bytes.Buffer
+	runner, err := NewRunner(models.Tasks{
+		{Name: "login", Script: []models.ScriptBlock{{Body: "token is s3cret, user is admin\n"}}, Inputs: []models.Input{{Name: "TOKEN"}, {Name: "USER"}}},
+		{Name: "deploy", Script: []models.ScriptBlock{{Body: "using s3cret\n"}}},
+	}, "", WithInputMasks([]string{"TOKEN"}), WithOutput(&stdout, &stdout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.scriptRunner = outputScriptRunner{}
+	if err := runner.Run(context.Background(), "login", []string{"s3cret", "admin"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Run(context.Background(), "deploy", nil); err != nil {
+		t.Fatal(err)
+	}
+	out := stdout.String()
+	if strings.Contains(out, "s3cret") {
+		t.Fatalf("expected the input to be masked, got %q", out)
+	}
+	for _, expect := range []string{"token is ***REDACTED***, user is admin", "using ***REDACTED***"} {
+		if !strings.Contains(out, expect) {
+			t.Fatalf("expected %q in %q", expect, out)
+		}
+	}
+}
+
+func TestMaskedValues(t *testing.T) {
+	var m maskedValues
+	m.add("")
+	m.add("abc")
+	m.add("abcdef")
+	m.add("abc")
+	if got := string(m.line([]byte("abcdef abc ab\n"))); got != "***REDACTED*** ***REDACTED*** ab\n" {
+		t.Fatalf("got %q", got)
+	}
+}
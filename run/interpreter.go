@@ -4,12 +4,13 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
 	"regexp"
 	"strings"
 
+	"github.com/joerdav/xc/models"
+	"github.com/joerdav/xc/state"
 	"golang.org/x/term"
 	"mvdan.cc/sh/v3/expand"
 	"mvdan.cc/sh/v3/interp"
@@ -23,7 +24,7 @@ var (
 
 type interpreter struct {
 	shellRunner    func(context.Context, *interp.Runner, *syntax.File) error
-	shebangRunner  func(*exec.Cmd) error
+	shebangRunner  func(*exec.Cmd, Execution) error
 	tempFilePrefix string
 }
 
@@ -31,26 +32,35 @@ func interpShellRunner(ctx context.Context, runner *interp.Runner, file *syntax.
 	return runner.Run(ctx, file)
 }
 
-func cmdShebangRunner(cmd *exec.Cmd) error {
-	return cmd.Run()
+func cmdShebangRunner(cmd *exec.Cmd, e Execution) error {
+	if err := beforeStart(cmd, e); err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	defer e.processes.track(cmd.Process)()
+	defer e.running.track(cmd.Process)()
+	return cmd.Wait()
 }
 
 func newInterpreter() interpreter {
 	return interpreter{
 		shellRunner:    interpShellRunner,
 		shebangRunner:  cmdShebangRunner,
-		tempFilePrefix: "xc_",
+		tempFilePrefix: state.TempFilePrefix,
 	}
 }
 
-func (i interpreter) Execute(
-	ctx context.Context, script string, env, args []string, dir, logPrefix string,
-) error {
-	interpreterCmd, interpreterArgs, text, ok := parseShebang(script)
+func (i interpreter) Execute(ctx context.Context, e Execution) error {
+	if shell := strings.Fields(e.Shell); len(shell) > 0 {
+		return i.executeShebang(ctx, shell[0], shell[1:], e.Script, e)
+	}
+	interpreterCmd, interpreterArgs, text, ok := parseShebang(e.Script)
 	if !ok {
-		return i.executeShell(ctx, script, env, args, dir, logPrefix)
+		return i.executeShell(ctx, e)
 	}
-	return i.executeShebang(ctx, interpreterCmd, interpreterArgs, text, env, args, dir, logPrefix)
+	return i.executeShebang(ctx, interpreterCmd, interpreterArgs, text, e)
 }
 
 //nolint:gosec // accept that command is being executed here from outside of xc
@@ -59,33 +69,50 @@ func (i interpreter) executeShebang(
 	interpreterCmd string,
 	interpreterArgs []string,
 	text string,
-	env []string,
-	args []string,
-	dir string,
-	logPrefix string,
+	e Execution,
 ) error {
-	f, err := os.CreateTemp("", i.tempFilePrefix)
-	if err != nil {
-		return fmt.Errorf("failed to create execution file")
-	}
-	defer os.Remove(f.Name())
-	if _, err = f.WriteString(text); err != nil {
-		return fmt.Errorf("failed to write execution file")
-	}
-	interpreterArgs = append(interpreterArgs, f.Name())
-	cmd := exec.CommandContext(ctx, interpreterCmd, append(interpreterArgs, args...)...)
-	cmd.Dir = dir
-	cmd.Env = env
-	stdin, stdout, stderr := stdFiles(logPrefix)
-	cmd.Stdin = stdin
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
-	return i.shebangRunner(cmd)
+	stdin, stdout, stderr := e.stdio()
+	switch e.ScriptMode {
+	case models.ScriptModeStdin:
+		// the script replaces the stdin of the task
+		stdin = strings.NewReader(text)
+	case models.ScriptModeHeredoc:
+		// $0 is the interpreter, so that arguments start at $1 as in a file
+		interpreterArgs = append(interpreterArgs, "-c", text, interpreterCmd)
+	default:
+		f, err := os.CreateTemp("", i.tempFilePrefix)
+		if err != nil {
+			return fmt.Errorf("failed to create execution file")
+		}
+		defer os.Remove(f.Name())
+		if _, err = f.WriteString(text); err != nil {
+			return fmt.Errorf("failed to write execution file")
+		}
+		interpreterArgs = append(interpreterArgs, f.Name())
+	}
+	cmd := exec.CommandContext(ctx, interpreterCmd, append(interpreterArgs, e.Args...)...)
+	cmd.Dir = e.Dir
+	cmd.Env = e.Env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, stderr
+	if e.KillGroup {
+		setProcessGroup(cmd)
+		cmd.Cancel = func() error {
+			err := terminateProcessGroup(cmd.Process)
+			e.interrupt()
+			return err
+		}
+		// the group is killed once Wait returns
+		cmd.WaitDelay = killTimeout
+	}
+	err := i.shebangRunner(cmd, e)
+	if err != nil && e.KillGroup && cmd.Process != nil {
+		_ = killProcessGroup(cmd.Process)
+	}
+	return err
 }
 
-func (i interpreter) executeShell(
-	ctx context.Context, text string, env, args []string, dir, logPrefix string,
-) error {
+func (i interpreter) executeShell(ctx context.Context, e Execution) error {
+	text := e.Script
 	if shellShebangRe.MatchString(text) {
 		text = strings.Join(strings.Split(text, "\n")[1:], "\n")
 	}
@@ -100,6 +127,7 @@ func (i interpreter) executeShell(
 	if err != nil {
 		return fmt.Errorf("failed to parse task: %w", err)
 	}
+	env := e.Env
 	// Ignore G115: Potential integer overflow when converting between integer types
 	// "Fd()" ultimately returns a SysFd value, which is an int.
 	//nolint:gosec
@@ -108,14 +136,19 @@ func (i interpreter) executeShell(
 	}
 	runner, err := interp.New(
 		interp.Env(expand.ListEnviron(env...)),
-		interp.StdIO(stdFiles(logPrefix)),
-		interp.Dir(dir),
-		interp.Params(args...),
+		interp.StdIO(e.stdio()),
+		interp.Dir(e.Dir),
+		interp.Params(e.Args...),
+		interp.ExecHandler(execHandler(e)),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to compose script: %w", err)
 	}
-	return i.shellRunner(ctx, runner, file)
+	err = i.shellRunner(ctx, runner, file)
+	if e.exported != nil {
+		e.exported(exportedVars(runner, env))
+	}
+	return err
 }
 
 func parseShebang(script string) (interpreterCmd string, interpreterArgs []string, text string, ok bool) {
@@ -136,10 +169,3 @@ func parseShebang(script string) (interpreterCmd string, interpreterArgs []strin
 	interpreterArgs = interpreterParts[1:]
 	return interpreterCmd, interpreterArgs, strings.Join(lines[1:], "\n"), true
 }
-
-func stdFiles(prefix string) (io.Reader, io.Writer, io.Writer) {
-	if prefix == "" {
-		return os.Stdin, os.Stdout, os.Stderr
-	}
-	return os.Stdin, newPrefixLogger(os.Stdout, prefix), newPrefixLogger(os.Stderr, prefix)
-}
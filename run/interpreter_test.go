@@ -2,9 +2,14 @@ package run
 
 import (
 	"context"
+	"io"
 	"os/exec"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/joerdav/xc/models"
+
 	"mvdan.cc/sh/v3/interp"
 	"mvdan.cc/sh/v3/syntax"
 )
@@ -22,7 +27,7 @@ func newTestInterpreter() *testInterpreter {
 			inter.shellRunnerCalled = true
 			return nil
 		},
-		shebangRunner: func(*exec.Cmd) error {
+		shebangRunner: func(*exec.Cmd, Execution) error {
 			inter.shebangRunnerCalled = true
 			return nil
 		},
@@ -33,7 +38,7 @@ func newTestInterpreter() *testInterpreter {
 func TestIsShell(t *testing.T) {
 	t.Run("empty assume shell", func(t *testing.T) {
 		ti := newTestInterpreter()
-		if err := ti.Execute(context.Background(), "", nil, nil, "", ""); err != nil {
+		if err := ti.Execute(context.Background(), Execution{}); err != nil {
 			t.Fatal(err)
 		}
 		if !ti.shellRunnerCalled {
@@ -45,7 +50,7 @@ func TestIsShell(t *testing.T) {
 	})
 	t.Run("no shebang assume shell", func(t *testing.T) {
 		ti := newTestInterpreter()
-		if err := ti.Execute(context.Background(), "echo", nil, nil, "", ""); err != nil {
+		if err := ti.Execute(context.Background(), Execution{Script: "echo"}); err != nil {
 			t.Fatal(err)
 		}
 		if !ti.shellRunnerCalled {
@@ -66,7 +71,7 @@ func TestIsShell(t *testing.T) {
 		for _, s := range shells {
 			she := "#!/usr/bin/env " + s + " "
 			ti := newTestInterpreter()
-			if err := ti.Execute(context.Background(), she, nil, nil, "", ""); err != nil {
+			if err := ti.Execute(context.Background(), Execution{Script: she}); err != nil {
 				t.Fatal(err)
 			}
 			if !ti.shellRunnerCalled {
@@ -85,7 +90,7 @@ func TestIsShell(t *testing.T) {
 		for _, s := range shells {
 			she := "#!/usr/bin/env " + s + " "
 			ti := newTestInterpreter()
-			if err := ti.Execute(context.Background(), she, nil, nil, "", ""); err != nil {
+			if err := ti.Execute(context.Background(), Execution{Script: she}); err != nil {
 				t.Fatal(err)
 			}
 			if ti.shellRunnerCalled {
@@ -103,7 +108,7 @@ func TestIsShell(t *testing.T) {
 			print("hang on this isn't shell")
 		}`
 		ti := newTestInterpreter()
-		if err := ti.Execute(context.Background(), she, nil, nil, "", ""); err == nil {
+		if err := ti.Execute(context.Background(), Execution{Script: she}); err == nil {
 			t.Fatal("expected an error")
 		}
 		if ti.shellRunnerCalled {
@@ -113,11 +118,76 @@ func TestIsShell(t *testing.T) {
 			t.Fatal("expected no shebang")
 		}
 	})
+	t.Run("shell should run the script with that interpreter", func(t *testing.T) {
+		ti := newTestInterpreter()
+		var args []string
+		ti.shebangRunner = func(cmd *exec.Cmd, _ Execution) error {
+			ti.shebangRunnerCalled = true
+			args = cmd.Args
+			return nil
+		}
+		e := Execution{Script: "echo hi", Shell: "python3 -u", Args: []string{"a"}}
+		if err := ti.Execute(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+		if ti.shellRunnerCalled {
+			t.Fatal("expected no shell call")
+		}
+		if !ti.shebangRunnerCalled {
+			t.Fatal("expected shebang")
+		}
+		if len(args) != 4 || args[0] != "python3" || args[1] != "-u" || args[3] != "a" {
+			t.Fatalf("got args %q, want python3 -u <file> a", args)
+		}
+	})
+	t.Run("script mode should change how the script is passed", func(t *testing.T) {
+		tests := []struct {
+			mode       models.ScriptMode
+			expectArgs []string
+			expectIn   string
+		}{
+			{mode: models.ScriptModeStdin, expectArgs: []string{"bash", "-s", "a"}, expectIn: "echo hi"},
+			{mode: models.ScriptModeHeredoc, expectArgs: []string{"bash", "-s", "-c", "echo hi", "bash", "a"}},
+		}
+		for _, tt := range tests {
+			ti := newTestInterpreter()
+			var args []string
+			var in string
+			ti.shebangRunner = func(cmd *exec.Cmd, _ Execution) error {
+				args = cmd.Args
+				b, err := io.ReadAll(cmd.Stdin)
+				in = string(b)
+				return err
+			}
+			e := Execution{Script: "echo hi", Shell: "bash -s", Args: []string{"a"}, ScriptMode: tt.mode, Stdin: strings.NewReader("")}
+			if err := ti.Execute(context.Background(), e); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(args, tt.expectArgs) {
+				t.Errorf("%s: got args %q, want %q", tt.mode, args, tt.expectArgs)
+			}
+			if in != tt.expectIn {
+				t.Errorf("%s: got stdin %q, want %q", tt.mode, in, tt.expectIn)
+			}
+		}
+	})
+	t.Run("blank shell should use the default", func(t *testing.T) {
+		ti := newTestInterpreter()
+		if err := ti.Execute(context.Background(), Execution{Script: "echo", Shell: " "}); err != nil {
+			t.Fatal(err)
+		}
+		if !ti.shellRunnerCalled {
+			t.Fatal("expected shell call")
+		}
+		if ti.shebangRunnerCalled {
+			t.Fatal("expected no shebang")
+		}
+	})
 	t.Run("error creating file should not execute", func(t *testing.T) {
 		she := "#!/usr/bin/env python "
 		ti := newTestInterpreter()
 		ti.tempFilePrefix = "invalid/prefix"
-		if err := ti.Execute(context.Background(), she, nil, nil, "", ""); err == nil {
+		if err := ti.Execute(context.Background(), Execution{Script: she}); err == nil {
 			t.Fatal("expected an error")
 		}
 		if ti.shellRunnerCalled {
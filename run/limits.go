@@ -0,0 +1,56 @@
+package run
+
+import (
+	"fmt"
+
+	"github.com/joerdav/xc/models"
+)
+
+// openFilesLimit returns the limit on open files for the commands of task,
+// or 0 for no limit. A task's max-open-files attribute overrides the Runner.
+// Limits above the hard limit of xc are lowered to it, with a warning.
+func (r *Runner) openFilesLimit(task models.Task) uint64 {
+	n := r.maxOpenFiles
+	if task.MaxOpenFiles > 0 {
+		n = task.MaxOpenFiles
+	}
+	if n == 0 {
+		return 0
+	}
+	hard, err := openFilesHardLimit()
+	if err != nil {
+		fmt.Fprintf(r.stderr, "xc: ignoring max-open-files for %s: %v\n", task.Name, err)
+		return 0
+	}
+	if n > hard {
+		fmt.Fprintf(r.stderr, "xc: max-open-files %d for %s exceeds the hard limit of %d, using %d\n",
+			n, task.Name, hard, hard)
+		return hard
+	}
+	return n
+}
+
+// hostname returns the hostname seen by the commands of task, or "" to leave it unchanged.
+func (r *Runner) hostname(task models.Task) string {
+	if task.Hostname != "" {
+		return task.Hostname
+	}
+	return r.defaultHostname
+}
+
+// checkHostname returns an error if any task which will be run sets its
+// hostname, but hostnames cannot be set.
+func (r *Runner) checkHostname(name string) error {
+	plan, err := r.executionPlan(name)
+	if err != nil {
+		return err
+	}
+	for _, t := range plan {
+		if r.hostname(t) != "" {
+			if err := checkHostnameSupport(); err != nil {
+				return fmt.Errorf("cannot set hostname of %s: %w", t.Name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package run
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessTreeRSS(t *testing.T) {
+	cmd := exec.Command("sleep", "5")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill() //nolint:errcheck
+	self := processRSS(os.Getpid())
+	if self == 0 {
+		t.Fatal("expected the test process to use memory")
+	}
+	total, err := processTreeRSS([]int{os.Getpid()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total <= self {
+		t.Fatalf("expected the child to be included, got %d for process using %d", total, self)
+	}
+}
+
+func TestMemProfiler(t *testing.T) {
+	dir := t.TempDir()
+	m := newMemProfiler(10*time.Millisecond, dir)
+	procs, stop := m.profile("a/task")
+	cmd := exec.Command("sleep", "5")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill() //nolint:errcheck
+	untrack := procs.track(cmd.Process)
+	time.Sleep(100 * time.Millisecond)
+	untrack()
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "a_task-mem.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if lines[0] != "time,rss_bytes" || len(lines) < 2 {
+		t.Fatalf("expected a header and samples, got %q", b)
+	}
+	if m.peaks["a/task"] == 0 {
+		t.Fatal("expected a peak to be recorded")
+	}
+}
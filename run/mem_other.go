@@ -0,0 +1,10 @@
+//go:build !linux
+
+package run
+
+import "errors"
+
+// processTreeRSS is only supported on linux.
+func processTreeRSS([]int) (int64, error) {
+	return 0, errors.New("memory profiling is only supported on linux")
+}
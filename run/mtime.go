@@ -0,0 +1,53 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/joerdav/xc/models"
+)
+
+// preserveMtimes snapshots the files in dir if task should preserve their
+// modification times. The returned function restores the modification time
+// of each file whose content is unchanged.
+func (r *Runner) preserveMtimes(task models.Task, dir string) (restore func() error, err error) {
+	if !r.preserveMtime && !task.PreserveMtime {
+		return func() error { return nil }, nil
+	}
+	if dir == "" {
+		dir = "."
+	}
+	snapshot, err := snapshotFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot modification times: %w", err)
+	}
+	return func() error {
+		if err := restoreMtimes(snapshot); err != nil {
+			return fmt.Errorf("failed to restore modification times: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// restoreMtimes sets the modification time of each file in snapshot back to
+// its recorded value, if the file has been touched but its content is unchanged.
+func restoreMtimes(snapshot map[string]fileSnapshot) error {
+	var errs []error
+	for path, s := range snapshot {
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().Equal(s.modTime) {
+			// removed or untouched
+			continue
+		}
+		hash, err := hashFile(path)
+		if err != nil || hash != s.hash {
+			continue
+		}
+		if err := os.Chtimes(path, time.Now(), s.modTime); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,57 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRestoreMtimes(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	files := map[string]string{"touched": "same", "changed": "before", filepath.Join(".git", "index"): "git"}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshot, err := snapshotFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := snapshot[filepath.Join(dir, ".git", "index")]; ok {
+		t.Fatal("expected .git to be skipped")
+	}
+	// rewrite both files, changing only one
+	if err := os.WriteFile(filepath.Join(dir, "touched"), []byte("same"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "changed"), []byte("after"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := restoreMtimes(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "touched"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Fatalf("expected unchanged file to have mtime %v, got %v", old, info.ModTime())
+	}
+	info, err = os.Stat(filepath.Join(dir, "changed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ModTime().Equal(old) {
+		t.Fatal("expected changed file to keep its new mtime")
+	}
+}
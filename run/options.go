@@ -0,0 +1,626 @@
+package run
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"text/template"
+	"time"
+
+	"github.com/joerdav/xc/models"
+	"github.com/joerdav/xc/state"
+)
+
+// RunnerOption configures optional behaviour of a Runner.
+type RunnerOption func(*Runner)
+
+// WithKillGroup sets whether the process group of a task is killed when
+// the task fails or is cancelled. Tasks can opt out with `kill-group: false`.
+func WithKillGroup(killGroup bool) RunnerOption {
+	return func(r *Runner) {
+		r.killGroup = killGroup
+	}
+}
+
+// WithErrorHighlighting highlights lines of task output which match any of patterns.
+func WithErrorHighlighting(patterns []*regexp.Regexp) RunnerOption {
+	return func(r *Runner) {
+		r.errorLines = patterns
+	}
+}
+
+// WithOutputHighlights colours lines of task output with the first of
+// highlights which matches them. Lines matching none of them are highlighted
+// by WithErrorHighlighting, if it is set.
+func WithOutputHighlights(highlights []Highlight) RunnerOption {
+	return func(r *Runner) {
+		r.highlights = highlights
+	}
+}
+
+// WithExpandEnvRefs expands references to other variables in the env attribute
+// of tasks before they are run, rather than leaving them to the shell.
+func WithExpandEnvRefs(expand bool) RunnerOption {
+	return func(r *Runner) {
+		r.expandEnvRefs = expand
+	}
+}
+
+// WithAbortOnStderr fails every task as soon as it writes to stderr, even if
+// it would have exited successfully. Tasks can enable this individually with
+// `fail-on-stderr: true`.
+func WithAbortOnStderr(abort bool) RunnerOption {
+	return func(r *Runner) {
+		r.abortOnStderr = abort
+	}
+}
+
+// WithAssertNoOutput fails the named tasks if they write to stdout or stderr,
+// even if they exit successfully, as if they had `expect-silent: true`.
+func WithAssertNoOutput(tasks []string) RunnerOption {
+	return func(r *Runner) {
+		r.assertNoOutput = tasks
+	}
+}
+
+// WithNoPTY runs interactive tasks like any other task, with their output
+// prefixed and piped through xc rather than given control of the terminal.
+func WithNoPTY(noPTY bool) RunnerOption {
+	return func(r *Runner) {
+		r.noPTY = noPTY
+	}
+}
+
+// WithShowScript writes the script of each task to stderr before it is run.
+func WithShowScript(show bool) RunnerOption {
+	return func(r *Runner) {
+		r.showScript = show
+	}
+}
+
+// WithDryRun goes through the tasks which would be run without running their scripts.
+func WithDryRun(dryRun bool) RunnerOption {
+	return func(r *Runner) {
+		r.dryRun = dryRun
+	}
+}
+
+// WithDryRunOutput writes the tasks reached by a dry run to w as a single JSON
+// object, in the order they are reached, once Run has finished.
+func WithDryRunOutput(w io.Writer) RunnerOption {
+	return func(r *Runner) {
+		r.dryRunOutput = &dryRunLogger{w: w}
+	}
+}
+
+// WithPersistEnv sets the variables exported by the script of each task for
+// the tasks which run after it. Only scripts run by the built-in shell can
+// export variables.
+func WithPersistEnv(persist bool) RunnerOption {
+	return func(r *Runner) {
+		r.persistEnv = persist
+	}
+}
+
+// WithClearEnvOnError drops the variables exported by a task which fails,
+// rather than persisting them, with WithPersistEnv.
+func WithClearEnvOnError(clear bool) RunnerOption {
+	return func(r *Runner) {
+		r.clearEnvOnError = clear
+	}
+}
+
+// WithNoInheritCwd sets PWD in the environment of each task to the absolute
+// path of the directory it runs in, rather than the working directory of xc.
+func WithNoInheritCwd(noInherit bool) RunnerOption {
+	return func(r *Runner) {
+		r.noInheritCwd = noInherit
+	}
+}
+
+// WithRetryBackoff sets how the wait between retries grows for tasks which
+// do not set retry-backoff.
+func WithRetryBackoff(backoff models.RetryBackoff) RunnerOption {
+	return func(r *Runner) {
+		r.retryBackoff = backoff
+	}
+}
+
+// WithStdinEnv passes the value of the environment variable name as the stdin
+// of tasks which do not set stdin-env.
+func WithStdinEnv(name string) RunnerOption {
+	return func(r *Runner) {
+		r.stdinEnv = name
+	}
+}
+
+// WithStdinJSON passes data, verbatim, as the stdin of tasks which do not set stdin-env.
+func WithStdinJSON(data string) RunnerOption {
+	return func(r *Runner) {
+		r.stdinJSON = []byte(data)
+	}
+}
+
+// WithStdinLog copies the stdin of every task to the file at path, as it is
+// read. Tasks can override this with `stdin-log`.
+func WithStdinLog(path string) RunnerOption {
+	return func(r *Runner) {
+		r.stdinLog = path
+	}
+}
+
+// WithTmpfs runs every task in a memory-backed copy of its directory. Unless
+// noSyncBack is set, the changes each task makes are copied back once it has finished.
+// noSyncBack applies to tasks with the tmpfs attribute too.
+func WithTmpfs(tmpfs, noSyncBack bool) RunnerOption {
+	return func(r *Runner) {
+		r.tmpfs, r.noSyncBack = tmpfs, noSyncBack
+	}
+}
+
+// WithDefaultTimeout stops tasks without the timeout attribute once they
+// have run for timeout, if it is greater than 0.
+func WithDefaultTimeout(timeout time.Duration) RunnerOption {
+	return func(r *Runner) {
+		r.defaultTimeout = timeout
+	}
+}
+
+// WithTimestamps prepends the time, formatted with the time layout, to every
+// line of task output. The layout can also be RFC3339, RFC3339Nano, or UnixMs
+// for milliseconds since the epoch. If layout is empty the time since the
+// Runner was created is used instead, as +HH:MM:SS.mmm.
+func WithTimestamps(layout string) RunnerOption {
+	if named, ok := namedLayouts[layout]; ok {
+		layout = named
+	}
+	return func(r *Runner) {
+		r.timestamps = &timestamper{layout: layout, start: time.Now(), now: time.Now}
+	}
+}
+
+// WithInheritSignals forwards each signal received on signals to the running
+// commands of every task, rather than interrupting them when xc is cancelled.
+func WithInheritSignals(signals <-chan os.Signal) RunnerOption {
+	return func(r *Runner) {
+		r.signals = signals
+		r.running = &processSet{pids: map[int]bool{}}
+	}
+}
+
+// WithScriptInterpolation expands $VAR and ${VAR} in the scripts of tasks
+// without no-interpolate, using their environment, before they are run.
+func WithScriptInterpolation(interpolate bool) RunnerOption {
+	return func(r *Runner) {
+		r.interpolateScripts = interpolate
+	}
+}
+
+// WithScriptLog writes the script of each task to the log file before its
+// output, with secrets redacted as they are in the environment log.
+func WithScriptLog(logScript bool) RunnerOption {
+	return func(r *Runner) {
+		r.logScript = logScript
+	}
+}
+
+// WithTaskHooks runs the before script ahead of every task, and the after script
+// once every task has exited, whether or not it succeeded.
+// Either script may be empty.
+func WithTaskHooks(before, after string) RunnerOption {
+	return func(r *Runner) {
+		r.beforeEach, r.afterEach = before, after
+	}
+}
+
+// WithTaskEnv sets variables, as KEY=VALUE, on top of the env attribute of the named task.
+func WithTaskEnv(task string, vars []string) RunnerOption {
+	return func(r *Runner) {
+		r.taskEnv[task] = append(r.taskEnv[task], vars...)
+	}
+}
+
+// WithEnvFiles sets variables, as KEY=VALUE, in the environment of every task,
+// before the env-files and env attributes of the task, which take precedence.
+func WithEnvFiles(vars []string) RunnerOption {
+	return func(r *Runner) {
+		r.envFiles = append(r.envFiles, vars...)
+	}
+}
+
+// WithEnvTypes requires variables in the environment of every task to be set
+// to values of their type before the task runs. Types set by the env-types
+// attribute of a task take precedence.
+func WithEnvTypes(types map[string]models.EnvType) RunnerOption {
+	return func(r *Runner) {
+		r.envTypes = types
+	}
+}
+
+// WithRunHidden allows hidden tasks, whose names start with an underscore,
+// to be run directly rather than only as required tasks.
+func WithRunHidden(runHidden bool) RunnerOption {
+	return func(r *Runner) {
+		r.runHidden = runHidden
+	}
+}
+
+// WithExitCodes changes the meaning of exit codes of every task, such as
+// treating 2 as a warning rather than a failure. Meanings set by the
+// exit-codes attribute of a task take precedence.
+func WithExitCodes(codes map[int]models.ExitCodeMeaning) RunnerOption {
+	return func(r *Runner) {
+		r.exitCodes = codes
+	}
+}
+
+// WithEnvOverrides sets variables, as KEY=VALUE, in the environment of every
+// task, taking precedence over the env attribute and WithTaskEnv.
+// Inputs given to a task still take precedence.
+func WithEnvOverrides(vars []string) RunnerOption {
+	return func(r *Runner) {
+		r.envOverrides = append(r.envOverrides, vars...)
+	}
+}
+
+// WithGlobInputs expands glob patterns in the values of the named inputs of
+// every task, as if they were listed in its expand-glob-inputs attribute.
+func WithGlobInputs(names []string) RunnerOption {
+	return func(r *Runner) {
+		r.globInputs = names
+	}
+}
+
+// WithInputMasks redacts the values of the named inputs, once they are
+// resolved, from the output of every task which runs after, like
+// ***REDACTED***.
+func WithInputMasks(names []string) RunnerOption {
+	return func(r *Runner) {
+		r.inputMasks = names
+	}
+}
+
+// WithOutputMasking replaces the parts of each line of task output which match
+// any of patterns with ***REDACTED***, in the terminal and the log file.
+func WithOutputMasking(patterns []*regexp.Regexp) RunnerOption {
+	return func(r *Runner) {
+		r.maskPatterns = patterns
+	}
+}
+
+// WithSummaryLine writes a line to stdout once each task has finished, by
+// executing tmpl with the TaskSummary of the task.
+func WithSummaryLine(tmpl *template.Template) RunnerOption {
+	return func(r *Runner) {
+		r.summaryLine = tmpl
+	}
+}
+
+// WithOutputGrep only shows lines of task output which match any of patterns.
+// Every line is still written to the log file.
+func WithOutputGrep(patterns []*regexp.Regexp) RunnerOption {
+	return func(r *Runner) {
+		r.grepPatterns = patterns
+	}
+}
+
+// WithOutputTruncation replaces each section of task output with a line
+// saying how many lines were suppressed. Every line is still written to the log file.
+func WithOutputTruncation(sections []Section) RunnerOption {
+	return func(r *Runner) {
+		r.sections = sections
+	}
+}
+
+// WithOutputLines shows only the first or last lines of output from each task
+// without output-head or output-tail. Output is buffered until the task completes
+// if only the last lines are shown. Every line is still written to the log file.
+func WithOutputLines(lines models.OutputLines) RunnerOption {
+	return func(r *Runner) {
+		r.lines = &lines
+	}
+}
+
+// WithOutputLimit limits the output shown from each task to the last limit bytes.
+// Output is buffered until the task completes.
+func WithOutputLimit(limit int64) RunnerOption {
+	return func(r *Runner) {
+		r.outputLimit = limit
+	}
+}
+
+// WithOutputFilter pipes the combined stdout and stderr of each task through
+// the command filter before it is shown. Tasks can override this with `output-filter`.
+func WithOutputFilter(filter string) RunnerOption {
+	return func(r *Runner) {
+		r.outputFilter = filter
+	}
+}
+
+// WithMaxLineLength truncates lines of output shown from each task which are
+// longer than n bytes, ending them with "...". The log file still gets every line in full.
+func WithMaxLineLength(n int) RunnerOption {
+	return func(r *Runner) {
+		r.maxLineLength = n
+	}
+}
+
+// WithMaxRestarts makes Watch return an error once a task without the
+// max-restarts attribute has been run again n times, if n is greater than 0.
+func WithMaxRestarts(n int) RunnerOption {
+	return func(r *Runner) {
+		r.maxRestarts = n
+	}
+}
+
+// WithLogFile writes the full output of every task to w.
+func WithLogFile(w io.Writer) RunnerOption {
+	return func(r *Runner) {
+		r.logFile = &syncWriter{w: w}
+	}
+}
+
+// WithStripANSI removes ANSI escape sequences from output written to the log file.
+func WithStripANSI(strip bool) RunnerOption {
+	return func(r *Runner) {
+		r.stripANSI = strip
+	}
+}
+
+// WithOutput writes the output of tasks to stdout and stderr, instead of
+// those of xc.
+func WithOutput(stdout, stderr io.Writer) RunnerOption {
+	return func(r *Runner) {
+		r.stdout, r.stderr = stdout, stderr
+	}
+}
+
+// WithJSONLog writes each line of task output to stdout as a JSON object,
+// instead of prefixing it with the task name.
+func WithJSONLog(jsonLog bool) RunnerOption {
+	return func(r *Runner) {
+		r.jsonLog = jsonLog
+	}
+}
+
+// WithEnvLog writes the resolved environment of each task to the log file,
+// or to stdout if there is no log file, before the task runs.
+// The values of variables which look like secrets are masked if maskSecrets is set.
+func WithEnvLog(envLog, maskSecrets bool) RunnerOption {
+	return func(r *Runner) {
+		r.envLog = envLog
+		r.maskSecrets = maskSecrets
+	}
+}
+
+// WithCleanupEnvFiles deletes the env files of each task once it has run, as
+// set by cleanup. Tasks can set this themselves with `cleanup-env-file`.
+func WithCleanupEnvFiles(cleanup models.EnvFileCleanup) RunnerOption {
+	return func(r *Runner) {
+		r.cleanupEnvFiles = cleanup
+	}
+}
+
+// WithWorkDirLog writes the absolute directory each task runs in, once its
+// dir attribute is resolved, to the log file, or to stdout if there is no log
+// file, before the task runs.
+func WithWorkDirLog(workDirLog bool) RunnerOption {
+	return func(r *Runner) {
+		r.workDirLog = workDirLog
+	}
+}
+
+// WithPersistOutputs saves the outputs of the named tasks, from their outputs
+// attribute, to .xc/artifacts/<task> each time they succeed.
+func WithPersistOutputs(persistOutputs []string) RunnerOption {
+	return func(r *Runner) {
+		r.persistOutputs = persistOutputs
+	}
+}
+
+// WithDirSnapshot hashes the files in the directory of each task before and
+// after it runs, and reports any which changed to the log file, or to stdout
+// if there is no log file.
+func WithDirSnapshot(snapshot bool) RunnerOption {
+	return func(r *Runner) {
+		r.dirSnapshot = snapshot
+	}
+}
+
+// WithEnvWhitelist only passes variables from the environment of xc to tasks
+// if their name matches one of the glob patterns.
+// Variables set by the `env` attribute and task inputs are always passed.
+func WithEnvWhitelist(patterns []string) RunnerOption {
+	return func(r *Runner) {
+		r.envWhitelist = patterns
+	}
+}
+
+// WithEnvBlacklist stops variables from the environment of xc being passed to
+// tasks if their name matches one of the glob patterns.
+func WithEnvBlacklist(patterns []string) RunnerOption {
+	return func(r *Runner) {
+		r.envBlacklist = patterns
+	}
+}
+
+// WithStdinEOFTimeout closes the stdin of a task after no data has been read
+// from it for timeout. Tasks can override this with `stdin-eof-timeout`.
+func WithStdinEOFTimeout(timeout time.Duration) RunnerOption {
+	return func(r *Runner) {
+		r.stdinEOFTimeout = timeout
+	}
+}
+
+// WithComputedEnv sets each of vars to the trimmed stdout of its command, run
+// before every task. Variables from the computed-env attribute of a task are set after them.
+func WithComputedEnv(vars []models.ComputedVar) RunnerOption {
+	return func(r *Runner) {
+		r.computedVars = vars
+	}
+}
+
+// WithDynamicEnv sets a script which is run before every task, with the
+// environment of the task, whose stdout of KEY=VALUE lines is added to that
+// environment. It runs before the dynamic-env script of the task, if any.
+func WithDynamicEnv(script string) RunnerOption {
+	return func(r *Runner) {
+		r.dynamicEnvScript = script
+	}
+}
+
+// WithCleanupScript sets a script which is run when a task is cancelled,
+// for tasks without a `cleanup` attribute.
+func WithCleanupScript(script string) RunnerOption {
+	return func(r *Runner) {
+		r.cleanupScript = script
+	}
+}
+
+// WithTaskInputs supplies values for the inputs of the named task, as KEY=VALUE.
+// Variables which are not inputs of the task are ignored.
+// Inputs given as arguments take precedence.
+func WithTaskInputs(task string, values []string) RunnerOption {
+	return func(r *Runner) {
+		r.taskInputs[task] = append(r.taskInputs[task], values...)
+	}
+}
+
+// WithDefaultInputs supplies values, as KEY=VALUE, for the inputs of every
+// task which are not given as arguments, in the environment, or by a default
+// in the markdown or the defaults-file of the task.
+func WithDefaultInputs(values []string) RunnerOption {
+	return func(r *Runner) {
+		r.defaultInputs = values
+	}
+}
+
+// WithMemProfile samples the memory used by the processes of each task every
+// interval, writing the samples to .xc/profiles/<task>-mem.csv, and prints the
+// peak memory of each task once the run has finished.
+func WithMemProfile(interval time.Duration) RunnerOption {
+	return func(r *Runner) {
+		r.memProfiler = newMemProfiler(interval, state.Dir(r.dir, "profiles"))
+	}
+}
+
+// WithMaxOpenFiles limits the number of files which each command of a task can
+// open to n. Tasks can override this with `max-open-files`.
+func WithMaxOpenFiles(n uint64) RunnerOption {
+	return func(r *Runner) {
+		r.maxOpenFiles = n
+	}
+}
+
+// WithHostname runs the commands of each task in a new UTS namespace with
+// hostname. Tasks can override this with `hostname`. Only supported on linux.
+func WithHostname(hostname string) RunnerOption {
+	return func(r *Runner) {
+		r.defaultHostname = hostname
+	}
+}
+
+// WithScriptMode passes scripts run by an interpreter other than the built-in
+// shell in mode. Tasks can override this with `script-mode`.
+func WithScriptMode(mode models.ScriptMode) RunnerOption {
+	return func(r *Runner) {
+		r.scriptMode = mode
+	}
+}
+
+// WithPreserveMtime restores the modification time of files in the directory
+// of each task which the task touched without changing.
+// Tasks can enable this individually with `preserve-mtime: true`.
+func WithPreserveMtime(preserve bool) RunnerOption {
+	return func(r *Runner) {
+		r.preserveMtime = preserve
+	}
+}
+
+// WithCreateDir creates the directory of each task before it runs, if it does
+// not exist. Tasks can enable this individually with `create-dir: true`.
+func WithCreateDir(create bool) RunnerOption {
+	return func(r *Runner) {
+		r.createDir = create
+	}
+}
+
+// WithTagLimit allows at most n tasks with tag to run at once. Other tasks
+// with the tag wait for one to finish before they run.
+func WithTagLimit(tag string, n int) RunnerOption {
+	return func(r *Runner) {
+		r.tagLimits[tag] = make(chan struct{}, n)
+	}
+}
+
+// WithRunInOrder runs the dependencies of every task one at a time, in the
+// order they are listed, even if the task has `runDeps: async`.
+func WithRunInOrder(inOrder bool) RunnerOption {
+	return func(r *Runner) {
+		r.runInOrder = inOrder
+	}
+}
+
+// WithNoDedup runs a task every time it is required, rather than once for each
+// set of inputs it is required with. Tasks with `run: once` still run once.
+func WithNoDedup(noDedup bool) RunnerOption {
+	return func(r *Runner) {
+		r.noDedup = noDedup
+	}
+}
+
+// WithEnvNoNewlines fails tasks if the value of any variable in their
+// environment contains a newline, before they are run.
+func WithEnvNoNewlines(check bool) RunnerOption {
+	return func(r *Runner) {
+		r.noNewlineEnv = check
+	}
+}
+
+// WithOutputAssertion fails the named task, even if it exits successfully,
+// unless a line of its output matches pattern. Can be given more than once.
+func WithOutputAssertion(task string, pattern *regexp.Regexp) RunnerOption {
+	return func(r *Runner) {
+		r.outputAssertions[task] = append(r.outputAssertions[task], pattern)
+	}
+}
+
+// WithStdoutFile writes the stdout of the named task to w, instead of the
+// terminal and log file. Tasks can share a writer, including with WithStderrFile.
+func WithStdoutFile(task string, w io.Writer) RunnerOption {
+	return func(r *Runner) {
+		r.stdoutFiles[task] = lockedWriter{mu: r.redirectMu, w: w}
+	}
+}
+
+// WithStderrFile writes the stderr of the named task to w, instead of the
+// terminal and log file. Tasks can share a writer, including with WithStdoutFile.
+func WithStderrFile(task string, w io.Writer) RunnerOption {
+	return func(r *Runner) {
+		r.stderrFiles[task] = lockedWriter{mu: r.redirectMu, w: w}
+	}
+}
+
+// WithRequiredOutputs fails the named task, even if it exits successfully,
+// unless each of files exists relative to its directory. Can be given more than once.
+func WithRequiredOutputs(task string, files []string) RunnerOption {
+	return func(r *Runner) {
+		r.requiredOutputs[task] = append(r.requiredOutputs[task], files...)
+	}
+}
+
+// WithRequiredFiles fails every task before it runs unless each of files,
+// or glob patterns, exists relative to its directory.
+func WithRequiredFiles(files []string) RunnerOption {
+	return func(r *Runner) {
+		r.requiredFiles = append(r.requiredFiles, files...)
+	}
+}
+
+// WithRequireDocker checks that the Docker daemon is accessible before running any task.
+// Without it, the check is only made if a task with `requires-docker: true` is going to run.
+func WithRequireDocker(require bool) RunnerOption {
+	return func(r *Runner) {
+		r.requireDocker = require
+	}
+}
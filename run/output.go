@@ -0,0 +1,647 @@
+package run
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/joerdav/xc/models"
+)
+
+var (
+	errorLineColor = []byte("\033[1;31m")
+	resetColor     = []byte("\033[0m")
+)
+
+// ansiRegexp matches ANSI escape sequences, including SGR colours, cursor
+// movement and OSC hyperlinks.
+var ansiRegexp = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// DefaultErrorPatterns match lines of output which commonly indicate an error.
+var DefaultErrorPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`ERROR:`),
+	regexp.MustCompile(`FAILED`),
+	regexp.MustCompile(`panic:`),
+	regexp.MustCompile(`Exception:`),
+}
+
+// taskOutput returns the writers for the stdout and stderr of a task, and a
+// function which flushes them once the task has finished.
+// Output is prefixed with prefix, unless it is empty, in which case
+// the task is given the stdout and stderr of the Runner directly.
+// If lines is set only those lines are shown, the log file still gets every line.
+func (r *Runner) taskOutput(prefix string, lines *models.OutputLines) (stdout, stderr io.Writer, closer func() error) {
+	if prefix == "" {
+		return r.interactiveOutput()
+	}
+	var out, errOut io.WriteCloser
+	if r.jsonLog {
+		j := newJSONLogger(strings.TrimSpace(prefix))
+		// both streams are written to stdout, but must not close it
+		stdout := struct{ io.Writer }{r.stdout}
+		out, errOut = newLineWriter(stdout, j.line("stdout")), newLineWriter(stdout, j.line("stderr"))
+	} else {
+		out, errOut = r.terminalOutput(r.stdout, prefix), r.terminalOutput(r.stderr, prefix)
+	}
+	if r.outputLimit > 0 {
+		out, errOut = newTailLimiter(out, errOut, r.outputLimit)
+	}
+	if lines != nil {
+		out, errOut = newLineLimiter(out, errOut, *lines)
+	}
+	if r.maxLineLength > 0 {
+		out, errOut = newLineWriter(out, truncateLines(r.maxLineLength)), newLineWriter(errOut, truncateLines(r.maxLineLength))
+	}
+	if len(r.grepPatterns) > 0 {
+		// filter only what is shown, the log file still gets every line
+		out, errOut = newGrepFilter(out, errOut, r.grepPatterns)
+	}
+	if len(r.sections) > 0 {
+		out, errOut = newSectionFilter(out, errOut, r.sections)
+	}
+	if r.logFile != nil {
+		out = teeWriteCloser{out, r.logFileOutput(prefix)}
+		errOut = teeWriteCloser{errOut, r.logFileOutput(prefix)}
+	}
+	if r.timestamps != nil && !r.jsonLog {
+		out, errOut = newLineWriter(out, r.timestamps.line), newLineWriter(errOut, r.timestamps.line)
+	}
+	// masking wraps every other writer so nothing unmasked reaches the terminal or log file
+	out, errOut = r.masked(out), r.masked(errOut)
+	return out, errOut, func() error {
+		return errors.Join(out.Close(), errOut.Close())
+	}
+}
+
+// interactiveOutput returns writers for the output of an interactive task.
+// The terminal gets the output as it is written, without prefixes, filters or
+// masking, which would hold back prompts until the end of the line.
+// The log file, if there is one, still gets every line, masked.
+func (r *Runner) interactiveOutput() (stdout, stderr io.Writer, closer func() error) {
+	if r.logFile == nil {
+		return r.stdout, r.stderr, func() error { return nil }
+	}
+	logOut, logErr := r.masked(r.logFileOutput("")), r.masked(r.logFileOutput(""))
+	out := teeWriteCloser{nopWriteCloser{r.stdout}, logOut}
+	errOut := teeWriteCloser{nopWriteCloser{r.stderr}, logErr}
+	return out, errOut, func() error {
+		return errors.Join(out.Close(), errOut.Close())
+	}
+}
+
+// logFileOutput returns a writer for task output to the log file.
+func (r *Runner) logFileOutput(prefix string) io.WriteCloser {
+	var logFile io.Writer = r.logFile
+	if r.stripANSI {
+		logFile = ansiStripper{logFile}
+	}
+	return newPrefixLogger(logFile, prefix)
+}
+
+// masked wraps w to redact text matching the output mask patterns of the
+// Runner, and the values of masked inputs.
+func (r *Runner) masked(w io.WriteCloser) io.WriteCloser {
+	if len(r.maskPatterns) > 0 {
+		w = newLineWriter(w, redactLines(r.maskPatterns))
+	}
+	if len(r.inputMasks) > 0 {
+		w = newLineWriter(w, r.maskedInputs.line)
+	}
+	return w
+}
+
+// infoWriter returns a writer for information from xc about a task, which is
+// written to the log file if there is one, or to stdout otherwise.
+func (r *Runner) infoWriter(prefix string, stdout io.Writer) io.WriteCloser {
+	if r.logFile != nil {
+		return newPrefixLogger(r.logFile, prefix)
+	}
+	return nopWriteCloser{stdout}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// terminalOutput wraps w with the filters configured on the Runner.
+func (r *Runner) terminalOutput(w io.Writer, prefix string) io.WriteCloser {
+	var out io.WriteCloser = newPrefixLogger(w, prefix)
+	// lines matching an error pattern but no highlight are still coloured
+	highlights := append([]Highlight(nil), r.highlights...)
+	for _, re := range r.errorLines {
+		highlights = append(highlights, Highlight{Pattern: re, color: errorLineColor})
+	}
+	if len(highlights) > 0 {
+		out = newLineWriter(out, colorLines(highlights))
+	}
+	return out
+}
+
+// jsonLogger encodes lines of output from a task as JSON objects.
+type jsonLogger struct {
+	task  string
+	start time.Time
+	seq   int64
+}
+
+type jsonLine struct {
+	Task      string `json:"task"`
+	Stream    string `json:"stream"`
+	Seq       int64  `json:"seq"`
+	TS        string `json:"ts"`
+	Line      string `json:"line"`
+	ElapsedMS int64  `json:"elapsed_ms"`
+}
+
+func newJSONLogger(task string) *jsonLogger {
+	return &jsonLogger{task: task, start: time.Now()}
+}
+
+// line returns a function for use with lineWriter, which encodes each line
+// written to stream. Lines are numbered in order across all streams of the task.
+func (j *jsonLogger) line(stream string) func([]byte) []byte {
+	return func(line []byte) []byte {
+		now := time.Now()
+		b, err := json.Marshal(jsonLine{
+			Task:      j.task,
+			Stream:    stream,
+			Seq:       atomic.AddInt64(&j.seq, 1),
+			TS:        now.UTC().Format(time.RFC3339Nano),
+			Line:      string(bytes.TrimSuffix(line, []byte{newLine})),
+			ElapsedMS: now.Sub(j.start).Milliseconds(),
+		})
+		if err != nil {
+			return line
+		}
+		return append(b, newLine)
+	}
+}
+
+// dryRunLogger collects the tasks reached by a dry run, in the format of
+// jsonLine but without timings, and encodes them as a single JSON object
+// once the run has finished.
+type dryRunLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	tasks []dryRunTask
+}
+
+type dryRunPlan struct {
+	DryRun bool         `json:"dry_run"`
+	Tasks  []dryRunTask `json:"tasks"`
+}
+
+type dryRunTask struct {
+	Task   string   `json:"task"`
+	Seq    int64    `json:"seq"`
+	Dir    string   `json:"dir"`
+	Args   []string `json:"args,omitempty"`
+	Script string   `json:"script"`
+}
+
+func (d *dryRunLogger) add(task, dir string, args []string, script string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.tasks = append(d.tasks, dryRunTask{
+		Task:   task,
+		Seq:    int64(len(d.tasks) + 1),
+		Dir:    dir,
+		Args:   args,
+		Script: script,
+	})
+}
+
+// flush writes the tasks added since it was last called to w.
+func (d *dryRunLogger) flush() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	plan := dryRunPlan{DryRun: true, Tasks: d.tasks}
+	if plan.Tasks == nil {
+		plan.Tasks = []dryRunTask{}
+	}
+	d.tasks = nil
+	enc := json.NewEncoder(d.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(plan)
+}
+
+// teeWriteCloser writes to, and closes, both of its writers.
+type teeWriteCloser struct {
+	a, b io.WriteCloser
+}
+
+func (t teeWriteCloser) Write(p []byte) (int, error) {
+	if n, err := t.a.Write(p); err != nil {
+		return n, err
+	}
+	return t.b.Write(p)
+}
+
+func (t teeWriteCloser) Close() error {
+	return errors.Join(t.a.Close(), t.b.Close())
+}
+
+// ansiStripper removes ANSI escape sequences from output.
+// Each write must contain only complete escape sequences, as is the case for
+// the lines written by prefixLogger.
+type ansiStripper struct {
+	w io.Writer
+}
+
+func (a ansiStripper) Write(p []byte) (int, error) {
+	if _, err := a.w.Write(ansiRegexp.ReplaceAll(p, nil)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// syncWriter serialises writes to a writer shared by concurrent tasks.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// lineWriter passes each line written to it through a function before
+// writing it to the underlying writer.
+type lineWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+	fn  func(line []byte) []byte
+}
+
+// newLineWriter returns a lineWriter which writes fn(line) to w for every line.
+// Lines for which fn returns nil are dropped.
+func newLineWriter(w io.Writer, fn func(line []byte) []byte) *lineWriter {
+	return &lineWriter{w: w, fn: fn}
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	n, _ := l.buf.Write(p)
+	for {
+		i := bytes.IndexByte(l.buf.Bytes(), newLine)
+		if i < 0 {
+			return n, nil
+		}
+		if err := l.out(l.buf.Next(i + 1)); err != nil {
+			return n, err
+		}
+	}
+}
+
+// Close writes any incomplete line left in the buffer,
+// then closes the underlying writer if it is an io.Closer.
+func (l *lineWriter) Close() error {
+	if l.buf.Len() > 0 {
+		if err := l.out(l.buf.Next(l.buf.Len())); err != nil {
+			return err
+		}
+	}
+	if c, ok := l.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (l *lineWriter) out(line []byte) error {
+	line = l.fn(line)
+	if line == nil {
+		return nil
+	}
+	_, err := l.w.Write(line)
+	return err
+}
+
+// Highlight colours lines of task output which match Pattern.
+type Highlight struct {
+	Pattern *regexp.Regexp
+	color   []byte
+}
+
+// highlightColors are the colours lines can be highlighted with, by name.
+var highlightColors = map[string][]byte{
+	"red":     []byte("\033[31m"),
+	"green":   []byte("\033[32m"),
+	"yellow":  []byte("\033[33m"),
+	"blue":    []byte("\033[34m"),
+	"magenta": []byte("\033[35m"),
+	"cyan":    []byte("\033[36m"),
+	"white":   []byte("\033[37m"),
+	"gray":    []byte("\033[90m"),
+}
+
+// NewHighlight returns a Highlight of the lines matching expr with the named
+// colour. expr is matched case-insensitively, unless it starts with (?-i).
+func NewHighlight(expr, color string) (Highlight, error) {
+	c, ok := highlightColors[strings.ToLower(color)]
+	if !ok {
+		names := make([]string, 0, len(highlightColors))
+		for name := range highlightColors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return Highlight{}, fmt.Errorf("unknown colour %q, should be one of (%s)", color, strings.Join(names, ", "))
+	}
+	re, err := regexp.Compile("(?i)" + expr)
+	if err != nil {
+		return Highlight{}, err
+	}
+	return Highlight{Pattern: re, color: c}, nil
+}
+
+// colorLines colours each line with the first of highlights which matches it.
+func colorLines(highlights []Highlight) func([]byte) []byte {
+	return func(line []byte) []byte {
+		text := bytes.TrimSuffix(line, []byte{newLine})
+		for _, h := range highlights {
+			if !h.Pattern.Match(text) {
+				continue
+			}
+			s := make([]byte, 0, len(h.color)+len(line)+len(resetColor))
+			s = append(s, h.color...)
+			s = append(s, text...)
+			s = append(s, resetColor...)
+			return append(s, line[len(text):]...)
+		}
+		return line
+	}
+}
+
+// redacted replaces text matched by a mask pattern.
+var redacted = []byte("***REDACTED***")
+
+// redactLines replaces the parts of each line matching any of patterns.
+func redactLines(patterns []*regexp.Regexp) func([]byte) []byte {
+	return func(line []byte) []byte {
+		text := bytes.TrimSuffix(line, []byte{newLine})
+		eol := line[len(text):]
+		for _, re := range patterns {
+			text = re.ReplaceAllLiteral(text, redacted)
+		}
+		return append(text, eol...)
+	}
+}
+
+var ellipsis = []byte("...")
+
+// truncateLines shortens each line longer than max bytes to max-3 bytes
+// followed by "...". The cut is moved back so a UTF-8 sequence is not split.
+func truncateLines(max int) func([]byte) []byte {
+	return func(line []byte) []byte {
+		text := bytes.TrimSuffix(line, []byte{newLine})
+		if len(text) <= max {
+			return line
+		}
+		eol := line[len(text):]
+		n := max - len(ellipsis)
+		if n < 0 {
+			n = 0
+		}
+		for n > 0 && !utf8.RuneStart(text[n]) {
+			n--
+		}
+		out := make([]byte, 0, n+len(ellipsis)+len(eol))
+		out = append(out, text[:n]...)
+		out = append(out, ellipsis...)
+		return append(out, eol...)
+	}
+}
+
+// unixMs is the timestamp layout for milliseconds since the Unix epoch.
+const unixMs = "UnixMs"
+
+// namedLayouts are the timestamp layouts which can be given by name.
+var namedLayouts = map[string]string{
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+}
+
+// timestamper prepends the time to lines of output.
+type timestamper struct {
+	// layout is the format of the time, unixMs, or "" for the time since start.
+	layout string
+	start  time.Time
+	now    func() time.Time
+}
+
+func (t *timestamper) line(line []byte) []byte {
+	now := t.now()
+	var ts string
+	switch t.layout {
+	case "":
+		ts = formatElapsed(now.Sub(t.start))
+	case unixMs:
+		ts = strconv.FormatInt(now.UnixMilli(), 10)
+	default:
+		ts = now.Format(t.layout)
+	}
+	return append([]byte(ts+" "), line...)
+}
+
+// formatElapsed formats d as +HH:MM:SS.mmm.
+func formatElapsed(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("+%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// tailLimiter keeps only the last limit bytes written to the stdout and
+// stderr of a task, writing them out in order once the task has finished.
+type tailLimiter struct {
+	mu       sync.Mutex
+	limit    int64
+	size     int64
+	omitted  int64
+	segments []segment
+	stdout   io.Writer
+}
+
+type segment struct {
+	w io.Writer
+	b []byte
+}
+
+// newTailLimiter returns writers for stdout and stderr which share a limit.
+func newTailLimiter(stdout, stderr io.WriteCloser, limit int64) (io.WriteCloser, io.WriteCloser) {
+	t := &tailLimiter{limit: limit, stdout: stdout}
+	return limitedWriter{t, stdout}, limitedWriter{t, stderr}
+}
+
+func (t *tailLimiter) write(w io.Writer, p []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if n := len(t.segments); n > 0 && t.segments[n-1].w == w {
+		t.segments[n-1].b = append(t.segments[n-1].b, p...)
+	} else {
+		t.segments = append(t.segments, segment{w: w, b: append([]byte(nil), p...)})
+	}
+	t.size += int64(len(p))
+	for t.size > t.limit {
+		drop := t.size - t.limit
+		if first := int64(len(t.segments[0].b)); first <= drop {
+			drop = first
+			t.segments = t.segments[1:]
+		} else {
+			t.segments[0].b = t.segments[0].b[drop:]
+		}
+		t.size -= drop
+		t.omitted += drop
+	}
+}
+
+// flush writes out the buffered output, preceded by a marker if any was omitted.
+func (t *tailLimiter) flush() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.omitted > 0 && len(t.segments) > 0 {
+		// start from a complete line
+		first := t.segments[0].b
+		if i := bytes.IndexByte(first, newLine); i >= 0 {
+			t.segments[0].b = first[i+1:]
+			t.omitted += int64(i + 1)
+		}
+	}
+	if t.omitted > 0 {
+		if _, err := fmt.Fprintf(t.stdout, "... %d bytes of output omitted\n", t.omitted); err != nil {
+			return err
+		}
+		t.omitted = 0
+	}
+	for _, s := range t.segments {
+		if _, err := s.w.Write(s.b); err != nil {
+			return err
+		}
+	}
+	t.segments, t.size = nil, 0
+	return nil
+}
+
+type limitedWriter struct {
+	t *tailLimiter
+	w io.WriteCloser
+}
+
+func (l limitedWriter) Write(p []byte) (int, error) {
+	l.t.write(l.w, p)
+	return len(p), nil
+}
+
+// Close writes out all buffered output before closing the underlying writer.
+func (l limitedWriter) Close() error {
+	if err := l.t.flush(); err != nil {
+		return err
+	}
+	return l.w.Close()
+}
+
+// lineLimiter shows only the first or last lines written to the stdout and
+// stderr of a task. The last lines are buffered until the task has finished.
+type lineLimiter struct {
+	mu      sync.Mutex
+	head    bool
+	limit   int
+	shown   int
+	omitted int
+	lines   []segment
+	stdout  io.Writer
+}
+
+// newLineLimiter returns writers for stdout and stderr which share the limit of lines.
+func newLineLimiter(stdout, stderr io.WriteCloser, lines models.OutputLines) (io.WriteCloser, io.WriteCloser) {
+	l := &lineLimiter{head: lines.Head, limit: lines.N, stdout: stdout}
+	return l.writer(stdout), l.writer(stderr)
+}
+
+func (l *lineLimiter) writer(w io.WriteCloser) io.WriteCloser {
+	return lineLimitedWriter{l, newLineWriter(struct{ io.Writer }{w}, l.line(w)), w}
+}
+
+// line returns a function for use with lineWriter, which passes on or buffers
+// each line written to w.
+func (l *lineLimiter) line(w io.Writer) func([]byte) []byte {
+	return func(line []byte) []byte {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.head {
+			if l.shown < l.limit {
+				l.shown++
+				return line
+			}
+			l.omitted++
+			return nil
+		}
+		l.lines = append(l.lines, segment{w: w, b: append([]byte(nil), line...)})
+		if len(l.lines) > l.limit {
+			l.lines = l.lines[1:]
+			l.omitted++
+		}
+		return nil
+	}
+}
+
+// flush writes out the buffered lines, with a marker where any were omitted.
+// Nothing is written if the limit is 0.
+func (l *lineLimiter) flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limit == 0 || l.omitted == 0 && len(l.lines) == 0 {
+		l.lines, l.omitted = nil, 0
+		return nil
+	}
+	marker := fmt.Sprintf("... %d lines of output omitted\n", l.omitted)
+	if l.omitted > 0 && !l.head {
+		if _, err := io.WriteString(l.stdout, marker); err != nil {
+			return err
+		}
+	}
+	for _, s := range l.lines {
+		if _, err := s.w.Write(s.b); err != nil {
+			return err
+		}
+	}
+	if l.omitted > 0 && l.head {
+		if _, err := io.WriteString(l.stdout, marker); err != nil {
+			return err
+		}
+	}
+	l.lines, l.omitted = nil, 0
+	return nil
+}
+
+type lineLimitedWriter struct {
+	l *lineLimiter
+	// lines splits what is written into lines, without closing w.
+	lines *lineWriter
+	w     io.WriteCloser
+}
+
+func (l lineLimitedWriter) Write(p []byte) (int, error) {
+	return l.lines.Write(p)
+}
+
+// Close writes out all buffered output before closing the underlying writer.
+func (l lineLimitedWriter) Close() error {
+	if err := l.lines.Close(); err != nil {
+		return err
+	}
+	if err := l.l.flush(); err != nil {
+		return err
+	}
+	return l.w.Close()
+}
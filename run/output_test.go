@@ -0,0 +1,313 @@
+//nolint:errcheck
+package run
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestLineWriter(t *testing.T) {
+	w := bytes.NewBuffer(nil)
+	l := newLineWriter(w, func(line []byte) []byte {
+		if bytes.HasPrefix(line, []byte("drop")) {
+			return nil
+		}
+		return append([]byte("> "), line...)
+	})
+
+	l.Write([]byte("hello"))
+	if w.String() != "" {
+		t.Fatalf("got %q, want incomplete line to be buffered", w.String())
+	}
+	l.Write([]byte(" world\ndrop this\nlast"))
+	if expect := "> hello world\n"; w.String() != expect {
+		t.Fatalf("got %q, want %q", w.String(), expect)
+	}
+	l.Close()
+	if expect := "> hello world\n> last"; w.String() != expect {
+		t.Fatalf("got %q, want %q", w.String(), expect)
+	}
+}
+
+func TestErrorHighlighting(t *testing.T) {
+	highlighted := func(patterns []*regexp.Regexp, in string) string {
+		t.Helper()
+		runner, err := NewRunner(models.Tasks{}, "", WithErrorHighlighting(patterns))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		w := runner.terminalOutput(&out, "")
+		w.Write([]byte(in))
+		w.Close()
+		return out.String()
+	}
+	tests := map[string]bool{
+		"all good\n":             false,
+		"ERROR: bad thing\n":     true,
+		"panic: oh no":           true,
+		"--- FAILED: TestSome\n": true,
+	}
+	for in, expect := range tests {
+		line := strings.TrimSuffix(in, "\n")
+		colored := string(errorLineColor) + line + string(resetColor)
+		if got := highlighted(DefaultErrorPatterns, in); strings.Contains(got, colored) != expect || !strings.Contains(got, line) {
+			t.Errorf("got %q, want highlighted %v", got, expect)
+		}
+	}
+	custom := []*regexp.Regexp{regexp.MustCompile(`^warn`)}
+	if got := highlighted(custom, "ERROR: not matched\n"); strings.Contains(got, string(errorLineColor)) {
+		t.Errorf("got %q, want line unchanged", got)
+	}
+	if got := highlighted(custom, "warning: matched\n"); !strings.Contains(got, string(errorLineColor)+"warning: matched") {
+		t.Errorf("got %q, want line highlighted", got)
+	}
+}
+
+func TestColorLines(t *testing.T) {
+	mustHighlight := func(expr, color string) Highlight {
+		h, err := NewHighlight(expr, color)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	color := colorLines([]Highlight{
+		mustHighlight("error", "red"),
+		mustHighlight("(?-i)WARNING", "yellow"),
+		mustHighlight("warning|error", "blue"),
+	})
+	tests := map[string]string{
+		"all good\n":          "all good\n",
+		"Error: bad thing\n":  "\033[31mError: bad thing" + string(resetColor) + "\n",
+		"WARNING: careful\n":  "\033[33mWARNING: careful" + string(resetColor) + "\n",
+		"warning: lower case": "\033[34mwarning: lower case" + string(resetColor),
+	}
+	for in, expect := range tests {
+		if got := string(color([]byte(in))); got != expect {
+			t.Errorf("got %q, want %q", got, expect)
+		}
+	}
+	if _, err := NewHighlight("error", "purple"); err == nil {
+		t.Error("expected an unknown colour to return an error")
+	}
+}
+
+func TestRedactLines(t *testing.T) {
+	redact := redactLines([]*regexp.Regexp{
+		regexp.MustCompile(`\b[0-9]{12}\b`),
+		regexp.MustCompile(`[a-z]+\.internal`),
+	})
+	tests := map[string]string{
+		"all good\n":                        "all good\n",
+		"account 123456789012 ready\n":      "account ***REDACTED*** ready\n",
+		"db.internal and 123456789012":      "***REDACTED*** and ***REDACTED***",
+		"1234567890123 is not an account\n": "1234567890123 is not an account\n",
+	}
+	for in, expect := range tests {
+		if got := string(redact([]byte(in))); got != expect {
+			t.Errorf("got %q, want %q", got, expect)
+		}
+	}
+}
+
+func TestTruncateLines(t *testing.T) {
+	truncate := truncateLines(10)
+	tests := map[string]string{
+		"short\n":            "short\n",
+		"exactly 10\n":       "exactly 10\n",
+		"much too long\n":    "much to...\n",
+		"no newline at all":  "no newl...",
+		"abcdef世界\n":         "abcdef...\n",
+		"abcde世界 and more\n": "abcde...\n",
+	}
+	for in, expect := range tests {
+		if got := string(truncate([]byte(in))); got != expect {
+			t.Errorf("%q: got %q, want %q", in, got, expect)
+		}
+	}
+}
+
+func TestTimestamper(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := start.Add(time.Hour + 2*time.Minute + 3*time.Second + 45*time.Millisecond)
+	tests := map[string]string{
+		time.RFC3339: "2024-01-02T04:06:08Z hello\n",
+		"15:04:05":   "04:06:08 hello\n",
+		unixMs:       "1704168368045 hello\n",
+		"":           "+01:02:03.045 hello\n",
+	}
+	for layout, expect := range tests {
+		ts := &timestamper{layout: layout, start: start, now: func() time.Time { return now }}
+		if got := string(ts.line([]byte("hello\n"))); got != expect {
+			t.Errorf("layout %q: got %q, want %q", layout, got, expect)
+		}
+	}
+}
+
+func TestWithTimestampsNamedLayout(t *testing.T) {
+	r, err := NewRunner(models.Tasks{}, "", WithTimestamps("RFC3339Nano"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.timestamps.layout != time.RFC3339Nano {
+		t.Fatalf("got layout %q, want %q", r.timestamps.layout, time.RFC3339Nano)
+	}
+}
+
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestTailLimiter(t *testing.T) {
+	t.Run("given output under the limit, should write everything on close", func(t *testing.T) {
+		var out, errOut closeRecorder
+		stdout, stderr := newTailLimiter(&out, &errOut, 100)
+		stdout.Write([]byte("one\n"))
+		stderr.Write([]byte("two\n"))
+		if out.Len() != 0 || errOut.Len() != 0 {
+			t.Fatal("expected output to be buffered")
+		}
+		stdout.Close()
+		stderr.Close()
+		if out.String() != "one\n" || errOut.String() != "two\n" {
+			t.Fatalf("got stdout=%q stderr=%q", out.String(), errOut.String())
+		}
+		if !out.closed || !errOut.closed {
+			t.Fatal("expected writers to be closed")
+		}
+	})
+	t.Run("given output over the limit, should keep the last complete lines", func(t *testing.T) {
+		var out, errOut closeRecorder
+		stdout, stderr := newTailLimiter(&out, &errOut, 10)
+		stdout.Write([]byte("first line\n"))
+		stderr.Write([]byte("second\n"))
+		stdout.Write([]byte("third\n"))
+		stdout.Close()
+		stderr.Close()
+		expect := "... 18 bytes of output omitted\nthird\n"
+		if out.String() != expect {
+			t.Fatalf("got %q, want %q", out.String(), expect)
+		}
+		if errOut.String() != "" {
+			t.Fatalf("got %q, want stderr to be omitted", errOut.String())
+		}
+	})
+}
+
+func TestLineLimiter(t *testing.T) {
+	tests := []struct {
+		name         string
+		lines        models.OutputLines
+		expectStdout string
+		expectStderr string
+	}{
+		{
+			name:         "given a tail, should keep the last lines",
+			lines:        models.OutputLines{N: 2},
+			expectStdout: "... 2 lines of output omitted\nfour",
+			expectStderr: "three\n",
+		},
+		{
+			name:         "given a head, should keep the first lines",
+			lines:        models.OutputLines{Head: true, N: 2},
+			expectStdout: "one\n... 2 lines of output omitted\n",
+			expectStderr: "two\n",
+		},
+		{
+			name:  "given 0 lines, should show nothing",
+			lines: models.OutputLines{N: 0},
+		},
+		{
+			name:         "given more lines than the output, should keep everything",
+			lines:        models.OutputLines{N: 10},
+			expectStdout: "one\nfour",
+			expectStderr: "two\nthree\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errOut closeRecorder
+			stdout, stderr := newLineLimiter(&out, &errOut, tt.lines)
+			stdout.Write([]byte("one\n"))
+			stderr.Write([]byte("two\nthr"))
+			stderr.Write([]byte("ee\n"))
+			stdout.Write([]byte("four"))
+			stdout.Close()
+			stderr.Close()
+			if out.String() != tt.expectStdout || errOut.String() != tt.expectStderr {
+				t.Fatalf("got stdout=%q stderr=%q, want stdout=%q stderr=%q", out.String(), errOut.String(), tt.expectStdout, tt.expectStderr)
+			}
+			if !out.closed || !errOut.closed {
+				t.Fatal("expected writers to be closed")
+			}
+		})
+	}
+}
+
+func TestANSIStripper(t *testing.T) {
+	tests := map[string]string{
+		"plain\n":                          "plain\n",
+		"\033[0mtask｜ \033[31mred\033[m\n": "task｜ red\n",
+		"\033[2K\033[1Aprogress\n":         "progress\n",
+		"\033]8;;https://xcfile.dev\033\\docs\033]8;;\033\\\n": "docs\n",
+		"\033]8;;https://xcfile.dev\adocs\033]8;;\a\n":         "docs\n",
+	}
+	for in, expect := range tests {
+		var w bytes.Buffer
+		n, err := ansiStripper{&w}.Write([]byte(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(in) {
+			t.Errorf("wrote %d, want %d", n, len(in))
+		}
+		if w.String() != expect {
+			t.Errorf("got %q, want %q", w.String(), expect)
+		}
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	j := newJSONLogger("build")
+	out, errOut := newLineWriter(&buf, j.line("stdout")), newLineWriter(&buf, j.line("stderr"))
+	out.Write([]byte("one\ntw"))              //nolint:errcheck
+	errOut.Write([]byte("oops \"quoted\"\n")) //nolint:errcheck
+	out.Write([]byte("o\n"))                  //nolint:errcheck
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte{'\n'})
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %q", buf.String())
+	}
+	want := []jsonLine{
+		{Task: "build", Stream: "stdout", Seq: 1, Line: "one"},
+		{Task: "build", Stream: "stderr", Seq: 2, Line: `oops "quoted"`},
+		{Task: "build", Stream: "stdout", Seq: 3, Line: "two"},
+	}
+	for i, l := range lines {
+		var got jsonLine
+		if err := json.Unmarshal(l, &got); err != nil {
+			t.Fatalf("line %d is not JSON: %s", i, l)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, got.TS); err != nil {
+			t.Fatalf("line %d has invalid ts: %v", i, err)
+		}
+		got.TS, got.ElapsedMS = "", 0
+		if got != want[i] {
+			t.Fatalf("line %d: got %+v, want %+v", i, got, want[i])
+		}
+	}
+}
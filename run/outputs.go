@@ -0,0 +1,58 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joerdav/xc/models"
+)
+
+// ErrOutputMissing is returned, wrapped, when a task exits without creating
+// one of its outputs.
+var ErrOutputMissing = errors.New("expected output missing")
+
+// ErrRequiredFileMissing is returned, wrapped, when a file which a task
+// requires does not exist before it runs.
+var ErrRequiredFileMissing = errors.New("required file not found")
+
+// checkRequiredFiles returns an error listing the files, or glob patterns,
+// from the require-files attribute of task and WithRequiredFiles, which do
+// not exist, or match nothing, relative to dir.
+func (r *Runner) checkRequiredFiles(task models.Task, dir string) error {
+	var missing []string
+	for _, pattern := range append(task.RequireFiles[:len(task.RequireFiles):len(task.RequireFiles)], r.requiredFiles...) {
+		path := pattern
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if matches, err := filepath.Glob(path); err != nil || len(matches) == 0 {
+			missing = append(missing, pattern)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("task %s: %w: %s", task.Name, ErrRequiredFileMissing, strings.Join(missing, ", "))
+}
+
+// checkOutputs returns an error listing the outputs of task, from its outputs
+// attribute and WithRequiredOutputs, which do not exist relative to dir.
+func (r *Runner) checkOutputs(task models.Task, dir string) error {
+	var missing []string
+	for _, output := range append(task.Outputs[:len(task.Outputs):len(task.Outputs)], r.requiredOutputs[task.Name]...) {
+		path := output
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			missing = append(missing, output)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("task %s: %w: %s", task.Name, ErrOutputMissing, strings.Join(missing, ", "))
+}
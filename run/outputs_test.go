@@ -0,0 +1,102 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestCheckOutputs(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "bin", "app"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		outputs       []string
+		required      []string
+		expectMissing string
+	}{
+		{name: "given existing outputs, should pass", outputs: []string{"bin/app"}, required: []string{"bin"}},
+		{name: "given a missing output, should fail", outputs: []string{"bin/app", "dist/app.tar.gz"}, expectMissing: "dist/app.tar.gz"},
+		{name: "given a missing required output, should fail", required: []string{"bin/other"}, expectMissing: "bin/other"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{Name: "build", Script: []models.ScriptBlock{{Body: "somecmd"}}, Outputs: tt.outputs},
+			}, dir, WithRequiredOutputs("build", tt.required))
+			if err != nil {
+				t.Fatal(err)
+			}
+			runner.scriptRunner = &mockScriptRunner{}
+			err = runner.Run(context.Background(), "build", nil)
+			if tt.expectMissing == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrOutputMissing) || !strings.HasSuffix(err.Error(), ": "+tt.expectMissing) {
+				t.Fatalf("expected %s to be missing, got %v", tt.expectMissing, err)
+			}
+		})
+	}
+	t.Run("given outputs for an unknown task, return an error", func(t *testing.T) {
+		_, err := NewRunner(models.Tasks{{Name: "build", Script: []models.ScriptBlock{{Body: "somecmd"}}}}, dir, WithRequiredOutputs("missing", []string{"bin"}))
+		if err == nil {
+			t.Fatal("expected an error got nil")
+		}
+	})
+}
+
+func TestCheckRequiredFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "go.sum"), "")
+	writeFile(t, filepath.Join(dir, "gen", "api.go"), "")
+	tests := []struct {
+		name          string
+		files         []string
+		required      []string
+		expectMissing string
+	}{
+		{name: "given existing files and matching globs, should run", files: []string{"go.sum"}, required: []string{"gen/*.go"}},
+		{name: "given a missing file, should fail", files: []string{"go.sum", "go.mod"}, expectMissing: "go.mod"},
+		{name: "given a glob which matches nothing, should fail", required: []string{"gen/*.pb.go"}, expectMissing: "gen/*.pb.go"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{Name: "build", Script: []models.ScriptBlock{{Body: "somecmd"}}, RequireFiles: tt.files},
+			}, dir, WithRequiredFiles(tt.required))
+			if err != nil {
+				t.Fatal(err)
+			}
+			scriptRunner := &mockScriptRunner{}
+			runner.scriptRunner = scriptRunner
+			err = runner.Run(context.Background(), "build", nil)
+			if tt.expectMissing == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrRequiredFileMissing) || !strings.HasSuffix(err.Error(), "required file not found: "+tt.expectMissing) {
+				t.Fatalf("expected %s to be missing, got %v", tt.expectMissing, err)
+			}
+			if scriptRunner.calls != 0 {
+				t.Fatal("expected the task not to run")
+			}
+		})
+	}
+}
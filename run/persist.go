@@ -0,0 +1,74 @@
+package run
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/joerdav/xc/models"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// sharedEnv holds the variables exported by tasks run with WithPersistEnv,
+// which are set for the tasks that run after them in the same run.
+type sharedEnv struct {
+	mu   sync.Mutex
+	vars []string
+}
+
+func (s *sharedEnv) list() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.vars...)
+}
+
+func (s *sharedEnv) add(vars []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.vars = append(s.vars, vars...)
+}
+
+// persistExports adds the variables exported by task to the shared
+// environment. If the task failed and the Runner clears env on error they
+// are dropped, so that later tasks do not see a partial setup.
+func (r *Runner) persistExports(task models.Task, exported []string, err error) {
+	if r.sharedEnv == nil || len(exported) == 0 {
+		return
+	}
+	if err != nil && r.clearEnvOnError {
+		names := make([]string, len(exported))
+		for i, kv := range exported {
+			names[i], _, _ = strings.Cut(kv, "=")
+		}
+		fmt.Fprintf(r.stderr, "task %q failed, clearing %s\n", task.Name, strings.Join(names, ", "))
+		return
+	}
+	r.sharedEnv.add(exported)
+}
+
+// exportedVars returns the variables exported by the script run by runner
+// which were not already set to the same value in env, in KEY=VALUE form.
+func exportedVars(runner *interp.Runner, env []string) []string {
+	initial := map[string]string{}
+	for _, kv := range env {
+		k, v, _ := strings.Cut(kv, "=")
+		initial[k] = v
+	}
+	var vars []string
+	for name, vr := range runner.Vars {
+		if !vr.Exported || vr.Kind != expand.String {
+			continue
+		}
+		if v, ok := initial[name]; ok && v == vr.Str {
+			continue
+		}
+		vars = append(vars, name+"="+vr.Str)
+	}
+	sort.Strings(vars)
+	return vars
+}
@@ -0,0 +1,102 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestRunPersistEnv(t *testing.T) {
+	tests := []struct {
+		name        string
+		persist     bool
+		clear       bool
+		setupFails  bool
+		expectToken string
+	}{
+		{
+			name:        "given persisted env, should set exported variables for later tasks",
+			persist:     true,
+			expectToken: "abc",
+		},
+		{
+			name:        "given persisted env and a failed task, should keep its exports",
+			persist:     true,
+			setupFails:  true,
+			expectToken: "abc",
+		},
+		{
+			name:       "given clear on error and a failed task, should drop its exports",
+			persist:    true,
+			clear:      true,
+			setupFails: true,
+		},
+		{
+			name: "given env is not persisted, should not share exports",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			setup := "export TOKEN=abc\n"
+			if tt.setupFails {
+				setup += "false\n"
+			}
+			var out bytes.Buffer
+			runner, err := NewRunner(models.Tasks{
+				{Name: "setup", Script: []models.ScriptBlock{{Body: setup}}, ContinueOnError: true},
+				{Name: "check", Script: []models.ScriptBlock{{Body: `test "$TOKEN" = "` + tt.expectToken + `"` + "\n"}}},
+				{Name: "main", DependsOn: []models.TaskRef{{Name: "setup"}, {Name: "check"}}},
+			}, t.TempDir(), WithPersistEnv(tt.persist), WithClearEnvOnError(tt.clear), WithOutput(&out, &out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := runner.Run(context.Background(), "main", nil); err != nil {
+				t.Fatalf("expected TOKEN=%q in check: %v\n%s", tt.expectToken, err, out.String())
+			}
+		})
+	}
+}
+
+func TestPersistExports(t *testing.T) {
+	tests := []struct {
+		name         string
+		clear        bool
+		err          error
+		expectShared []string
+	}{
+		{
+			name:         "given a task which succeeds, should persist its exports",
+			expectShared: []string{"TOKEN=abc"},
+		},
+		{
+			name:         "given a task which fails, should persist its exports",
+			err:          errors.New("failed"),
+			expectShared: []string{"TOKEN=abc"},
+		},
+		{
+			name:  "given clear on error and a task which fails, should drop its exports",
+			clear: true,
+			err:   errors.New("failed"),
+		},
+		{
+			name:         "given clear on error and a task which succeeds, should persist its exports",
+			clear:        true,
+			expectShared: []string{"TOKEN=abc"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := Runner{sharedEnv: &sharedEnv{}, clearEnvOnError: tt.clear, stderr: &bytes.Buffer{}}
+			r.persistExports(models.Task{Name: "setup"}, []string{"TOKEN=abc"}, tt.err)
+			if shared := r.sharedEnv.list(); !reflect.DeepEqual(shared, tt.expectShared) {
+				t.Fatalf("expected shared env %v, got %v", tt.expectShared, shared)
+			}
+		})
+	}
+}
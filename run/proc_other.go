@@ -0,0 +1,22 @@
+//go:build !unix
+
+package run
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op on platforms without process groups.
+func setProcessGroup(*exec.Cmd) {}
+
+// terminateProcessGroup kills p, as signals other than kill are not supported
+// on this platform.
+func terminateProcessGroup(p *os.Process) error {
+	return p.Kill()
+}
+
+// killProcessGroup kills p, as process groups are not supported on this platform.
+func killProcessGroup(p *os.Process) error {
+	return p.Kill()
+}
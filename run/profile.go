@@ -0,0 +1,164 @@
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/joerdav/xc/state"
+)
+
+// processSet records the processes started by a task while they are running.
+// A nil processSet records nothing.
+type processSet struct {
+	mu   sync.Mutex
+	pids map[int]bool
+}
+
+// track records p until the returned function is called.
+func (s *processSet) track(p *os.Process) (untrack func()) {
+	if s == nil || p == nil {
+		return func() {}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pids[p.Pid] = true
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.pids, p.Pid)
+	}
+}
+
+func (s *processSet) list() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pids := make([]int, 0, len(s.pids))
+	for pid := range s.pids {
+		pids = append(pids, pid)
+	}
+	return pids
+}
+
+// memProfiler samples the memory used by the processes of each task,
+// appending the samples to a CSV file per task.
+type memProfiler struct {
+	interval time.Duration
+	dir      string
+	mu       sync.Mutex
+	peaks    map[string]int64
+	// tasks are the names of profiled tasks, in the order they started.
+	tasks []string
+}
+
+func newMemProfiler(interval time.Duration, dir string) *memProfiler {
+	return &memProfiler{interval: interval, dir: dir, peaks: map[string]int64{}}
+}
+
+// profile samples the memory of the processes recorded in the returned set
+// until stop is called. A nil memProfiler does nothing.
+func (m *memProfiler) profile(task string) (procs *processSet, stop func() error) {
+	if m == nil {
+		return nil, func() error { return nil }
+	}
+	f, err := m.openProfile(task)
+	if err != nil {
+		return nil, func() error { return err }
+	}
+	m.mu.Lock()
+	if _, ok := m.peaks[task]; !ok {
+		m.peaks[task] = 0
+		m.tasks = append(m.tasks, task)
+	}
+	m.mu.Unlock()
+	procs = &processSet{pids: map[int]bool{}}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				m.sample(task, procs, f, now)
+			}
+		}
+	}()
+	return procs, func() error {
+		close(done)
+		wg.Wait()
+		return f.Close()
+	}
+}
+
+func (m *memProfiler) openProfile(task string) (*os.File, error) {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	path := filepath.Join(m.dir, state.FileName(task)+"-mem.csv")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open memory profile: %w", err)
+	}
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		fmt.Fprintln(f, "time,rss_bytes")
+	}
+	return f, nil
+}
+
+func (m *memProfiler) sample(task string, procs *processSet, w io.Writer, now time.Time) {
+	pids := procs.list()
+	if len(pids) == 0 {
+		return
+	}
+	rss, err := processTreeRSS(pids)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "%s,%d\n", now.Format(time.RFC3339Nano), rss)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rss > m.peaks[task] {
+		m.peaks[task] = rss
+	}
+}
+
+// summary writes the peak memory of each profiled task to w, then resets them.
+func (m *memProfiler) summary(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.tasks) == 0 {
+		return
+	}
+	maxLen := 0
+	for _, t := range m.tasks {
+		if len(t) > maxLen {
+			maxLen = len(t)
+		}
+	}
+	fmt.Fprintln(w, "peak memory:")
+	for _, t := range m.tasks {
+		fmt.Fprintf(w, "    %-*s  %s\n", maxLen, t, formatBytes(m.peaks[t]))
+	}
+	m.peaks, m.tasks = map[string]int64{}, nil
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,52 @@
+package run
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestProcessSet(t *testing.T) {
+	s := &processSet{pids: map[int]bool{}}
+	untrack := s.track(&os.Process{Pid: 42})
+	if pids := s.list(); len(pids) != 1 || pids[0] != 42 {
+		t.Fatalf("got %v, want [42]", pids)
+	}
+	untrack()
+	if pids := s.list(); len(pids) != 0 {
+		t.Fatalf("got %v, want none", pids)
+	}
+	var nilSet *processSet
+	nilSet.track(&os.Process{Pid: 42})()
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		512:              "512 B",
+		1536:             "1.5 KiB",
+		80 * 1024 * 1024: "80.0 MiB",
+		3 << 30:          "3.0 GiB",
+	}
+	for n, want := range tests {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d)=%q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestMemProfilerSummary(t *testing.T) {
+	m := newMemProfiler(0, t.TempDir())
+	m.tasks = []string{"build", "test"}
+	m.peaks = map[string]int64{"build": 2048, "test": 512}
+	var out bytes.Buffer
+	m.summary(&out)
+	want := "peak memory:\n    build  2.0 KiB\n    test   512 B\n"
+	if out.String() != want {
+		t.Fatalf("got %q, want %q", out.String(), want)
+	}
+	out.Reset()
+	m.summary(&out)
+	if out.Len() != 0 {
+		t.Fatalf("expected the summary to be reset, got %q", out.String())
+	}
+}
@@ -0,0 +1,31 @@
+package run
+
+import (
+	"io"
+	"sync"
+)
+
+// lockedWriter writes to w while holding mu, which may be shared by other
+// writers to w.
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// redirectOutput returns the writers for the stdout and stderr of the named
+// task, replacing stdout and stderr with the files given by WithStdoutFile and WithStderrFile.
+func (r *Runner) redirectOutput(taskName string, stdout, stderr io.Writer) (io.Writer, io.Writer) {
+	if w, ok := r.stdoutFiles[taskName]; ok {
+		stdout = w
+	}
+	if w, ok := r.stderrFiles[taskName]; ok {
+		stderr = w
+	}
+	return stdout, stderr
+}
@@ -0,0 +1,45 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestRedirectOutput(t *testing.T) {
+	var shared, stderr, terminal bytes.Buffer
+	runner, err := NewRunner(models.Tasks{
+		{Name: "build", Script: []models.ScriptBlock{{Body: "building\n"}}},
+		{Name: "test", Script: []models.ScriptBlock{{Body: "testing\n"}}},
+		{Name: "deploy", Script: []models.ScriptBlock{{Body: "deploying\n"}}, DependsOn: []models.TaskRef{{Name: "build"}, {Name: "test"}}},
+	}, "",
+		WithOutput(&terminal, &terminal),
+		WithStdoutFile("build", &shared),
+		WithStdoutFile("test", &shared),
+		WithStderrFile("build", &stderr),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.scriptRunner = outputScriptRunner{}
+	if err := runner.Run(context.Background(), "deploy", nil); err != nil {
+		t.Fatal(err)
+	}
+	if shared.String() != "building\ntesting\n" {
+		t.Errorf("shared file got %q, want the output of build then test", shared.String())
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("stderr file got %q, want nothing", stderr.String())
+	}
+	if got := terminal.String(); !bytes.Contains(terminal.Bytes(), []byte("deploying")) || bytes.Contains(terminal.Bytes(), []byte("building")) {
+		t.Errorf("terminal got %q, want only the output of deploy", got)
+	}
+	t.Run("given an unknown task, should error", func(t *testing.T) {
+		_, err := NewRunner(models.Tasks{{Name: "build"}}, "", WithStderrFile("missing", &stderr))
+		if err == nil {
+			t.Fatal("expected an error got nil")
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/joerdav/xc/models"
+)
+
+// retryDelay returns the wait before retry n of task, counting from 1, given
+// the wait before its first retry. Tasks without retry-backoff use the backoff
+// of the Runner.
+func (r *Runner) retryDelay(task models.Task, n int, delay time.Duration) time.Duration {
+	backoff := task.RetryBackoff
+	if backoff == models.RetryBackoffDefault {
+		backoff = r.retryBackoff
+	}
+	return backoff.Delay(n, delay, task.RetryMaxDelay)
+}
+
+// executeWithRetries runs e, running it again up to the retry count of task
+// while it fails, waiting between attempts as configured by the task.
+// Each failed attempt is reported to w.
+func (r *Runner) executeWithRetries(ctx context.Context, task models.Task, e Execution, scripts []string, w io.WriteCloser) error {
+	defer w.Close()
+	for attempt := 0; ; attempt++ {
+		err := r.mapExitCode(task, r.executeScripts(ctx, e, scripts), w)
+		if err == nil || attempt == task.RetryCount || ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			return err
+		}
+		delay := r.retryDelay(task, attempt+1, task.RetryDelay)
+		fmt.Fprintf(w, "attempt %d of %d failed: %v, retrying in %s\n", attempt+1, task.RetryCount+1, err, delay)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep waits for d, returning early with the error of ctx if it is cancelled.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,183 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joerdav/xc/models"
+)
+
+// flakyScriptRunner fails the first failures times it is run.
+type flakyScriptRunner struct {
+	failures int
+	calls    int
+}
+
+func (r *flakyScriptRunner) Execute(ctx context.Context, e Execution) error {
+	r.calls++
+	if r.calls <= r.failures {
+		return errors.New("flaked")
+	}
+	return nil
+}
+
+func TestExecuteWithRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		retries     int
+		failures    int
+		expectCalls int
+		expectErr   bool
+	}{
+		{name: "given no retries, should run once", failures: 1, expectCalls: 1, expectErr: true},
+		{name: "given enough retries, should succeed", retries: 3, failures: 2, expectCalls: 3},
+		{name: "given too few retries, should fail", retries: 1, failures: 2, expectCalls: 2, expectErr: true},
+		{name: "given success, should not retry", retries: 3, expectCalls: 1},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, RetryCount: tt.retries, RetryDelay: time.Millisecond},
+			}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var stdout bytes.Buffer
+			runner.stdout = &stdout
+			scriptRunner := &flakyScriptRunner{failures: tt.failures}
+			runner.scriptRunner = scriptRunner
+			err = runner.Run(context.Background(), "task", nil)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("err=%v, want error=%v", err, tt.expectErr)
+			}
+			if scriptRunner.calls != tt.expectCalls {
+				t.Fatalf("expected %d calls, got %d", tt.expectCalls, scriptRunner.calls)
+			}
+			if retried := strings.Count(stdout.String(), "retrying in"); retried != tt.expectCalls-1 {
+				t.Fatalf("expected %d retries to be reported, got %q", tt.expectCalls-1, stdout.String())
+			}
+		})
+	}
+}
+
+func TestExecuteWithRetriesCancelled(t *testing.T) {
+	runner, err := NewRunner(models.Tasks{
+		{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, RetryCount: 3, RetryDelay: time.Hour},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.stdout = &bytes.Buffer{}
+	scriptRunner := &flakyScriptRunner{failures: 3}
+	runner.scriptRunner = scriptRunner
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := runner.Run(ctx, "task", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the wait to be cancelled, got %v", err)
+	}
+	if scriptRunner.calls != 1 {
+		t.Fatalf("expected 1 call, got %d", scriptRunner.calls)
+	}
+}
+
+// cancellingScriptRunner cancels the context of the task, then fails.
+type cancellingScriptRunner struct {
+	cancel context.CancelFunc
+	calls  int
+}
+
+func (r *cancellingScriptRunner) Execute(ctx context.Context, e Execution) error {
+	r.calls++
+	r.cancel()
+	return errors.New("interrupted")
+}
+
+func TestExecuteWithRetriesAlreadyCancelled(t *testing.T) {
+	runner, err := NewRunner(models.Tasks{
+		{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, RetryCount: 3},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	runner.stdout = &stdout
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	scriptRunner := &cancellingScriptRunner{cancel: cancel}
+	runner.scriptRunner = scriptRunner
+	if err := runner.Run(ctx, "task", nil); err == nil {
+		t.Fatal("expected an error got nil")
+	}
+	if scriptRunner.calls != 1 {
+		t.Fatalf("expected 1 call, got %d", scriptRunner.calls)
+	}
+	if strings.Contains(stdout.String(), "retrying in") {
+		t.Fatalf("expected no retry to be reported, got %q", stdout.String())
+	}
+}
+
+func TestRetryBackoffDelay(t *testing.T) {
+	tests := []struct {
+		backoff  models.RetryBackoff
+		maxDelay time.Duration
+		expected []time.Duration
+	}{
+		{backoff: models.RetryBackoffDefault, expected: []time.Duration{1, 1, 1, 1}},
+		{backoff: models.RetryBackoffConstant, expected: []time.Duration{1, 1, 1, 1}},
+		{backoff: models.RetryBackoffLinear, expected: []time.Duration{1, 2, 3, 4}},
+		{backoff: models.RetryBackoffExponential, expected: []time.Duration{1, 2, 4, 8}},
+		{backoff: models.RetryBackoffExponential, maxDelay: 5 * time.Second, expected: []time.Duration{1, 2, 4, 5}},
+		{backoff: models.RetryBackoffLinear, maxDelay: 2 * time.Second, expected: []time.Duration{1, 2, 2, 2}},
+	}
+	for _, tt := range tests {
+		for i, expected := range tt.expected {
+			if got := tt.backoff.Delay(i+1, time.Second, tt.maxDelay); got != expected*time.Second {
+				t.Errorf("%s (max %s) retry %d: got %s, want %s", tt.backoff, tt.maxDelay, i+1, got, expected*time.Second)
+			}
+		}
+	}
+	if got := models.RetryBackoffExponential.Delay(100, time.Second, 0); got <= 0 {
+		t.Errorf("expected a large exponential delay not to overflow, got %s", got)
+	}
+}
+
+func TestRunnerRetryDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		task     models.Task
+		expected time.Duration
+	}{
+		{
+			name:     "given no backoff, should use the backoff of the runner",
+			task:     models.Task{Name: "task"},
+			expected: 4 * time.Second,
+		},
+		{
+			name:     "given a backoff, should use it",
+			task:     models.Task{Name: "task", RetryBackoff: models.RetryBackoffLinear},
+			expected: 3 * time.Second,
+		},
+		{
+			name:     "given a max delay, should cap the wait",
+			task:     models.Task{Name: "task", RetryMaxDelay: 2 * time.Second},
+			expected: 2 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{tt.task}, "", WithRetryBackoff(models.RetryBackoffExponential))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := runner.retryDelay(tt.task, 3, time.Second); got != tt.expected {
+				t.Fatalf("expected a wait of %s before retry 3, got %s", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package run
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// openFilesHardLimit is not supported on this platform.
+func openFilesHardLimit() (uint64, error) {
+	return 0, errors.New("limiting open files is not supported on this platform")
+}
+
+// setOpenFilesLimit is not supported on this platform, as openFilesHardLimit
+// always fails no limit is ever set.
+func setOpenFilesLimit(*exec.Cmd, uint64) {}
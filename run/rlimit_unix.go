@@ -0,0 +1,24 @@
+//go:build unix
+
+package run
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// openFilesHardLimit returns the hard limit on open files of xc,
+// which is inherited by tasks.
+func openFilesHardLimit() (uint64, error) {
+	var lim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &lim); err != nil {
+		return 0, err
+	}
+	return uint64(lim.Max), nil
+}
+
+// setOpenFilesLimit wraps cmd so that it starts with a soft limit of n open files.
+func setOpenFilesLimit(cmd *exec.Cmd, n uint64) {
+	wrapShell(cmd, `ulimit -S -n "$0" && exec "$@"`, strconv.FormatUint(n, 10))
+}
@@ -0,0 +1,58 @@
+//go:build unix
+
+package run
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestRunCommandMaxOpenFiles(t *testing.T) {
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", "ulimit -n")
+	cmd.Stdout = &out
+	if err := runCommand(context.Background(), cmd, Execution{MaxOpenFiles: 20}); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "20" {
+		t.Fatalf("got limit %s, want 20", got)
+	}
+}
+
+func TestOpenFilesLimit(t *testing.T) {
+	hard, err := openFilesHardLimit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		runnerLimit   uint64
+		taskLimit     uint64
+		expected      uint64
+		expectWarning bool
+	}{
+		{name: "given no limit, should return 0"},
+		{name: "given a runner limit, should use it", runnerLimit: 50, expected: 50},
+		{name: "given a task limit, should override the runner", runnerLimit: 50, taskLimit: 20, expected: 20},
+		{name: "given a limit over the hard limit, should warn", taskLimit: hard + 1, expected: hard, expectWarning: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			r := Runner{maxOpenFiles: tt.runnerLimit, stderr: &stderr}
+			got := r.openFilesLimit(models.Task{Name: "task", MaxOpenFiles: tt.taskLimit})
+			if got != tt.expected {
+				t.Fatalf("got %d, want %d", got, tt.expected)
+			}
+			if warned := stderr.Len() > 0; warned != tt.expectWarning {
+				t.Fatalf("warned=%v, want %v: %s", warned, tt.expectWarning, stderr.String())
+			}
+		})
+	}
+}
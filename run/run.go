@@ -4,19 +4,79 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
 	"sync"
+	"text/template"
+	"time"
 
-	"github.com/google/shlex"
 	"github.com/joerdav/xc/models"
 )
 
 const maxDeps = 50
 
+// Execution holds everything required to execute a single task script.
+type Execution struct {
+	Script string
+	Env    []string
+	Args   []string
+	Dir    string
+	// Shell runs the script from a temporary file with this interpreter and
+	// its arguments, if set, rather than the built-in shell.
+	Shell string
+	// ScriptMode is how the script is passed to an interpreter other than the
+	// built-in shell, by default in a temporary file.
+	ScriptMode models.ScriptMode
+	// Stdin, Stdout and Stderr default to those of the xc process.
+	Stdin          io.Reader
+	Stdout, Stderr io.Writer
+	// KillGroup runs commands in their own process group, which is killed
+	// if the command fails or the context is cancelled.
+	KillGroup bool
+	// MaxOpenFiles sets the soft limit on open files of each command, if set.
+	MaxOpenFiles uint64
+	// Hostname runs each command in a new UTS namespace with this hostname, if set.
+	Hostname string
+	// processes records the commands run by the script, if set.
+	processes *processSet
+	// running records the commands run by the script to forward signals to, if set.
+	running *processSet
+	// exported is called with the variables exported by a script run by the
+	// built-in shell, if set.
+	exported func(vars []string)
+	// interrupted is called once the commands of the script have been
+	// signalled to stop, as the context is cancelled, if set. They are killed
+	// if they have not exited a grace period after it returns.
+	interrupted func()
+}
+
+// interrupt calls e.interrupted, if set.
+func (e Execution) interrupt() {
+	if e.interrupted != nil {
+		e.interrupted()
+	}
+}
+
+func (e Execution) stdio() (io.Reader, io.Writer, io.Writer) {
+	stdin, stdout, stderr := e.Stdin, e.Stdout, e.Stderr
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	return stdin, stdout, stderr
+}
+
 type ScriptRunner interface {
-	Execute(ctx context.Context, text string, env, args []string, dir, logPrefix string) error
+	Execute(ctx context.Context, e Execution) error
 }
 
 // Runner is responsible for running Tasks.
@@ -26,6 +86,135 @@ type Runner struct {
 	dir          string
 	alreadyRan   map[string]bool
 	alreadRanMu  sync.Mutex
+	seen         *dedupState
+	killGroup    bool
+	errorLines   []*regexp.Regexp
+	highlights   []Highlight
+	outputLimit  int64
+	logFile      io.Writer
+	stripANSI    bool
+	envWhitelist []string
+	envBlacklist []string
+	// stdinEOFTimeout closes the stdin of a task once it has been idle this long.
+	stdinEOFTimeout time.Duration
+	requireDocker   bool
+	dockerPing      func(context.Context) error
+	// goos is the operating system compared to the platform attribute of tasks.
+	goos string
+	// cleanupScript is run when a task without its own cleanup script is cancelled.
+	cleanupScript string
+	// dynamicEnvScript is run before every task to add to its environment.
+	dynamicEnvScript string
+	// computedVars are set to the output of their command before every task.
+	computedVars []models.ComputedVar
+	// taskInputs are values for the inputs of each task, by task name.
+	taskInputs map[string][]string
+	// taskEnv are variables set on top of the env attribute of each task, by task name.
+	taskEnv map[string][]string
+	// envFiles are variables from env files, set before the env of every task.
+	envFiles []string
+	// envTypes are the types which variables in the environment of every task must have.
+	envTypes map[string]models.EnvType
+	// exitCodes change the meaning of exit codes of every task, by code.
+	exitCodes map[int]models.ExitCodeMeaning
+	// envOverrides are variables which take precedence over the env of every task.
+	envOverrides []string
+	memProfiler  *memProfiler
+	jsonLog      bool
+	// maxOpenFiles limits the open files of tasks without max-open-files.
+	maxOpenFiles uint64
+	// defaultHostname is the hostname of tasks without the hostname attribute.
+	defaultHostname string
+	preserveMtime   bool
+	createDir       bool
+	envLog          bool
+	workDirLog      bool
+	// cleanupEnvFiles deletes the env files of tasks without cleanup-env-file once they have run.
+	cleanupEnvFiles models.EnvFileCleanup
+	dirSnapshot     bool
+	runInOrder      bool
+	noDedup         bool
+	noNewlineEnv    bool
+	// persistOutputs are the names of tasks whose outputs are saved to .xc/artifacts.
+	persistOutputs []string
+	// runHidden allows hidden tasks to be run directly.
+	runHidden    bool
+	maskPatterns []*regexp.Regexp
+	// inputMasks are the names of inputs whose values are added to maskedInputs.
+	inputMasks   []string
+	maskedInputs *maskedValues
+	grepPatterns []*regexp.Regexp
+	// sections of output are replaced with a marker in the terminal.
+	sections []Section
+	// outputFilter is the command which the output of tasks without output-filter is piped through.
+	outputFilter string
+	// defaultInputs give values, as KEY=VALUE, to inputs which are not set
+	// any other way, after the defaults-file of the task.
+	defaultInputs []string
+	// globInputs are the names of inputs of every task whose values are
+	// expanded as glob patterns.
+	globInputs []string
+	// lines limits the output shown from tasks without output-head or output-tail.
+	lines         *models.OutputLines
+	maxLineLength int
+	expandEnvRefs bool
+	noPTY         bool
+	abortOnStderr bool
+	// assertNoOutput are the names of tasks which fail if they write to
+	// stdout or stderr.
+	assertNoOutput []string
+	logScript      bool
+	// interpolateScripts expands variables in scripts before they are run.
+	interpolateScripts bool
+	// signals are forwarded to the commands in running while tasks run.
+	signals    <-chan os.Signal
+	running    *processSet
+	timestamps *timestamper
+	// scriptMode is how scripts of tasks without script-mode are passed to interpreters.
+	scriptMode models.ScriptMode
+	// defaultTimeout limits how long tasks without the timeout attribute run.
+	defaultTimeout time.Duration
+	tmpfs          bool
+	noSyncBack     bool
+	// maxRestarts limits how many times Watch runs tasks without max-restarts again.
+	maxRestarts int
+	// stdinEnv is the variable read as stdin by tasks without stdin-env.
+	stdinEnv string
+	// stdinJSON is the stdin of tasks without stdin-env, if it is not nil.
+	stdinJSON []byte
+	// stdinLog is the file stdin is copied to for tasks without stdin-log.
+	stdinLog   string
+	showScript bool
+	dryRun     bool
+	// noInheritCwd sets PWD to the directory of each task, rather than that of xc.
+	noInheritCwd bool
+	// sharedEnv is set for every task, and added to by the exports of each
+	// task, if env is persisted.
+	sharedEnv       *sharedEnv
+	persistEnv      bool
+	clearEnvOnError bool
+	// dryRunOutput gets a JSON object of the tasks reached by each dry run.
+	dryRunOutput *dryRunLogger
+	// retryBackoff is used for tasks which retry without the retry-backoff attribute.
+	retryBackoff models.RetryBackoff
+	beforeEach   string
+	afterEach    string
+	// requiredFiles are files, or glob patterns, which must exist before any task runs.
+	requiredFiles []string
+	// requiredOutputs are files which each task must create, by task name.
+	requiredOutputs map[string][]string
+	tagLimits       tagLimits
+	// outputAssertions are patterns which the output of each task must match, by task name.
+	outputAssertions map[string][]*regexp.Regexp
+	maskSecrets      bool
+	// stdoutFiles and stderrFiles replace the stdout and stderr of each task, by task name.
+	stdoutFiles, stderrFiles map[string]io.Writer
+	// redirectMu is held while writing to stdoutFiles and stderrFiles, which may share a file.
+	redirectMu *sync.Mutex
+	// summaryLine is written to stdout for each task once it has finished.
+	summaryLine *template.Template
+	// stdout and stderr are where task output is written, by default those of xc.
+	stdout, stderr io.Writer
 }
 
 // NewRunner takes Tasks and returns a Runner.
@@ -36,18 +225,71 @@ type Runner struct {
 //
 // NewRunner will return an error in the case that Dependent tasks are cyclical,
 // invalid or at a larger depth than 50.
-func NewRunner(ts models.Tasks, dir string) (runner Runner, err error) {
+func NewRunner(ts models.Tasks, dir string, opts ...RunnerOption) (runner Runner, err error) {
 	runner = Runner{
-		scriptRunner: newInterpreter(),
-		tasks:        ts,
-		dir:          dir,
-		alreadyRan:   map[string]bool{},
+		scriptRunner:     newInterpreter(),
+		tasks:            ts,
+		dir:              dir,
+		alreadyRan:       map[string]bool{},
+		dockerPing:       pingDocker,
+		goos:             runtime.GOOS,
+		taskInputs:       map[string][]string{},
+		taskEnv:          map[string][]string{},
+		outputAssertions: map[string][]*regexp.Regexp{},
+		requiredOutputs:  map[string][]string{},
+		stdoutFiles:      map[string]io.Writer{},
+		stderrFiles:      map[string]io.Writer{},
+		redirectMu:       &sync.Mutex{},
+		tagLimits:        tagLimits{},
+		maskedInputs:     &maskedValues{},
+		maskSecrets:      true,
+		stdout:           os.Stdout,
+		stderr:           os.Stderr,
+	}
+	for _, opt := range opts {
+		opt(&runner)
+	}
+	for name := range runner.taskInputs {
+		if _, ok := ts.Get(name); !ok {
+			err = fmt.Errorf("inputs supplied for unknown task %s", name)
+			return
+		}
+	}
+	for name := range runner.taskEnv {
+		if _, ok := ts.Get(name); !ok {
+			err = fmt.Errorf("environment supplied for unknown task %s", name)
+			return
+		}
+	}
+	for name := range runner.requiredOutputs {
+		if _, ok := ts.Get(name); !ok {
+			err = fmt.Errorf("outputs required of unknown task %s", name)
+			return
+		}
+	}
+	for name := range runner.outputAssertions {
+		if _, ok := ts.Get(name); !ok {
+			err = fmt.Errorf("output assertion given for unknown task %s", name)
+			return
+		}
+	}
+	for _, files := range []map[string]io.Writer{runner.stdoutFiles, runner.stderrFiles} {
+		for name := range files {
+			if _, ok := ts.Get(name); !ok {
+				err = fmt.Errorf("output redirected for unknown task %s", name)
+				return
+			}
+		}
 	}
 	for _, t := range ts {
 		err = runner.ValidateDependencies(t.Name, []string{})
 		if err != nil {
 			return
 		}
+		err = runner.validateInherit(t, []string{})
+		if err != nil {
+			return
+		}
 	}
 	return
 }
@@ -59,12 +301,14 @@ const scriptHeader = ` #!/bin/bash
 
 func taskUsage(task models.Task) string {
 	argUsage := fmt.Sprintf("xc %s", task.Name)
-	for _, n := range task.Inputs {
-		argUsage += fmt.Sprintf(" <%s>", strings.ToLower(n))
+	for _, in := range task.Inputs {
+		argUsage += fmt.Sprintf(" <%s>", strings.ToLower(in.Name))
 	}
 	envUsage := ""
-	for _, n := range task.Inputs {
-		envUsage += fmt.Sprintf("%s=<%s> ", n, strings.ToLower(n))
+	for _, in := range task.Inputs {
+		if in.Required() {
+			envUsage += fmt.Sprintf("%s=<%s> ", in.Name, strings.ToLower(in.Name))
+		}
 	}
 	envUsage += fmt.Sprintf("xc %s", task.Name)
 	return fmt.Sprintf("Task has required inputs:\n\t%s\n\t%s", argUsage, envUsage)
@@ -79,16 +323,25 @@ func environmentContainsInput(env []string, input string) bool {
 	return false
 }
 
-func getInputs(task models.Task, inputs, env []string) ([]string, error) {
+func getInputs(task models.Task, inputs, env, defaults []string) ([]string, error) {
 	result := []string{}
-	for i, n := range task.Inputs {
+	for i, in := range task.Inputs {
 		// Do the command args contain the input?
 		if len(inputs) > i {
-			result = append(result, fmt.Sprintf("%v=%v", n, inputs[i]))
+			result = append(result, fmt.Sprintf("%v=%v", in.Name, inputs[i]))
 			continue
 		}
 		// Does the task environment contain the input?
-		if environmentContainsInput(env, n) {
+		if environmentContainsInput(env, in.Name) {
+			continue
+		}
+		// Does a defaults file give the input a value?
+		if v, ok := lookupEnv(defaults, in.Name); ok {
+			result = append(result, fmt.Sprintf("%v=%v", in.Name, v))
+			continue
+		}
+		if !in.Required() {
+			result = append(result, fmt.Sprintf("%v=%v", in.Name, in.Default))
 			continue
 		}
 		return nil, errors.New(taskUsage(task))
@@ -104,14 +357,65 @@ func (r *Runner) Run(ctx context.Context, name string, inputs []string) error {
 	if err != nil {
 		return err
 	}
-	return r.runWithPadding(ctx, name, inputs, padding)
+	if task, ok := r.tasks.Get(name); ok && task.IsHidden() && !r.runHidden {
+		return fmt.Errorf("task %s is hidden, it can only be required by other tasks unless forced", task.Name)
+	}
+	if err := r.checkDocker(ctx, name); err != nil {
+		return err
+	}
+	if err := r.checkHostname(name); err != nil {
+		return err
+	}
+	if r.memProfiler != nil {
+		defer r.memProfiler.summary(r.stdout)
+	}
+	defer r.forwardSignals()()
+	r.seen = newDedupState()
+	if r.persistEnv {
+		r.sharedEnv = &sharedEnv{}
+	}
+	err = r.runWithPadding(ctx, name, inputs, padding)
+	if r.dryRunOutput != nil {
+		if flushErr := r.dryRunOutput.flush(); err == nil {
+			err = flushErr
+		}
+	}
+	return err
 }
 
-func (r *Runner) runWithPadding(ctx context.Context, name string, inputs []string, padding int) error {
+// checkDocker pings the Docker daemon if it is required by the Runner,
+// or by any task which will be run.
+func (r *Runner) checkDocker(ctx context.Context, name string) error {
+	required := r.requireDocker
+	plan, err := r.executionPlan(name)
+	if err != nil {
+		return err
+	}
+	for _, t := range plan {
+		if t.RequiresDocker {
+			required = true
+		}
+	}
+	if !required {
+		return nil
+	}
+	return r.dockerPing(ctx)
+}
+
+func (r *Runner) runWithPadding(ctx context.Context, name string, inputs []string, padding int) (err error) {
 	task, ok := r.tasks.Get(name)
 	if !ok {
 		return fmt.Errorf("task %s not found", name)
 	}
+	task = r.inherit(task)
+	if task.Interactive && r.noPTY {
+		fmt.Fprintf(r.stderr, "task %q: interactive is ignored with no pty\n", task.Name)
+		task.Interactive = false
+	}
+	if !runsOn(task, r.goos) {
+		fmt.Fprintf(r.stdout, "task %q skipped (only runs on %s)\n", task.Name, strings.Join(task.Platforms, ", "))
+		return nil
+	}
 	r.alreadRanMu.Lock()
 	if task.RequiredBehaviour == models.RequiredBehaviourOnce && r.alreadyRan[task.Name] {
 		r.alreadRanMu.Unlock()
@@ -120,58 +424,321 @@ func (r *Runner) runWithPadding(ctx context.Context, name string, inputs []strin
 	}
 	r.alreadyRan[task.Name] = true
 	r.alreadRanMu.Unlock()
-	env := os.Environ()
-	env = append(env, task.Env...)
-	inp, err := getInputs(task, inputs, env)
+	if !r.noDedup && !task.RequiredBehaviourSet {
+		first, finish, err := r.seen.claim(ctx, dedupKey(task.Name, inputs))
+		if !first {
+			if err == nil {
+				fmt.Fprintf(r.stdout, "task %q ran already: skipping\n", task.Name)
+			}
+			return err
+		}
+		defer func() { finish(err) }()
+	}
+	// the inputs are checked before the dependencies run, so that a task
+	// missing one fails without running them
+	env := r.inheritedEnv(task)
+	workDirEnv, err := r.workDirEnv(task)
+	if err != nil {
+		return err
+	}
+	env = append(env, workDirEnv...)
+	fileEnv, err := r.taskEnvFiles(task)
 	if err != nil {
 		return err
 	}
+	fileEnv = append(r.envFiles[:len(r.envFiles):len(r.envFiles)], fileEnv...)
+	taskEnv := append(task.Env[:len(task.Env):len(task.Env)], r.taskEnv[task.Name]...)
+	if r.expandEnvRefs {
+		taskEnv = expandEnvRefs(append(env[:len(env):len(env)], fileEnv...), taskEnv)
+	}
+	fileEnv = append(fileEnv, taskEnv...)
+	overrides := append(r.envOverrides[:len(r.envOverrides):len(r.envOverrides)], r.inputValues(task)...)
+	defaults, err := r.inputDefaults(task)
+	if err != nil {
+		return err
+	}
+	checkEnv := append(append(env[:len(env):len(env)], fileEnv...), overrides...)
+	inp, err := getInputs(task, inputs, checkEnv, defaults)
+	if err != nil {
+		return err
+	}
+	checkEnv = append(checkEnv, inp...)
+	r.maskInputs(checkEnv)
+	if err := r.validateInputs(ctx, task, checkEnv, inputs); err != nil {
+		return err
+	}
+	if err := r.checkEnvTypes(task, checkEnv); err != nil {
+		return err
+	}
+	if r.noNewlineEnv {
+		if err := checkEnvNewlines(task, checkEnv); err != nil {
+			return err
+		}
+	}
 	runFunc := r.runDepsSync
-	if task.DepsBehaviour == models.DependencyBehaviourAsync {
+	switch {
+	case len(task.DependsOn) < 2:
+	case task.Parallel && r.runInOrder:
+		fmt.Fprintf(r.stderr, "task %q: running dependencies in order, parallel is suppressed\n", task.Name)
+	case task.Parallel:
+		runFunc = r.runDepsParallel
+	case task.DepsBehaviour == models.DependencyBehaviourAsync && r.runInOrder:
+		fmt.Fprintf(r.stderr, "task %q: running dependencies in order, runDeps: async is suppressed\n", task.Name)
+	case task.DepsBehaviour == models.DependencyBehaviourAsync:
 		runFunc = r.runDepsAsync
 	}
 	if err := runFunc(ctx, padding, task.DependsOn...); err != nil {
 		return err
 	}
+	// the dynamic environment is built once the dependencies have run, so that
+	// it can use files they create and variables they export
+	env = append(env, r.sharedEnv.list()...)
+	env = append(env, fileEnv...)
+	dynamicEnv, err := r.dynamicEnv(ctx, task, env)
+	if err != nil {
+		return err
+	}
+	env = append(env, dynamicEnv...)
+	computedEnv, err := r.computedEnv(ctx, task, env)
+	if err != nil {
+		return err
+	}
+	env = append(env, computedEnv...)
+	vars, err := r.taskVars(ctx, task, env)
+	if err != nil {
+		return err
+	}
+	env = append(env, vars...)
+	env = append(env, overrides...)
 	if len(task.Script) == 0 {
+		if len(task.DependsOn) == 0 {
+			fmt.Fprintf(r.stdout, "task %q skipped (empty)\n", task.Name)
+		}
 		return nil
 	}
+	if err := r.checkRequiredFiles(task, r.getExecutionPath(task)); err != nil {
+		return err
+	}
 	env = append(env, inp...)
+	env, inputs, err = r.expandGlobInputs(task, r.getExecutionPath(task), env, inputs)
+	if err != nil {
+		return err
+	}
+	scripts := make([]string, len(task.Script))
+	for i, b := range task.Script {
+		scripts[i] = r.interpolate(task, b.Body, env)
+	}
+	script := strings.Join(scripts, "")
+	if r.showScript {
+		showScript(r.stderr, task.Name, script, inputs)
+	}
+	if r.dryRun {
+		fmt.Fprintf(r.stderr, "task %q: dry run, not running\n", task.Name)
+		if r.dryRunOutput != nil {
+			r.dryRunOutput.add(task.Name, r.getExecutionPath(task), inputs, script)
+		}
+		return nil
+	}
 
 	var prefix string
 	if !task.Interactive {
 		prefix = fmt.Sprintf("%*s", padding, strings.TrimSpace(task.Name))
 	}
-	return r.scriptRunner.Execute(ctx, task.Script, env, inputs, r.getExecutionPath(task), prefix)
+	stdin, closeStdin, err := r.taskInput(task, env)
+	if err != nil {
+		return err
+	}
+	stdout, stderr, closeOutput := r.taskOutput(prefix, r.outputLines(task))
+	taskStdout, taskStderr := r.redirectOutput(task.Name, stdout, stderr)
+	taskStdout, taskStderr, closeOutput = r.filterOutput(ctx, task, env, taskStdout, taskStderr, closeOutput)
+	taskStdout, taskStderr, checkOutput := r.assertOutput(task, taskStdout, taskStderr)
+	taskStdout, taskStderr, writeSummary := r.summarise(task, taskStdout, taskStderr)
+	e := Execution{
+		Env:          env,
+		Args:         inputs,
+		Dir:          r.getExecutionPath(task),
+		Shell:        task.Shell,
+		ScriptMode:   r.taskScriptMode(task),
+		Stdin:        stdin,
+		Stdout:       taskStdout,
+		Stderr:       taskStderr,
+		KillGroup:    r.killGroup && !task.NoKillGroup,
+		MaxOpenFiles: r.openFilesLimit(task),
+		Hostname:     r.hostname(task),
+	}
+	if r.logScript && r.logFile != nil {
+		if err := r.writeScriptLog(script, e.Env, r.infoWriter(prefix, stdout)); err != nil {
+			return errors.Join(err, closeStdin(), closeOutput())
+		}
+	}
+	if r.envLog {
+		if err := r.logEnv(e.Env, r.infoWriter(prefix, stdout)); err != nil {
+			return errors.Join(err, closeStdin(), closeOutput())
+		}
+	}
+	if err := r.createWorkDir(task, e.Dir); err != nil {
+		return errors.Join(err, closeStdin(), closeOutput())
+	}
+	reportChanges, err := r.snapshotDir(e.Dir, r.infoWriter(prefix, stdout))
+	if err != nil {
+		return errors.Join(err, closeStdin(), closeOutput())
+	}
+	restoreMtimes, err := r.preserveMtimes(task, e.Dir)
+	if err != nil {
+		return errors.Join(err, closeStdin(), closeOutput())
+	}
+	var finishTmpfs func() error
+	e.Dir, finishTmpfs, err = r.tmpfsWorkDir(task, e.Dir)
+	if err != nil {
+		return errors.Join(err, restoreMtimes(), reportChanges(), closeStdin(), closeOutput())
+	}
+	if r.workDirLog {
+		if err := logWorkDir(e.Dir, r.infoWriter(prefix, stdout)); err != nil {
+			return errors.Join(err, finishTmpfs(), restoreMtimes(), reportChanges(), closeStdin(), closeOutput())
+		}
+	}
+	var stopProfile func() error
+	e.processes, stopProfile = r.memProfiler.profile(task.Name)
+	e.running = r.running
+	if err := r.runBeforeEach(ctx, task, e); err != nil {
+		return errors.Join(err, stopProfile(), finishTmpfs(), restoreMtimes(), reportChanges(), closeStdin(), closeOutput())
+	}
+	release, err := r.tagLimits.acquire(ctx, task.Tags)
+	if err != nil {
+		return errors.Join(err, r.runAfterEach(task, e, err), stopProfile(), finishTmpfs(), restoreMtimes(), reportChanges(), closeStdin(), closeOutput())
+	}
+	defer release()
+	ctx, describeTimeout, cancelTimeout := r.withTimeout(ctx, task)
+	defer cancelTimeout()
+	ctx, describeStderr, cancelStderr := r.watchStderr(ctx, task, &e)
+	defer cancelStderr()
+	describeOutput := r.expectSilent(task, &e)
+	waitCleanup := r.cleanupOnCancel(ctx, task, &e)
+	// only the exports of the task's own scripts are persisted, not those of hooks
+	var exported []string
+	scriptExec := e
+	if r.sharedEnv != nil {
+		scriptExec.exported = func(vars []string) { exported = append(exported, vars...) }
+	}
+	err = describeTimeout(describeStderr(describeOutput(r.executeWithRetries(ctx, task, scriptExec, scripts, r.infoWriter(prefix, stdout)))))
+	if err == nil {
+		err = r.checkOutputs(task, e.Dir)
+	}
+	if err == nil {
+		err = r.saveArtifacts(task, e.Dir)
+	}
+	if assertErr := checkOutput(); err == nil {
+		err = assertErr
+	}
+	err = errors.Join(err, waitCleanup(), r.runAfterEach(task, e, err), r.removeEnvFiles(task, err), stopProfile(), finishTmpfs(), restoreMtimes(), reportChanges(), closeStdin(), closeOutput())
+	err = errors.Join(err, writeSummary(err))
+	r.persistExports(task, exported, err)
+	if err != nil && task.ContinueOnError && ctx.Err() == nil {
+		fmt.Fprintf(r.stderr, "task %q failed, continuing: %v\n", task.Name, err)
+		return nil
+	}
+	return err
 }
 
-func (r *Runner) runDepsSync(ctx context.Context, padding int, dependencies ...string) error {
+// executeScripts runs each of scripts in order, stopping at the first which fails.
+func (r *Runner) executeScripts(ctx context.Context, e Execution, scripts []string) error {
+	for _, script := range scripts {
+		e.Script = script
+		if err := r.scriptRunner.Execute(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// showScript writes the script which will be run for the named task, with its arguments, to w.
+func showScript(w io.Writer, name, script string, args []string) {
+	header := fmt.Sprintf("task %q script", name)
+	if len(args) > 0 {
+		header += fmt.Sprintf(" (args: %s)", strings.Join(args, " "))
+	}
+	fmt.Fprintf(w, "%s:\n%s\n", header, indent(script))
+}
+
+// requiredTask returns the name of the task required by ref, and the inputs
+// to run it with. Arguments of the form NAME=value, where NAME is an input of
+// the task, set that input by name, and the rest are given to the remaining
+// inputs in order.
+func (r *Runner) requiredTask(ref models.TaskRef) (string, []string, error) {
+	task, ok := r.tasks.Get(ref.Name)
+	if !ok {
+		return ref.Name, ref.Args, nil
+	}
+	index := map[string]int{}
+	for i, in := range task.Inputs {
+		index[in.Name] = i
+	}
+	named := map[int]string{}
+	last := -1
+	var positional []string
+	for _, a := range ref.Args {
+		name, value, ok := strings.Cut(a, "=")
+		if i, isInput := index[name]; ok && isInput {
+			named[i] = value
+			if i > last {
+				last = i
+			}
+			continue
+		}
+		positional = append(positional, a)
+	}
+	if len(named) == 0 {
+		return ref.Name, ref.Args, nil
+	}
+	var inputs []string
+	for i, in := range task.Inputs {
+		if v, ok := named[i]; ok {
+			inputs = append(inputs, v)
+			continue
+		}
+		if len(positional) > 0 {
+			inputs = append(inputs, positional[0])
+			positional = positional[1:]
+			continue
+		}
+		if i > last {
+			break
+		}
+		if in.Required() {
+			return "", nil, fmt.Errorf("required task %s: input %s has no default, so it must be given to set %s by name", ref, in.Name, task.Inputs[last].Name)
+		}
+		inputs = append(inputs, in.Default)
+	}
+	return ref.Name, append(inputs, positional...), nil
+}
+
+func (r *Runner) runDepsSync(ctx context.Context, padding int, dependencies ...models.TaskRef) error {
 	for _, t := range dependencies {
-		ta, err := shlex.Split(t)
+		name, inputs, err := r.requiredTask(t)
 		if err != nil {
 			return err
 		}
-		if err := r.runWithPadding(ctx, ta[0], ta[1:], padding); err != nil {
+		if err := r.runWithPadding(ctx, name, inputs, padding); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (r *Runner) runDepsAsync(ctx context.Context, padding int, dependencies ...string) error {
+func (r *Runner) runDepsAsync(ctx context.Context, padding int, dependencies ...models.TaskRef) error {
 	var wg sync.WaitGroup
 	errs := make([]error, len(dependencies))
 	for i, t := range dependencies {
 		wg.Add(1)
-		go func(index int, task string) {
+		go func(index int, task models.TaskRef) {
 			defer wg.Done()
-			ta, err := shlex.Split(task)
+			name, inputs, err := r.requiredTask(task)
 			if err != nil {
 				errs[index] = err
 				return
 			}
 
-			errs[index] = r.runWithPadding(ctx, ta[0], ta[1:], padding)
+			errs[index] = r.runWithPadding(ctx, name, inputs, padding)
 		}(i, t)
 	}
 
@@ -179,15 +746,60 @@ func (r *Runner) runDepsAsync(ctx context.Context, padding int, dependencies ...
 	return errors.Join(errs...)
 }
 
+// runDepsParallel runs dependencies concurrently, like runDepsAsync, but
+// cancels the rest as soon as one fails. It waits for all of them to return,
+// and returns the errors of those which failed before any were cancelled.
+func (r *Runner) runDepsParallel(ctx context.Context, padding int, dependencies ...models.TaskRef) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures []error
+		errs     = make([]error, len(dependencies))
+	)
+	for i, t := range dependencies {
+		wg.Add(1)
+		go func(index int, task models.TaskRef) {
+			defer wg.Done()
+			name, inputs, err := r.requiredTask(task)
+			if err == nil {
+				err = r.runWithPadding(ctx, name, inputs, padding)
+			}
+			if err == nil {
+				return
+			}
+			errs[index] = err
+			mu.Lock()
+			defer mu.Unlock()
+			// tasks which fail once cancelled were stopped by another failure
+			if ctx.Err() == nil {
+				failures = append(failures, err)
+				cancel()
+			}
+		}(i, t)
+	}
+	wg.Wait()
+	if len(failures) == 0 {
+		// every dependency succeeded, or xc was cancelled
+		return errors.Join(errs...)
+	}
+	return errors.Join(failures...)
+}
+
 func (r *Runner) getLogPadding(name string) (int, error) {
-	task, ok := r.tasks.Get(name)
+	ref, err := models.ParseTaskRef(name)
+	if err != nil {
+		return 0, err
+	}
+	task, ok := r.tasks.Get(ref.Name)
 	if !ok {
-		return 0, fmt.Errorf("task %s not found", name)
+		return 0, fmt.Errorf("task %s not found", ref.Name)
 	}
 
 	maxLen := len(task.Name)
-	for _, depName := range task.DependsOn {
-		depLen, err := r.getLogPadding(depName)
+	for _, dep := range task.DependsOn {
+		depLen, err := r.getLogPadding(dep.Name)
 		if err != nil {
 			return maxLen, err
 		}
@@ -198,6 +810,49 @@ func (r *Runner) getLogPadding(name string) (int, error) {
 	return maxLen, nil
 }
 
+// executionPlan returns the named task and all of its dependencies, each listed
+// once, with dependencies before the tasks which require them.
+func (r *Runner) executionPlan(name string) ([]models.Task, error) {
+	var plan []models.Task
+	seen := map[string]bool{}
+	var visit func(name string) error
+	visit = func(name string) error {
+		ref, err := models.ParseTaskRef(name)
+		if err != nil {
+			return err
+		}
+		task, ok := r.tasks.Get(ref.Name)
+		if !ok {
+			return fmt.Errorf("task %s not found", ref.Name)
+		}
+		if seen[task.Name] {
+			return nil
+		}
+		seen[task.Name] = true
+		for _, dep := range task.DependsOn {
+			if err := visit(dep.Name); err != nil {
+				return err
+			}
+		}
+		plan = append(plan, task)
+		return nil
+	}
+	return plan, visit(name)
+}
+
+// runsOn reports whether task runs on the operating system goos.
+func runsOn(task models.Task, goos string) bool {
+	if len(task.Platforms) == 0 {
+		return true
+	}
+	for _, p := range task.Platforms {
+		if p == goos {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *Runner) getExecutionPath(task models.Task) string {
 	if task.Dir == "" {
 		return r.dir
@@ -208,6 +863,79 @@ func (r *Runner) getExecutionPath(task models.Task) string {
 	return filepath.Join(r.dir, task.Dir)
 }
 
+// taskScriptMode returns how the script of task is passed to an interpreter.
+func (r *Runner) taskScriptMode(task models.Task) models.ScriptMode {
+	if task.ScriptMode != "" {
+		return task.ScriptMode
+	}
+	return r.scriptMode
+}
+
+// outputLines returns the lines of output shown from task, or nil for all of them.
+func (r *Runner) outputLines(task models.Task) *models.OutputLines {
+	if task.OutputLines != nil {
+		return task.OutputLines
+	}
+	return r.lines
+}
+
+// createWorkDir creates dir, and any missing parents, if task should have its
+// directory created.
+func (r *Runner) createWorkDir(task models.Task, dir string) error {
+	if !r.createDir && !task.CreateDir {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory of task %s: %w", task.Name, err)
+	}
+	return nil
+}
+
+// inherit returns task with the environment and directory of the task it
+// inherits from, if any, applied to it.
+func (r *Runner) inherit(task models.Task) models.Task {
+	if task.Inherit == "" {
+		return task
+	}
+	base, ok := r.tasks.Get(task.Inherit)
+	if !ok {
+		return task
+	}
+	base = r.inherit(base)
+	task.Env = append(append([]string{}, base.Env...), task.Env...)
+	// the env files of base are relative to its own directory
+	envFiles := make([]string, len(base.EnvFiles), len(base.EnvFiles)+len(task.EnvFiles))
+	for i, path := range base.EnvFiles {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(r.getExecutionPath(base), path)
+		}
+		envFiles[i] = path
+	}
+	task.EnvFiles = append(envFiles, task.EnvFiles...)
+	if task.Dir == "" {
+		task.Dir = base.Dir
+	}
+	return task
+}
+
+// validateInherit checks that the task inherited by t exists, and that
+// inheritance is not circular.
+func (r *Runner) validateInherit(t models.Task, prevTasks []string) error {
+	if t.Inherit == "" {
+		return nil
+	}
+	base, ok := r.tasks.Get(t.Inherit)
+	if !ok {
+		return fmt.Errorf("task %s inherits from %s which was not found", t.Name, t.Inherit)
+	}
+	for _, pt := range append(prevTasks, t.Name) {
+		if pt == base.Name {
+			return fmt.Errorf("task %s contains a circular inherit", base.Name)
+		}
+	}
+	return r.validateInherit(base, append(prevTasks, t.Name))
+}
+
 // ValidateDependencies checks that task dependencies follow these rules:
 // - No deeper dependency trees than maxDeps.
 // - Dependencies must exist as tasks.
@@ -224,8 +952,8 @@ func (r *Runner) ValidateDependencies(task string, prevTasks []string) error {
 	if t.ParsingError != "" {
 		return fmt.Errorf("task %s has a parsing error: %s", task, t.ParsingError)
 	}
-	for _, t := range t.DependsOn {
-		t, _, _ := strings.Cut(t, " ")
+	for _, dep := range t.DependsOn {
+		t := dep.Name
 		st, ok := r.tasks.Get(t)
 		if !ok {
 			return fmt.Errorf("task %s not found", t)
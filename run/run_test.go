@@ -1,27 +1,33 @@
 package run
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/joerdav/xc/models"
 )
 
 type mockScriptRunner struct {
 	calls       int
+	executions  []Execution
 	returns     error
 	runnerMutex sync.Mutex
 }
 
-func (r *mockScriptRunner) Execute(
-	ctx context.Context, text string, env, args []string, dir, logPrefix string,
-) error {
+func (r *mockScriptRunner) Execute(ctx context.Context, e Execution) error {
 	r.runnerMutex.Lock()
 	defer r.runnerMutex.Unlock()
 	r.calls++
+	r.executions = append(r.executions, e)
 	return r.returns
 }
 
@@ -52,7 +58,7 @@ func testCases() []testCase {
 			tasks: []models.Task{
 				{
 					Name:   "mytask",
-					Script: "somecmd",
+					Script: []models.ScriptBlock{{Body: "somecmd"}},
 				},
 			},
 			taskName:         "mytask",
@@ -63,11 +69,11 @@ func testCases() []testCase {
 			tasks: []models.Task{
 				{
 					Name:      "mytask",
-					DependsOn: []string{"mytask2"},
+					DependsOn: []models.TaskRef{{Name: "mytask2"}},
 				},
 				{
 					Name:      "mytask2",
-					DependsOn: []string{"mytask"},
+					DependsOn: []models.TaskRef{{Name: "mytask"}},
 				},
 			},
 			taskName:           "mytask",
@@ -78,11 +84,11 @@ func testCases() []testCase {
 			tasks: []models.Task{
 				{
 					Name:   "mytask",
-					Script: "somecmd",
+					Script: []models.ScriptBlock{{Body: "somecmd"}},
 				},
 				{
 					Name:      "mytask2",
-					DependsOn: []string{"mytask"},
+					DependsOn: []models.TaskRef{{Name: "mytask"}},
 				},
 			},
 			taskName:         "mytask2",
@@ -93,13 +99,13 @@ func testCases() []testCase {
 			tasks: []models.Task{
 				{
 					Name:   "mytask",
-					Script: "somecmd",
+					Script: []models.ScriptBlock{{Body: "somecmd"}},
 				},
 				{
 					Name:      "mytask2",
-					Script:    "somecmd2",
+					Script:    []models.ScriptBlock{{Body: "somecmd2"}},
 					Dir:       ".",
-					DependsOn: []string{"mytask"},
+					DependsOn: []models.TaskRef{{Name: "mytask"}},
 				},
 			},
 			taskName:         "mytask2",
@@ -112,13 +118,13 @@ func testCases() []testCase {
 			tasks: []models.Task{
 				{
 					Name:   "mytask",
-					Script: "somecmd",
+					Script: []models.ScriptBlock{{Body: "somecmd"}},
 				},
 				{
 					Name:      "mytask2",
-					Script:    "somecmd2",
+					Script:    []models.ScriptBlock{{Body: "somecmd2"}},
 					Dir:       ".",
-					DependsOn: []string{"mytask"},
+					DependsOn: []models.TaskRef{{Name: "mytask"}},
 				},
 			},
 			taskName:         "mytask2",
@@ -128,20 +134,21 @@ func testCases() []testCase {
 			name: "given a valid command with run always set, should only run always",
 			tasks: []models.Task{
 				{
-					Name:              "setup",
-					Script:            "somecmd",
-					RequiredBehaviour: models.RequiredBehaviourAlways,
+					Name:                 "setup",
+					Script:               []models.ScriptBlock{{Body: "somecmd"}},
+					RequiredBehaviour:    models.RequiredBehaviourAlways,
+					RequiredBehaviourSet: true,
 				},
 				{
 					Name:      "mytask",
-					Script:    "somecmd",
-					DependsOn: []string{"setup"},
+					Script:    []models.ScriptBlock{{Body: "somecmd"}},
+					DependsOn: []models.TaskRef{{Name: "setup"}},
 				},
 				{
 					Name:      "mytask2",
-					Script:    "somecmd2",
+					Script:    []models.ScriptBlock{{Body: "somecmd2"}},
 					Dir:       ".",
-					DependsOn: []string{"mytask", "setup"},
+					DependsOn: []models.TaskRef{{Name: "mytask"}, {Name: "setup"}},
 				},
 			},
 			taskName:         "mytask2",
@@ -151,25 +158,49 @@ func testCases() []testCase {
 			name: "given a valid command with run once set, should only run once",
 			tasks: []models.Task{
 				{
-					Name:              "setup",
-					Script:            "somecmd",
-					RequiredBehaviour: models.RequiredBehaviourOnce,
+					Name:                 "setup",
+					Script:               []models.ScriptBlock{{Body: "somecmd"}},
+					RequiredBehaviour:    models.RequiredBehaviourOnce,
+					RequiredBehaviourSet: true,
 				},
 				{
 					Name:      "mytask",
-					Script:    "somecmd",
-					DependsOn: []string{"setup"},
+					Script:    []models.ScriptBlock{{Body: "somecmd"}},
+					DependsOn: []models.TaskRef{{Name: "setup"}},
 				},
 				{
 					Name:      "mytask2",
-					Script:    "somecmd2",
+					Script:    []models.ScriptBlock{{Body: "somecmd2"}},
 					Dir:       ".",
-					DependsOn: []string{"mytask", "setup"},
+					DependsOn: []models.TaskRef{{Name: "mytask"}, {Name: "setup"}},
 				},
 			},
 			taskName:         "mytask2",
 			expectedTasksRun: 3,
 		},
+		{
+			name:             "given a diamond of dependencies, should run the shared dependency once",
+			tasks:            diamondTasks(models.TaskRef{Name: "migrate"}, models.TaskRef{Name: "migrate"}),
+			taskName:         "deploy",
+			expectedTasksRun: 4,
+		},
+		{
+			name:             "given a dependency required with different inputs, should run it for each",
+			tasks:            diamondTasks(models.TaskRef{Name: "migrate", Args: []string{"up"}}, models.TaskRef{Name: "migrate", Args: []string{"down"}}),
+			taskName:         "deploy",
+			expectedTasksRun: 5,
+		},
+	}
+}
+
+// diamondTasks returns tasks without the run attribute where deploy requires
+// api and web, which require left and right respectively.
+func diamondTasks(left, right models.TaskRef) models.Tasks {
+	return models.Tasks{
+		{Name: "migrate", Script: []models.ScriptBlock{{Body: "migrate"}}},
+		{Name: "api", Script: []models.ScriptBlock{{Body: "api"}}, DependsOn: []models.TaskRef{left}},
+		{Name: "web", Script: []models.ScriptBlock{{Body: "web"}}, DependsOn: []models.TaskRef{right}},
+		{Name: "deploy", Script: []models.ScriptBlock{{Body: "deploy"}}, DependsOn: []models.TaskRef{{Name: "api"}, {Name: "web"}}},
 	}
 }
 
@@ -199,6 +230,136 @@ func TestRunAsync(t *testing.T) {
 		})
 	}
 }
+func TestRunParallel(t *testing.T) {
+	for _, tt := range testCases() {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range tt.tasks {
+				tt.tasks[i].Parallel = true
+			}
+			runner, err := NewRunner(tt.tasks, "")
+			if (err != nil) != tt.expectedParseError {
+				t.Fatalf("expected error %v, got %v", tt.expectedParseError, err)
+			}
+			if err != nil {
+				return
+			}
+			scriptRunner := &mockScriptRunner{returns: tt.err}
+			runner.scriptRunner = scriptRunner
+			err = runner.Run(context.Background(), tt.taskName, nil)
+			if (err != nil) != tt.expectedRunError {
+				t.Fatalf("expected error %v, got %v", tt.expectedRunError, err)
+			}
+			if scriptRunner.calls != tt.expectedTasksRun {
+				t.Fatalf("expected %d task runs got %d", tt.expectedTasksRun, scriptRunner.calls)
+			}
+		})
+	}
+}
+
+// parallelScriptRunner waits for every script to start before any return.
+// The script "fail" then fails, and every other script waits to be cancelled.
+type parallelScriptRunner struct {
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	cancelled []string
+}
+
+func (r *parallelScriptRunner) Execute(ctx context.Context, e Execution) error {
+	r.wg.Done()
+	r.wg.Wait()
+	if e.Script == "fail" {
+		return errors.New("failed")
+	}
+	<-ctx.Done()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cancelled = append(r.cancelled, e.Script)
+	return ctx.Err()
+}
+
+func TestRunParallelFailFast(t *testing.T) {
+	runner, err := NewRunner(models.Tasks{
+		{Name: "lint", Script: []models.ScriptBlock{{Body: "lint"}}},
+		{Name: "test", Script: []models.ScriptBlock{{Body: "fail"}}},
+		{Name: "assets", Script: []models.ScriptBlock{{Body: "assets"}}},
+		{Name: "build", Script: []models.ScriptBlock{{Body: "build"}}, DependsOn: []models.TaskRef{{Name: "lint"}, {Name: "test"}, {Name: "assets"}}, Parallel: true},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptRunner := &parallelScriptRunner{}
+	scriptRunner.wg.Add(3)
+	runner.scriptRunner = scriptRunner
+	done := make(chan error)
+	go func() {
+		done <- runner.Run(context.Background(), "build", nil)
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the dependencies to run concurrently, and the rest to be cancelled")
+	}
+	if err == nil || err.Error() != "failed" {
+		t.Fatalf("expected only the failure, got %v", err)
+	}
+	sort.Strings(scriptRunner.cancelled)
+	if got := strings.Join(scriptRunner.cancelled, ","); got != "assets,lint" {
+		t.Fatalf("expected the other dependencies to be cancelled, got %s", got)
+	}
+}
+
+func TestRunContinueOnError(t *testing.T) {
+	tests := []struct {
+		name            string
+		continueOnError bool
+		expectRun       []string
+		expectErr       bool
+	}{
+		{
+			name:      "given a failing requirement, should not run the rest",
+			expectRun: []string{"lint"},
+			expectErr: true,
+		},
+		{
+			name:            "given a failing requirement with continue-on-error, should run the rest",
+			continueOnError: true,
+			expectRun:       []string{"lint", "test", "build"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{Name: "lint", Script: []models.ScriptBlock{{Body: "lint"}}, ContinueOnError: tt.continueOnError},
+				{Name: "test", Script: []models.ScriptBlock{{Body: "test"}}},
+				{Name: "build", Script: []models.ScriptBlock{{Body: "build"}}, DependsOn: []models.TaskRef{{Name: "lint"}, {Name: "test"}}},
+			}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var stderr bytes.Buffer
+			runner.stderr = &stderr
+			scriptRunner := &scriptResults{results: map[string]error{"lint": errors.New("lint failed")}}
+			runner.scriptRunner = scriptRunner
+			err = runner.Run(context.Background(), "build", nil)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("err=%v, want error=%v", err, tt.expectErr)
+			}
+			var run []string
+			for _, e := range scriptRunner.executions {
+				run = append(run, e.Script)
+			}
+			if strings.Join(run, ",") != strings.Join(tt.expectRun, ",") {
+				t.Fatalf("ran %q, want %q", run, tt.expectRun)
+			}
+			if tt.continueOnError && !strings.Contains(stderr.String(), `task "lint" failed, continuing: lint failed`) {
+				t.Fatalf("expected the failure to be logged, got %q", stderr.String())
+			}
+		})
+	}
+}
+
 func TestRun(t *testing.T) {
 	for _, tt := range testCases() {
 		tt := tt
@@ -223,13 +384,44 @@ func TestRun(t *testing.T) {
 	}
 }
 
+func TestRunNoDedup(t *testing.T) {
+	runner, err := NewRunner(diamondTasks(models.TaskRef{Name: "migrate"}, models.TaskRef{Name: "migrate"}), "", WithNoDedup(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptRunner := &mockScriptRunner{}
+	runner.scriptRunner = scriptRunner
+	if err := runner.Run(context.Background(), "deploy", nil); err != nil {
+		t.Fatal(err)
+	}
+	if scriptRunner.calls != 5 {
+		t.Fatalf("expected 5 task runs got %d", scriptRunner.calls)
+	}
+	t.Run("given a second run, should run every task again", func(t *testing.T) {
+		runner, err := NewRunner(diamondTasks(models.TaskRef{Name: "migrate"}, models.TaskRef{Name: "migrate"}), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptRunner := &mockScriptRunner{}
+		runner.scriptRunner = scriptRunner
+		for i := 0; i < 2; i++ {
+			if err := runner.Run(context.Background(), "deploy", nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if scriptRunner.calls != 8 {
+			t.Fatalf("expected 8 task runs got %d", scriptRunner.calls)
+		}
+	})
+}
+
 func TestRunWithInputs(t *testing.T) {
 	t.Run("given a required input is not provided, return an error", func(t *testing.T) {
 		runner, err := NewRunner(models.Tasks{
 			{
 				Name:   "task",
-				Script: "somecmd",
-				Inputs: []string{"FOO"},
+				Script: []models.ScriptBlock{{Body: "somecmd"}},
+				Inputs: []models.Input{{Name: "FOO"}},
 			},
 		}, "")
 		if err != nil {
@@ -244,8 +436,8 @@ func TestRunWithInputs(t *testing.T) {
 		runner, err := NewRunner(models.Tasks{
 			{
 				Name:   "task",
-				Script: "somecmd",
-				Inputs: []string{"FOO"},
+				Script: []models.ScriptBlock{{Body: "somecmd"}},
+				Inputs: []models.Input{{Name: "FOO"}},
 			},
 		}, "")
 		if err != nil {
@@ -265,8 +457,8 @@ func TestRunWithInputs(t *testing.T) {
 		runner, err := NewRunner(models.Tasks{
 			{
 				Name:   "task",
-				Script: "somecmd",
-				Inputs: []string{"FOO"},
+				Script: []models.ScriptBlock{{Body: "somecmd"}},
+				Inputs: []models.Input{{Name: "FOO"}},
 			},
 		}, "")
 		if err != nil {
@@ -284,4 +476,667 @@ func TestRunWithInputs(t *testing.T) {
 			t.Fatal("task was not run")
 		}
 	})
+	t.Run("given a required input is provided by WithTaskInputs, run the task", func(t *testing.T) {
+		runner, err := NewRunner(models.Tasks{
+			{
+				Name:   "task",
+				Script: []models.ScriptBlock{{Body: "somecmd"}},
+				Inputs: []models.Input{{Name: "FOO"}},
+			},
+		}, "", WithTaskInputs("task", []string{"FOO=bar", "OTHER=ignored"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptRunner := &mockScriptRunner{}
+		runner.scriptRunner = scriptRunner
+		err = runner.Run(context.Background(), "task", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		env := strings.Join(scriptRunner.executions[0].Env, ",")
+		if !strings.HasSuffix(env, "FOO=bar") || strings.Contains(env, "OTHER=") {
+			t.Fatalf("env=%s, want FOO=bar and no OTHER", env)
+		}
+	})
+	t.Run("given an input is provided as an argument and by WithTaskInputs, the argument wins", func(t *testing.T) {
+		runner, err := NewRunner(models.Tasks{
+			{
+				Name:   "task",
+				Script: []models.ScriptBlock{{Body: "somecmd"}},
+				Inputs: []models.Input{{Name: "FOO"}},
+			},
+		}, "", WithTaskInputs("task", []string{"FOO=file"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptRunner := &mockScriptRunner{}
+		runner.scriptRunner = scriptRunner
+		err = runner.Run(context.Background(), "task", []string{"arg"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		env := scriptRunner.executions[0].Env
+		if env[len(env)-1] != "FOO=arg" {
+			t.Fatalf("env=%s, want FOO=arg last", strings.Join(env, ","))
+		}
+	})
+	t.Run("given an input with a default, use it only if the input is not provided", func(t *testing.T) {
+		os.Setenv("COUNT", "5")
+		defer os.Unsetenv("COUNT")
+		for _, tc := range []struct {
+			args     []string
+			expected string
+		}{
+			{args: nil, expected: "NAME=world,COUNT=5"},
+			{args: []string{"joe", "7"}, expected: "NAME=joe,COUNT=7"},
+		} {
+			runner, err := NewRunner(models.Tasks{
+				{
+					Name:   "task",
+					Script: []models.ScriptBlock{{Body: "somecmd"}},
+					Inputs: []models.Input{{Name: "NAME", Default: "world"}, {Name: "COUNT", Default: "3"}},
+				},
+			}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			scriptRunner := &mockScriptRunner{}
+			runner.scriptRunner = scriptRunner
+			if err := runner.Run(context.Background(), "task", tc.args); err != nil {
+				t.Fatal(err)
+			}
+			env := scriptRunner.executions[0].Env
+			for _, kv := range strings.Split(tc.expected, ",") {
+				name, expect, _ := strings.Cut(kv, "=")
+				if v, _ := lookupEnv(env, name); v != expect {
+					t.Errorf("args %q: %s=%q, want %q", tc.args, name, v, expect)
+				}
+			}
+		}
+	})
+	t.Run("given default inputs, use them over inline defaults but not args or the environment", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, ".xc-defaults.env"), "REGION=task-file\n")
+		os.Setenv("STAGE", "env")
+		defer os.Unsetenv("STAGE")
+		runner, err := NewRunner(models.Tasks{
+			{
+				Name:         "task",
+				Script:       []models.ScriptBlock{{Body: "somecmd"}},
+				Inputs:       []models.Input{{Name: "NAME"}, {Name: "STAGE"}, {Name: "COUNT", Default: "3"}, {Name: "REGION"}, {Name: "ZONE"}, {Name: "TAG", Default: "latest"}},
+				DefaultsFile: ".xc-defaults.env",
+			},
+		}, dir, WithDefaultInputs([]string{"NAME=global", "STAGE=global", "COUNT=global", "REGION=global", "ZONE=global"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptRunner := &mockScriptRunner{}
+		runner.scriptRunner = scriptRunner
+		if err := runner.Run(context.Background(), "task", []string{"arg"}); err != nil {
+			t.Fatal(err)
+		}
+		env := scriptRunner.executions[0].Env
+		for name, expect := range map[string]string{"NAME": "arg", "STAGE": "env", "COUNT": "global", "REGION": "task-file", "ZONE": "global", "TAG": "latest"} {
+			if v, _ := lookupEnv(env, name); v != expect {
+				t.Errorf("%s=%q, want %q", name, v, expect)
+			}
+		}
+	})
+	t.Run("given an input with an empty default, it is not required", func(t *testing.T) {
+		runner, err := NewRunner(models.Tasks{
+			{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, Inputs: []models.Input{models.ParseInput("NAME=")}},
+		}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptRunner := &mockScriptRunner{}
+		runner.scriptRunner = scriptRunner
+		if err := runner.Run(context.Background(), "task", nil); err != nil {
+			t.Fatal(err)
+		}
+		if v, ok := lookupEnv(scriptRunner.executions[0].Env, "NAME"); !ok || v != "" {
+			t.Errorf("NAME=%q (set %v), want it set and empty", v, ok)
+		}
+	})
+	t.Run("given an input without a default, it is required", func(t *testing.T) {
+		runner, err := NewRunner(models.Tasks{
+			{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, Inputs: []models.Input{models.ParseInput("NAME")}},
+		}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		runner.scriptRunner = &mockScriptRunner{}
+		if err := runner.Run(context.Background(), "task", nil); err == nil {
+			t.Fatal("expected an error got nil")
+		}
+	})
+	t.Run("given inputs for an unknown task, return an error", func(t *testing.T) {
+		_, err := NewRunner(models.Tasks{
+			{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}},
+		}, "", WithTaskInputs("missing", []string{"FOO=bar"}))
+		if err == nil {
+			t.Fatal("expected an error got nil")
+		}
+	})
+}
+
+func TestRunRequiresWithArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		requires  models.TaskRef
+		expected  []string
+		expectErr bool
+	}{
+		{
+			name:     "given arguments, should pass them in order",
+			requires: models.TaskRef{Name: "deploy", Args: []string{"prod", "eu"}},
+			expected: []string{"prod", "eu"},
+		},
+		{
+			name:     "given named arguments, should set the inputs by name",
+			requires: models.TaskRef{Name: "deploy", Args: []string{"REGION=us", "ENV=prod"}},
+			expected: []string{"prod", "us"},
+		},
+		{
+			name:     "given a named argument after an input with a default, should use the default",
+			requires: models.TaskRef{Name: "deploy", Args: []string{"ENV=prod", "TAG=v1"}},
+			expected: []string{"prod", "eu", "v1"},
+		},
+		{
+			name:     "given named and positional arguments, should fill the rest in order",
+			requires: models.TaskRef{Name: "deploy", Args: []string{"REGION=us", "prod"}},
+			expected: []string{"prod", "us"},
+		},
+		{
+			name:      "given a named argument after a required input, should error",
+			requires:  models.TaskRef{Name: "deploy", Args: []string{"REGION=us"}},
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{Name: "release", Script: []models.ScriptBlock{{Body: "somecmd"}}, DependsOn: []models.TaskRef{tt.requires}},
+				{
+					Name:   "deploy",
+					Script: []models.ScriptBlock{{Body: "somecmd"}},
+					Inputs: []models.Input{{Name: "ENV"}, {Name: "REGION", Default: "eu"}, {Name: "TAG", Default: "latest"}},
+				},
+			}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			scriptRunner := &mockScriptRunner{}
+			runner.scriptRunner = scriptRunner
+			err = runner.Run(context.Background(), "release", nil)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("err=%v, want error=%v", err, tt.expectErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := scriptRunner.executions[0].Args; strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+				t.Fatalf("args=%q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunWithTaskEnv(t *testing.T) {
+	t.Run("given env for a task, should set it after the env attribute", func(t *testing.T) {
+		runner, err := NewRunner(models.Tasks{
+			{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, Env: []string{"A=1", "B=1"}},
+			{Name: "other", Script: []models.ScriptBlock{{Body: "somecmd"}}, Env: []string{"B=1"}, DependsOn: []models.TaskRef{{Name: "task"}}},
+		}, "", WithTaskEnv("task", []string{"B=2"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptRunner := &mockScriptRunner{}
+		runner.scriptRunner = scriptRunner
+		if err = runner.Run(context.Background(), "other", nil); err != nil {
+			t.Fatal(err)
+		}
+		if env := strings.Join(scriptRunner.executions[0].Env, ","); !strings.HasSuffix(env, "A=1,B=1,B=2") {
+			t.Fatalf("env=%s, want A=1,B=1,B=2 last", env)
+		}
+		if env := strings.Join(scriptRunner.executions[1].Env, ","); !strings.HasSuffix(env, ",B=1") {
+			t.Fatalf("env=%s, want other task unaffected", env)
+		}
+	})
+	t.Run("given env overrides, should set them after the task env and before inputs", func(t *testing.T) {
+		runner, err := NewRunner(models.Tasks{
+			{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, Env: []string{"A=1"}, Inputs: []models.Input{{Name: "IN"}}},
+		}, "", WithTaskEnv("task", []string{"A=2"}), WithEnvOverrides([]string{"A=3"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptRunner := &mockScriptRunner{}
+		runner.scriptRunner = scriptRunner
+		if err = runner.Run(context.Background(), "task", []string{"x"}); err != nil {
+			t.Fatal(err)
+		}
+		if env := strings.Join(scriptRunner.executions[0].Env, ","); !strings.HasSuffix(env, "A=1,A=2,A=3,IN=x") {
+			t.Fatalf("env=%s, want A=1,A=2,A=3,IN=x last", env)
+		}
+	})
+	t.Run("given env for an unknown task, return an error", func(t *testing.T) {
+		_, err := NewRunner(models.Tasks{
+			{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}},
+		}, "", WithTaskEnv("missing", []string{"FOO=bar"}))
+		if err == nil {
+			t.Fatal("expected an error got nil")
+		}
+	})
+}
+
+func TestRunWithNoPTY(t *testing.T) {
+	runner, err := NewRunner(models.Tasks{
+		{Name: "task", Script: []models.ScriptBlock{{Body: "hello\n"}}, Interactive: true},
+	}, "", WithNoPTY(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr bytes.Buffer
+	runner.stdout, runner.stderr = &stdout, &stderr
+	runner.scriptRunner = outputScriptRunner{}
+	if err = runner.Run(context.Background(), "task", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stderr.String(), "interactive is ignored") {
+		t.Fatalf("expected a warning, got %q", stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "task｜ hello") {
+		t.Fatalf("expected prefixed output, got %q", stdout.String())
+	}
+}
+
+func TestRunInteractiveOutput(t *testing.T) {
+	var stdout, logFile bytes.Buffer
+	runner, err := NewRunner(models.Tasks{
+		{Name: "task", Script: []models.ScriptBlock{{Body: "token s3cret\npassword: "}}, Interactive: true},
+	}, "", WithOutput(&stdout, &stdout), WithLogFile(&logFile), WithOutputMasking([]*regexp.Regexp{regexp.MustCompile("s3cret")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.scriptRunner = outputScriptRunner{}
+	if err = runner.Run(context.Background(), "task", nil); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "token s3cret\npassword: " {
+		t.Fatalf("expected the terminal to get the output as written, got %q", stdout.String())
+	}
+	if !strings.Contains(logFile.String(), "token ***REDACTED***\n") || !strings.Contains(logFile.String(), "password: ") {
+		t.Fatalf("expected the log file to get the masked output, got %q", logFile.String())
+	}
+	if strings.Contains(logFile.String(), "s3cret") {
+		t.Fatalf("expected the log file to be masked, got %q", logFile.String())
+	}
+}
+
+func TestRunWithShowScript(t *testing.T) {
+	tests := []struct {
+		name         string
+		dryRun       bool
+		expectedRuns int
+	}{
+		{name: "given show script, should print scripts and run them", expectedRuns: 2},
+		{name: "given a dry run, should print scripts without running them", dryRun: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{Name: "dep", Script: []models.ScriptBlock{{Body: "echo dep\n"}}},
+				{Name: "task", Script: []models.ScriptBlock{{Body: "echo one\necho two\n"}}, DependsOn: []models.TaskRef{{Name: "dep"}}},
+			}, "", WithShowScript(true), WithDryRun(tt.dryRun))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var stderr bytes.Buffer
+			runner.stderr = &stderr
+			scriptRunner := &mockScriptRunner{}
+			runner.scriptRunner = scriptRunner
+			if err = runner.Run(context.Background(), "task", []string{"a"}); err != nil {
+				t.Fatal(err)
+			}
+			if scriptRunner.calls != tt.expectedRuns {
+				t.Fatalf("expected %d runs, got %d", tt.expectedRuns, scriptRunner.calls)
+			}
+			expected := "task \"dep\" script:\n    echo dep\n"
+			if !strings.Contains(stderr.String(), expected) {
+				t.Fatalf("expected %q in %q", expected, stderr.String())
+			}
+			expected = "task \"task\" script (args: a):\n    echo one\n    echo two\n"
+			if !strings.Contains(stderr.String(), expected) {
+				t.Fatalf("expected %q in %q", expected, stderr.String())
+			}
+		})
+	}
+}
+
+func TestRunWithDryRunOutput(t *testing.T) {
+	var out bytes.Buffer
+	runner, err := NewRunner(models.Tasks{
+		{Name: "dep", Script: []models.ScriptBlock{{Body: "echo dep\n"}}},
+		{Name: "task", Script: []models.ScriptBlock{{Body: "echo $1\n"}}, DependsOn: []models.TaskRef{{Name: "dep"}}},
+	}, "/repo", WithDryRun(true), WithDryRunOutput(&out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner.stderr = &bytes.Buffer{}
+	scriptRunner := &mockScriptRunner{}
+	runner.scriptRunner = scriptRunner
+	if err = runner.Run(context.Background(), "task", []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if scriptRunner.calls != 0 {
+		t.Fatalf("expected no runs, got %d", scriptRunner.calls)
+	}
+	expected := `{
+  "dry_run": true,
+  "tasks": [
+    {
+      "task": "dep",
+      "seq": 1,
+      "dir": "/repo",
+      "script": "echo dep\n"
+    },
+    {
+      "task": "task",
+      "seq": 2,
+      "dir": "/repo",
+      "args": [
+        "a"
+      ],
+      "script": "echo $1\n"
+    }
+  ]
+}
+`
+	if out.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestRunEmptyTask(t *testing.T) {
+	runner, err := NewRunner(models.Tasks{
+		{Name: "stub", AllowEmpty: true},
+		{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, DependsOn: []models.TaskRef{{Name: "stub"}}},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	runner.stdout = &stdout
+	scriptRunner := &mockScriptRunner{}
+	runner.scriptRunner = scriptRunner
+	if err = runner.Run(context.Background(), "task", nil); err != nil {
+		t.Fatal(err)
+	}
+	if scriptRunner.calls != 1 {
+		t.Fatalf("expected only the task to run, got %d runs", scriptRunner.calls)
+	}
+	if !strings.Contains(stdout.String(), `task "stub" skipped (empty)`) {
+		t.Fatalf("expected the empty task to be reported, got %q", stdout.String())
+	}
+}
+
+func TestRunCreateDir(t *testing.T) {
+	tests := []struct {
+		name      string
+		createDir bool
+		task      models.Task
+	}{
+		{name: "given -task-dir-create, should create the directory", createDir: true, task: models.Task{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, Dir: "out/nested"}},
+		{name: "given create-dir, should create the directory", task: models.Task{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, Dir: "out/nested", CreateDir: true}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			runner, err := NewRunner(models.Tasks{tt.task}, dir, WithCreateDir(tt.createDir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			runner.scriptRunner = &mockScriptRunner{}
+			if err = runner.Run(context.Background(), "task", nil); err != nil {
+				t.Fatal(err)
+			}
+			if info, err := os.Stat(filepath.Join(dir, "out", "nested")); err != nil || !info.IsDir() {
+				t.Fatalf("expected the directory of the task to be created, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRunWithInherit(t *testing.T) {
+	t.Run("given a task inherits, should use the inherited env and dir", func(t *testing.T) {
+		runner, err := NewRunner(models.Tasks{
+			{Name: "base", Script: []models.ScriptBlock{{Body: "somecmd"}}, Env: []string{"A=1", "B=1"}, Dir: "base"},
+			{Name: "middle", Inherit: "base", Env: []string{"B=2"}, DependsOn: []models.TaskRef{{Name: "base"}}},
+			{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, Inherit: "middle", Env: []string{"C=3"}},
+		}, "root")
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptRunner := &mockScriptRunner{}
+		runner.scriptRunner = scriptRunner
+		if err = runner.Run(context.Background(), "task", nil); err != nil {
+			t.Fatal(err)
+		}
+		if scriptRunner.calls != 1 {
+			t.Fatalf("expected only the task to run, got %d runs", scriptRunner.calls)
+		}
+		e := scriptRunner.executions[0]
+		if e.Dir != filepath.Join("root", "base") {
+			t.Fatalf("dir=%q, want %q", e.Dir, filepath.Join("root", "base"))
+		}
+		env := strings.Join(e.Env, ",")
+		if !strings.HasSuffix(env, "A=1,B=1,B=2,C=3") {
+			t.Fatalf("env=%s, want suffix A=1,B=1,B=2,C=3", env)
+		}
+	})
+	t.Run("given a task inherits env-files, should read them from the inherited dir first", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "base", "base.env"), "A=1\nB=1\n")
+		writeFile(t, filepath.Join(dir, "web", "web.env"), "B=2\n")
+		runner, err := NewRunner(models.Tasks{
+			{Name: "base", Dir: "base", EnvFiles: []string{"base.env"}},
+			{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, Inherit: "base", Dir: "web", EnvFiles: []string{"web.env"}},
+		}, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptRunner := &mockScriptRunner{}
+		runner.scriptRunner = scriptRunner
+		if err = runner.Run(context.Background(), "task", nil); err != nil {
+			t.Fatal(err)
+		}
+		env := strings.Join(scriptRunner.executions[0].Env, ",")
+		if !strings.Contains(env, "A=1,B=1,B=2") {
+			t.Fatalf("env=%s, want A=1,B=1,B=2", env)
+		}
+	})
+	t.Run("given a circular inherit, should error", func(t *testing.T) {
+		_, err := NewRunner(models.Tasks{
+			{Name: "a", Script: []models.ScriptBlock{{Body: "somecmd"}}, Inherit: "b"},
+			{Name: "b", Script: []models.ScriptBlock{{Body: "somecmd"}}, Inherit: "a"},
+		}, "")
+		if err == nil {
+			t.Fatal("expected an error got nil")
+		}
+	})
+	t.Run("given an unknown inherit, should error", func(t *testing.T) {
+		_, err := NewRunner(models.Tasks{
+			{Name: "a", Script: []models.ScriptBlock{{Body: "somecmd"}}, Inherit: "missing"},
+		}, "")
+		if err == nil {
+			t.Fatal("expected an error got nil")
+		}
+	})
+}
+
+func TestRunInOrder(t *testing.T) {
+	var stderr bytes.Buffer
+	runner, err := NewRunner(models.Tasks{
+		{Name: "a", Script: []models.ScriptBlock{{Body: "a"}}},
+		{Name: "b", Script: []models.ScriptBlock{{Body: "b"}}},
+		{Name: "c", Script: []models.ScriptBlock{{Body: "c"}}},
+		{Name: "all", DependsOn: []models.TaskRef{{Name: "c"}, {Name: "a"}, {Name: "b"}}, DepsBehaviour: models.DependencyBehaviourAsync},
+	}, "", WithRunInOrder(true), WithOutput(&bytes.Buffer{}, &stderr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		scriptRunner := &mockScriptRunner{}
+		runner.scriptRunner = scriptRunner
+		if err := runner.Run(context.Background(), "all", nil); err != nil {
+			t.Fatal(err)
+		}
+		var order []string
+		for _, e := range scriptRunner.executions {
+			order = append(order, e.Script)
+		}
+		if got := strings.Join(order, ","); got != "c,a,b" {
+			t.Fatalf("got order %s, want c,a,b", got)
+		}
+	}
+	if !strings.Contains(stderr.String(), `task "all": running dependencies in order`) {
+		t.Fatalf("expected a message that parallelism was suppressed, got %q", stderr.String())
+	}
+}
+
+func TestRunScriptBlocks(t *testing.T) {
+	tasks := models.Tasks{
+		{Name: "build", Script: []models.ScriptBlock{{Body: "compile\n", Lang: "sh"}, {Body: "link\n"}}},
+	}
+	t.Run("given several blocks, should run them in order", func(t *testing.T) {
+		runner, err := NewRunner(tasks, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptRunner := &mockScriptRunner{}
+		runner.scriptRunner = scriptRunner
+		if err := runner.Run(context.Background(), "build", nil); err != nil {
+			t.Fatal(err)
+		}
+		var order []string
+		for _, e := range scriptRunner.executions {
+			order = append(order, e.Script)
+		}
+		if got := strings.Join(order, ""); got != "compile\nlink\n" {
+			t.Fatalf("got scripts %q, want compile then link", got)
+		}
+	})
+	t.Run("given a block fails, should not run the rest", func(t *testing.T) {
+		runner, err := NewRunner(tasks, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptRunner := &mockScriptRunner{returns: errors.New("exit status 1")}
+		runner.scriptRunner = scriptRunner
+		if err := runner.Run(context.Background(), "build", nil); err == nil {
+			t.Fatal("expected an error got nil")
+		}
+		if scriptRunner.calls != 1 {
+			t.Fatalf("expected 1 block to run, got %d", scriptRunner.calls)
+		}
+	})
+}
+
+func TestGetExecutionPath(t *testing.T) {
+	runner, err := NewRunner(models.Tasks{}, "/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		dir      string
+		expected string
+	}{
+		{dir: "", expected: "/repo"},
+		{dir: "web", expected: "/repo/web"},
+		{dir: "../shared", expected: "/shared"},
+		{dir: "/srv/app", expected: "/srv/app"},
+	}
+	for _, tt := range tests {
+		if got := runner.getExecutionPath(models.Task{Dir: tt.dir}); got != tt.expected {
+			t.Errorf("dir %q: got %q, want %q", tt.dir, got, tt.expected)
+		}
+	}
+}
+
+func TestRunHidden(t *testing.T) {
+	tasks := models.Tasks{
+		{Name: "_compile", Script: []models.ScriptBlock{{Body: "somecmd"}}},
+		{Name: "build", DependsOn: []models.TaskRef{{Name: "_compile"}}},
+	}
+	tests := []struct {
+		name        string
+		task        string
+		runHidden   bool
+		expectErr   bool
+		expectCalls int
+	}{
+		{name: "given a hidden task is required, should run it", task: "build", expectCalls: 1},
+		{name: "given a hidden task, should not run it", task: "_compile", expectErr: true},
+		{name: "given a hidden task with -force, should run it", task: "_compile", runHidden: true, expectCalls: 1},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(tasks, "", WithRunHidden(tt.runHidden))
+			if err != nil {
+				t.Fatal(err)
+			}
+			scriptRunner := &mockScriptRunner{}
+			runner.scriptRunner = scriptRunner
+			err = runner.Run(context.Background(), tt.task, nil)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("err=%v, want error=%v", err, tt.expectErr)
+			}
+			if scriptRunner.calls != tt.expectCalls {
+				t.Fatalf("expected %d calls, got %d", tt.expectCalls, scriptRunner.calls)
+			}
+		})
+	}
+}
+
+func TestRunPlatform(t *testing.T) {
+	tasks := models.Tasks{
+		{Name: "install-brew", Script: []models.ScriptBlock{{Body: "brew bundle"}}, Platforms: []string{"darwin"}},
+		{Name: "setup", Script: []models.ScriptBlock{{Body: "make setup"}}, DependsOn: []models.TaskRef{{Name: "install-brew"}}},
+	}
+	tests := []struct {
+		name        string
+		goos        string
+		task        string
+		expectCalls int
+	}{
+		{name: "given a matching platform, should run the task", goos: "darwin", task: "install-brew", expectCalls: 1},
+		{name: "given another platform, should skip the task", goos: "linux", task: "install-brew", expectCalls: 0},
+		{name: "given a skipped dependency, should still run the task", goos: "windows", task: "setup", expectCalls: 1},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			runner, err := NewRunner(tasks, "", WithOutput(&out, &out))
+			if err != nil {
+				t.Fatal(err)
+			}
+			runner.goos = tt.goos
+			scriptRunner := &mockScriptRunner{}
+			runner.scriptRunner = scriptRunner
+			if err := runner.Run(context.Background(), tt.task, nil); err != nil {
+				t.Fatal(err)
+			}
+			if scriptRunner.calls != tt.expectCalls {
+				t.Fatalf("expected %d calls, got %d", tt.expectCalls, scriptRunner.calls)
+			}
+			if skipped := strings.Contains(out.String(), `"install-brew" skipped`); skipped != (tt.goos != "darwin") {
+				t.Fatalf("output %q, want skipped=%v", out.String(), tt.goos != "darwin")
+			}
+		})
+	}
 }
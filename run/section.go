@@ -0,0 +1,76 @@
+package run
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// Section is a range of lines of output, from a line matching Start to the
+// next line matching End, inclusive.
+type Section struct {
+	Start, End *regexp.Regexp
+}
+
+// sectionFilter replaces the sections of a stream of output with a marker.
+type sectionFilter struct {
+	sections []Section
+	// open is the section being suppressed, if any.
+	open       *Section
+	suppressed int
+	w          io.WriteCloser
+	lines      *lineWriter
+}
+
+// newSectionFilter returns writers which pass on the lines written to stdout
+// and stderr, replacing each of sections with a line counting those suppressed.
+func newSectionFilter(stdout, stderr io.WriteCloser, sections []Section) (io.WriteCloser, io.WriteCloser) {
+	return newSectionWriter(stdout, sections), newSectionWriter(stderr, sections)
+}
+
+func newSectionWriter(w io.WriteCloser, sections []Section) *sectionFilter {
+	f := &sectionFilter{sections: sections, w: w}
+	f.lines = newLineWriter(struct{ io.Writer }{w}, f.line)
+	return f
+}
+
+// line drops line if it is part of a section, for use with lineWriter.
+func (f *sectionFilter) line(line []byte) []byte {
+	text := bytes.TrimSuffix(line, []byte{newLine})
+	if f.open != nil {
+		f.suppressed++
+		if f.open.End.Match(text) {
+			f.open = nil
+			return f.marker()
+		}
+		return nil
+	}
+	for i, s := range f.sections {
+		if s.Start.Match(text) {
+			f.open, f.suppressed = &f.sections[i], 1
+			return nil
+		}
+	}
+	return line
+}
+
+func (f *sectionFilter) marker() []byte {
+	return []byte(fmt.Sprintf("--- (%d lines suppressed) ---\n", f.suppressed))
+}
+
+func (f *sectionFilter) Write(p []byte) (int, error) {
+	return f.lines.Write(p)
+}
+
+// Close writes the marker for a section which never ended, then closes the
+// underlying writer.
+func (f *sectionFilter) Close() error {
+	err := f.lines.Close()
+	if err == nil && f.open != nil {
+		f.open = nil
+		_, err = f.w.Write(f.marker())
+	}
+	return errors.Join(err, f.w.Close())
+}
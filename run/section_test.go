@@ -0,0 +1,37 @@
+//nolint:errcheck
+package run
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestSectionFilter(t *testing.T) {
+	sections := []Section{{Start: regexp.MustCompile(`^tool v`), End: regexp.MustCompile(`^---$`)}}
+	t.Run("given a section, should replace it with a marker", func(t *testing.T) {
+		var out, errOut closeRecorder
+		stdout, stderr := newSectionFilter(&out, &errOut, sections)
+		stdout.Write([]byte("starting\ntool v1.2.3\nbuilt with go\n---\nresult: ok\n"))
+		stderr.Write([]byte("---\n"))
+		stdout.Close()
+		stderr.Close()
+		if expect := "starting\n--- (3 lines suppressed) ---\nresult: ok\n"; out.String() != expect {
+			t.Fatalf("got %q, want %q", out.String(), expect)
+		}
+		if errOut.String() != "---\n" {
+			t.Fatalf("got %q, want stderr to be unchanged", errOut.String())
+		}
+		if !out.closed || !errOut.closed {
+			t.Fatal("expected writers to be closed")
+		}
+	})
+	t.Run("given a section which does not end, should write a marker on close", func(t *testing.T) {
+		var out, errOut closeRecorder
+		stdout, _ := newSectionFilter(&out, &errOut, sections)
+		stdout.Write([]byte("tool v2\nlicence"))
+		stdout.Close()
+		if expect := "--- (2 lines suppressed) ---\n"; out.String() != expect {
+			t.Fatalf("got %q, want %q", out.String(), expect)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package run
+
+import (
+	"errors"
+	"os"
+)
+
+// signal sends sig to every process in the set.
+func (s *processSet) signal(sig os.Signal) error {
+	if s == nil {
+		return nil
+	}
+	var errs []error
+	for _, pid := range s.list() {
+		p, err := os.FindProcess(pid)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := p.Signal(sig); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// forwardSignals sends each signal received from the Runner's signal channel
+// to the running commands of every task, until the returned function is called.
+func (r *Runner) forwardSignals() (stop func()) {
+	if r.signals == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-r.signals:
+				_ = r.running.signal(sig)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,70 @@
+//go:build unix
+
+package run
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/joerdav/xc/models"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// readyWriter closes ready once "ready" has been written to it.
+type readyWriter struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	ready chan struct{}
+	once  sync.Once
+}
+
+func (w *readyWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err := w.buf.Write(p)
+	if strings.Contains(w.buf.String(), "ready") {
+		w.once.Do(func() { close(w.ready) })
+	}
+	return n, err
+}
+
+func (w *readyWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func TestInheritSignals(t *testing.T) {
+	signals := make(chan os.Signal, 1)
+	runner, err := NewRunner(models.Tasks{
+		{
+			Name:   "server",
+			Script: []models.ScriptBlock{{Body: `sh -c 'trap "echo flushed; exit 3" TERM; echo ready; while :; do sleep 0.01; done'`}},
+		},
+	}, "", WithInheritSignals(signals))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := &readyWriter{ready: make(chan struct{})}
+	runner.stdout = stdout
+	go func() {
+		select {
+		case <-stdout.ready:
+			signals <- syscall.SIGTERM
+		case <-time.After(5 * time.Second):
+		}
+	}()
+	err = runner.Run(context.Background(), "server", nil)
+	if status, ok := interp.IsExitStatus(err); !ok || status != 3 {
+		t.Fatalf("expected the task to exit 3 from its trap, got %v", err)
+	}
+	if !strings.Contains(stdout.String(), "flushed") {
+		t.Fatalf("expected the trap to run, got %q", stdout.String())
+	}
+}
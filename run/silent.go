@@ -0,0 +1,78 @@
+package run
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/joerdav/xc/models"
+)
+
+// ErrProducedOutput is returned, wrapped, when a task which must be silent
+// writes to stdout or stderr.
+var ErrProducedOutput = errors.New("produced output")
+
+// outputWatcher records the first line written by a task.
+type outputWatcher struct {
+	mu    sync.Mutex
+	first []byte
+	seen  bool
+}
+
+// observe records line if it is the first, for use with lineWriter.
+func (o *outputWatcher) observe(line []byte) []byte {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.seen {
+		o.seen = true
+		o.first = append([]byte(nil), bytes.TrimSuffix(line, []byte{newLine})...)
+	}
+	return line
+}
+
+// observeStderr is observe, ignoring commands traced by the shell.
+func (o *outputWatcher) observeStderr(line []byte) []byte {
+	if bytes.HasPrefix(line, []byte("+ ")) {
+		return line
+	}
+	return o.observe(line)
+}
+
+// expectSilent fails task if it writes anything to stdout or stderr, whatever
+// its exit code, if it has expect-silent or the runner asserts no output for
+// it, by wrapping the stdout and stderr of e.
+// It returns a function which describes the error of the task if it wrote output.
+// Interactive tasks are left alone, as their output goes to the terminal.
+func (r *Runner) expectSilent(task models.Task, e *Execution) func(error) error {
+	if task.Interactive || !task.ExpectSilent && !r.assertsNoOutput(task.Name) {
+		return func(err error) error { return err }
+	}
+	w := &outputWatcher{}
+	// the underlying writers are closed with the rest of the task output
+	stdout := newLineWriter(struct{ io.Writer }{e.Stdout}, w.observe)
+	stderr := newLineWriter(struct{ io.Writer }{e.Stderr}, w.observeStderr)
+	e.Stdout, e.Stderr = stdout, stderr
+	return func(err error) error {
+		// the last line may not end with a new line
+		err = errors.Join(err, stdout.Close(), stderr.Close())
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if !w.seen {
+			return err
+		}
+		return errors.Join(err, fmt.Errorf("task %s %w: %s", task.Name, ErrProducedOutput, w.first))
+	}
+}
+
+// assertsNoOutput reports whether the runner asserts that the named task
+// writes no output.
+func (r *Runner) assertsNoOutput(name string) bool {
+	for _, n := range r.assertNoOutput {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
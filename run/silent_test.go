@@ -0,0 +1,117 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestAssertNoOutput(t *testing.T) {
+	tests := []struct {
+		name         string
+		task         models.Task
+		assert       []string
+		scriptRunner ScriptRunner
+		expectErr    string
+	}{
+		{
+			name:         "given -task-assert-no-output, should fail with the first line of stdout",
+			task:         models.Task{Name: "fmt", Script: []models.ScriptBlock{{Body: "main.go\nutil.go\n"}}},
+			assert:       []string{"fmt"},
+			scriptRunner: outputScriptRunner{},
+			expectErr:    "task fmt produced output: main.go",
+		},
+		{
+			name:         "given expect-silent, should fail on stderr without a new line",
+			task:         models.Task{Name: "fmt", Script: []models.ScriptBlock{{Body: "+ gofmt -l .\nwarning"}}, ExpectSilent: true},
+			scriptRunner: stderrScriptRunner{},
+			expectErr:    "task fmt produced output: warning",
+		},
+		{
+			name:         "given no output, should succeed",
+			task:         models.Task{Name: "fmt", Script: []models.ScriptBlock{{Body: "gofmt -l ."}}, ExpectSilent: true},
+			scriptRunner: &mockScriptRunner{},
+		},
+		{
+			name:         "given only traced commands, should succeed",
+			task:         models.Task{Name: "fmt", Script: []models.ScriptBlock{{Body: "+ gofmt -l .\n"}}, ExpectSilent: true},
+			scriptRunner: stderrScriptRunner{},
+		},
+		{
+			name:         "given -task-assert-no-output for another task, should succeed",
+			task:         models.Task{Name: "fmt", Script: []models.ScriptBlock{{Body: "main.go\n"}}},
+			assert:       []string{"lint", "vet"},
+			scriptRunner: outputScriptRunner{},
+		},
+		{
+			name:         "given output is allowed, should succeed",
+			task:         models.Task{Name: "fmt", Script: []models.ScriptBlock{{Body: "main.go\n"}}},
+			scriptRunner: outputScriptRunner{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{tt.task}, "", WithAssertNoOutput(tt.assert), WithOutput(io.Discard, io.Discard))
+			if err != nil {
+				t.Fatal(err)
+			}
+			runner.scriptRunner = tt.scriptRunner
+			err = runner.Run(context.Background(), "fmt", nil)
+			if tt.expectErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrProducedOutput) || !strings.Contains(err.Error(), tt.expectErr) {
+				t.Fatalf("expected error %q, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestAssertNoOutputDependencies(t *testing.T) {
+	tests := []struct {
+		name      string
+		assert    []string
+		expectErr string
+	}{
+		{
+			name:   "given -task-assert-no-output for a task, should not fail its dependencies",
+			assert: []string{"fmt"},
+		},
+		{
+			name:      "given -task-assert-no-output for a dependency, should fail it",
+			assert:    []string{"fmt", "gen"},
+			expectErr: "task gen produced output: generated",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{Name: "gen", Script: []models.ScriptBlock{{Body: "generated\n"}}},
+				{Name: "fmt", Script: []models.ScriptBlock{{Body: ""}}, DependsOn: []models.TaskRef{{Name: "gen"}}},
+			}, "", WithAssertNoOutput(tt.assert), WithOutput(io.Discard, io.Discard))
+			if err != nil {
+				t.Fatal(err)
+			}
+			runner.scriptRunner = outputScriptRunner{}
+			err = runner.Run(context.Background(), "fmt", nil)
+			if tt.expectErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrProducedOutput) || !strings.Contains(err.Error(), tt.expectErr) {
+				t.Fatalf("expected error %q, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package run
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// fileSnapshot is the state of a file before a task runs.
+type fileSnapshot struct {
+	modTime time.Time
+	hash    [sha256.Size]byte
+}
+
+// snapshotFiles records the modification time and content hash of every
+// regular file in dir, apart from those in .git directories.
+func snapshotFiles(dir string) (map[string]fileSnapshot, error) {
+	snapshot := map[string]fileSnapshot{}
+	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		snapshot[path] = fileSnapshot{modTime: info.ModTime(), hash: hash}
+		return nil
+	})
+	return snapshot, err
+}
+
+func hashFile(path string) ([sha256.Size]byte, error) {
+	var hash [sha256.Size]byte
+	f, err := os.Open(path)
+	if err != nil {
+		return hash, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return hash, err
+	}
+	copy(hash[:], h.Sum(nil))
+	return hash, nil
+}
+
+// diffSnapshots describes each file which was added, removed or modified
+// between two snapshots of dir, with the change in its content hash.
+func diffSnapshots(dir string, before, after map[string]fileSnapshot) []string {
+	paths := map[string]bool{}
+	for p := range before {
+		paths[p] = true
+	}
+	for p := range after {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+	var changes []string
+	for _, p := range sorted {
+		b, inBefore := before[p]
+		a, inAfter := after[p]
+		name, err := filepath.Rel(dir, p)
+		if err != nil {
+			name = p
+		}
+		switch {
+		case !inBefore:
+			changes = append(changes, fmt.Sprintf("added %s (%s)", name, shortHash(a.hash)))
+		case !inAfter:
+			changes = append(changes, fmt.Sprintf("removed %s (%s)", name, shortHash(b.hash)))
+		case a.hash != b.hash:
+			changes = append(changes, fmt.Sprintf("modified %s (%s -> %s)", name, shortHash(b.hash), shortHash(a.hash)))
+		}
+	}
+	return changes
+}
+
+func shortHash(hash [sha256.Size]byte) string {
+	return hex.EncodeToString(hash[:6])
+}
+
+// snapshotDir snapshots dir if the Runner is configured to detect changes to
+// the directory of each task. The returned function reports every file which
+// the task changed to w.
+func (r *Runner) snapshotDir(dir string, w io.WriteCloser) (report func() error, err error) {
+	if !r.dirSnapshot {
+		return func() error { return nil }, nil
+	}
+	if dir == "" {
+		dir = "."
+	}
+	before, err := snapshotFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot directory: %w", err)
+	}
+	return func() error {
+		after, err := snapshotFiles(dir)
+		if err != nil {
+			return fmt.Errorf("failed to snapshot directory: %w", err)
+		}
+		for _, change := range diffSnapshots(dir, before, after) {
+			if _, err := fmt.Fprintln(w, change); err != nil {
+				return err
+			}
+		}
+		return w.Close()
+	}, nil
+}
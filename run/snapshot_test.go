@@ -0,0 +1,46 @@
+package run
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("same", "same")
+	write("modified", "before")
+	write("removed", "removed")
+	before, err := snapshotFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("same", "same")
+	write("modified", "after")
+	write("added", "added")
+	if err := os.Remove(filepath.Join(dir, "removed")); err != nil {
+		t.Fatal(err)
+	}
+	after, err := snapshotFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := func(s string) string { return shortHash(sha256.Sum256([]byte(s))) }
+	expected := []string{
+		"added added (" + hash("added") + ")",
+		"modified modified (" + hash("before") + " -> " + hash("after") + ")",
+		"removed removed (" + hash("removed") + ")",
+	}
+	got := diffSnapshots(dir, before, after)
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
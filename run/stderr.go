@@ -0,0 +1,68 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/joerdav/xc/models"
+)
+
+// ErrWroteStderr is returned, wrapped, when a task which must not write to
+// stderr does.
+var ErrWroteStderr = errors.New("wrote to stderr")
+
+// stderrWatcher records the first line written to stderr by a task, and
+// cancels the task when it is written.
+type stderrWatcher struct {
+	mu     sync.Mutex
+	first  []byte
+	seen   bool
+	cancel context.CancelFunc
+}
+
+// observe checks each line of stderr, for use with lineWriter.
+// Commands traced by the shell are ignored.
+func (s *stderrWatcher) observe(line []byte) []byte {
+	text := bytes.TrimSuffix(line, []byte{newLine})
+	if bytes.HasPrefix(text, []byte("+ ")) {
+		return line
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.seen {
+		s.seen = true
+		s.first = append([]byte(nil), text...)
+		s.cancel()
+	}
+	return line
+}
+
+// watchStderr fails task as soon as it writes to stderr, if it has
+// fail-on-stderr or the runner aborts on stderr, by wrapping the stderr of e.
+// It returns a context which is cancelled once the task writes to stderr, and
+// a function which describes the error of the task if it did.
+// The stderr of interactive tasks is left alone, as it goes to the terminal.
+func (r *Runner) watchStderr(ctx context.Context, task models.Task, e *Execution) (context.Context, func(error) error, context.CancelFunc) {
+	if task.Interactive || !r.abortOnStderr && !task.FailOnStderr {
+		return ctx, func(err error) error { return err }, func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	w := &stderrWatcher{cancel: cancel}
+	// the underlying writer is closed with the rest of the task output
+	stderr := newLineWriter(struct{ io.Writer }{e.Stderr}, w.observe)
+	e.Stderr = stderr
+	return ctx, func(err error) error {
+		// the last line may not end with a new line
+		flushErr := stderr.Close()
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if !w.seen {
+			return errors.Join(err, flushErr)
+		}
+		return fmt.Errorf("task %s %w: %s", task.Name, ErrWroteStderr, w.first)
+	}, cancel
+}
@@ -0,0 +1,78 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joerdav/xc/models"
+)
+
+// stderrScriptRunner writes the script to stderr, then waits for ctx to be
+// cancelled, or exits successfully after a while.
+type stderrScriptRunner struct{}
+
+func (stderrScriptRunner) Execute(ctx context.Context, e Execution) error {
+	if _, err := io.WriteString(e.Stderr, e.Script); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(100 * time.Millisecond):
+		return nil
+	}
+}
+
+func TestAbortOnStderr(t *testing.T) {
+	tests := []struct {
+		name      string
+		task      models.Task
+		abort     bool
+		expectErr string
+	}{
+		{
+			name:      "given -task-abort-on-stderr, should fail with the first line",
+			task:      models.Task{Name: "build", Script: []models.ScriptBlock{{Body: "+ cc main.c\nwarning: implicit declaration\nnote: here\n"}}},
+			abort:     true,
+			expectErr: "task build wrote to stderr: warning: implicit declaration",
+		},
+		{
+			name:      "given fail-on-stderr, should fail on a line without a new line",
+			task:      models.Task{Name: "build", Script: []models.ScriptBlock{{Body: "warning"}}, FailOnStderr: true},
+			expectErr: "task build wrote to stderr: warning",
+		},
+		{
+			name:  "given only traced commands, should succeed",
+			task:  models.Task{Name: "build", Script: []models.ScriptBlock{{Body: "+ cc main.c\n"}}, FailOnStderr: true},
+			abort: true,
+		},
+		{
+			name: "given stderr is allowed, should succeed",
+			task: models.Task{Name: "build", Script: []models.ScriptBlock{{Body: "warning\n"}}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{tt.task}, "", WithAbortOnStderr(tt.abort), WithOutput(io.Discard, io.Discard))
+			if err != nil {
+				t.Fatal(err)
+			}
+			runner.scriptRunner = stderrScriptRunner{}
+			err = runner.Run(context.Background(), "build", nil)
+			if tt.expectErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrWroteStderr) || !strings.Contains(err.Error(), tt.expectErr) {
+				t.Fatalf("expected error %q, got %v", tt.expectErr, err)
+			}
+		})
+	}
+}
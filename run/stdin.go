@@ -0,0 +1,155 @@
+package run
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joerdav/xc/models"
+)
+
+// taskInput returns the stdin for a task with the environment env, and a
+// function which releases it once the task has finished.
+func (r *Runner) taskInput(task models.Task, env []string) (io.Reader, func() error, error) {
+	var stdin io.Reader = os.Stdin
+	name := task.StdinEnv
+	if name == "" && r.stdinJSON != nil {
+		stdin = bytes.NewReader(r.stdinJSON)
+	} else if name == "" {
+		name = r.stdinEnv
+	}
+	if name != "" {
+		value, ok := lookupEnv(env, name)
+		if !ok {
+			return nil, nil, fmt.Errorf("stdin of %s is read from %s, which is not set", task.Name, name)
+		}
+		stdin = strings.NewReader(value)
+	}
+	closeLog := func() error { return nil }
+	if path := r.stdinLogPath(task); path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open stdin-log of %s: %w", task.Name, err)
+		}
+		tr := &teeReader{r: stdin, f: f}
+		stdin, closeLog = tr, tr.Close
+	}
+	timeout := r.stdinEOFTimeout
+	if task.StdinEOFTimeout > 0 {
+		timeout = task.StdinEOFTimeout
+	}
+	if timeout > 0 {
+		ir := newIdleReader(stdin, timeout)
+		return ir, func() error { return errors.Join(ir.Close(), closeLog()) }, nil
+	}
+	return stdin, closeLog, nil
+}
+
+// stdinLogPath returns the file the stdin of task is copied to, or "" if it is not.
+func (r *Runner) stdinLogPath(task models.Task) string {
+	if task.StdinLog == "" {
+		return r.stdinLog
+	}
+	if filepath.IsAbs(task.StdinLog) {
+		return task.StdinLog
+	}
+	return filepath.Join(r.getExecutionPath(task), task.StdinLog)
+}
+
+// teeReader copies everything read from r to f, which is closed once r is
+// exhausted. Writes to f are not buffered, so it is up to date as the task reads.
+type teeReader struct {
+	r    io.Reader
+	f    *os.File
+	once sync.Once
+	err  error
+}
+
+func (t *teeReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if _, werr := t.f.Write(p[:n]); werr != nil {
+			return n, fmt.Errorf("failed to write stdin-log: %w", werr)
+		}
+	}
+	if err != nil {
+		t.Close() //nolint:errcheck
+	}
+	return n, err
+}
+
+// Close closes the log file, it is safe to call more than once.
+func (t *teeReader) Close() error {
+	t.once.Do(func() {
+		t.err = t.f.Close()
+	})
+	return t.err
+}
+
+// lookupEnv returns the last value of the variable name in env.
+func lookupEnv(env []string, name string) (value string, ok bool) {
+	for i := len(env) - 1; i >= 0; i-- {
+		if k, v, _ := strings.Cut(env[i], "="); k == name {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// idleReader reads from r, returning io.EOF once no data has been read
+// from r for longer than timeout.
+type idleReader struct {
+	pr      *io.PipeReader
+	pw      *io.PipeWriter
+	timer   *time.Timer
+	timeout time.Duration
+	once    sync.Once
+}
+
+func newIdleReader(r io.Reader, timeout time.Duration) *idleReader {
+	pr, pw := io.Pipe()
+	ir := &idleReader{pr: pr, pw: pw, timeout: timeout}
+	ir.timer = time.AfterFunc(timeout, ir.close)
+	go ir.copy(r)
+	return ir
+}
+
+func (ir *idleReader) copy(r io.Reader) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			ir.timer.Reset(ir.timeout)
+			if _, werr := ir.pw.Write(buf[:n]); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			ir.pw.CloseWithError(err)
+			return
+		}
+	}
+}
+
+func (ir *idleReader) close() {
+	ir.once.Do(func() {
+		ir.pw.Close()
+	})
+}
+
+func (ir *idleReader) Read(p []byte) (int, error) {
+	return ir.pr.Read(p)
+}
+
+// Close stops the reader, any data read from r afterwards is discarded.
+func (ir *idleReader) Close() error {
+	ir.timer.Stop()
+	ir.close()
+	return ir.pr.Close()
+}
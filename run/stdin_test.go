@@ -0,0 +1,149 @@
+package run
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestIdleReader(t *testing.T) {
+	src, w := io.Pipe()
+	defer w.Close()
+	r := newIdleReader(src, 50*time.Millisecond)
+	defer r.Close()
+
+	go w.Write([]byte("hello")) //nolint:errcheck
+	done := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- b
+	}()
+	select {
+	case b := <-done:
+		if string(b) != "hello" {
+			t.Fatalf("got %q, want %q", b, "hello")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected stdin to be closed after the timeout")
+	}
+}
+
+func TestTaskInputFromEnv(t *testing.T) {
+	env := []string{"INPUT=old", "OTHER=x", "INPUT=line 1\nline 2"}
+	tests := []struct {
+		name      string
+		task      models.Task
+		stdinEnv  string
+		stdinJSON string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:     "given stdin-env, should read the last value",
+			task:     models.Task{Name: "task", StdinEnv: "INPUT"},
+			expected: "line 1\nline 2",
+		},
+		{
+			name:     "given a default, the attribute takes precedence",
+			task:     models.Task{Name: "task", StdinEnv: "OTHER"},
+			stdinEnv: "INPUT",
+			expected: "x",
+		},
+		{
+			name:     "given a default, should read it",
+			task:     models.Task{Name: "task"},
+			stdinEnv: "OTHER",
+			expected: "x",
+		},
+		{
+			name:      "given JSON, should pass it verbatim",
+			task:      models.Task{Name: "task"},
+			stdinJSON: `{ "key": "val" }`,
+			expected:  `{ "key": "val" }`,
+		},
+		{
+			name:      "given an empty JSON object, should pass it",
+			task:      models.Task{Name: "task"},
+			stdinJSON: "{}",
+			expected:  "{}",
+		},
+		{
+			name:      "given JSON, the attribute takes precedence",
+			task:      models.Task{Name: "task", StdinEnv: "OTHER"},
+			stdinJSON: "{}",
+			expected:  "x",
+		},
+		{
+			name:      "given an unset variable, should error",
+			task:      models.Task{Name: "task", StdinEnv: "MISSING"},
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := Runner{stdinEnv: tt.stdinEnv, stdinEOFTimeout: time.Second}
+			if tt.stdinJSON != "" {
+				WithStdinJSON(tt.stdinJSON)(&r)
+			}
+			stdin, closeStdin, err := r.taskInput(tt.task, env)
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("err=%v, want error=%v", err, tt.expectErr)
+			}
+			if err != nil {
+				return
+			}
+			defer closeStdin()
+			b, err := io.ReadAll(stdin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.expected {
+				t.Fatalf("got %q, want %q", b, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTaskInputLog(t *testing.T) {
+	dir := t.TempDir()
+	global := filepath.Join(dir, "global.log")
+	r := Runner{dir: dir, stdinLog: global}
+	env := []string{"INPUT=typed"}
+	for _, task := range []models.Task{
+		{Name: "first", StdinEnv: "INPUT"},
+		{Name: "second", StdinEnv: "INPUT"},
+		{Name: "own", StdinEnv: "INPUT", Dir: "sub", StdinLog: "own.log"},
+	} {
+		if err := os.MkdirAll(r.getExecutionPath(task), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		stdin, closeStdin, err := r.taskInput(task, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(stdin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != "typed" {
+			t.Fatalf("%s: got %q, want %q", task.Name, b, "typed")
+		}
+		if err := closeStdin(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for path, expected := range map[string]string{global: "typedtyped", filepath.Join(dir, "sub", "own.log"): "typed"} {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != expected {
+			t.Errorf("%s: got %q, want %q", path, b, expected)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/joerdav/xc/models"
+)
+
+// TaskSummary describes a task which has finished, for the template given to WithSummaryLine.
+type TaskSummary struct {
+	Task string
+	// Status is one of succeeded, failed, timed out or cancelled.
+	Status   string
+	Duration time.Duration
+	ExitCode int
+	// Error is the error the task failed with, or "" if it succeeded.
+	Error string
+	// OutputLines is the number of lines written by the task to stdout and stderr.
+	OutputLines int
+}
+
+func newTaskSummary(task string, d time.Duration, lines int, err error) TaskSummary {
+	s := TaskSummary{
+		Task:        task,
+		Status:      "succeeded",
+		Duration:    d.Round(time.Millisecond),
+		ExitCode:    exitCode(err),
+		OutputLines: lines,
+	}
+	if err == nil {
+		return s
+	}
+	s.Error = err.Error()
+	switch {
+	case errors.Is(err, ErrTimedOut):
+		s.Status = "timed out"
+	case errors.Is(err, context.Canceled):
+		s.Status = "cancelled"
+	default:
+		s.Status = "failed"
+	}
+	return s
+}
+
+// lineCounter counts the lines written to it by a task.
+type lineCounter struct {
+	mu    sync.Mutex
+	lines int
+	// partial is set if the last write did not end with a new line.
+	partial bool
+}
+
+func (c *lineCounter) writer(w io.Writer) io.Writer {
+	return countingWriter{c, w}
+}
+
+func (c *lineCounter) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.partial {
+		return c.lines + 1
+	}
+	return c.lines
+}
+
+type countingWriter struct {
+	c *lineCounter
+	w io.Writer
+}
+
+func (cw countingWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		cw.c.mu.Lock()
+		cw.c.lines += bytes.Count(p, []byte{newLine})
+		cw.c.partial = p[len(p)-1] != newLine
+		cw.c.mu.Unlock()
+	}
+	return cw.w.Write(p)
+}
+
+// summarise wraps the output of task to count its lines, if there is a
+// summary line template. The returned function writes the summary line of the
+// task to stdout, it must be called once the task has finished.
+// The output of interactive tasks is left alone, as it goes to the terminal.
+func (r *Runner) summarise(task models.Task, stdout, stderr io.Writer) (io.Writer, io.Writer, func(error) error) {
+	if r.summaryLine == nil {
+		return stdout, stderr, func(error) error { return nil }
+	}
+	start := time.Now()
+	c := &lineCounter{}
+	if !task.Interactive {
+		stdout, stderr = c.writer(stdout), c.writer(stderr)
+	}
+	return stdout, stderr, func(taskErr error) error {
+		var b bytes.Buffer
+		if err := r.summaryLine.Execute(&b, newTaskSummary(task.Name, time.Since(start), c.count(), taskErr)); err != nil {
+			return fmt.Errorf("failed to write summary line of task %s: %w", task.Name, err)
+		}
+		if b.Len() == 0 || b.Bytes()[b.Len()-1] != newLine {
+			b.WriteByte(newLine)
+		}
+		_, err := r.stdout.Write(b.Bytes())
+		return err
+	}
+}
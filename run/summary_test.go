@@ -0,0 +1,53 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/joerdav/xc/models"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// resultScriptRunner writes the script to stdout, then returns err.
+type resultScriptRunner struct {
+	err error
+}
+
+func (r resultScriptRunner) Execute(ctx context.Context, e Execution) error {
+	if err := (outputScriptRunner{}).Execute(ctx, e); err != nil {
+		return err
+	}
+	return r.err
+}
+
+func TestSummaryLine(t *testing.T) {
+	tmpl := template.Must(template.New("summary").Parse("{{.Task}} {{.Status}} exit={{.ExitCode}} lines={{.OutputLines}} error={{.Error}}"))
+	tests := []struct {
+		name   string
+		err    error
+		expect string
+	}{
+		{name: "given a task succeeds, should summarise it", expect: "task succeeded exit=0 lines=2 error=\n"},
+		{name: "given a task fails, should summarise the failure", err: interp.NewExitStatus(3), expect: "task failed exit=3 lines=2 error=exit status 3\n"},
+		{name: "given a task is cancelled, should summarise it as cancelled", err: context.Canceled, expect: "task cancelled exit=1 lines=2 error=context canceled\n"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{{Name: "task", Script: []models.ScriptBlock{{Body: "one\ntwo\n"}}}}, "", WithSummaryLine(tmpl))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var stdout bytes.Buffer
+			runner.stdout, runner.stderr = &stdout, &bytes.Buffer{}
+			runner.scriptRunner = resultScriptRunner{tt.err}
+			runner.Run(context.Background(), "task", nil)
+			if !strings.HasSuffix(stdout.String(), "\n"+tt.expect) {
+				t.Fatalf("expected summary %q, got %q", tt.expect, stdout.String())
+			}
+		})
+	}
+}
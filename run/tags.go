@@ -0,0 +1,37 @@
+package run
+
+import (
+	"context"
+	"sort"
+)
+
+// tagLimits limits how many tasks with each tag run at once, by tag.
+type tagLimits map[string]chan struct{}
+
+// acquire waits until there is a free slot for each of tags which has a limit,
+// returning a function which releases them. Slots are taken in order of tag,
+// so that tasks sharing several tags cannot deadlock.
+func (l tagLimits) acquire(ctx context.Context, tags []string) (release func(), err error) {
+	sorted := append([]string(nil), tags...)
+	sort.Strings(sorted)
+	var held []chan struct{}
+	release = func() {
+		for _, slots := range held {
+			<-slots
+		}
+	}
+	for i, tag := range sorted {
+		slots, ok := l[tag]
+		if !ok || i > 0 && sorted[i-1] == tag {
+			continue
+		}
+		select {
+		case slots <- struct{}{}:
+			held = append(held, slots)
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
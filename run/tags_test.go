@@ -0,0 +1,76 @@
+package run
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joerdav/xc/models"
+)
+
+// concurrencyScriptRunner records the most scripts which ran at once.
+type concurrencyScriptRunner struct {
+	mu            sync.Mutex
+	running, most int
+}
+
+func (r *concurrencyScriptRunner) Execute(ctx context.Context, e Execution) error {
+	r.mu.Lock()
+	r.running++
+	if r.running > r.most {
+		r.most = r.running
+	}
+	r.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	r.mu.Lock()
+	r.running--
+	r.mu.Unlock()
+	return nil
+}
+
+func TestTagLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int
+		expect int
+	}{
+		{name: "given a limit of 1, should run tagged tasks one at a time", limit: 1, expect: 1},
+		{name: "given a limit of 2, should run two tagged tasks at once", limit: 2, expect: 2},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{Name: "a", Script: []models.ScriptBlock{{Body: "a"}}, Tags: []string{"deploy"}},
+				{Name: "b", Script: []models.ScriptBlock{{Body: "b"}}, Tags: []string{"deploy", "build"}},
+				{Name: "c", Script: []models.ScriptBlock{{Body: "c"}}, Tags: []string{"build", "deploy"}},
+				{Name: "all", DependsOn: []models.TaskRef{{Name: "a"}, {Name: "b"}, {Name: "c"}}, DepsBehaviour: models.DependencyBehaviourAsync},
+			}, "", WithTagLimit("deploy", tt.limit), WithTagLimit("build", 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			scriptRunner := &concurrencyScriptRunner{}
+			runner.scriptRunner = scriptRunner
+			if err := runner.Run(context.Background(), "all", nil); err != nil {
+				t.Fatal(err)
+			}
+			if scriptRunner.most != tt.expect {
+				t.Fatalf("expected at most %d tasks at once, got %d", tt.expect, scriptRunner.most)
+			}
+		})
+	}
+	t.Run("given the context is cancelled while waiting, should return", func(t *testing.T) {
+		limits := tagLimits{"deploy": make(chan struct{}, 1)}
+		release, err := limits.acquire(context.Background(), []string{"deploy"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer release()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := limits.acquire(ctx, []string{"deploy"}); err == nil {
+			t.Fatal("expected an error got nil")
+		}
+	})
+}
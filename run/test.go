@@ -0,0 +1,71 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/joerdav/xc/models"
+)
+
+// ErrTestsFailed is returned by Test if any test task fails.
+var ErrTestsFailed = errors.New("tests failed")
+
+// Test runs every test task in tasks, reporting the results to w in the
+// style of `go test -v`. Tasks with the test attribute have their output
+// captured, and shown only if they fail.
+// Each test is run by a new Runner, created with opts.
+func Test(ctx context.Context, tasks models.Tasks, dir string, w io.Writer, opts ...RunnerOption) error {
+	var tests models.Tasks
+	for _, t := range tasks {
+		if t.IsTest() {
+			tests = append(tests, t)
+		}
+	}
+	if len(tests) == 0 {
+		fmt.Fprintln(w, "no test tasks found")
+		return nil
+	}
+	failed := 0
+	for _, t := range tests {
+		fmt.Fprintf(w, "=== RUN   %s\n", t.Name)
+		var output bytes.Buffer
+		// hidden tests are still run, as they are chosen by xc rather than by name
+		testOpts := append(opts[:len(opts):len(opts)], WithRunHidden(true))
+		if t.Test {
+			out := &syncWriter{w: &output}
+			testOpts = append(testOpts, WithOutput(out, out))
+		}
+		runner, err := NewRunner(tasks, dir, testOpts...)
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		err = runner.Run(ctx, t.Name, nil)
+		elapsed := time.Since(start).Seconds()
+		if err == nil {
+			fmt.Fprintf(w, "--- PASS: %s (%.2fs)\n", t.Name, elapsed)
+			continue
+		}
+		failed++
+		fmt.Fprintf(w, "--- FAIL: %s (%.2fs)\n", t.Name, elapsed)
+		fmt.Fprintf(w, "%s\n", indent(output.String()+err.Error()))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintln(w, "FAIL")
+		return fmt.Errorf("%w: %d of %d", ErrTestsFailed, failed, len(tests))
+	}
+	fmt.Fprintln(w, "PASS")
+	return nil
+}
+
+func indent(s string) string {
+	return "    " + strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n    ")
+}
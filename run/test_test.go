@@ -0,0 +1,71 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestTest(t *testing.T) {
+	tests := []struct {
+		name        string
+		tasks       models.Tasks
+		expectErr   bool
+		contains    []string
+		notContains []string
+	}{
+		{
+			name: "given passing tests, should report PASS",
+			tasks: models.Tasks{
+				{Name: "smoke_test", Script: []models.ScriptBlock{{Body: "echo smoke"}}},
+				{Name: "test_unit", Script: []models.ScriptBlock{{Body: "echo unit"}}},
+				{Name: "build", Script: []models.ScriptBlock{{Body: "echo build"}}},
+			},
+			contains:    []string{"--- PASS: smoke_test", "--- PASS: test_unit", "PASS\n"},
+			notContains: []string{"build"},
+		},
+		{
+			name: "given a failing test with the test attribute, should show its output",
+			tasks: models.Tasks{
+				{Name: "db", Test: true, Script: []models.ScriptBlock{{Body: "echo connecting\nexit 2"}}},
+				{Name: "quiet", Test: true, Script: []models.ScriptBlock{{Body: "echo hidden"}}},
+			},
+			expectErr:   true,
+			contains:    []string{"--- FAIL: db", "    ", "connecting", "--- PASS: quiet", "FAIL\n"},
+			notContains: []string{"hidden"},
+		},
+		{
+			name:     "given no tests, should say so",
+			tasks:    models.Tasks{{Name: "build", Script: []models.ScriptBlock{{Body: "echo build"}}}},
+			contains: []string{"no test tasks found"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			// send the output of tests without the test attribute to the report too
+			err := Test(context.Background(), tt.tasks, "", &out, WithOutput(&out, &out))
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("err=%v, want error=%v", err, tt.expectErr)
+			}
+			if err != nil && !errors.Is(err, ErrTestsFailed) {
+				t.Fatalf("expected ErrTestsFailed, got %v", err)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(out.String(), s) {
+					t.Errorf("expected output to contain %q, got:\n%s", s, out.String())
+				}
+			}
+			for _, s := range tt.notContains {
+				if strings.Contains(out.String(), s) {
+					t.Errorf("expected output not to contain %q, got:\n%s", s, out.String())
+				}
+			}
+		})
+	}
+}
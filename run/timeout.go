@@ -0,0 +1,42 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/joerdav/xc/models"
+)
+
+// ErrTimedOut is returned, wrapped, when a task is stopped by its timeout.
+var ErrTimedOut = errors.New("timed out")
+
+// timeout returns how long task may run for, or 0 if it has no limit.
+func (r *Runner) timeout(task models.Task) time.Duration {
+	switch {
+	case task.Timeout == models.NoTimeout:
+		return 0
+	case task.Timeout > 0:
+		return task.Timeout
+	default:
+		return r.defaultTimeout
+	}
+}
+
+// withTimeout returns a context which is cancelled once task has run for
+// its timeout, and a function which describes an error returned by the task
+// as a timeout if it was stopped by it.
+func (r *Runner) withTimeout(ctx context.Context, task models.Task) (context.Context, func(error) error, context.CancelFunc) {
+	timeout := r.timeout(task)
+	if timeout <= 0 {
+		return ctx, func(err error) error { return err }, func() {}
+	}
+	taskCtx, cancel := context.WithTimeout(ctx, timeout)
+	return taskCtx, func(err error) error {
+		if err == nil || ctx.Err() != nil || !errors.Is(taskCtx.Err(), context.DeadlineExceeded) {
+			return err
+		}
+		return fmt.Errorf("task %s %w after %s: %v", task.Name, ErrTimedOut, timeout, err)
+	}, cancel
+}
@@ -0,0 +1,87 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		name           string
+		timeout        time.Duration
+		defaultTimeout time.Duration
+		expected       time.Duration
+	}{
+		{name: "given no timeouts, should not limit", expected: 0},
+		{name: "given a default, should use it", defaultTimeout: time.Minute, expected: time.Minute},
+		{name: "given a task timeout, should take precedence", timeout: time.Second, defaultTimeout: time.Minute, expected: time.Second},
+		{name: "given timeout none, should disable the default", timeout: models.NoTimeout, defaultTimeout: time.Minute, expected: 0},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			r := Runner{defaultTimeout: tt.defaultTimeout}
+			if got := r.timeout(models.Task{Timeout: tt.timeout}); got != tt.expected {
+				t.Fatalf("got %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunWithTimeout(t *testing.T) {
+	tests := []struct {
+		name           string
+		timeout        time.Duration
+		defaultTimeout time.Duration
+	}{
+		{name: "given a task timeout, should stop the task", timeout: 10 * time.Millisecond},
+		{name: "given a default timeout, should stop the task", defaultTimeout: 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{Name: "task", Script: []models.ScriptBlock{{Body: "main"}}, Timeout: tt.timeout, Cleanup: "cleanup", Interactive: true},
+			}, "", WithDefaultTimeout(tt.defaultTimeout))
+			if err != nil {
+				t.Fatal(err)
+			}
+			scriptRunner := &blockingScriptRunner{script: "main", started: make(chan struct{})}
+			runner.scriptRunner = scriptRunner
+			err = runner.Run(context.Background(), "task", nil)
+			if !errors.Is(err, ErrTimedOut) {
+				t.Fatalf("expected ErrTimedOut, got %v", err)
+			}
+			if !strings.Contains(err.Error(), "task task timed out after 10ms") {
+				t.Fatalf("expected a descriptive error, got %v", err)
+			}
+			if len(scriptRunner.others) != 1 || !strings.Contains(strings.Join(scriptRunner.others[0].Env, ","), "XC_KILL_REASON=timeout") {
+				t.Fatalf("expected cleanup to run with the timeout as the reason, got %v", scriptRunner.others)
+			}
+		})
+	}
+	t.Run("given the run is cancelled, should not report a timeout", func(t *testing.T) {
+		runner, err := NewRunner(models.Tasks{
+			{Name: "task", Script: []models.ScriptBlock{{Body: "main"}}, Timeout: time.Hour, Interactive: true},
+		}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptRunner := &blockingScriptRunner{script: "main", started: make(chan struct{})}
+		runner.scriptRunner = scriptRunner
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-scriptRunner.started
+			cancel()
+		}()
+		err = runner.Run(ctx, "task", nil)
+		if !errors.Is(err, context.Canceled) || errors.Is(err, ErrTimedOut) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	})
+}
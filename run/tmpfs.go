@@ -0,0 +1,153 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/joerdav/xc/models"
+	"github.com/joerdav/xc/state"
+)
+
+// tmpfsWorkDir copies dir into a memory-backed directory if task should run
+// in one, and returns the directory the task should run in.
+// The returned function copies the files which the task changed back to dir,
+// unless the Runner is configured not to, and removes the copy.
+func (r *Runner) tmpfsWorkDir(task models.Task, dir string) (workDir string, finish func() error, err error) {
+	if !r.tmpfs && !task.Tmpfs {
+		return dir, func() error { return nil }, nil
+	}
+	if dir == "" {
+		dir = "."
+	}
+	root, err := tmpfsRoot()
+	if err != nil {
+		return "", nil, fmt.Errorf("tmpfs for %s: %w", task.Name, err)
+	}
+	tmp, err := os.MkdirTemp(root, state.TempFilePrefix+"tmpfs_")
+	if err != nil {
+		return "", nil, fmt.Errorf("tmpfs for %s: %w", task.Name, err)
+	}
+	before, err := copyWorkDir(dir, tmp)
+	if err != nil {
+		return "", nil, errors.Join(fmt.Errorf("tmpfs for %s: failed to copy %s: %w", task.Name, dir, err), os.RemoveAll(tmp))
+	}
+	return tmp, func() error {
+		var err error
+		if !r.noSyncBack {
+			err = syncBack(tmp, dir, before)
+		}
+		if err != nil {
+			err = fmt.Errorf("tmpfs for %s: failed to copy changes back to %s: %w", task.Name, dir, err)
+		}
+		return errors.Join(err, os.RemoveAll(tmp))
+	}, nil
+}
+
+// copyWorkDir copies the files in src to dst, apart from .git which is linked
+// so that git still works in dst, and returns a snapshot of the copied files.
+func copyWorkDir(src, dst string) (map[string]fileSnapshot, error) {
+	err := filepath.Walk(src, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.Name() == ".git" && rel == ".git":
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(abs, target); err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshotFiles(dst)
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		return errors.Join(err, out.Close())
+	}
+	return out.Close()
+}
+
+// syncBack applies the changes made to the regular files in tmp since before
+// was taken to dir: added and modified files are copied, removed files are removed.
+func syncBack(tmp, dir string, before map[string]fileSnapshot) error {
+	after, err := snapshotFiles(tmp)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for path, a := range after {
+		if b, ok := before[path]; ok && b.hash == a.hash {
+			continue
+		}
+		rel, err := filepath.Rel(tmp, path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		target := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		errs = append(errs, copyFile(path, target, info.Mode().Perm()))
+	}
+	for path := range before {
+		if _, ok := after[path]; ok {
+			continue
+		}
+		rel, err := filepath.Rel(tmp, path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, rel)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
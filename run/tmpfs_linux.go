@@ -0,0 +1,24 @@
+package run
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// shmDir is where linux mounts a tmpfs which any user can write to.
+const shmDir = "/dev/shm"
+
+// tmpfsMagic is the filesystem type of tmpfs reported by statfs.
+const tmpfsMagic = 0x01021994
+
+// tmpfsRoot returns a memory-backed directory in which task directories can be copied.
+func tmpfsRoot() (string, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(shmDir, &fs); err != nil {
+		return "", fmt.Errorf("no tmpfs available: %w", err)
+	}
+	if fs.Type != tmpfsMagic {
+		return "", fmt.Errorf("no tmpfs available: %s is not a tmpfs", shmDir)
+	}
+	return shmDir, nil
+}
@@ -0,0 +1,52 @@
+package run
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+// dirScriptRunner writes the directory each task runs in to out.txt within it.
+type dirScriptRunner struct {
+	dirs []string
+}
+
+func (r *dirScriptRunner) Execute(ctx context.Context, e Execution) error {
+	r.dirs = append(r.dirs, e.Dir)
+	return os.WriteFile(filepath.Join(e.Dir, "out.txt"), []byte(e.Dir), 0o644)
+}
+
+func TestRunInTmpfs(t *testing.T) {
+	if _, err := tmpfsRoot(); err != nil {
+		t.Skip(err)
+	}
+	for _, noSyncBack := range []bool{false, true} {
+		dir := t.TempDir()
+		runner, err := NewRunner(models.Tasks{
+			{Name: "task", Script: []models.ScriptBlock{{Body: "somecmd"}}, Tmpfs: true},
+		}, dir, WithTmpfs(false, noSyncBack))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scriptRunner := &dirScriptRunner{}
+		runner.scriptRunner = scriptRunner
+		if err := runner.Run(context.Background(), "task", nil); err != nil {
+			t.Fatal(err)
+		}
+		workDir := scriptRunner.dirs[0]
+		if !strings.HasPrefix(workDir, shmDir) {
+			t.Fatalf("expected task to run in %s, ran in %s", shmDir, workDir)
+		}
+		if _, err := os.Stat(workDir); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed, got %v", workDir, err)
+		}
+		_, err = os.Stat(filepath.Join(dir, "out.txt"))
+		if synced := err == nil; synced == noSyncBack {
+			t.Fatalf("noSyncBack=%v, but out.txt synced=%v", noSyncBack, synced)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package run
+
+import "errors"
+
+// tmpfsRoot is only supported on linux.
+func tmpfsRoot() (string, error) {
+	return "", errors.New("tmpfs is only supported on linux")
+}
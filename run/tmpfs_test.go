@@ -0,0 +1,62 @@
+package run
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyWorkDirAndSyncBack(t *testing.T) {
+	dir, tmp := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(dir, "same.txt"), "same")
+	writeFile(t, filepath.Join(dir, "changed.txt"), "before")
+	writeFile(t, filepath.Join(dir, "removed.txt"), "removed")
+	writeFile(t, filepath.Join(dir, ".git", "HEAD"), "ref: refs/heads/main")
+	before, err := copyWorkDir(dir, tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link, err := os.Readlink(filepath.Join(tmp, ".git")); err != nil || link != filepath.Join(dir, ".git") {
+		t.Fatalf("expected .git to be linked, got %q, %v", link, err)
+	}
+	writeFile(t, filepath.Join(tmp, "changed.txt"), "after")
+	writeFile(t, filepath.Join(tmp, "sub", "added.txt"), "added")
+	if err := os.Remove(filepath.Join(tmp, "removed.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := syncBack(tmp, dir, before); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"same.txt":      "same",
+		"changed.txt":   "after",
+		"sub/added.txt": "added",
+		".git/HEAD":     "ref: refs/heads/main",
+		"removed.txt":   "",
+	}
+	for name, content := range expected {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if content == "" {
+			if !os.IsNotExist(err) {
+				t.Errorf("expected %s to be removed, got %v", name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != content {
+			t.Errorf("%s: got %q, want %q", name, b, content)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,38 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/joerdav/xc/models"
+)
+
+// validateInputs runs the validate-inputs script of task with its inputs set.
+// Validation fails if the script exits non-zero, or writes to stdout, in which
+// case the output is used as the error message.
+func (r *Runner) validateInputs(ctx context.Context, task models.Task, env, args []string) error {
+	if task.ValidateInputs == "" {
+		return nil
+	}
+	var stdout bytes.Buffer
+	err := r.scriptRunner.Execute(ctx, Execution{
+		Script: task.ValidateInputs,
+		Env:    env,
+		Args:   args,
+		Dir:    r.getExecutionPath(task),
+		Stdin:  strings.NewReader(""),
+		Stdout: &stdout,
+		Stderr: io.Discard,
+	})
+	msg := strings.TrimSpace(stdout.String())
+	switch {
+	case msg != "":
+		return fmt.Errorf("invalid inputs for %s: %s", task.Name, msg)
+	case err != nil:
+		return fmt.Errorf("invalid inputs for %s: %w", task.Name, err)
+	}
+	return nil
+}
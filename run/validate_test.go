@@ -0,0 +1,57 @@
+package run
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestValidateInputs(t *testing.T) {
+	tests := []struct {
+		name      string
+		validate  string
+		input     string
+		expectErr string
+	}{
+		{
+			name:     "given valid inputs, should run the task",
+			validate: `test "$VERSION" = v1 || echo "VERSION must be v1"`,
+			input:    "v1",
+		},
+		{
+			name:      "given the validator writes a message, should fail with it",
+			validate:  `test "$VERSION" = v1 || echo "VERSION must be v1"`,
+			input:     "v2",
+			expectErr: "invalid inputs for release: VERSION must be v1",
+		},
+		{
+			name:      "given the validator exits non-zero, should fail",
+			validate:  `exit 3`,
+			input:     "v1",
+			expectErr: "invalid inputs for release: exit status 3",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			runner, err := NewRunner(models.Tasks{
+				{Name: "release", Script: []models.ScriptBlock{{Body: "true"}}, Inputs: []models.Input{{Name: "VERSION"}}, ValidateInputs: tt.validate},
+			}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = runner.Run(context.Background(), "release", []string{tt.input})
+			if tt.expectErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectErr) {
+				t.Fatalf("err=%v, want %q", err, tt.expectErr)
+			}
+		})
+	}
+}
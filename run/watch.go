@@ -0,0 +1,220 @@
+package run
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// watchDebounce is how long watched files must stop changing before the task is run again.
+const watchDebounce = 200 * time.Millisecond
+
+// watchInterval is how often watched files are checked for changes. Each
+// check walks the directories which the watch patterns could match.
+const watchInterval = 500 * time.Millisecond
+
+// watchedFile is the state of a file matching a watch pattern.
+type watchedFile struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watch runs the named task with inputs, as Run does, then runs it again each
+// time a file matching its watch attribute changes, until ctx is cancelled.
+// A run which is still in progress when files change is cancelled first.
+// Failures are written to stderr rather than ending the watch. Once the task
+// has been run again as many times as its max-restarts attribute, or
+// WithMaxRestarts, allows, the next change ends the watch with an error.
+// Files are polled every watchInterval, rather than using file system
+// notifications, so only directories which a pattern could match are walked.
+func (r *Runner) Watch(ctx context.Context, name string, inputs []string) error {
+	task, ok := r.tasks.Get(name)
+	if !ok {
+		return fmt.Errorf("task %s not found", name)
+	}
+	if len(task.Watch) == 0 {
+		return fmt.Errorf("task %s has no watch attribute", task.Name)
+	}
+	maxRestarts := task.MaxRestarts
+	if maxRestarts == 0 {
+		maxRestarts = r.maxRestarts
+	}
+	dir := r.getExecutionPath(task)
+	files, err := watchedFiles(dir, task.Watch)
+	if err != nil {
+		return err
+	}
+	for restarts := 0; ; restarts++ {
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := r.Run(runCtx, name, inputs); err != nil && runCtx.Err() == nil {
+				fmt.Fprintf(r.stderr, "task %q failed: %v\n", task.Name, err)
+			}
+		}()
+		var changed string
+		files, changed, err = waitForChange(ctx, dir, task.Watch, files)
+		cancel()
+		<-done
+		if err != nil || changed == "" {
+			return err
+		}
+		if maxRestarts > 0 && restarts == maxRestarts {
+			return fmt.Errorf("task %s: %s changed after %d restarts, the most allowed", task.Name, changed, restarts)
+		}
+		fmt.Fprintf(r.stderr, "task %q: %s changed, running again\n", task.Name, changed)
+		// tasks with `run: once` run again along with the watched task
+		r.alreadRanMu.Lock()
+		r.alreadyRan = map[string]bool{}
+		r.alreadRanMu.Unlock()
+	}
+}
+
+// waitForChange polls the files in dir matching patterns until one differs
+// from files, and then until they have stopped changing, returning their new
+// state and the first file which changed. If ctx is cancelled first, the
+// changed file is "".
+func waitForChange(ctx context.Context, dir string, patterns []string, files map[string]watchedFile) (map[string]watchedFile, string, error) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	var changed string
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return files, "", nil
+		case <-settled:
+			return files, changed, nil
+		case <-ticker.C:
+			current, err := watchedFiles(dir, patterns)
+			if err != nil {
+				return files, "", err
+			}
+			if p := changedFile(files, current); p != "" {
+				if changed == "" {
+					changed = p
+				}
+				files = current
+				settled = time.After(watchDebounce)
+			}
+		}
+	}
+}
+
+// watchedFiles returns the state of the files in dir, apart from those in
+// .git directories, whose paths relative to dir match any of patterns.
+// Directories which none of patterns could match files in are not walked.
+func watchedFiles(dir string, patterns []string) (map[string]watchedFile, error) {
+	files := map[string]watchedFile{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			// removed while walking, it will be missing from the next walk too
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel != "." && (d.Name() == ".git" || !matchesAnyDir(patterns, rel)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		for _, pattern := range patterns {
+			if matchGlob(pattern, rel) {
+				info, err := d.Info()
+				if err != nil {
+					return nil
+				}
+				files[rel] = watchedFile{modTime: info.ModTime(), size: info.Size()}
+				break
+			}
+		}
+		return nil
+	})
+	return files, err
+}
+
+// changedFile returns a file which was added, removed or modified between
+// before and after, or "" if none were.
+func changedFile(before, after map[string]watchedFile) string {
+	for p, f := range after {
+		if b, ok := before[p]; !ok || b != f {
+			return p
+		}
+	}
+	for p := range before {
+		if _, ok := after[p]; !ok {
+			return p
+		}
+	}
+	return ""
+}
+
+// matchGlob reports whether the slash separated name matches pattern, where
+// a ** element of pattern matches any number of directories.
+func matchGlob(pattern, name string) bool {
+	return matchElems(strings.Split(strings.TrimPrefix(pattern, "./"), "/"), strings.Split(name, "/"))
+}
+
+// matchesAnyDir reports whether any of patterns could match a file in the
+// slash separated directory dir, or in the directories below it.
+func matchesAnyDir(patterns []string, dir string) bool {
+	for _, pattern := range patterns {
+		if matchDir(strings.Split(strings.TrimPrefix(pattern, "./"), "/"), strings.Split(dir, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchDir(pattern, dir []string) bool {
+	for len(dir) > 0 {
+		if len(pattern) == 0 {
+			return false
+		}
+		if pattern[0] == "**" {
+			return true
+		}
+		if ok, _ := path.Match(pattern[0], dir[0]); !ok {
+			return false
+		}
+		pattern, dir = pattern[1:], dir[1:]
+	}
+	return len(pattern) > 0
+}
+
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,145 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joerdav/xc/models"
+)
+
+// countingScriptRunner sends on runs each time a script is executed.
+type countingScriptRunner struct {
+	runs chan struct{}
+}
+
+func (c countingScriptRunner) Execute(ctx context.Context, e Execution) error {
+	c.runs <- struct{}{}
+	return nil
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "main.go"), "package main\n")
+	var stderr bytes.Buffer
+	runner, err := NewRunner(models.Tasks{
+		{Name: "build", Script: []models.ScriptBlock{{Body: "go build"}}, Watch: []string{"**/*.go"}},
+	}, dir, WithOutput(&bytes.Buffer{}, &stderr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := make(chan struct{})
+	runner.scriptRunner = countingScriptRunner{runs: runs}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- runner.Watch(ctx, "build", nil)
+	}()
+	expectRun := func() {
+		t.Helper()
+		select {
+		case <-runs:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the task to run")
+		}
+	}
+	expectRun()
+	writeFile(t, filepath.Join(dir, "README.md"), "not watched\n")
+	writeFile(t, filepath.Join(dir, "src", "main.go"), "package main\n\nfunc main() {}\n")
+	expectRun()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(stderr.Bytes(), []byte("src/main.go changed")) {
+		t.Fatalf("stderr=%q, want it to name the changed file", stderr.String())
+	}
+}
+
+func TestWatchMaxRestarts(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "main.go"), "package main\n")
+	runner, err := NewRunner(models.Tasks{
+		{Name: "build", Script: []models.ScriptBlock{{Body: "go build"}}, Watch: []string{"*.go"}, MaxRestarts: 1},
+	}, dir, WithOutput(&bytes.Buffer{}, &bytes.Buffer{}), WithMaxRestarts(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := make(chan struct{}, 10)
+	runner.scriptRunner = countingScriptRunner{runs: runs}
+	done := make(chan error)
+	go func() {
+		done <- runner.Watch(context.Background(), "build", nil)
+	}()
+	waitForRuns := func(n int) {
+		t.Helper()
+		deadline := time.After(5 * time.Second)
+		for len(runs) < n {
+			select {
+			case err := <-done:
+				t.Fatalf("expected %d runs before the watch ended with %v", n, err)
+			case <-deadline:
+				t.Fatalf("expected %d runs, got %d", n, len(runs))
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+	waitForRuns(1)
+	writeFile(t, filepath.Join(dir, "main.go"), "package main\n\nfunc main() {}\n")
+	waitForRuns(2)
+	writeFile(t, filepath.Join(dir, "main.go"), "package main\n")
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "after 1 restarts") {
+			t.Fatalf("expected the restart limit error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the watch to end once the task reached max-restarts")
+	}
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %d", len(runs))
+	}
+}
+
+func TestMatchesAnyDir(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		dir      string
+		expected bool
+	}{
+		{[]string{"**/*.go"}, "vendor/a", true},
+		{[]string{"go.mod"}, "vendor", false},
+		{[]string{"src/*.go", "go.mod"}, "src", true},
+		{[]string{"src/*.go"}, "src/a", false},
+		{[]string{"src/*/*.go"}, "src/a", true},
+		{[]string{"./src/**"}, "node_modules", false},
+		{[]string{"src/**"}, "src/a/b", true},
+	}
+	for _, tt := range tests {
+		if got := matchesAnyDir(tt.patterns, tt.dir); got != tt.expected {
+			t.Errorf("matchesAnyDir(%q, %q)=%v, want %v", tt.patterns, tt.dir, got, tt.expected)
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		expected      bool
+	}{
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "cmd/xc/main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"./go.mod", "go.mod", true},
+		{"src/**", "src/a/b.txt", true},
+		{"go.mod", "vendor/go.mod", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.expected {
+			t.Errorf("matchGlob(%q, %q)=%v, want %v", tt.pattern, tt.name, got, tt.expected)
+		}
+	}
+}
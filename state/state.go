@@ -0,0 +1,124 @@
+// Package state manages the files xc keeps between runs.
+//
+// Per-task state is stored in directories under .xc, next to the markdown
+// file containing the tasks, e.g. .xc/profiles/build-mem.csv.
+// Each entry in these directories is named after the task it belongs to,
+// either exactly or followed by a "-" or ".".
+package state
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/joerdav/xc/models"
+)
+
+const (
+	// DirName is the name of the directory xc stores state in.
+	DirName = ".xc"
+	// TempFilePrefix is the prefix of temporary files created by xc.
+	TempFilePrefix = "xc_"
+	// tempFileMaxAge is how old a temporary file must be before it is
+	// assumed to be left over from a crashed run.
+	tempFileMaxAge = 24 * time.Hour
+)
+
+// Dir returns the directory for a kind of state, relative to root.
+func Dir(root, kind string) string {
+	return filepath.Join(root, DirName, kind)
+}
+
+// FileName returns the name used for the state of a task,
+// with path separators replaced.
+func FileName(task string) string {
+	return strings.NewReplacer("/", "_", `\`, "_").Replace(task)
+}
+
+// GC removes state belonging to tasks which no longer exist, and temporary
+// files left behind by crashed runs.
+// Each removed path is written to w, if dryRun is set nothing is removed.
+func GC(root string, tasks models.Tasks, dryRun bool, w io.Writer) error {
+	stale, err := staleEntries(root, tasks)
+	if err != nil {
+		return err
+	}
+	temp, err := staleTempFiles(os.TempDir(), time.Now())
+	if err != nil {
+		return err
+	}
+	for _, p := range append(stale, temp...) {
+		if dryRun {
+			fmt.Fprintf(w, "would remove %s\n", p)
+			continue
+		}
+		fmt.Fprintf(w, "removing %s\n", p)
+		if err := os.RemoveAll(p); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+func staleEntries(root string, tasks models.Tasks) ([]string, error) {
+	kinds, err := os.ReadDir(filepath.Join(root, DirName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state directory: %w", err)
+	}
+	var stale []string
+	for _, kind := range kinds {
+		if !kind.IsDir() {
+			continue
+		}
+		dir := Dir(root, kind.Name())
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read state directory: %w", err)
+		}
+		for _, e := range entries {
+			if !belongsToTask(e.Name(), tasks) {
+				stale = append(stale, filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	return stale, nil
+}
+
+func belongsToTask(entry string, tasks models.Tasks) bool {
+	for _, t := range tasks {
+		rest, ok := strings.CutPrefix(entry, FileName(t.Name))
+		if ok && (rest == "" || rest[0] == '-' || rest[0] == '.') {
+			return true
+		}
+	}
+	return false
+}
+
+func staleTempFiles(dir string, now time.Time) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read temp directory: %w", err)
+	}
+	var stale []string
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), TempFilePrefix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if now.Sub(info.ModTime()) > tempFileMaxAge {
+			stale = append(stale, filepath.Join(dir, e.Name()))
+		}
+	}
+	return stale, nil
+}
@@ -0,0 +1,120 @@
+package state
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joerdav/xc/models"
+)
+
+func TestBelongsToTask(t *testing.T) {
+	tasks := models.Tasks{{Name: "build"}, {Name: "test"}, {Name: "ci/lint"}}
+	tests := []struct {
+		entry string
+		want  bool
+	}{
+		{entry: "build", want: true},
+		{entry: "build-mem.csv", want: true},
+		{entry: "test.sock", want: true},
+		{entry: "builder", want: false},
+		{entry: "lint", want: false},
+		{entry: "ci_lint-mem.csv", want: true},
+	}
+	for _, tt := range tests {
+		if got := belongsToTask(tt.entry, tasks); got != tt.want {
+			t.Errorf("belongsToTask(%q)=%v, want %v", tt.entry, got, tt.want)
+		}
+	}
+}
+
+func TestStaleEntries(t *testing.T) {
+	root := t.TempDir()
+	for _, p := range []string{"profiles/build-mem.csv", "profiles/old-mem.csv", "artifacts/old/out.txt"} {
+		p = filepath.Join(root, DirName, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := staleEntries(root, models.Tasks{{Name: "build"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(Dir(root, "artifacts"), "old"),
+		filepath.Join(Dir(root, "profiles"), "old-mem.csv"),
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestStaleEntriesWithoutStateDir(t *testing.T) {
+	got, err := staleEntries(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("expected no entries, got %v", got)
+	}
+}
+
+func TestStaleTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	files := map[string]time.Time{
+		"xc_old":    now.Add(-2 * tempFileMaxAge),
+		"xc_recent": now,
+		"other_old": now.Add(-2 * tempFileMaxAge),
+	}
+	for name, mod := range files {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := staleTempFiles(dir, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != filepath.Join(dir, "xc_old") {
+		t.Fatalf("got %v, want [%s]", got, filepath.Join(dir, "xc_old"))
+	}
+}
+
+func TestGCDryRun(t *testing.T) {
+	root := t.TempDir()
+	p := filepath.Join(Dir(root, "profiles"), "old-mem.csv")
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := GC(root, nil, true, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "would remove "+p) {
+		t.Fatalf("expected %q to be listed, got %q", p, out.String())
+	}
+	if _, err := os.Stat(p); err != nil {
+		t.Fatalf("expected dry run to keep %s: %v", p, err)
+	}
+	out.Reset()
+	if err := GC(root, nil, false, &out); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed", p)
+	}
+}